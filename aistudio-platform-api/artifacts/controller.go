@@ -72,7 +72,7 @@ func filesPreview(c *fiber.Ctx) error {
 	filename := c.Query("filename")
 
 	path := "./" + "artifact/ModelRegistry/" + username + "/" + modelname + "-" + version
-	result, err = ReadFiles(path, filename)
+	result, err = ReadFiles(afero.NewOsFs(), path, filename)
 	if err != nil {
 		return helper.SendResponse(c, "Invalid Request", nil, fiber.ErrBadRequest.Code)
 	}
@@ -86,7 +86,7 @@ func labFilePreview(c *fiber.Ctx) error {
 	filename := c.Query("filename")
 
 	path := "./artifact/jl-" + username + "-0"
-	result, err = ReadFiles(path, filename)
+	result, err = ReadFiles(afero.NewOsFs(), path, filename)
 	if err != nil {
 		return helper.SendResponse(c, "Invalid Request", nil, fiber.ErrBadRequest.Code)
 	}
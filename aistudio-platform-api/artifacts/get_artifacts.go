@@ -253,8 +253,7 @@ func CopyModelArtifactsFile(username string, deploymentName string, modelname st
 	return success, nil
 }
 
-func CopyModelArtifactsFiles(username string, deploymentName string, modelname string, version string, models []string) (bool, error) {
-	fs := afero.NewOsFs()
+func CopyModelArtifactsFiles(fs afero.Fs, username string, deploymentName string, modelname string, version string, models []string) (bool, error) {
 	success := false
 	src := "./" + "artifact/ModelRegistry/" + username + "/" + modelname + "-" + version
 	dst := "./" + "artifact/pvc-" + deploymentName + "/"
@@ -392,8 +391,7 @@ func CopyModelFile(username string, modelname string, version string, modelFileN
 	return success, nil
 }
 
-func CloneSelectedArtifacts(src string, dst string, artifactsFilesNames []string) (string, error) {
-	fs := afero.NewOsFs()
+func CloneSelectedArtifacts(fs afero.Fs, src string, dst string, artifactsFilesNames []string) (string, error) {
 	logs.Info("Starting artifact cloning", artifactsFilesNames)
 
 	artifactsFilesMap := make(map[string]bool)
@@ -472,11 +470,11 @@ func CloneSelectedArtifacts(src string, dst string, artifactsFilesNames []string
 	return "Files copied successfully", nil
 }
 
-func ReadFiles(path string, filename string) (string, error) {
+func ReadFiles(fs afero.Fs, path string, filename string) (string, error) {
 
 	fullPath := filepath.Join(path, filename)
 
-	content, err := os.ReadFile(fullPath)
+	content, err := afero.ReadFile(fs, fullPath)
 	if err != nil {
 		return "", fmt.Errorf("failed to read file: %w", err)
 	}
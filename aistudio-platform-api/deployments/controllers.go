@@ -2,59 +2,49 @@ package deployments
 
 import (
 	"Kubernetes-api/helper"
-	"Kubernetes-api/internal/sse"
+	"Kubernetes-api/jobs"
 	utils "Kubernetes-api/kubeutils"
-	"bufio"
-	"fmt"
 	"strconv"
-	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/log"
-
-	"github.com/valyala/fasthttp"
 )
 
-// @Description	Create Jupyter ModelDeployments Environment based on the specific users and project
+// @Description	Create Jupyter ModelDeployments Environment based on the specific users and project. Provisioning runs as a background job; follow it at /api/jobs/{id}
 // @Summary		Create ModelDeployments Environment
 // @Tags		JupyterLabs ModelDeployments
 // @Accept		json
 // @Produce		json
 // @Param 		createModelDeploymentsRequest body CreateModelDeploymentsRequest true "ModelDeployments Body"
+// @Param		cluster query string false "Cluster name"
+// @Param		X-Tenant header string false "Tenant, required when tenancy is enabled"
 // @Router		/api/modeldeplyment [post]
 // @Router		/api/modeldeplyment [post]
-func CreateModelDeployment(c *fiber.Ctx) error {
+func (s *Service) CreateModelDeployment(c *fiber.Ctx) error {
+	svc, err := s.forCluster(c)
+	if err != nil {
+		return err
+	}
 	var req CreateModelDeploymentsRequest
 	if err := c.BodyParser(&req); err != nil {
-		return helper.SendResponse(c, "Invalid Request", nil, fiber.ErrBadRequest.Code)
+		return helper.BadRequest(err)
+	}
+	if err := req.Validate(); err != nil {
+		return err
 	}
 
-	// Create a channel to receive the result and error from the goroutine
-	resultChan := make(chan string)
-	errorChan := make(chan error)
-
-	go func() {
-		url, err := CreateModelDeployments(req.Username, req.DeploymentName, req.Modelname, req.Version, req.Modelartifacts, req.CPURequest, req.GPURequest, req.MemoryRequest, req.CPULimit, req.MemoryLimit, req.DiskStorage, req.NodeSelector)
-		// CreateLLMDeployments
-		// url, err := CreateLLMDeployments(req.Username, req.DeploymentName, req.Modelname, req.Version, req.Template, req.Modelartifacts, req.CPURequest, req.GPURequest, req.MemoryRequest, req.CPULimit, req.MemoryLimit, req.DiskStorage, req.NodeSelector)
-		resultChan <- url
-		errorChan <- err
-	}()
-
-	url := <-resultChan
-	err := <-errorChan
-
+	url, steps, err := svc.CreateModelDeployments(req.Username, req.DeploymentName, req.Modelname, req.Version, req.Modelartifacts, req.CPURequest, req.GPURequest, req.GPUType, req.GPUModel, req.MemoryRequest, req.CPULimit, req.MemoryLimit, req.DiskStorage, req.NodeSelector)
 	if err != nil {
 		log.Info(err)
-		return helper.SendResponse(c, "Invalid Request", nil, fiber.ErrBadRequest.Code)
+		return helper.Wrap(err, err.Error(), fiber.StatusBadRequest)
 	}
-	message := "Model Deployment Created Sucessfully"
-	log.Info(message)
 
-	data := map[string]interface{}{
+	job := svc.jobs.Submit("model-deployment", steps, map[string]interface{}{
 		"inferenceUrl": url,
-	}
-	return helper.SendResponse(c, message, data, fiber.StatusOK)
+		"cluster":      svc.cluster,
+	})
+	log.Info("Model deployment job started: ", job.ID)
+	return jobs.Accepted(c, "Model Deployment Accepted", job)
 }
 
 // @Description	Delete or Stop a specific notebook experiments
@@ -63,10 +53,19 @@ func CreateModelDeployment(c *fiber.Ctx) error {
 // @Accept		json
 // @Param 		id  path string true "Pod Username"
 // @Produce		json
+// @Param		cluster query string false "Cluster name"
+// @Param		X-Tenant header string false "Tenant, required when tenancy is enabled"
 // @Router		/api/modeldeplyment/{id} [delete]
-func DeleteModelDeployment(c *fiber.Ctx) error {
+func (s *Service) DeleteModelDeployment(c *fiber.Ctx) error {
+	svc, err := s.forCluster(c)
+	if err != nil {
+		return err
+	}
 	podUsername := c.Params("id")
-	DeleteModelDeployments(podUsername)
+	if err := svc.DeleteModelDeployments(podUsername); err != nil {
+		log.Error("error deleting model deployment: ", err)
+		return helper.SendResponse(c, "Failed to delete deployment", nil, helper.StatusFor(err, fiber.StatusInternalServerError))
+	}
 	log.Info("Delete request for pod: ", podUsername)
 	return helper.SendResponse(c, "Deployments deleted successfully", nil, fiber.StatusOK)
 }
@@ -75,9 +74,15 @@ func DeleteModelDeployment(c *fiber.Ctx) error {
 // @Summary		Get List of Jupyter ModelDeployments
 // @Tags		JupyterLabs ModelDeployments
 // @Produce		json
+// @Param		cluster query string false "Cluster name"
+// @Param		X-Tenant header string false "Tenant, required when tenancy is enabled"
 // @Router		/api/modeldeplyment [get]
-func GetModelDeployments(c *fiber.Ctx) error {
-	data, err := ListModelDeployments()
+func (s *Service) GetModelDeployments(c *fiber.Ctx) error {
+	svc, err := s.forCluster(c)
+	if err != nil {
+		return err
+	}
+	data, err := svc.ListModelDeployments()
 
 	if err != nil {
 		return helper.SendResponse(c, "Invalid Request", nil, fiber.ErrBadRequest.Code)
@@ -103,10 +108,16 @@ func GetModelDeployments(c *fiber.Ctx) error {
 // @Accept		json
 // @Param 		id  path string true "Pod Username"
 // @Produce		json
+// @Param		cluster query string false "Cluster name"
+// @Param		X-Tenant header string false "Tenant, required when tenancy is enabled"
 // @Router		/api/modeldeplyment/{id} [get]
-func GetOneDeployment(c *fiber.Ctx) error {
+func (s *Service) GetOneDeployment(c *fiber.Ctx) error {
+	svc, err := s.forCluster(c)
+	if err != nil {
+		return err
+	}
 	podUsername := c.Params("id")
-	element, err := getOneDeployment(podUsername)
+	element, err := svc.getOneDeployment(podUsername)
 
 	if err != nil {
 		return helper.SendResponse(c, "Invalid Request", nil, fiber.ErrBadRequest.Code)
@@ -126,51 +137,42 @@ func GetOneDeployment(c *fiber.Ctx) error {
 // @Tags		JupyterLabs ModelDeployments
 // @Accept		json
 // @Produce		text/event-stream
+// @Param		cluster query string false "Cluster name"
+// @Param		X-Tenant header string false "Tenant, required when tenancy is enabled"
 // @Router		/api/modeldeplyment/sse [get]
-func GetModelsSse(c *fiber.Ctx) error {
-	timeGap := time.Duration(5) * time.Second
-	c.Set("Content-Type", "text/event-stream")
-	c.Set("Cache-Control", "no-cache")
-	c.Set("Connection", "keep-alive")
-	c.Set("Transfer-Encoding", "chunked")
-
-	c.Context().SetBodyStreamWriter(fasthttp.StreamWriter(func(wr *bufio.Writer) {
-		fmt.Println("WRITER MODEL")
-		em := sse.NewBufioEmitter(wr, "model deployments")
-		for {
-			data, errs := ListModelDeployments()
-			if errs != nil {
-				log.Error("Error finding the list of model deployments")
-				continue
-			}
-
-			sendJsonFlowErr := em.SendJSON("", "message", data)
-			if sendJsonFlowErr.Err != nil {
-				if sendJsonFlowErr.Next {
-					continue
-				} else {
-					break
-				}
-			}
-
-			time.Sleep(timeGap)
-		}
-	}))
+func (s *Service) GetModelsSse(c *fiber.Ctx) error {
+	svc, err := s.forCluster(c)
+	if err != nil {
+		return err
+	}
+	topic := svc.topic(modelTopic, svc.produceModelEvents)
+	if err := s.broker.Start(topic); err != nil {
+		log.Error("Error starting model deployment stream: ", err)
+		return helper.SendResponse(c, "Model stream is unavailable", nil, fiber.StatusServiceUnavailable)
+	}
 
+	s.broker.Serve(c, topic)
 	return nil
 }
 
-func GetPodDescription(c *fiber.Ctx) error {
-
+func (s *Service) GetPodDescription(c *fiber.Ctx) error {
+	svc, err := s.forCluster(c)
+	if err != nil {
+		return err
+	}
 	podName := c.Query("deploymentName")
-	data, err := getPodDescription(podName)
+	data, err := svc.getPodDescription(podName)
 	if err != nil {
 		return helper.SendResponse(c, "Invalid Request", nil, fiber.ErrBadRequest.Code)
 	}
 	return c.Status(200).JSON(data)
 }
 
-func GetModelDeploymentLogs(c *fiber.Ctx) error {
+func (s *Service) GetModelDeploymentLogs(c *fiber.Ctx) error {
+	svc, err := s.forCluster(c)
+	if err != nil {
+		return err
+	}
 	deploymentName := c.Query("deploymentName")
 
 	if deploymentName == "" {
@@ -178,24 +180,48 @@ func GetModelDeploymentLogs(c *fiber.Ctx) error {
 	}
 	ctx := c.Context()
 	opts := utils.NewLogsOptions()
-	opts.Namespace = modelNamespace
+	opts.Namespace = svc.namespace
 	opts.PodName = deploymentName
 
 	c.Set("Content-Type", "text/plain; charset=utf-8")
 
-	err := kc.GetDeploymentLog(deploymentName, opts.Namespace, ctx, opts, c.Response().BodyWriter())
+	err = svc.kc.GetDeploymentLog(deploymentName, opts.Namespace, ctx, opts, c.Response().BodyWriter())
 	if err != nil {
 		return helper.SendResponse(c, err.Error(), nil, 500)
 	}
 	return nil
 }
 
-func GetModelMetrics(c *fiber.Ctx) error {
-
-	podMetrics, err := getModelMetrics()
+func (s *Service) GetModelMetrics(c *fiber.Ctx) error {
+	svc, err := s.forCluster(c)
+	if err != nil {
+		return err
+	}
+	podMetrics, err := svc.getModelMetrics()
 	if err != nil {
 		log.Errorf("Error getting pod metrics: %v", err)
 		return helper.SendResponse(c, "Error fetching model metrics", nil, 500)
 	}
 	return helper.SendResponse(c, "Model metrics fetched successfully", podMetrics, 200)
 }
+
+// forCluster returns the service bound to the cluster the request names in
+// its cluster query parameter, or to the default cluster, and scoped to the
+// tenant in its TenantHeader.
+func (s *Service) forCluster(c *fiber.Ctx) (*Service, error) {
+	cluster, err := s.clusters.Get(c.Query(helper.ClusterParam))
+	if err != nil {
+		return nil, err
+	}
+	tenant := c.Get(helper.TenantHeader)
+	namespace, err := cluster.Kube.TenantNamespace(tenant, modelNamespace)
+	if err != nil {
+		return nil, err
+	}
+	svc := *s
+	svc.kc = cluster.Kube
+	svc.cluster = cluster.Name
+	svc.namespace = namespace
+	svc.tenant = tenant
+	return &svc, nil
+}
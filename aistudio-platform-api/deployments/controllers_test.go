@@ -0,0 +1,323 @@
+package deployments_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	model "Kubernetes-api/deployments"
+	"Kubernetes-api/helper"
+	"Kubernetes-api/internal/kubetest"
+	"Kubernetes-api/jobs"
+	"Kubernetes-api/kubeutils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/spf13/afero"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const modelNamespace = "model"
+
+func newModelApp(h *kubetest.Harness) *fiber.App {
+	return h.App(func(api fiber.Router) {
+		model.SetupRoutes(api, model.NewService(h.Clusters, h.Fs, h.Broker, h.Jobs))
+	})
+}
+
+func modelRequest() model.CreateModelDeploymentsRequest {
+	return model.CreateModelDeploymentsRequest{
+		Username:       "alice",
+		DeploymentName: "iris",
+		Modelname:      "iris",
+		Version:        "1.0",
+		Modelartifacts: []string{"model.pkl"},
+		CPURequest:     "1",
+		GPURequest:     "0",
+		MemoryRequest:  "1Gi",
+		CPULimit:       "2",
+		MemoryLimit:    "2Gi",
+		DiskStorage:    "5Gi",
+		NodeSelector:   "cpu",
+	}
+}
+
+func TestCreateModelDeployment(t *testing.T) {
+	h := kubetest.New(kubetest.Node("node-a", "8", "32Gi", ""))
+	h.WriteFile(t, "artifact/ModelRegistry/alice/iris-1-0/model.pkl", "weights")
+	h.WriteFile(t, "artifact/ModelRegistry/alice/iris-1-0/notes.txt", "not selected")
+	app := newModelApp(h)
+
+	status, resp := kubetest.Do(t, app, fiber.MethodPost, "/api/modeldeployment", modelRequest())
+	if status != fiber.StatusAccepted {
+		t.Fatalf("create returned %d %+v", status, resp)
+	}
+	job := h.WaitJob(t, resp)
+	if job.Status != jobs.StatusSucceeded {
+		t.Fatalf("job = %+v, want succeeded", job)
+	}
+	if result, _ := job.Result.(map[string]any); result["inferenceUrl"] != "http://iris.model" {
+		t.Errorf("inferenceUrl = %v", job.Result)
+	}
+
+	ctx := context.TODO()
+	dep, err := h.Clientset.AppsV1().Deployments(modelNamespace).Get(ctx, "iris", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("deployment not created: %v", err)
+	}
+	if sel := dep.Spec.Template.Spec.NodeSelector["type"]; sel != "cpu" {
+		t.Errorf("node selector = %q, want cpu", sel)
+	}
+	if _, err := h.Clientset.CoreV1().Services(modelNamespace).Get(ctx, "iris", metav1.GetOptions{}); err != nil {
+		t.Errorf("service not created: %v", err)
+	}
+	if _, err := h.Clientset.CoreV1().PersistentVolumeClaims(modelNamespace).Get(ctx, "pvc-iris", metav1.GetOptions{}); err != nil {
+		t.Errorf("pvc not created: %v", err)
+	}
+
+	if ok, _ := afero.Exists(h.Fs, "artifact/pvc-iris/iris1-0/model.pkl"); !ok {
+		t.Error("selected artifact was not copied into the deployment volume")
+	}
+	if ok, _ := afero.Exists(h.Fs, "artifact/pvc-iris/iris1-0/notes.txt"); ok {
+		t.Error("unselected artifact was copied")
+	}
+}
+
+func TestCreateModelDeploymentWithoutArtifacts(t *testing.T) {
+	h := kubetest.New(kubetest.Node("node-a", "8", "32Gi", ""))
+	app := newModelApp(h)
+
+	status, resp := kubetest.Do(t, app, fiber.MethodPost, "/api/modeldeployment", modelRequest())
+	if status != fiber.StatusAccepted {
+		t.Fatalf("status = %d, want 202", status)
+	}
+	if job := h.WaitJob(t, resp); job.Status != jobs.StatusFailed || failedStep(job) != jobs.StepCopy {
+		t.Fatalf("job = %+v, want a failure at the copy step", job)
+	}
+	if _, err := h.Clientset.AppsV1().Deployments(modelNamespace).Get(context.TODO(), "iris", metav1.GetOptions{}); err == nil {
+		t.Fatal("deployment created without artifacts")
+	}
+}
+
+func TestCreateModelDeploymentUndoesEarlierSteps(t *testing.T) {
+	h := kubetest.New(kubetest.Node("node-a", "8", "32Gi", ""))
+	h.WriteFile(t, "artifact/ModelRegistry/alice/iris-1-0/model.pkl", "weights")
+	h.Clientset.PrependReactor("create", "deployments", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("admission webhook denied the request")
+	})
+	app := newModelApp(h)
+
+	status, resp := kubetest.Do(t, app, fiber.MethodPost, "/api/modeldeployment", modelRequest())
+	if status != fiber.StatusAccepted {
+		t.Fatalf("status = %d, want 202", status)
+	}
+	if job := h.WaitJob(t, resp); job.Status != jobs.StatusFailed || failedStep(job) != jobs.StepDeployment {
+		t.Fatalf("job = %+v, want a failure at the deployment step", job)
+	}
+	ctx := context.TODO()
+	if _, err := h.Clientset.CoreV1().Services(modelNamespace).Get(ctx, "iris", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("service left behind after the deployment failed, err=%v", err)
+	}
+	if _, err := h.Clientset.CoreV1().PersistentVolumeClaims(modelNamespace).Get(ctx, "pvc-iris", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("pvc left behind after the deployment failed, err=%v", err)
+	}
+}
+
+func TestCreateModelDeploymentKeepsExistingVolumeOnFailure(t *testing.T) {
+	h := kubetest.New(
+		kubetest.Node("node-a", "8", "32Gi", ""),
+		kubetest.Claim(modelNamespace, "pvc-iris", "", "5Gi"),
+	)
+	h.WriteFile(t, "artifact/ModelRegistry/alice/iris-1-0/model.pkl", "weights")
+	h.Clientset.PrependReactor("create", "deployments", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("admission webhook denied the request")
+	})
+	app := newModelApp(h)
+
+	_, resp := kubetest.Do(t, app, fiber.MethodPost, "/api/modeldeployment", modelRequest())
+	if job := h.WaitJob(t, resp); job.Status != jobs.StatusFailed || failedStep(job) != jobs.StepDeployment {
+		t.Fatalf("job = %+v, want a failure at the deployment step", job)
+	}
+	if _, err := h.Clientset.CoreV1().PersistentVolumeClaims(modelNamespace).Get(context.TODO(), "pvc-iris", metav1.GetOptions{}); err != nil {
+		t.Errorf("pvc of the previous deployment was removed: %v", err)
+	}
+}
+
+func TestRedeployModelOverExistingVolume(t *testing.T) {
+	h := kubetest.New(
+		kubetest.Node("node-a", "8", "32Gi", ""),
+		kubetest.Claim(modelNamespace, "pvc-iris", "", "5Gi"),
+	)
+	h.WriteFile(t, "artifact/ModelRegistry/alice/iris-1-0/model.pkl", "weights")
+	app := newModelApp(h)
+
+	_, resp := kubetest.Do(t, app, fiber.MethodPost, "/api/modeldeployment", modelRequest())
+	if job := h.WaitJob(t, resp); job.Status != jobs.StatusSucceeded {
+		t.Fatalf("job = %+v, want succeeded", job)
+	}
+	if _, err := h.Clientset.AppsV1().Deployments(modelNamespace).Get(context.TODO(), "iris", metav1.GetOptions{}); err != nil {
+		t.Errorf("deployment not created over the existing volume: %v", err)
+	}
+}
+
+func TestCreateModelDeploymentWithoutGPU(t *testing.T) {
+	h := kubetest.New(kubetest.Node("node-a", "8", "32Gi", ""))
+	h.WriteFile(t, "artifact/ModelRegistry/alice/iris-1-0/model.pkl", "weights")
+	app := newModelApp(h)
+
+	req := modelRequest()
+	req.GPURequest = "1"
+	status, resp := kubetest.Do(t, app, fiber.MethodPost, "/api/modeldeployment", req)
+	if status != fiber.StatusAccepted {
+		t.Fatalf("status = %d, want 202", status)
+	}
+	job := h.WaitJob(t, resp)
+	if job.Status != jobs.StatusFailed || failedStep(job) != jobs.StepResourceCheck {
+		t.Fatalf("job = %+v, want a failure at the resource check", job)
+	}
+	for _, step := range job.Steps[1:] {
+		if step.Status != jobs.StatusSkipped {
+			t.Errorf("step %s is %s after the resource check failed, want skipped", step.Name, step.Status)
+		}
+	}
+}
+
+func failedStep(job jobs.Job) string {
+	for _, step := range job.Steps {
+		if step.Status == jobs.StatusFailed {
+			return step.Name
+		}
+	}
+	return ""
+}
+
+func TestListModelDeployments(t *testing.T) {
+	h := kubetest.New(kubetest.Pod(modelNamespace, "iris-5d8f", "iris", "node-a", "1", "1Gi"))
+	app := newModelApp(h)
+
+	status, resp := kubetest.Do(t, app, fiber.MethodGet, "/api/modeldeployment", nil)
+	if status != fiber.StatusOK {
+		t.Fatalf("list returned %d", status)
+	}
+	list, _ := resp.Data.([]any)
+	if len(list) != 1 || list[0].(map[string]any)["name"] != "iris-5d8f" {
+		t.Fatalf("list data = %#v", resp.Data)
+	}
+}
+
+func TestDeleteMissingModelDeployment(t *testing.T) {
+	h := kubetest.New()
+	app := newModelApp(h)
+
+	if status, resp := kubetest.Do(t, app, fiber.MethodDelete, "/api/modeldeployment/iris", nil); status != fiber.StatusNotFound {
+		t.Fatalf("delete returned %d %+v, want 404", status, resp)
+	}
+}
+
+func TestDeletePartlyRemovedModelDeployment(t *testing.T) {
+	h := kubetest.New(kubetest.Claim(modelNamespace, "pvc-iris", "", "5Gi"))
+	app := newModelApp(h)
+
+	if status, resp := kubetest.Do(t, app, fiber.MethodDelete, "/api/modeldeployment/iris", nil); status != fiber.StatusOK {
+		t.Fatalf("delete returned %d %+v, want 200", status, resp)
+	}
+	if _, err := h.Clientset.CoreV1().PersistentVolumeClaims(modelNamespace).Get(context.TODO(), "pvc-iris", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("pvc left behind, err=%v", err)
+	}
+}
+
+func TestModelStreamFollowsCallersCluster(t *testing.T) {
+	cpu := kubetest.New(kubetest.Deployment(modelNamespace, "iris"))
+	gpu := kubetest.New(kubetest.Deployment(modelNamespace, "llama"))
+	for _, h := range []*kubetest.Harness{cpu, gpu} {
+		h.StartCache(t)
+	}
+	clusters, err := kubeutils.NewClusters(
+		kubeutils.Cluster{Name: "cpu", Kube: cpu.Kube},
+		kubeutils.Cluster{Name: "gpu", Kube: gpu.Kube},
+	)
+	if err != nil {
+		t.Fatalf("NewClusters: %v", err)
+	}
+	t.Cleanup(cpu.Broker.Close)
+	app := cpu.App(func(api fiber.Router) {
+		model.SetupRoutes(api, model.NewService(clusters, cpu.Fs, cpu.Broker, cpu.Jobs))
+	})
+
+	if got := kubetest.FirstEvent(t, app, "/api/modeldeployment/sse?cluster=gpu", nil); got != "llama" {
+		t.Errorf("stream on gpu reported %s, want llama", got)
+	}
+	if got := kubetest.FirstEvent(t, app, "/api/modeldeployment/sse", nil); got != "iris" {
+		t.Errorf("stream on the default cluster reported %s, want iris", got)
+	}
+	if status, resp := kubetest.Do(t, app, fiber.MethodGet, "/api/modeldeployment/sse?cluster=tpu", nil); status != fiber.StatusNotFound {
+		t.Errorf("stream on an unknown cluster returned %d %+v, want 404", status, resp)
+	}
+}
+
+func TestModelStreamFollowsCallersTenant(t *testing.T) {
+	h := kubetest.New(
+		kubetest.Deployment("tenant-vision", "resnet"),
+		kubetest.Deployment("tenant-speech", "whisper"),
+	)
+	h.Kube.Tenancy = &kubeutils.Tenancy{}
+	h.StartCache(t)
+	t.Cleanup(h.Broker.Close)
+	app := newModelApp(h)
+
+	for tenant, want := range map[string]string{"vision": "resnet", "speech": "whisper"} {
+		headers := map[string]string{helper.TenantHeader: tenant}
+		if got := kubetest.FirstEvent(t, app, "/api/modeldeployment/sse", headers); got != want {
+			t.Errorf("%s's stream reported %s, want %s", tenant, got, want)
+		}
+	}
+	want := map[string]bool{"models/default/tenant-vision": true, "models/default/tenant-speech": true}
+	for _, stats := range h.Broker.Stats() {
+		if !want[stats.Topic] {
+			t.Errorf("unexpected sse topic %s", stats.Topic)
+		}
+		delete(want, stats.Topic)
+	}
+	if len(want) != 0 {
+		t.Errorf("sse topics %v were not started", want)
+	}
+}
+
+func TestCreateModelDeploymentsInARowShareTheQuota(t *testing.T) {
+	h := kubetest.New(kubetest.Node("node-a", "8", "32Gi", ""))
+	one := int64(1)
+	h.Clusters.Quotas = &kubeutils.QuotaPolicy{Defaults: kubeutils.QuotaDefaults{User: kubeutils.QuotaLimits{Deployments: &one}}}
+	h.WriteFile(t, "artifact/ModelRegistry/alice/iris-1-0/model.pkl", "weights")
+	// Hold the first deployment's job before its deployment exists.
+	unblock := make(chan struct{})
+	h.Clientset.PrependReactor("create", "deployments", func(k8stesting.Action) (bool, runtime.Object, error) {
+		<-unblock
+		return false, nil, nil
+	})
+	app := newModelApp(h)
+
+	status, first := kubetest.Do(t, app, fiber.MethodPost, "/api/modeldeployment", modelRequest())
+	if status != fiber.StatusAccepted {
+		close(unblock)
+		t.Fatalf("first create returned %d %+v", status, first)
+	}
+	second := modelRequest()
+	second.DeploymentName = "resnet"
+	status, resp := kubetest.Do(t, app, fiber.MethodPost, "/api/modeldeployment", second)
+	close(unblock)
+	if status != fiber.StatusForbidden || resp.Error == nil || resp.Error.Code != helper.CodeQuotaExceeded {
+		t.Errorf("second create while the first is running returned %d %+v, want 403 quota_exceeded", status, resp)
+	}
+	if job := h.WaitJob(t, first); job.Status != jobs.StatusSucceeded {
+		t.Fatalf("first job = %+v, want succeeded", job)
+	}
+
+	// The finished deployment counts from the cluster now; replacing it is
+	// still allowed.
+	_, resp = kubetest.Do(t, app, fiber.MethodPost, "/api/modeldeployment", modelRequest())
+	if job := h.WaitJob(t, resp); job.Status != jobs.StatusSucceeded {
+		t.Errorf("redeploy after the first finished = %+v, want succeeded", job)
+	}
+}
@@ -3,42 +3,28 @@ package deployments
 import (
 	"Kubernetes-api/artifacts"
 	"Kubernetes-api/helper"
+	"Kubernetes-api/jobs"
+	"context"
 	"errors"
 	"fmt"
-	"strconv"
 	"strings"
-	"time"
 
 	utils "Kubernetes-api/kubeutils"
 
-	"github.com/gofiber/fiber/v2/log"
 	apiv1 "k8s.io/api/core/v1"
 )
 
-func CreateModelDeployments(userName string, deploymentName string, Modelname string, Version string, Modelartifacts []string, cpuRequest string, gpuRequest string, memoryRequest string, cpuLimit string, memoryLimit string, diskStorage string, noddeSelector string) (string, error) {
+// CreateModelDeployments validates the request and returns the inference URL
+// the deployment will serve on together with the steps that provision it.
+func (s *Service) CreateModelDeployments(userName string, deploymentName string, Modelname string, Version string, Modelartifacts []string, cpuRequest string, gpuRequest string, gpuType string, gpuModel string, memoryRequest string, cpuLimit string, memoryLimit string, diskStorage string, noddeSelector string) (string, []jobs.Step, error) {
 
 	modelPort := 9000
 	// Image := "9861531522/global-deployment:v0.3" 
 	Image := "9861531522/custom-script-deployment:v1.1"
 	// Image := "9861531522/custom-deployment-python3.8:v0.1" // This the container with python version 3.7
-	gpuSize, err := strconv.Atoi(gpuRequest)
+	gpu, err := utils.ParseGPU(gpuRequest, gpuType, gpuModel)
 	if err != nil {
-		log.Error(err.Error(), " Gpu value souldnot be in decimal")
-		return "Gpu value souldnot be in decimal", err
-	}
-	cpuAvailable, err := kc.CheckCpuAvailability(cpuRequest)
-	if !cpuAvailable {
-		return "requested cpu is not available in any node", err
-	}
-	if int32(gpuSize) > 0 {
-		gpuAvailable, err := kc.CheckGpuAvailability(gpuRequest)
-		if !gpuAvailable {
-			return "requested gpu is not available in any node", err
-		}
-	}
-	memoryAvailable, err := kc.CheckMemoryAvailability(memoryRequest)
-	if !memoryAvailable {
-		return "Requested memory is not available in any node", err
+		return "", nil, err
 	}
 	deploymentName = strings.Replace(deploymentName, ".", "-", -1)
 	Version = strings.Replace(Version, ".", "-", -1)
@@ -54,59 +40,47 @@ func CreateModelDeployments(userName string, deploymentName string, Modelname st
 	},
 	}
 
-	serviceName := deploymentName
 	pvcName := fmt.Sprintf("pvc-%s", deploymentName)
-	kc.CreateNamespace(modelNamespace)
-	resource := utils.ConfigResource(cpuRequest, memoryRequest, cpuLimit, memoryLimit)
-	if !kc.PersistentVolumeExists(modelNamespace, pvcName) {
-		kc.CreatePersistentVolume(modelNamespace, pvcName, diskStorage)
-		fmt.Println("Persistent volume of name is created", pvcName)
-	}
-	// resultCopy, errCopy := artifacts.CopyModelFile(userName, Modelname, Version, Modelartifacts)
-	resultCopy, errCopy := artifacts.CopyModelArtifactsFiles(userName, deploymentName, Modelname, Version, Modelartifacts)
-	if errCopy != nil {
-		return "copy Artifacts fails", errCopy
-	}
-	if resultCopy {
-		if kc.ModelDeploymentExists(modelNamespace, deploymentName) {
-			kc.DeleteDeployment(modelNamespace, deploymentName)
-			time.Sleep(2 * time.Second)
-		}
-		for kc.ModelDeploymentExists(modelNamespace, deploymentName) {
-			time.Sleep(1 * time.Second)
-		}
-		if !kc.ServiceExists(modelNamespace, serviceName) {
-			kc.CreateService(modelNamespace, serviceName, deploymentName, modelPort, apiv1.ServiceTypeClusterIP)
-		}
-		kc.ConfigModelDeployment(modelNamespace, deploymentName, Image, pvcName, gpuSize, modelPort, noddeSelector, resource, envVars)
-		url := "http://" + deploymentName + "." + modelNamespace
-		return url, nil
+	resource, err := utils.ConfigResource(cpuRequest, memoryRequest, cpuLimit, memoryLimit)
+	if err != nil {
+		return "", nil, err
+	}
+	owner := s.owner(userName, utils.WorkloadModel)
+	release, err := s.reserveQuota(owner, resource, gpu, diskStorage, deploymentName, pvcName)
+	if err != nil {
+		return "", nil, err
+	}
+	steps := []jobs.Step{
+		{Name: jobs.StepResourceCheck, Run: func(ctx context.Context) error {
+			return s.checkResources(resource, gpu, noddeSelector)
+		}},
+		s.volumeStep(pvcName, diskStorage, owner),
+		{Name: jobs.StepCopy, Run: func(ctx context.Context) error {
+			// resultCopy, errCopy := artifacts.CopyModelFile(userName, Modelname, Version, Modelartifacts)
+			resultCopy, errCopy := artifacts.CopyModelArtifactsFiles(s.fs, userName, deploymentName, Modelname, Version, Modelartifacts)
+			if errCopy != nil {
+				return fmt.Errorf("copy artifacts fails: %w", errCopy)
+			}
+			if !resultCopy {
+				return errors.New("failed to copy model file")
+			}
+			return nil
+		}},
 	}
-	return "", errors.New("failed to copy model file")
+	steps = append(steps, s.serveModelSteps(deploymentName, Image, pvcName, gpu, modelPort, noddeSelector, resource, envVars, owner)...)
+
+	url := "http://" + deploymentName + "." + s.namespace
+	return url, jobs.Finally(steps, release), nil
 }
 
-func CreateLLMDeployments(userName string, deploymentName string, Modelname string, Version string, template string, Modelartifacts []string, cpuRequest string, gpuRequest string, memoryRequest string, cpuLimit string, memoryLimit string, diskStorage string, noddeSelector string) (string, error) {
+// CreateLLMDeployments is CreateModelDeployments for the LLM serving image.
+func (s *Service) CreateLLMDeployments(userName string, deploymentName string, Modelname string, Version string, template string, Modelartifacts []string, cpuRequest string, gpuRequest string, gpuType string, gpuModel string, memoryRequest string, cpuLimit string, memoryLimit string, diskStorage string, noddeSelector string) (string, []jobs.Step, error) {
 
 	modelPort := 8000
 	Image := helper.LllmDeploymentImage
-	gpuSize, err := strconv.Atoi(gpuRequest)
+	gpu, err := utils.ParseGPU(gpuRequest, gpuType, gpuModel)
 	if err != nil {
-		log.Error(err.Error(), " Gpu value souldnot be in decimal")
-		return "Gpu value souldnot be in decimal", err
-	}
-	cpuAvailable, err := kc.CheckCpuAvailability(cpuRequest)
-	if !cpuAvailable {
-		return "requested cpu is not available in any node", err
-	}
-	if int32(gpuSize) > 0 {
-		gpuAvailable, err := kc.CheckGpuAvailability(gpuRequest)
-		if !gpuAvailable {
-			return "requested gpu is not available in any node", err
-		}
-	}
-	memoryAvailable, err := kc.CheckMemoryAvailability(memoryRequest)
-	if !memoryAvailable {
-		return "Requested memory is not available in any node", err
+		return "", nil, err
 	}
 	deploymentName = strings.Replace(deploymentName, ".", "-", -1)
 	Version = strings.Replace(Version, ".", "-", -1)
@@ -122,64 +96,194 @@ func CreateLLMDeployments(userName string, deploymentName string, Modelname stri
 	},
 	}
 
-	serviceName := deploymentName
 	pvcName := fmt.Sprintf("pvc-%s", deploymentName)
-	kc.CreateNamespace(modelNamespace)
-	resource := utils.ConfigResource(cpuRequest, memoryRequest, cpuLimit, memoryLimit)
-	if !kc.PersistentVolumeExists(modelNamespace, pvcName) {
-		kc.CreatePersistentVolume(modelNamespace, pvcName, diskStorage)
-		fmt.Println("Persistent volume of name is created", pvcName)
-	}
-	// resultCopy, errCopy := artifacts.CopyModelFile(userName, Modelname, Version, Modelartifacts)
-	resultCopy, errCopy :=  artifacts.CopyModelArtifactsFiles(userName, deploymentName, Modelname, Version, Modelartifacts)
-	if errCopy != nil {
-		return "copy Artifacts fails", errCopy
-	}
-	if resultCopy {
-		if kc.ModelDeploymentExists(modelNamespace, deploymentName) {
-			kc.DeleteDeployment(modelNamespace, deploymentName)
-			time.Sleep(2 * time.Second)
-		}
-		for kc.ModelDeploymentExists(modelNamespace, deploymentName) {
-			time.Sleep(1 * time.Second)
-		}
-		if !kc.ServiceExists(modelNamespace, serviceName) {
-			kc.CreateService(modelNamespace, serviceName, deploymentName, modelPort, apiv1.ServiceTypeClusterIP)
-		}
-		kc.ConfigModelDeployment(modelNamespace, deploymentName, Image, pvcName, gpuSize, modelPort, noddeSelector, resource, envVars)
-		url := "http://" + deploymentName + "." + modelNamespace 
-		return url , nil
+	resource, err := utils.ConfigResource(cpuRequest, memoryRequest, cpuLimit, memoryLimit)
+	if err != nil {
+		return "", nil, err
+	}
+	owner := s.owner(userName, utils.WorkloadLLM)
+	release, err := s.reserveQuota(owner, resource, gpu, diskStorage, deploymentName, pvcName)
+	if err != nil {
+		return "", nil, err
 	}
-	return "", errors.New("failed to copy model file")
+	steps := []jobs.Step{
+		{Name: jobs.StepResourceCheck, Run: func(ctx context.Context) error {
+			return s.checkResources(resource, gpu, noddeSelector)
+		}},
+		s.volumeStep(pvcName, diskStorage, owner),
+		{Name: jobs.StepCopy, Run: func(ctx context.Context) error {
+			resultCopy, errCopy := artifacts.CopyModelArtifactsFiles(s.fs, userName, deploymentName, Modelname, Version, Modelartifacts)
+			if errCopy != nil {
+				return fmt.Errorf("copy artifacts fails: %w", errCopy)
+			}
+			if !resultCopy {
+				return errors.New("failed to copy model file")
+			}
+			return nil
+		}},
+	}
+	steps = append(steps, s.serveModelSteps(deploymentName, Image, pvcName, gpu, modelPort, noddeSelector, resource, envVars, owner)...)
+
+	url := "http://" + deploymentName + "." + s.namespace
+	return url, jobs.Finally(steps, release), nil
+}
+
+// checkResources fails unless one node can hold the model's pod.
+func (s *Service) checkResources(resource apiv1.ResourceRequirements, gpu utils.GPURequest, nodeSelector string) error {
+	result, err := s.kc.CanSchedule(utils.ScheduleRequest{
+		Resources:    resource,
+		GPU:          gpu,
+		NodeSelector: s.kc.WorkloadNodeSelector(nodeSelector),
+	})
+	if err != nil {
+		return err
+	}
+	return result.Err()
+}
+
+// owner is who a deployment of userName created by the service belongs to.
+func (s *Service) owner(userName, workload string) utils.Owner {
+	return utils.Owner{User: userName, Team: s.tenant, Workload: workload}
+}
+
+// reserveQuota fails when the deployment would take its owner over a
+// quota, and otherwise holds its usage until release is called. A
+// deployment of the same name and its volume are replaced rather than added
+// to, so they are left out of the current usage.
+func (s *Service) reserveQuota(owner utils.Owner, resource apiv1.ResourceRequirements, gpu utils.GPURequest, diskStorage, deploymentName, pvcName string) (release func(), err error) {
+	disk, err := utils.ParseQuantity("diskStorage", diskStorage)
+	if err != nil {
+		return nil, err
+	}
+	usage := utils.WorkloadUsage(resource, gpu, 1)
+	usage.DiskBytes = disk.Value()
+	usage.Deployments = 1
+	return s.clusters.ReserveQuota(utils.QuotaRequest{
+		Owner: owner,
+		Add:   usage,
+		Replaces: []utils.WorkloadRef{
+			{Cluster: s.cluster, Namespace: s.namespace, Name: deploymentName},
+			{Cluster: s.cluster, Namespace: s.namespace, Name: pvcName},
+		},
+	})
 }
 
-func DeleteModelDeployments(deploymentName string) error {
+// volumeStep creates the deployment's volume claim unless it already
+// exists. Undo only removes a claim the step created, so a failed redeploy
+// leaves the volume of the previous deployment in place.
+func (s *Service) volumeStep(pvcName, diskStorage string, owner utils.Owner) jobs.Step {
+	created := false
+	return jobs.Step{
+		Name: jobs.StepPVC,
+		Run: func(ctx context.Context) error {
+			if err := s.kc.EnsureNamespace(s.namespace, s.tenant); err != nil {
+				return err
+			}
+			exists, err := s.kc.ClaimExists(s.namespace, pvcName)
+			if err != nil || exists {
+				return err
+			}
+			if err := s.kc.CreatePersistentVolume(s.namespace, pvcName, diskStorage, owner); err != nil {
+				return err
+			}
+			created = true
+			return nil
+		},
+		Undo: func(ctx context.Context) error {
+			if !created {
+				return nil
+			}
+			return s.kc.DeletePersistentVolume(s.namespace, pvcName)
+		},
+	}
+}
 
+// serveModelSteps exposes the model through a service and replaces any
+// previous deployment of the same name. As with the volume, undoing them
+// only removes a service they created.
+func (s *Service) serveModelSteps(deploymentName, image, pvcName string, gpu utils.GPURequest, modelPort int, nodeSelector string, resource apiv1.ResourceRequirements, envVars []apiv1.EnvVar, owner utils.Owner) []jobs.Step {
 	serviceName := deploymentName
-	pvcName := fmt.Sprintf("pvc-%s", deploymentName)
-	kc.DeleteDeployment(modelNamespace, deploymentName)
-	kc.DeleteService(modelNamespace, serviceName)
-	kc.DeletePersistentVolume(modelNamespace, pvcName)
+	serviceCreated := false
+	return []jobs.Step{
+		{
+			Name: jobs.StepService,
+			Run: func(ctx context.Context) error {
+				if s.kc.ServiceExists(s.namespace, serviceName) {
+					return nil
+				}
+				if err := s.kc.CreateService(s.namespace, serviceName, deploymentName, modelPort, apiv1.ServiceTypeClusterIP); err != nil {
+					return err
+				}
+				serviceCreated = true
+				return nil
+			},
+			Undo: func(ctx context.Context) error {
+				if !serviceCreated {
+					return nil
+				}
+				return s.kc.DeleteService(s.namespace, serviceName)
+			},
+		},
+		{
+			Name: jobs.StepDeployment,
+			Run: func(ctx context.Context) error {
+				if err := s.kc.DeleteDeploymentAndWait(ctx, s.namespace, deploymentName); err != nil {
+					return err
+				}
+				return s.kc.ConfigModelDeployment(s.namespace, deploymentName, image, pvcName, gpu, modelPort, nodeSelector, resource, envVars, owner)
+			},
+			Undo: func(ctx context.Context) error {
+				return s.kc.DeleteDeployment(s.namespace, deploymentName)
+			},
+		},
+	}
+}
+
+// DeleteModelDeployments removes the deployment with its service and volume
+// claim. Parts that are already gone are skipped, so a deployment left half
+// created or half deleted can still be cleaned up; it fails with
+// ErrNotFound only when none of them exist.
+func (s *Service) DeleteModelDeployments(deploymentName string) error {
 
-	return nil
+	serviceName := deploymentName
+	pvcName := fmt.Sprintf("pvc-%s", deploymentName)
+	results := []error{
+		s.kc.DeleteDeployment(s.namespace, deploymentName),
+		s.kc.DeleteService(s.namespace, serviceName),
+		s.kc.DeletePersistentVolume(s.namespace, pvcName),
+	}
+	var errs []error
+	missing := 0
+	for _, err := range results {
+		switch {
+		case errors.Is(err, utils.ErrNotFound):
+			missing++
+		case err != nil:
+			errs = append(errs, err)
+		}
+	}
+	if missing == len(results) {
+		return &utils.Error{Op: "delete", Resource: "model deployment", Name: deploymentName, Kind: utils.ErrNotFound, Err: errors.New("no deployment, service or volume claim exists")}
+	}
+	return errors.Join(errs...)
 }
 
-func ListModelDeployments() ([]map[string]string, error) {
-	data, err := kc.ListPods(modelNamespace)
+func (s *Service) ListModelDeployments() ([]map[string]string, error) {
+	data, err := s.kc.ListPods(s.namespace)
 	if err != nil || len(data) == 0 {
 		return []map[string]string{}, err
 	}
 	return data, nil
 }
 
-func getOneDeployment(pod string) (map[string]string, error) {
-	return kc.GetPodDetail(pod, modelNamespace)
+func (s *Service) getOneDeployment(pod string) (map[string]string, error) {
+	return s.kc.GetPodDetail(pod, s.namespace)
 }
 
-func getPodDescription(pod string) ([]map[string]string, error) {
-	return kc.GetDeploymentPodEvents(pod, modelNamespace)
+func (s *Service) getPodDescription(pod string) ([]map[string]string, error) {
+	return s.kc.GetDeploymentPodEvents(pod, s.namespace)
 }
 
-func getModelMetrics() ([]utils.PodMetrics, error) {
-	return kc.GetPodMetric(modelNamespace)
+func (s *Service) getModelMetrics() ([]utils.PodMetrics, error) {
+	return s.kc.GetPodMetric(s.namespace)
 }
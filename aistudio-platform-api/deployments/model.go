@@ -1,7 +1,15 @@
 package deployments
 
 import (
+	"context"
+	"strings"
+
+	"Kubernetes-api/helper"
+	"Kubernetes-api/internal/sse"
+	"Kubernetes-api/jobs"
 	utils "Kubernetes-api/kubeutils"
+
+	"github.com/spf13/afero"
 )
 
 type Model struct {
@@ -20,6 +28,8 @@ type CreateModelDeploymentsRequest struct {
 	Modelartifacts []string `json:"modelartifacts"`
 	CPURequest     string   `json:"cpuRequest"`
 	GPURequest     string   `json:"gpuRequest"`
+	GPUType        string   `json:"gpuType,omitempty"`
+	GPUModel       string   `json:"gpuModel,omitempty"`
 	MemoryRequest  string   `json:"memoryRequest"`
 	CPULimit       string   `json:"cpuLimit"`
 	MemoryLimit    string   `json:"memoryLimit"`
@@ -27,6 +37,28 @@ type CreateModelDeploymentsRequest struct {
 	NodeSelector   string   `json:"nodeSelector"`
 }
 
+// Validate checks the request before anything is created in the cluster.
+// Dots in the deployment name are replaced with dashes when it is used, so
+// they are allowed here.
+func (r CreateModelDeploymentsRequest) Validate() error {
+	var v helper.Validator
+	v.Required("userName", r.Username)
+	v.LabelValue("userName", r.Username)
+	v.DNSLabel("deploymentName", "pvc-%s", strings.ReplaceAll(r.DeploymentName, ".", "-"))
+	v.Required("modelName", r.Modelname)
+	v.Required("version", r.Version)
+	if len(r.Modelartifacts) == 0 {
+		v.Fail("modelartifacts", "must list at least one artifact")
+	}
+	_, err := utils.ConfigResource(r.CPURequest, r.MemoryRequest, r.CPULimit, r.MemoryLimit)
+	v.Check(err)
+	v.Quantity("diskStorage", r.DiskStorage)
+	_, err = utils.ParseGPU(r.GPURequest, r.GPUType, r.GPUModel)
+	v.Check(err)
+	v.LabelValue("nodeSelector", r.NodeSelector)
+	return v.Err()
+}
+
 type EnvVar struct {
 	Key   string
 	Value string
@@ -37,4 +69,46 @@ type DeleteDeploymentRequest struct {
 }
 
 var modelNamespace = "model"
-var kc = utils.NewKubernetesConfig()
+
+// Service serves the model deployment endpoints. kc is the cluster the
+// service is bound to, the default one until forCluster picks another, and
+// namespace is where its deployments live: modelNamespace, or the tenant's
+// namespace when the cluster has tenancy enabled.
+type Service struct {
+	kc        *utils.KubernetesConfig
+	cluster   string
+	namespace string
+	tenant    string
+	clusters  *utils.Clusters
+	fs        afero.Fs
+	broker    *sse.Broker
+	jobs      *jobs.Manager
+}
+
+// modelTopic is the SSE topic GetModelsSse streams, one per cluster and
+// namespace; see topic.
+const modelTopic = "models"
+
+func NewService(clusters *utils.Clusters, fs afero.Fs, broker *sse.Broker, jobManager *jobs.Manager) *Service {
+	def := clusters.Default()
+	return &Service{kc: def.Kube, cluster: def.Name, namespace: modelNamespace, clusters: clusters, fs: fs, broker: broker, jobs: jobManager}
+}
+
+// topic returns the name of the service's own instance of base, registering
+// it fed by produce on first use. Each cluster and tenant namespace gets a
+// topic of its own, so a stream only carries the deployments its caller may
+// see.
+func (s *Service) topic(base string, produce sse.Producer) string {
+	name := base + "/" + s.cluster + "/" + s.namespace
+	s.broker.RegisterOnce(name, produce)
+	return name
+}
+
+// produceModelEvents feeds the models topic from the deployments and pods
+// in the service's namespace.
+func (s *Service) produceModelEvents(ctx context.Context, h *sse.Hub) error {
+	go sse.Follow(ctx, h, func(ctx context.Context) (<-chan utils.ResourceEvent, error) {
+		return s.kc.Watch(ctx, s.namespace, utils.WatchDeployments, utils.WatchPods)
+	})
+	return nil
+}
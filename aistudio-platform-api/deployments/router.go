@@ -4,14 +4,14 @@ import (
 	"github.com/gofiber/fiber/v2"
 )
 
-func SetupRoutes(router fiber.Router) {
+func SetupRoutes(router fiber.Router, svc *Service) {
 	modeldeployment := router.Group("/modeldeployment")
-	modeldeployment.Post("/", CreateModelDeployment)
-	modeldeployment.Get("/", GetModelDeployments)
-	modeldeployment.Get("/describepod", GetPodDescription)
-	modeldeployment.Get("/sse", GetModelsSse)
-	modeldeployment.Get("/metrics", GetModelMetrics)
-	modeldeployment.Get("/logs", GetModelDeploymentLogs)
-	modeldeployment.Delete("/:id", DeleteModelDeployment)
-	modeldeployment.Get("/:id", GetOneDeployment)
+	modeldeployment.Post("/", svc.CreateModelDeployment)
+	modeldeployment.Get("/", svc.GetModelDeployments)
+	modeldeployment.Get("/describepod", svc.GetPodDescription)
+	modeldeployment.Get("/sse", svc.GetModelsSse)
+	modeldeployment.Get("/metrics", svc.GetModelMetrics)
+	modeldeployment.Get("/logs", svc.GetModelDeploymentLogs)
+	modeldeployment.Delete("/:id", svc.DeleteModelDeployment)
+	modeldeployment.Get("/:id", svc.GetOneDeployment)
 }
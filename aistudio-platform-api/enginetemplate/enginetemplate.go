@@ -76,3 +76,20 @@ func isTag(version string) bool {
 	return re.MatchString(version)
 }
 
+// Source validates and downloads engine templates. GitHub is the production
+// implementation; tests substitute a fake so no network is needed.
+type Source interface {
+	Validate(url, version, gitToken string) (bool, error)
+	Download(t Template, gitToken string) error
+}
+
+// GitHub resolves templates from github.com repositories.
+type GitHub struct{}
+
+func (GitHub) Validate(url, version, gitToken string) (bool, error) {
+	return IsValidGitHubRepo(url, version, gitToken)
+}
+
+func (GitHub) Download(t Template, gitToken string) error {
+	return t.GetTemplate(gitToken)
+}
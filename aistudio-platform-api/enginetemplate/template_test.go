@@ -2,21 +2,54 @@ package enginetemplate
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/spf13/afero"
 )
 
-var expPath = "/tmp/foo/19"
+// newTemplateRepo creates a local repository with a single commit tagged
+// v5.4.2, so cloning needs no network access.
+func newTemplateRepo(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "status.go"), []byte("package template\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wt.Add("status.go"); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := wt.Commit("initial", &git.CommitOptions{
+		Author: &object.Signature{Name: "studio", Email: "studio@example.com", When: time.Now()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.CreateTag("v5.4.2", hash, nil); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
 
 func TestGetTemplate(t *testing.T) {
+	expPath := filepath.Join(t.TempDir(), "19")
 	templateEngine := Template{
-		TemplateBaseURL: "https://github.com/go-git/go-git/",
+		TemplateBaseURL: newTemplateRepo(t),
 		TemplateVersion: "v5.4.2",
 		ExpPath:         expPath,
 	}
-	gitToken := os.Getenv("git_token")
-	err := templateEngine.GetTemplate(gitToken)
+	err := templateEngine.GetTemplate("")
 
 	if err != nil {
 		t.Error("Error downloading the template file", err)
@@ -30,3 +63,17 @@ func TestGetTemplate(t *testing.T) {
 		t.Error("Error Downloading the template file", err)
 	}
 }
+
+func TestIsTag(t *testing.T) {
+	for version, want := range map[string]bool{
+		"v0.1.2":             true,
+		"v1":                 true,
+		"v0.1.1-stableBlank": true,
+		"main":               false,
+		"feature/x":          false,
+	} {
+		if got := isTag(version); got != want {
+			t.Errorf("isTag(%q) = %v, want %v", version, got, want)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package helper
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
+)
+
+// Machine-readable error codes carried in ErrorBody.Code.
+const (
+	CodeInvalidRequest   = "invalid_request"
+	CodeValidationFailed = "validation_failed"
+	CodeNotFound         = "not_found"
+	CodeConflict         = "conflict"
+	CodeForbidden        = "forbidden"
+	CodeQuotaExceeded    = "quota_exceeded"
+	CodeInvalid          = "invalid"
+	CodeUnavailable      = "unavailable"
+	CodeInternal         = "internal"
+)
+
+// RequestIDKey is the fiber local the request ID middleware stores the ID
+// under.
+const RequestIDKey = "requestid"
+
+// FieldError explains why one field of a request was rejected.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ErrorBody is the error part of an APIResponse.
+type ErrorBody struct {
+	Code      string       `json:"code"`
+	Message   string       `json:"message"`
+	Fields    []FieldError `json:"fields,omitempty"`
+	RequestID string       `json:"requestId,omitempty"`
+}
+
+// Error is an error a handler can return for ErrorHandler to render. Err is
+// the underlying cause; it is logged but not shown to the client.
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+	Fields  []FieldError
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+func (e *Error) StatusCode() int { return e.Status }
+
+// NewError returns an Error with the code that matches status.
+func NewError(status int, message string, err error) *Error {
+	return &Error{Status: status, Code: codeFor(status), Message: message, Err: err}
+}
+
+// Wrap describes err to the client with message, keeping the status and
+// code err carries, such as a kubeutils error does, or fallback when it
+// carries none. An error about one field of the request is reported against
+// that field.
+func Wrap(err error, message string, fallback int) *Error {
+	status := StatusFor(err, fallback)
+	e := &Error{Status: status, Code: codeOf(err, status), Message: message, Err: err}
+	if field, msg, ok := fieldError(err); ok {
+		e.Fields = []FieldError{{Field: field, Message: msg}}
+	}
+	return e
+}
+
+// BadRequest reports a body that could not be parsed.
+func BadRequest(err error) *Error {
+	return NewError(fiber.StatusBadRequest, "Invalid request body", err)
+}
+
+// SendError renders err in the standard envelope. The status and code come
+// from err when it carries them, such as kubeutils errors do, and default to
+// 500 otherwise. The text of unexpected server errors is logged rather than
+// sent.
+func SendError(c *fiber.Ctx, err error) error {
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		apiErr = Wrap(err, err.Error(), fiber.StatusInternalServerError)
+		var fe *fiber.Error
+		if errors.As(err, &fe) {
+			apiErr.Message = fe.Message
+		} else if apiErr.Status >= fiber.StatusInternalServerError {
+			apiErr.Message = http.StatusText(apiErr.Status)
+		}
+	}
+	if apiErr.Status >= fiber.StatusInternalServerError {
+		log.Error(apiErr.Error())
+	}
+
+	body := &ErrorBody{
+		Code:      apiErr.Code,
+		Message:   apiErr.Message,
+		Fields:    apiErr.Fields,
+		RequestID: requestID(c),
+	}
+	c.Status(apiErr.Status)
+	return c.JSON(APIResponse{
+		Message:    apiErr.Message,
+		StatusCode: apiErr.Status,
+		Data:       nil,
+		Error:      body,
+	})
+}
+
+// ErrorHandler is the fiber ErrorHandler: whatever a handler returns is sent
+// to the client in the standard envelope.
+func ErrorHandler(c *fiber.Ctx, err error) error {
+	return SendError(c, err)
+}
+
+// codeOf prefers a code err names itself, such as quota_exceeded, over the
+// generic one for status.
+func codeOf(err error, status int) string {
+	var coded interface{ Code() string }
+	if errors.As(err, &coded) && coded.Code() != "" {
+		return coded.Code()
+	}
+	return codeFor(status)
+}
+
+func codeFor(status int) string {
+	switch status {
+	case fiber.StatusBadRequest:
+		return CodeInvalidRequest
+	case fiber.StatusNotFound:
+		return CodeNotFound
+	case fiber.StatusConflict:
+		return CodeConflict
+	case fiber.StatusForbidden, fiber.StatusUnauthorized:
+		return CodeForbidden
+	case fiber.StatusUnprocessableEntity:
+		return CodeInvalid
+	case fiber.StatusServiceUnavailable:
+		return CodeUnavailable
+	}
+	if status >= fiber.StatusInternalServerError {
+		return CodeInternal
+	}
+	return CodeInvalidRequest
+}
+
+func requestID(c *fiber.Ctx) string {
+	if id, ok := c.Locals(RequestIDKey).(string); ok {
+		return id
+	}
+	return c.GetRespHeader(fiber.HeaderXRequestID)
+}
@@ -0,0 +1,83 @@
+package helper_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"Kubernetes-api/helper"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+)
+
+func send(t *testing.T, handler fiber.Handler) (int, helper.APIResponse) {
+	t.Helper()
+	app := fiber.New(fiber.Config{ErrorHandler: helper.ErrorHandler})
+	app.Use(requestid.New())
+	app.Get("/", handler)
+
+	resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/", nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	raw, _ := io.ReadAll(resp.Body)
+	var out helper.APIResponse
+	if err := json.Unmarshal(raw, &out); err != nil {
+		t.Fatalf("decoding %q: %v", raw, err)
+	}
+	if out.Error != nil && out.Error.RequestID != resp.Header.Get(fiber.HeaderXRequestID) {
+		t.Errorf("error request ID %q does not match the response header", out.Error.RequestID)
+	}
+	return resp.StatusCode, out
+}
+
+func TestSendResponseMarksEverySuccessStatus(t *testing.T) {
+	for _, code := range []int{fiber.StatusOK, fiber.StatusCreated, fiber.StatusAccepted} {
+		_, resp := send(t, func(c *fiber.Ctx) error { return helper.SendResponse(c, "ok", nil, code) })
+		if !resp.Status || resp.Error != nil {
+			t.Errorf("%d: status = %v, error = %+v; want a plain success", code, resp.Status, resp.Error)
+		}
+	}
+
+	_, resp := send(t, func(c *fiber.Ctx) error { return helper.SendResponse(c, "Job not found", nil, fiber.StatusNotFound) })
+	if resp.Status || resp.Error == nil || resp.Error.Code != helper.CodeNotFound || resp.Error.RequestID == "" {
+		t.Errorf("404 response = %+v, want an error envelope", resp)
+	}
+}
+
+func TestErrorHandlerRendersValidationErrors(t *testing.T) {
+	status, resp := send(t, func(c *fiber.Ctx) error {
+		var v helper.Validator
+		v.DNSLabel("userName", "notebook-%s", "Alice_Smith")
+		v.Quantity("cpuRequest", "two")
+		v.Quantity("memoryRequest", "2Gi")
+		v.Required("password", "")
+		return v.Err()
+	})
+	if status != fiber.StatusBadRequest || resp.Error == nil || resp.Error.Code != helper.CodeValidationFailed {
+		t.Fatalf("got %d %+v, want a 400 validation failure", status, resp)
+	}
+	var fields []string
+	for _, f := range resp.Error.Fields {
+		fields = append(fields, f.Field)
+	}
+	if len(fields) != 3 || fields[0] != "userName" || fields[1] != "cpuRequest" || fields[2] != "password" {
+		t.Errorf("field errors = %+v, want userName, cpuRequest and password", resp.Error.Fields)
+	}
+}
+
+func TestErrorHandlerHidesUnexpectedErrors(t *testing.T) {
+	status, resp := send(t, func(c *fiber.Ctx) error { return errors.New("dial tcp 10.0.0.1:443: connection refused") })
+	if status != fiber.StatusInternalServerError || resp.Error.Code != helper.CodeInternal || resp.Error.Message != "Internal Server Error" {
+		t.Fatalf("got %d %+v, want a generic 500", status, resp.Error)
+	}
+
+	status, resp = send(t, func(c *fiber.Ctx) error { return fiber.ErrMethodNotAllowed })
+	if status != fiber.StatusMethodNotAllowed || resp.Error.Message != "Method Not Allowed" {
+		t.Fatalf("got %d %+v, want fiber's status kept", status, resp.Error)
+	}
+}
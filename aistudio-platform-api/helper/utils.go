@@ -3,6 +3,7 @@ package helper
 import (
 	"archive/zip"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -12,40 +13,77 @@ import (
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/spf13/afero"
 )
 
+// APIResponse is the envelope every endpoint answers with. Status is true
+// for any 2xx response; failures also carry Error.
 type APIResponse struct {
 	Message    string      `json:"message,omitempty"`
 	StatusCode int         `json:"statusCode"`
 	Status     bool        `json:"status"`
 	Data       interface{} `json:"data"`
+	Error      *ErrorBody  `json:"error,omitempty"`
 }
 
 func SendResponse(c *fiber.Ctx, message string, data interface{}, statuscode int) error {
 
-	status := false
-	if statuscode == 200 {
-		status = true
-	}
+	status := statuscode >= 200 && statuscode < 300
 	response := APIResponse{
 		Message:    message,
 		StatusCode: statuscode,
 		Status:     status,
 		Data:       data,
 	}
+	if statuscode >= 400 {
+		response.Error = &ErrorBody{Code: codeFor(statuscode), Message: message, RequestID: requestID(c)}
+	}
 
 	c.Status(statuscode)
 	return c.JSON(response)
 }
 
-func ExtractZip(src, dest string) ([]string, error) {
+// StatusFor returns the HTTP status err asks for, such as the ones kubeutils
+// derives from Kubernetes API failures, or fallback when it carries none.
+func StatusFor(err error, fallback int) int {
+	var coded interface{ StatusCode() int }
+	if errors.As(err, &coded) {
+		return coded.StatusCode()
+	}
+	var fe *fiber.Error
+	if errors.As(err, &fe) {
+		return fe.Code
+	}
+	return fallback
+}
+
+// ClusterParam is the query parameter that names the registered cluster a
+// request goes to. Requests without it go to the default cluster.
+const ClusterParam = "cluster"
+
+// TenantHeader names the team or project a request acts for. It is
+// required, and selects the tenant's namespace, when the cluster has
+// tenancy enabled.
+const TenantHeader = "X-Tenant"
+
+func ExtractZip(fs afero.Fs, src, dest string) ([]string, error) {
 	var extractedFiles []string
 
-	r, err := zip.OpenReader(src)
+	zf, err := fs.Open(src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open zip file: %w", err)
+	}
+	defer zf.Close()
+
+	info, err := zf.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat zip file: %w", err)
+	}
+
+	r, err := zip.NewReader(zf, info.Size())
 	if err != nil {
 		return nil, fmt.Errorf("failed to open zip file: %w", err)
 	}
-	defer r.Close()
 
 	for _, f := range r.File {
 		fpath := filepath.Join(dest, f.Name)
@@ -56,17 +94,17 @@ func ExtractZip(src, dest string) ([]string, error) {
 		}
 
 		if f.FileInfo().IsDir() {
-			if err := os.MkdirAll(fpath, os.ModePerm); err != nil {
+			if err := fs.MkdirAll(fpath, os.ModePerm); err != nil {
 				return nil, fmt.Errorf("failed to create directory %s: %w", fpath, err)
 			}
 			continue
 		}
 
-		if err := os.MkdirAll(filepath.Dir(fpath), os.ModePerm); err != nil {
+		if err := fs.MkdirAll(filepath.Dir(fpath), os.ModePerm); err != nil {
 			return nil, fmt.Errorf("failed to create parent directory for %s: %w", fpath, err)
 		}
 
-		outFile, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode())
+		outFile, err := fs.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode())
 		if err != nil {
 			return nil, fmt.Errorf("failed to create file %s: %w", fpath, err)
 		}
@@ -93,7 +131,7 @@ func ExtractZip(src, dest string) ([]string, error) {
 }
 
 // Helper: Download file from URL
-func DownloadFile(url, filepath string) error {
+func DownloadFile(fs afero.Fs, url, filepath string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
 	defer cancel()
 
@@ -112,7 +150,7 @@ func DownloadFile(url, filepath string) error {
 		return fmt.Errorf("bad status: %s", resp.Status)
 	}
 
-	out, err := os.Create(filepath)
+	out, err := fs.Create(filepath)
 	if err != nil {
 		return err
 	}
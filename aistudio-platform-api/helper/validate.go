@@ -0,0 +1,132 @@
+package helper
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// Validator collects field errors so a request is rejected with every
+// problem at once rather than one per round trip.
+type Validator struct {
+	fields []FieldError
+}
+
+// Fail records a problem with field.
+func (v *Validator) Fail(field, format string, args ...any) {
+	v.fields = append(v.fields, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// Required reports whether value is set, recording an error if not.
+func (v *Validator) Required(field, value string) bool {
+	if strings.TrimSpace(value) == "" {
+		v.Fail(field, "is required")
+		return false
+	}
+	return true
+}
+
+// DNSLabel requires value to be usable in a Kubernetes object name. name is
+// a format with one %s for value, such as "notebook-%s", so the DNS-1123
+// label rules and length limit are checked against the final name.
+func (v *Validator) DNSLabel(field, name, value string) {
+	if !v.Required(field, value) {
+		return
+	}
+	if errs := validation.IsDNS1123Label(fmt.Sprintf(name, value)); len(errs) > 0 {
+		v.Fail(field, "must be a valid Kubernetes name: %s", strings.Join(errs, "; "))
+	}
+}
+
+// Quantity requires value to be a Kubernetes quantity such as "500m" or
+// "2Gi".
+func (v *Validator) Quantity(field, value string) {
+	if !v.Required(field, value) {
+		return
+	}
+	q, err := resource.ParseQuantity(value)
+	if err != nil {
+		v.Fail(field, "must be a Kubernetes quantity such as 500m or 2Gi")
+		return
+	}
+	if q.Sign() < 0 {
+		v.Fail(field, "must not be negative")
+	}
+}
+
+// Count requires value, when set, to be a whole number of devices.
+func (v *Validator) Count(field, value string) {
+	if value == "" {
+		return
+	}
+	if n, err := strconv.Atoi(value); err != nil || n < 0 {
+		v.Fail(field, "must be a whole number of devices")
+	}
+}
+
+// LabelValue requires value, when set, to be usable as a label value, as
+// node selectors are.
+func (v *Validator) LabelValue(field, value string) {
+	if value == "" {
+		return
+	}
+	if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+		v.Fail(field, "must be a valid label value: %s", strings.Join(errs, "; "))
+	}
+}
+
+// URL requires value to be an absolute http or https URL.
+func (v *Validator) URL(field, value string) {
+	if !v.Required(field, value) {
+		return
+	}
+	u, err := url.ParseRequestURI(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		v.Fail(field, "must be an http or https URL")
+	}
+}
+
+// Check records err, if any, against the field it names. Errors such as
+// kubeutils.QuantityError know their field; any other error is recorded
+// against the request as a whole.
+func (v *Validator) Check(err error) {
+	if err == nil {
+		return
+	}
+	if field, message, ok := fieldError(err); ok {
+		v.Fail(field, "%s", message)
+		return
+	}
+	v.Fail("", "%s", err.Error())
+}
+
+// Err returns the collected problems as a validation error, or nil when
+// there are none.
+func (v *Validator) Err() error {
+	if len(v.fields) == 0 {
+		return nil
+	}
+	return &Error{
+		Status:  fiber.StatusBadRequest,
+		Code:    CodeValidationFailed,
+		Message: "Request validation failed",
+		Fields:  v.fields,
+	}
+}
+
+// fieldError reports the field and message of an error that is about one
+// field of a request.
+func fieldError(err error) (string, string, bool) {
+	var fe interface{ FieldError() (string, string) }
+	if !errors.As(err, &fe) {
+		return "", "", false
+	}
+	field, message := fe.FieldError()
+	return field, message, true
+}
@@ -0,0 +1,52 @@
+package cron_test
+
+import (
+	"testing"
+	"time"
+
+	"Kubernetes-api/internal/cron"
+)
+
+func TestNext(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("no time zone data: %v", err)
+	}
+	// Friday 6 March 2026, 18:30 in Berlin.
+	from := time.Date(2026, 3, 6, 18, 30, 0, 0, berlin)
+	for _, tc := range []struct {
+		spec string
+		from time.Time
+		want time.Time
+	}{
+		{"0 20 * * *", from, time.Date(2026, 3, 6, 20, 0, 0, 0, berlin)},
+		{"0 9 * * MON-FRI", from, time.Date(2026, 3, 9, 9, 0, 0, 0, berlin)},
+		{"*/15 * * * *", from, time.Date(2026, 3, 6, 18, 45, 0, 0, berlin)},
+		{"0 0 * * 7", from, time.Date(2026, 3, 8, 0, 0, 0, 0, berlin)},
+		{"0 0 1 jan *", from, time.Date(2027, 1, 1, 0, 0, 0, 0, berlin)},
+		{"@daily", from, time.Date(2026, 3, 7, 0, 0, 0, 0, berlin)},
+		// Either day field matches when both are restricted.
+		{"0 12 10 * 1", from, time.Date(2026, 3, 9, 12, 0, 0, 0, berlin)},
+		// Clocks go from 02:00 to 03:00 on 29 March; the skipped hour
+		// does not fire.
+		{"30 2 * * *", time.Date(2026, 3, 28, 12, 0, 0, 0, berlin), time.Date(2026, 3, 30, 2, 30, 0, 0, berlin)},
+		{"0 0 30 2 *", from, time.Time{}},
+	} {
+		s, err := cron.Parse(tc.spec)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tc.spec, err)
+			continue
+		}
+		if got := s.Next(tc.from); !got.Equal(tc.want) {
+			t.Errorf("%q after %s = %s, want %s", tc.spec, tc.from, got, tc.want)
+		}
+	}
+}
+
+func TestParseRejectsInvalidExpressions(t *testing.T) {
+	for _, spec := range []string{"", "0 20 * *", "60 * * * *", "0 9 * * fri-mon", "*/0 * * * *", "0 9 * * weekday", "@reboot"} {
+		if _, err := cron.Parse(spec); err == nil {
+			t.Errorf("Parse(%q) succeeded", spec)
+		}
+	}
+}
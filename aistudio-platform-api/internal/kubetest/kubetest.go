@@ -0,0 +1,280 @@
+// Package kubetest runs the API against fake Kubernetes clients and an
+// in-memory filesystem so handlers can be exercised end to end with
+// fiber's app.Test and no cluster, disk or network.
+package kubetest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"Kubernetes-api/enginetemplate"
+	"Kubernetes-api/helper"
+	"Kubernetes-api/internal/sse"
+	"Kubernetes-api/jobs"
+	"Kubernetes-api/kubeutils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+	"github.com/spf13/afero"
+	"github.com/valyala/fasthttp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	metricsv1beta1 "k8s.io/metrics/pkg/apis/metrics/v1beta1"
+	metricsfake "k8s.io/metrics/pkg/client/clientset/versioned/fake"
+)
+
+// Harness holds the fakes behind a KubernetesConfig. Tests seed objects
+// through the constructor or the fake clients and assert on them afterwards.
+type Harness struct {
+	Clientset *fake.Clientset
+	Metrics   *metricsfake.Clientset
+	Dynamic   *dynamicfake.FakeDynamicClient
+	Fs        afero.Fs
+	Templates *Templates
+	Broker    *sse.Broker
+	Jobs      *jobs.Manager
+	Kube      *kubeutils.KubernetesConfig
+	// Clusters registers Kube as the only cluster.
+	Clusters *kubeutils.Clusters
+}
+
+// New returns a harness whose typed clientset is seeded with objects. The
+// fake discovery advertises the core and apps resources so manifest
+// application can build a REST mapper.
+func New(objects ...runtime.Object) *Harness {
+	cs := fake.NewSimpleClientset(objects...)
+	cs.Resources = discoveryResources
+
+	metrics := metricsfake.NewSimpleClientset()
+	dyn := dynamicfake.NewSimpleDynamicClient(scheme.Scheme)
+
+	kube := kubeutils.NewKubernetesConfigForClients(cs, metrics, dyn)
+	return &Harness{
+		Clientset: cs,
+		Metrics:   metrics,
+		Dynamic:   dyn,
+		Fs:        afero.NewMemMapFs(),
+		Templates: &Templates{},
+		Broker:    sse.NewBroker(),
+		Jobs:      jobs.NewManager(),
+		Kube:      kube,
+		Clusters:  kubeutils.SingleCluster(kube),
+	}
+}
+
+var discoveryResources = []*metav1.APIResourceList{
+	{
+		GroupVersion: "v1",
+		APIResources: []metav1.APIResource{
+			{Name: "services", Kind: "Service", Namespaced: true},
+			{Name: "configmaps", Kind: "ConfigMap", Namespaced: true},
+			{Name: "persistentvolumeclaims", Kind: "PersistentVolumeClaim", Namespaced: true},
+		},
+	},
+	{
+		GroupVersion: "apps/v1",
+		APIResources: []metav1.APIResource{
+			{Name: "deployments", Kind: "Deployment", Namespaced: true},
+			{Name: "statefulsets", Kind: "StatefulSet", Namespaced: true},
+		},
+	},
+}
+
+// podMetricsResource is the resource the fake metrics client lists from;
+// objects passed to metricsfake.NewSimpleClientset land elsewhere.
+var podMetricsResource = schema.GroupVersionResource{Group: "metrics.k8s.io", Version: "v1beta1", Resource: "pods"}
+
+// AddPodMetrics makes pm visible to MetricsV1beta1().PodMetricses().List.
+func (h *Harness) AddPodMetrics(t testing.TB, pm *metricsv1beta1.PodMetrics) {
+	t.Helper()
+	if err := h.Metrics.Tracker().Create(podMetricsResource, pm, pm.Namespace); err != nil {
+		t.Fatalf("seeding pod metrics %s: %v", pm.Name, err)
+	}
+}
+
+var nodeMetricsResource = schema.GroupVersionResource{Group: "metrics.k8s.io", Version: "v1beta1", Resource: "nodes"}
+
+// AddNodeMetrics makes nm visible to MetricsV1beta1().NodeMetricses().List.
+func (h *Harness) AddNodeMetrics(t testing.TB, nm *metricsv1beta1.NodeMetrics) {
+	t.Helper()
+	if err := h.Metrics.Tracker().Create(nodeMetricsResource, nm, ""); err != nil {
+		t.Fatalf("seeding node metrics %s: %v", nm.Name, err)
+	}
+}
+
+// StartCache syncs the informer cache against the fakes and stops it when
+// the test ends.
+func (h *Harness) StartCache(t testing.TB) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	if err := h.Kube.StartCache(ctx); err != nil {
+		t.Fatalf("starting informer cache: %v", err)
+	}
+}
+
+// WriteFile creates path and its parents on the in-memory filesystem.
+func (h *Harness) WriteFile(t testing.TB, path, content string) {
+	t.Helper()
+	if err := afero.WriteFile(h.Fs, path, []byte(content), 0644); err != nil {
+		t.Fatalf("writing %s: %v", path, err)
+	}
+}
+
+// App returns a fiber app with mount applied to its /api group, with the
+// error handler and request IDs main and router.SetupRoutes install. The job
+// routes are always mounted so tests can follow the jobs their requests
+// start.
+func (h *Harness) App(mount func(api fiber.Router)) *fiber.App {
+	app := fiber.New(fiber.Config{ErrorHandler: helper.ErrorHandler})
+	app.Use(requestid.New())
+	api := app.Group("/api")
+	jobs.SetupRoutes(api, h.Jobs)
+	mount(api)
+	return app
+}
+
+// WaitJob polls the job started by a 202 response until it finishes and
+// returns its final state.
+func (h *Harness) WaitJob(t testing.TB, resp helper.APIResponse) jobs.Job {
+	t.Helper()
+	data, _ := resp.Data.(map[string]interface{})
+	id, _ := data["id"].(string)
+	if id == "" {
+		t.Fatalf("response %+v does not describe a job", resp)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, ok := h.Jobs.Get(id)
+		if !ok {
+			t.Fatalf("job %s not found", id)
+		}
+		if job.Finished() {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s still %s: %+v", id, job.Status, job.Steps)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// Do sends a JSON request through app.Test and decodes the standard
+// response envelope.
+func Do(t testing.TB, app *fiber.App, method, path string, body any) (int, helper.APIResponse) {
+	t.Helper()
+	return DoWithHeaders(t, app, method, path, body, nil)
+}
+
+// DoWithHeaders is Do with extra request headers.
+func DoWithHeaders(t testing.TB, app *fiber.App, method, path string, body any, headers map[string]string) (int, helper.APIResponse) {
+	t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("encoding request body: %v", err)
+		}
+		reader = bytes.NewReader(b)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	var out helper.APIResponse
+	raw, _ := io.ReadAll(resp.Body)
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &out); err != nil {
+			t.Fatalf("%s %s: decoding response %q: %v", method, path, raw, err)
+		}
+	}
+	return resp.StatusCode, out
+}
+
+// FirstEvent opens the event stream at path on a live server and returns
+// the name of the first object it reports.
+func FirstEvent(t testing.TB, app *fiber.App, path string, headers map[string]string) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go fasthttp.Serve(ln, app.Handler())
+	defer ln.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+ln.Addr().String()+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var ev struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal([]byte(data), &ev); err == nil && ev.Name != "" {
+			return ev.Name
+		}
+	}
+	t.Fatalf("stream %s ended without an event: %v", path, scanner.Err())
+	return ""
+}
+
+// Templates is an enginetemplate.Source that records downloads, and the git
+// tokens templates were validated with, instead of cloning from GitHub.
+type Templates struct {
+	ValidateErr error
+	DownloadErr error
+	Downloaded  []enginetemplate.Template
+	Tokens      []string
+}
+
+func (f *Templates) Validate(url, version, gitToken string) (bool, error) {
+	f.Tokens = append(f.Tokens, gitToken)
+	return f.ValidateErr == nil, f.ValidateErr
+}
+
+func (f *Templates) Download(t enginetemplate.Template, gitToken string) error {
+	if f.DownloadErr != nil {
+		return f.DownloadErr
+	}
+	f.Downloaded = append(f.Downloaded, t)
+	return nil
+}
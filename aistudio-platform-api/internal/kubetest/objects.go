@@ -0,0 +1,173 @@
+package kubetest
+
+import (
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	metricsv1beta1 "k8s.io/metrics/pkg/apis/metrics/v1beta1"
+)
+
+// NodeGroupLabel marks fake nodes as EKS nodes so vendor detection succeeds.
+const NodeGroupLabel = "eks.amazonaws.com/nodegroup"
+
+// Node returns a ready node with the given allocatable CPU, memory and
+// nvidia.com/gpu. An empty gpu leaves the resource off the node.
+func Node(name, cpu, memory, gpu string) *corev1.Node {
+	allocatable := corev1.ResourceList{
+		corev1.ResourceCPU:    resource.MustParse(cpu),
+		corev1.ResourceMemory: resource.MustParse(memory),
+		corev1.ResourcePods:   resource.MustParse("110"),
+	}
+	if gpu != "" {
+		allocatable["nvidia.com/gpu"] = resource.MustParse(gpu)
+	}
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			Labels: map[string]string{
+				NodeGroupLabel:                     "default",
+				"beta.kubernetes.io/instance-type": "m5.xlarge",
+				"type":                             "cpu",
+			},
+		},
+		Status: corev1.NodeStatus{
+			Capacity:    allocatable.DeepCopy(),
+			Allocatable: allocatable,
+			Conditions: []corev1.NodeCondition{
+				{Type: corev1.NodeReady, Status: corev1.ConditionTrue},
+			},
+		},
+	}
+}
+
+// Pod returns a running, ready single-container pod labelled app=<app> and
+// bound to node, requesting cpu and memory.
+func Pod(namespace, name, app, node, cpu, memory string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         namespace,
+			Labels:            map[string]string{"app": app},
+			CreationTimestamp: metav1.Now(),
+		},
+		Spec: corev1.PodSpec{
+			NodeName: node,
+			Containers: []corev1.Container{{
+				Name:  app,
+				Image: "busybox",
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{
+						corev1.ResourceCPU:    resource.MustParse(cpu),
+						corev1.ResourceMemory: resource.MustParse(memory),
+					},
+				},
+			}},
+		},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodRunning,
+			ContainerStatuses: []corev1.ContainerStatus{{
+				Name:  app,
+				Ready: true,
+				State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}},
+			}},
+		},
+	}
+}
+
+// Ingress returns an ingress with a single host-less rule and no paths, the
+// shape AppendRuleToIngress expects to extend.
+func Ingress(namespace, name string) *networkingv1.Ingress {
+	return &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Spec: networkingv1.IngressSpec{
+			Rules: []networkingv1.IngressRule{{
+				IngressRuleValue: networkingv1.IngressRuleValue{
+					HTTP: &networkingv1.HTTPIngressRuleValue{},
+				},
+			}},
+		},
+	}
+}
+
+// Deployment returns a one-replica deployment selecting app=<name>.
+func Deployment(namespace, name string) *appsv1.Deployment {
+	replicas := int32(1)
+	labels := map[string]string{"app": name}
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: labels},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+			},
+		},
+	}
+}
+
+// Claim returns a bound volume claim of size from storageClass.
+func Claim(namespace, name, storageClass, size string) *corev1.PersistentVolumeClaim {
+	return &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteMany},
+			StorageClassName: &storageClass,
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse(size)},
+			},
+		},
+		Status: corev1.PersistentVolumeClaimStatus{Phase: corev1.ClaimBound},
+	}
+}
+
+// StorageClass returns a storage class that allows volume expansion when
+// expandable is set.
+func StorageClass(name string, expandable bool) *storagev1.StorageClass {
+	return &storagev1.StorageClass{
+		ObjectMeta:           metav1.ObjectMeta{Name: name},
+		Provisioner:          "nfs.csi.k8s.io",
+		AllowVolumeExpansion: &expandable,
+	}
+}
+
+// PodMetrics returns a single-container usage sample for a pod.
+func PodMetrics(namespace, name, cpu, memory string) *metricsv1beta1.PodMetrics {
+	return &metricsv1beta1.PodMetrics{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Containers: []metricsv1beta1.ContainerMetrics{{
+			Name: name,
+			Usage: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse(cpu),
+				corev1.ResourceMemory: resource.MustParse(memory),
+			},
+		}},
+	}
+}
+
+// NodeMetrics returns a usage sample for a node.
+func NodeMetrics(name, cpu, memory string) *metricsv1beta1.NodeMetrics {
+	return &metricsv1beta1.NodeMetrics{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Usage: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse(cpu),
+			corev1.ResourceMemory: resource.MustParse(memory),
+		},
+	}
+}
+
+// IngressPaths lists the paths of every rule of ing, in order.
+func IngressPaths(ing *networkingv1.Ingress) []string {
+	var paths []string
+	for _, rule := range ing.Spec.Rules {
+		if rule.HTTP == nil {
+			continue
+		}
+		for _, p := range rule.HTTP.Paths {
+			paths = append(paths, p.Path)
+		}
+	}
+	return paths
+}
@@ -0,0 +1,188 @@
+package sse
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultIdleTimeout is how long a topic's producer keeps running after its
+// last subscriber leaves, so a client that reconnects straight away resumes
+// from the replay buffer instead of a fresh snapshot.
+const DefaultIdleTimeout = 30 * time.Second
+
+// Producer feeds a topic's hub until ctx is done. It must not block; it
+// typically starts Pump in a goroutine.
+type Producer func(ctx context.Context, h *Hub) error
+
+// TopicStats describes one topic for monitoring.
+type TopicStats struct {
+	Topic       string `json:"topic"`
+	Subscribers int    `json:"subscribers"`
+	Running     bool   `json:"running"`
+}
+
+// Broker runs at most one producer per topic and fans its events out to every
+// client subscribed to that topic. Producers start with the first subscriber
+// and stop once a topic has been idle for the idle timeout.
+type Broker struct {
+	idle   time.Duration
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu     sync.Mutex
+	topics map[string]*topic
+}
+
+type topic struct {
+	produce     Producer
+	hub         *Hub
+	cancel      context.CancelFunc
+	subscribers int
+	idleTimer   *time.Timer
+}
+
+func NewBroker() *Broker {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Broker{idle: DefaultIdleTimeout, ctx: ctx, cancel: cancel, topics: make(map[string]*topic)}
+}
+
+// Close ends every open stream and stops every producer. Topics cannot be
+// started again afterwards.
+func (b *Broker) Close() {
+	b.cancel()
+}
+
+// Register adds a topic fed by produce. Registering a name twice replaces the
+// producer used the next time the topic starts.
+func (b *Broker) Register(name string, produce Producer) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if t, ok := b.topics[name]; ok {
+		t.produce = produce
+		return
+	}
+	b.topics[name] = &topic{produce: produce}
+}
+
+// RegisterOnce adds a topic fed by produce unless one of that name is
+// already registered. It suits topics named after what their first
+// subscriber asked for, which later subscribers share.
+func (b *Broker) RegisterOnce(name string, produce Producer) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.topics[name]; !ok {
+		b.topics[name] = &topic{produce: produce}
+	}
+}
+
+// Start makes sure the topic's producer is running, so handlers can report a
+// failure before they commit to a streaming response. A topic nobody
+// subscribes to is stopped again after the idle timeout.
+func (b *Broker) Start(name string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t, err := b.running(name)
+	if err != nil {
+		return err
+	}
+	if t.subscribers == 0 {
+		b.scheduleStop(t)
+	}
+	return nil
+}
+
+// Stream subscribes a client to the topic and writes its events to em until
+// ctx is done, the broker is closed or the client goes away. See Hub.Stream
+// for lastEventID.
+func (b *Broker) Stream(ctx context.Context, name string, em *Emitter, lastEventID string) error {
+	b.mu.Lock()
+	t, err := b.running(name)
+	if err != nil {
+		b.mu.Unlock()
+		return err
+	}
+	t.subscribers++
+	if t.idleTimer != nil {
+		t.idleTimer.Stop()
+		t.idleTimer = nil
+	}
+	hub := t.hub
+	b.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(b.ctx, cancel)
+	defer stop()
+
+	defer func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		t.subscribers--
+		if t.subscribers == 0 {
+			b.scheduleStop(t)
+		}
+	}()
+	return hub.Stream(ctx, em, lastEventID)
+}
+
+// Stats reports the subscriber count of every topic, ordered by name.
+func (b *Broker) Stats() []TopicStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	stats := make([]TopicStats, 0, len(b.topics))
+	for name, t := range b.topics {
+		stats = append(stats, TopicStats{Topic: name, Subscribers: t.subscribers, Running: t.hub != nil})
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Topic < stats[j].Topic })
+	return stats
+}
+
+// running returns the topic with its producer started. b.mu must be held.
+func (b *Broker) running(name string) (*topic, error) {
+	t, ok := b.topics[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown sse topic %q", name)
+	}
+	if err := b.ctx.Err(); err != nil {
+		return nil, fmt.Errorf("sse broker is closed: %w", err)
+	}
+	if t.hub != nil {
+		return t, nil
+	}
+
+	ctx, cancel := context.WithCancel(b.ctx)
+	hub := NewHub(DefaultBufferSize)
+	if err := t.produce(ctx, hub); err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to start sse topic %q: %w", name, err)
+	}
+	t.hub, t.cancel = hub, cancel
+	return t, nil
+}
+
+// scheduleStop stops the topic's producer once it has had no subscribers for
+// the idle timeout. b.mu must be held.
+func (b *Broker) scheduleStop(t *topic) {
+	if t.idleTimer != nil {
+		return
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(b.idle, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		// A subscriber came and went since this timer was set.
+		if t.idleTimer != timer {
+			return
+		}
+		t.idleTimer = nil
+		if t.subscribers > 0 || t.hub == nil {
+			return
+		}
+		t.cancel()
+		t.hub, t.cancel = nil, nil
+	})
+	t.idleTimer = timer
+}
@@ -0,0 +1,131 @@
+package sse
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func countingProducer(starts, stops *atomic.Int32) Producer {
+	return func(ctx context.Context, h *Hub) error {
+		starts.Add(1)
+		go func() {
+			<-ctx.Done()
+			stops.Add(1)
+		}()
+		return nil
+	}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func subscribers(b *Broker, topic string) int {
+	for _, s := range b.Stats() {
+		if s.Topic == topic {
+			return s.Subscribers
+		}
+	}
+	return -1
+}
+
+func TestBrokerSharesOneProducerPerTopic(t *testing.T) {
+	var starts, stops atomic.Int32
+	b := NewBroker()
+	b.Register("notebooks", countingProducer(&starts, &stops))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			done <- b.Stream(ctx, "notebooks", NewBufioEmitter(bufio.NewWriter(io.Discard), "test"), "")
+		}()
+	}
+	waitFor(t, "three subscribers", func() bool { return subscribers(b, "notebooks") == 3 })
+
+	if n := starts.Load(); n != 1 {
+		t.Fatalf("producer started %d times, want once", n)
+	}
+
+	cancel()
+	for i := 0; i < 3; i++ {
+		if err := <-done; !errors.Is(err, context.Canceled) {
+			t.Fatalf("Stream returned %v, want context.Canceled", err)
+		}
+	}
+	if n := subscribers(b, "notebooks"); n != 0 {
+		t.Fatalf("%d subscribers left after every client disconnected", n)
+	}
+}
+
+func TestBrokerStopsIdleTopics(t *testing.T) {
+	var starts, stops atomic.Int32
+	b := NewBroker()
+	b.idle = 10 * time.Millisecond
+	b.Register("metrics", countingProducer(&starts, &stops))
+
+	if err := b.Start("metrics"); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the idle producer to stop", func() bool { return stops.Load() == 1 })
+	if b.Stats()[0].Running {
+		t.Fatal("idle topic is still reported as running")
+	}
+
+	if err := b.Start("metrics"); err != nil {
+		t.Fatal(err)
+	}
+	if n := starts.Load(); n != 2 {
+		t.Fatalf("producer started %d times, want a restart after going idle", n)
+	}
+}
+
+func TestBrokerReportsProducerFailures(t *testing.T) {
+	b := NewBroker()
+	b.Register("models", func(context.Context, *Hub) error { return errors.New("cache not synced") })
+
+	if err := b.Start("models"); err == nil {
+		t.Fatal("Start succeeded although the producer failed")
+	}
+	if err := b.Start("plugins"); err == nil {
+		t.Fatal("Start succeeded for an unregistered topic")
+	}
+	if s := b.Stats(); len(s) != 1 || s[0].Running {
+		t.Fatalf("Stats = %+v, want one stopped topic", s)
+	}
+}
+
+func TestBrokerCloseEndsStreamsAndProducers(t *testing.T) {
+	var starts, stops atomic.Int32
+	b := NewBroker()
+	b.Register("plugins", countingProducer(&starts, &stops))
+
+	done := make(chan error, 1)
+	go func() {
+		done <- b.Stream(context.Background(), "plugins", NewBufioEmitter(bufio.NewWriter(io.Discard), "test"), "")
+	}()
+	waitFor(t, "a subscriber", func() bool { return subscribers(b, "plugins") == 1 })
+
+	b.Close()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("stream kept running after the broker was closed")
+	}
+	waitFor(t, "the producer to stop", func() bool { return stops.Load() == 1 })
+	if err := b.Start("plugins"); err == nil {
+		t.Fatal("Start succeeded on a closed broker")
+	}
+}
@@ -3,54 +3,76 @@ package sse
 import (
 	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/gofiber/fiber/v2/log"
 )
 
+// ErrClosed is wrapped by every error an Emitter returns once a write to the
+// client has failed. The connection is unusable from then on, so callers
+// should end the stream.
+var ErrClosed = errors.New("sse client disconnected")
+
 type Emitter struct {
 	w     *bufio.Writer
 	flush func() error
 	m     string
+	err   error
+	// closed, when set, is called once the first write fails.
+	closed func()
 }
 
 func NewBufioEmitter(bw *bufio.Writer, m string) *Emitter {
 	return &Emitter{w: bw, flush: bw.Flush, m: m}
 }
 
+// Send writes ev and flushes it to the client.
 func (e *Emitter) Send(ev DataByteEvent) error {
-	if _, err := e.w.Write(ev.Format()); err != nil {
-		return err
-	}
-	flushErr := e.flush()
-	if flushErr != nil {
-		fmt.Printf("Error while flushing: %v. Closing HTTP connection.\n", flushErr)
-		return flushErr
-	}
-	return nil
+	return e.write(ev.Format())
 }
 
-func (e *Emitter) SendJSON(id, typ string, v any) *FlowError {
+// SendJSON encodes v as the data of an event. An encoding failure leaves the
+// stream usable; a write failure closes it.
+func (e *Emitter) SendJSON(id, typ string, v any) error {
 	b, err := json.Marshal(v)
 	if err != nil {
-		log.Errorf("Error marshalling the data %s", e.m)
-		return NewFlowError(err, true)
+		log.Errorf("Error marshalling the data %s: %v", e.m, err)
+		return fmt.Errorf("failed to encode %s event: %w", typ, err)
+	}
+	return e.Send(DataByteEvent{ID: id, Type: typ, Data: b})
+}
+
+func (e *Emitter) Heartbeat() error {
+	return e.write([]byte(":\n\n"))
+}
+
+// Retry tells the client how long to wait before reconnecting. The field is
+// sent on its own, which clients apply without dispatching an event.
+func (e *Emitter) Retry(d time.Duration) error {
+	return e.write([]byte(fmt.Sprintf("retry: %d\n\n", d.Milliseconds())))
+}
+
+// write sends b unless an earlier write failed, and remembers the first
+// failure so every later call reports it too.
+func (e *Emitter) write(b []byte) error {
+	if e.err != nil {
+		return e.err
 	}
-	if !json.Valid(b) {
-		log.Errorf("Invalid JSON data: %s, retrying on next iteration", e.m)
-		return NewFlowError(err, true)
+	if _, err := e.w.Write(b); err != nil {
+		return e.fail(fmt.Errorf("%w: writing %s: %v", ErrClosed, e.m, err))
 	}
-	fmtErr := e.Send(DataByteEvent{ID: id, Type: typ, Data: b})
-	if fmtErr != nil {
-		log.Error("Error writing to buffer")
-		return NewFlowError(err, false)
+	if err := e.flush(); err != nil {
+		return e.fail(fmt.Errorf("%w: flushing %s: %v", ErrClosed, e.m, err))
 	}
-	return NewFlowError(nil, true)
+	return nil
 }
 
-func (e *Emitter) Heartbeat() error {
-	if _, err := e.w.WriteString(": ping\n\n"); err != nil {
-		return err
+func (e *Emitter) fail(err error) error {
+	e.err = err
+	if e.closed != nil {
+		e.closed()
 	}
-	return e.flush()
+	return err
 }
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/json"
+	"errors"
 	"testing"
 	"time"
 )
@@ -67,8 +68,8 @@ func TestSendJSON(t *testing.T) {
 	type payload struct {
 		Step int `json:"step"`
 	}
-	if flowErr := em.SendJSON("42", "progress", payload{Step: 7}); flowErr.Err != nil {
-		t.Fatalf("SendJSON returned error: %v", flowErr.Err)
+	if err := em.SendJSON("42", "progress", payload{Step: 7}); err != nil {
+		t.Fatalf("SendJSON returned error: %v", err)
 	}
 
 	got := buf.String()
@@ -125,3 +126,29 @@ func TestMultipleEvents(t *testing.T) {
 		t.Fatalf(unexpectedOutput, got, want)
 	}
 }
+
+func TestSendJSONEncodingErrorKeepsStreamOpen(t *testing.T) {
+	em, buf := newTestEmitter()
+
+	err := em.SendJSON("", "bad", func() {})
+	if err == nil || errors.Is(err, ErrClosed) {
+		t.Fatalf("SendJSON(func) = %v, want an encoding error that does not close the stream", err)
+	}
+	if err := em.Heartbeat(); err != nil {
+		t.Fatalf("Heartbeat after encoding error: %v", err)
+	}
+	if got, want := buf.String(), ":\n\n"; got != want {
+		t.Fatalf(unexpectedOutput, got, want)
+	}
+}
+
+func TestWriteFailureClosesEmitter(t *testing.T) {
+	em := NewBufioEmitter(bufio.NewWriterSize(failingWriter{}, 16), "test")
+
+	if err := em.SendJSON("", "added", map[string]string{"name": "alice"}); !errors.Is(err, ErrClosed) {
+		t.Fatalf("SendJSON on a broken connection = %v, want ErrClosed", err)
+	}
+	if err := em.Heartbeat(); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Heartbeat after a failed write = %v, want ErrClosed", err)
+	}
+}
@@ -0,0 +1,59 @@
+package sse
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2/log"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// EventError is the type of events reporting that a topic's producer is
+// failing. Clients keep their state and wait for the producer to recover.
+const EventError = "error"
+
+// ErrorEvent tells clients why a topic has stopped updating and when the
+// producer tries again. It has no key, so it is replayed from the buffer but
+// never kept in snapshots.
+type ErrorEvent struct {
+	Message   string `json:"message"`
+	RetryInMs int64  `json:"retryInMs"`
+}
+
+func (ErrorEvent) EventName() string { return EventError }
+func (ErrorEvent) EventKey() string  { return "" }
+
+// NewErrorEvent reports err, with the next attempt due after delay.
+func NewErrorEvent(err error, delay time.Duration) ErrorEvent {
+	return ErrorEvent{Message: err.Error(), RetryInMs: delay.Milliseconds()}
+}
+
+// DefaultBackoff paces producer retries: one second, doubling up to a minute.
+func DefaultBackoff() wait.Backoff {
+	return wait.Backoff{Duration: time.Second, Factor: 2, Jitter: 0.1, Steps: 8, Cap: time.Minute}
+}
+
+// Follow opens a source of events and pumps it into h until ctx is done.
+// While open fails, clients get an error event and the next attempt is
+// delayed with exponential back-off.
+func Follow[T Event](ctx context.Context, h *Hub, open func(context.Context) (<-chan T, error)) {
+	backoff := DefaultBackoff()
+	for {
+		events, err := open(ctx)
+		if err == nil {
+			Pump(ctx, h, events)
+			return
+		}
+
+		delay := backoff.Step()
+		log.Errorf("sse producer failed, retrying in %s: %v", delay, err)
+		if err := h.Publish(NewErrorEvent(err, delay)); err != nil {
+			log.Errorf("dropping event: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+}
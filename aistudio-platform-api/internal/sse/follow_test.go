@@ -0,0 +1,56 @@
+package sse
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestFollowReportsFailuresAsErrorEvents(t *testing.T) {
+	h := NewHub(4)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		Follow(ctx, h, func(context.Context) (<-chan testEvent, error) {
+			return nil, errors.New("informer cache has not synced yet")
+		})
+	}()
+
+	waitFor(t, "an error event", func() bool {
+		ch, replay := h.subscribe(startOf(h))
+		h.unsubscribe(ch)
+		return len(replay) == 1 && replay[0].Type == EventError
+	})
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Follow kept retrying after its context was cancelled")
+	}
+
+	if snapshot := replayed(h, ""); len(snapshot) != 0 {
+		t.Fatalf("snapshot = %v, want error events left out", snapshot)
+	}
+}
+
+func TestFollowPumpsOnceOpened(t *testing.T) {
+	h := NewHub(4)
+	events := make(chan testEvent, 1)
+	events <- testEvent{Kind: "added", Name: "a"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go Follow(ctx, h, func(context.Context) (<-chan testEvent, error) { return events, nil })
+
+	waitFor(t, "the event to be published", func() bool { return len(replayed(h, "")) == 1 })
+}
+
+// startOf is a Last-Event-ID that precedes every event h has published.
+func startOf(h *Hub) string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return strconv.FormatUint(h.evicted, 10)
+}
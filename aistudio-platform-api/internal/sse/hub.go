@@ -0,0 +1,274 @@
+package sse
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2/log"
+)
+
+const (
+	// HeartbeatInterval is how often Stream writes a comment line while no
+	// events are flowing. It keeps proxies from closing idle connections and
+	// surfaces clients that have gone away as a write error.
+	HeartbeatInterval = 15 * time.Second
+	// DefaultRetry is the reconnection delay advertised to clients.
+	DefaultRetry = 3 * time.Second
+	// DefaultBufferSize is how many recent events a hub keeps for replay.
+	DefaultBufferSize = 256
+
+	// EventDeleted removes an event's key from the hub snapshot.
+	EventDeleted = "deleted"
+	// EventReset tells a resuming client that its Last-Event-ID is no longer
+	// buffered and that the events following it are a full snapshot.
+	EventReset = "reset"
+
+	subscriberBuffer = 64
+)
+
+// ErrSlowClient is returned by Stream when a client fell so far behind that
+// it was dropped. It reconnects with Last-Event-ID and catches up from the
+// replay buffer.
+var ErrSlowClient = errors.New("sse client could not keep up")
+
+var errHubClosed = errors.New("sse hub is closed")
+
+// Event is a value published to a hub. EventName is the SSE event type and
+// EventKey identifies the object it describes, so the hub can keep the latest
+// event per object for clients that connect without a Last-Event-ID. Events
+// with an empty key are not part of that snapshot.
+type Event interface {
+	EventName() string
+	EventKey() string
+}
+
+type keyedEvent struct {
+	key string
+	ev  DataByteEvent
+}
+
+// Hub assigns monotonic IDs to the events of one stream, remembers the most
+// recent ones and delivers them to every connected client.
+//
+// IDs start from the current time in microseconds, so they keep increasing
+// across restarts and a stale Last-Event-ID is never mistaken for a new one.
+type Hub struct {
+	retry time.Duration
+
+	mu      sync.Mutex
+	lastID  uint64
+	evicted uint64 // ID of the newest event pushed out of the ring
+	ring    []keyedEvent
+	head    int
+	latest  map[string]DataByteEvent
+	subs    map[chan DataByteEvent]struct{}
+	closed  bool
+}
+
+// NewHub returns a hub that keeps the last size events for replay.
+func NewHub(size int) *Hub {
+	if size <= 0 {
+		size = DefaultBufferSize
+	}
+	start := uint64(time.Now().UnixMicro())
+	return &Hub{
+		retry:  DefaultRetry,
+		lastID: start,
+		// Nothing from before this hub existed can be replayed.
+		evicted: start,
+		ring:    make([]keyedEvent, 0, size),
+		latest:  make(map[string]DataByteEvent),
+		subs:    make(map[chan DataByteEvent]struct{}),
+	}
+}
+
+// Publish encodes ev, assigns it the next ID and delivers it to every client.
+func (h *Hub) Publish(ev Event) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", ev.EventName(), err)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return errHubClosed
+	}
+
+	h.lastID++
+	out := DataByteEvent{ID: strconv.FormatUint(h.lastID, 10), Type: ev.EventName(), Data: data}
+	h.remember(keyedEvent{key: ev.EventKey(), ev: out})
+
+	for ch := range h.subs {
+		select {
+		case ch <- out:
+		default:
+			// Dropping the client is cheaper than blocking every other one;
+			// it resumes from the ring buffer.
+			delete(h.subs, ch)
+			close(ch)
+		}
+	}
+	return nil
+}
+
+func (h *Hub) remember(ke keyedEvent) {
+	if len(h.ring) < cap(h.ring) {
+		h.ring = append(h.ring, ke)
+	} else {
+		h.evicted, _ = strconv.ParseUint(h.ring[h.head].ev.ID, 10, 64)
+		h.ring[h.head] = ke
+		h.head = (h.head + 1) % len(h.ring)
+	}
+
+	switch {
+	case ke.key == "":
+	case ke.ev.Type == EventDeleted:
+		delete(h.latest, ke.key)
+	default:
+		h.latest[ke.key] = ke.ev
+	}
+}
+
+// Close ends every stream once it has written the events already published.
+// Clients connecting afterwards get the replay and then the end of the
+// stream, which is how finite streams such as job progress finish.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return
+	}
+	h.closed = true
+	for ch := range h.subs {
+		delete(h.subs, ch)
+		close(ch)
+	}
+}
+
+// Stream writes the retry interval, the events the client has missed and then
+// live events with periodic heartbeats until ctx is done, the hub is closed
+// or a write fails. lastEventID is the client's Last-Event-ID header, empty
+// on first connect.
+func (h *Hub) Stream(ctx context.Context, em *Emitter, lastEventID string) error {
+	events, replay := h.subscribe(lastEventID)
+	defer h.unsubscribe(events)
+
+	if err := em.Retry(h.retry); err != nil {
+		return err
+	}
+	for _, ev := range replay {
+		if err := em.Send(ev); err != nil {
+			return err
+		}
+	}
+
+	heartbeat := time.NewTicker(HeartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case ev, ok := <-events:
+			if !ok {
+				if h.isClosed() {
+					return nil
+				}
+				return ErrSlowClient
+			}
+			if err := em.Send(ev); err != nil {
+				return err
+			}
+		case <-heartbeat.C:
+			if err := em.Heartbeat(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// subscribe registers a client and returns what it must be sent before live
+// events. Both happen under one lock so no event falls in between.
+func (h *Hub) subscribe(lastEventID string) (chan DataByteEvent, []DataByteEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ch := make(chan DataByteEvent, subscriberBuffer)
+	if h.closed {
+		close(ch)
+	} else {
+		h.subs[ch] = struct{}{}
+	}
+
+	if lastEventID == "" {
+		return ch, h.snapshot()
+	}
+	id, err := strconv.ParseUint(lastEventID, 10, 64)
+	if err != nil || id < h.evicted || id > h.lastID {
+		reset := DataByteEvent{Type: EventReset, Data: []byte("{}")}
+		return ch, append([]DataByteEvent{reset}, h.snapshot()...)
+	}
+	return ch, h.since(id)
+}
+
+func (h *Hub) isClosed() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.closed
+}
+
+func (h *Hub) unsubscribe(ch chan DataByteEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subs[ch]; ok {
+		delete(h.subs, ch)
+		close(ch)
+	}
+}
+
+// snapshot returns the latest event of every live key in ID order.
+func (h *Hub) snapshot() []DataByteEvent {
+	events := make([]DataByteEvent, 0, len(h.latest))
+	for _, ev := range h.latest {
+		events = append(events, ev)
+	}
+	sort.Slice(events, func(i, j int) bool { return eventID(events[i]) < eventID(events[j]) })
+	return events
+}
+
+// since returns the buffered events newer than id, oldest first.
+func (h *Hub) since(id uint64) []DataByteEvent {
+	var events []DataByteEvent
+	for i := range h.ring {
+		ev := h.ring[(h.head+i)%len(h.ring)].ev
+		if eventID(ev) > id {
+			events = append(events, ev)
+		}
+	}
+	return events
+}
+
+func eventID(ev DataByteEvent) uint64 {
+	id, _ := strconv.ParseUint(ev.ID, 10, 64)
+	return id
+}
+
+// Pump publishes everything received from events to h until ctx is done.
+func Pump[T Event](ctx context.Context, h *Hub, events <-chan T) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev := <-events:
+			if err := h.Publish(ev); err != nil {
+				log.Errorf("dropping event: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package sse
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type testEvent struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+}
+
+func (e testEvent) EventName() string { return e.Kind }
+func (e testEvent) EventKey() string  { return e.Name }
+
+func publish(t *testing.T, h *Hub, kind, name string) string {
+	t.Helper()
+	if err := h.Publish(testEvent{Kind: kind, Name: name}); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	return strconv.FormatUint(h.lastID, 10)
+}
+
+func replayed(h *Hub, lastEventID string) []string {
+	ch, events := h.subscribe(lastEventID)
+	h.unsubscribe(ch)
+	var out []string
+	for _, ev := range events {
+		if ev.Type == EventReset {
+			out = append(out, ev.Type)
+			continue
+		}
+		var te testEvent
+		json.Unmarshal(ev.Data, &te)
+		out = append(out, ev.Type+":"+te.Name)
+	}
+	return out
+}
+
+func assertEvents(t *testing.T, got []string, want ...string) {
+	t.Helper()
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("replayed %v, want %v", got, want)
+	}
+}
+
+func TestHubIDsIncrease(t *testing.T) {
+	h := NewHub(4)
+	first := publish(t, h, "added", "a")
+	second := publish(t, h, "modified", "a")
+	if eventID(DataByteEvent{ID: second}) != eventID(DataByteEvent{ID: first})+1 {
+		t.Fatalf("ids %s then %s, want consecutive", first, second)
+	}
+}
+
+func TestHubSnapshotForNewClients(t *testing.T) {
+	h := NewHub(4)
+	publish(t, h, "added", "a")
+	publish(t, h, "added", "b")
+	publish(t, h, "modified", "a")
+	publish(t, h, "deleted", "b")
+
+	assertEvents(t, replayed(h, ""), "modified:a")
+}
+
+func TestHubReplaysAfterLastEventID(t *testing.T) {
+	h := NewHub(4)
+	publish(t, h, "added", "a")
+	seen := publish(t, h, "added", "b")
+	publish(t, h, "deleted", "a")
+	publish(t, h, "added", "c")
+
+	assertEvents(t, replayed(h, seen), "deleted:a", "added:c")
+}
+
+func TestHubResetsWhenLastEventIDWasEvicted(t *testing.T) {
+	h := NewHub(2)
+	seen := publish(t, h, "added", "a")
+	publish(t, h, "added", "b")
+	publish(t, h, "added", "c")
+	publish(t, h, "deleted", "b")
+
+	assertEvents(t, replayed(h, seen), "reset", "added:a", "added:c")
+	assertEvents(t, replayed(h, "not-a-number"), "reset", "added:a", "added:c")
+	assertEvents(t, replayed(h, "1"), "reset", "added:a", "added:c")
+}
+
+func TestHubDropsSlowClients(t *testing.T) {
+	h := NewHub(4)
+	ch, _ := h.subscribe("")
+	for i := 0; i <= subscriberBuffer; i++ {
+		publish(t, h, "modified", "a")
+	}
+
+	n := 0
+	for range ch {
+		n++
+	}
+	if n != subscriberBuffer {
+		t.Fatalf("slow client got %d events before being dropped, want %d", n, subscriberBuffer)
+	}
+	if len(h.subs) != 0 {
+		t.Fatalf("slow client is still subscribed")
+	}
+}
+
+func TestHubStreamWritesRetryAndReplay(t *testing.T) {
+	h := NewHub(4)
+	id := publish(t, h, "added", "a")
+
+	em, buf := newTestEmitter()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := h.Stream(ctx, em, ""); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Stream returned %v, want context.Canceled", err)
+	}
+
+	want := "retry: 3000\n\n" +
+		"id: " + id + "\nevent: added\ndata: {\"kind\":\"added\",\"name\":\"a\"}\n\n"
+	if got := buf.String(); got != want {
+		t.Fatalf(unexpectedOutput, got, want)
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) { return 0, errors.New("broken pipe") }
+
+func TestHubStreamStopsWhenClientIsGone(t *testing.T) {
+	h := NewHub(4)
+	em := NewBufioEmitter(bufio.NewWriter(failingWriter{}), "test")
+
+	if err := h.Stream(context.Background(), em, ""); err == nil {
+		t.Fatal("Stream returned nil after the write failed")
+	}
+	if len(h.subs) != 0 {
+		t.Fatal("client is still subscribed after its stream ended")
+	}
+}
+
+func TestHubCloseEndsStreamsAfterReplay(t *testing.T) {
+	h := NewHub(4)
+	publish(t, h, "progress", "job")
+
+	em, buf := newTestEmitter()
+	done := make(chan error)
+	go func() { done <- h.Stream(context.Background(), em, "") }()
+
+	waitFor(t, "the subscriber", func() bool { return subscriberCount(h) == 1 })
+	h.Close()
+	if err := <-done; err != nil {
+		t.Fatalf("Stream returned %v after Close, want nil", err)
+	}
+	if !strings.Contains(buf.String(), "event: progress") {
+		t.Fatalf("stream %q is missing the replayed event", buf.String())
+	}
+
+	// Late clients still get the replay before the stream ends.
+	em, buf = newTestEmitter()
+	if err := h.Stream(context.Background(), em, ""); err != nil {
+		t.Fatalf("Stream on a closed hub returned %v", err)
+	}
+	if !strings.Contains(buf.String(), "event: progress") {
+		t.Fatalf("late stream %q is missing the replayed event", buf.String())
+	}
+	if err := h.Publish(testEvent{Kind: "progress", Name: "job"}); err == nil {
+		t.Fatal("Publish succeeded on a closed hub")
+	}
+}
+
+func subscriberCount(h *Hub) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subs)
+}
@@ -0,0 +1,54 @@
+package sse
+
+import (
+	"bufio"
+	"context"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/valyala/fasthttp"
+)
+
+// Serve answers c with the topic's event stream, resuming from the request's
+// Last-Event-ID header. The stream ends when a write to the client fails,
+// which heartbeats guarantee happens soon after it disconnects, or when the
+// broker is closed.
+func (b *Broker) Serve(c *fiber.Ctx, topic string) {
+	serve(b.ctx, c, topic, func(ctx context.Context, em *Emitter, lastEventID string) error {
+		return b.Stream(ctx, topic, em, lastEventID)
+	})
+}
+
+// Serve answers c with the hub's event stream, resuming from the request's
+// Last-Event-ID header, until the hub is closed, ctx is done or the client
+// goes away. ctx should last as long as the server, so shutting down ends
+// the stream.
+func (h *Hub) Serve(ctx context.Context, c *fiber.Ctx, label string) {
+	serve(ctx, c, label, h.Stream)
+}
+
+// serve streams to c once the handler returns. Each connection gets its own
+// context, derived from ctx and cancelled as soon as a write to the client
+// fails.
+func serve(ctx context.Context, c *fiber.Ctx, label string, stream func(ctx context.Context, em *Emitter, lastEventID string) error) {
+	lastEventID := c.Get("Last-Event-ID")
+
+	c.Set("Content-Type", "text/event-stream")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+	c.Set("Transfer-Encoding", "chunked")
+
+	c.Context().SetBodyStreamWriter(fasthttp.StreamWriter(func(w *bufio.Writer) {
+		err := streamTo(ctx, w, label, lastEventID, stream)
+		log.Debugf("%s SSE stream closed: %v", label, err)
+	}))
+}
+
+// streamTo runs stream for one connection written to w.
+func streamTo(ctx context.Context, w *bufio.Writer, label, lastEventID string, stream func(ctx context.Context, em *Emitter, lastEventID string) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	em := NewBufioEmitter(w, label)
+	em.closed = cancel
+	return stream(ctx, em, lastEventID)
+}
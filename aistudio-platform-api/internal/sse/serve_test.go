@@ -0,0 +1,78 @@
+package sse
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestServeCancelsConnectionWhenWriteFails(t *testing.T) {
+	var streamCtx context.Context
+	err := streamTo(context.Background(), bufio.NewWriter(failingWriter{}), "test", "", func(ctx context.Context, em *Emitter, _ string) error {
+		streamCtx = ctx
+		return em.Heartbeat()
+	})
+	if !errors.Is(err, ErrClosed) {
+		t.Fatalf("stream returned %v, want ErrClosed", err)
+	}
+	if streamCtx.Err() == nil {
+		t.Fatal("connection context still live after a failed write")
+	}
+}
+
+func TestHubServeEndsWithServerContext(t *testing.T) {
+	h := NewHub(4)
+	publish(t, h, "progress", "job")
+	ctx, cancel := context.WithCancel(context.Background())
+	app := fiber.New()
+	app.Get("/sse", func(c *fiber.Ctx) error {
+		h.Serve(ctx, c, "test")
+		return nil
+	})
+
+	body := make(chan string)
+	go func() {
+		resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/sse", nil), -1)
+		if err != nil {
+			body <- err.Error()
+			return
+		}
+		b, _ := io.ReadAll(resp.Body)
+		body <- string(b)
+	}()
+	waitFor(t, "the subscriber", func() bool { return subscriberCount(h) == 1 })
+	cancel()
+	if got := <-body; !strings.Contains(got, "event: progress") {
+		t.Fatalf("stream = %q, want the replayed event", got)
+	}
+	if n := subscriberCount(h); n != 0 {
+		t.Fatalf("%d subscribers left after the server context ended", n)
+	}
+}
+
+func TestBrokerServeEndsOnClose(t *testing.T) {
+	b := NewBroker()
+	b.Register("notebooks", func(ctx context.Context, h *Hub) error { return nil })
+	app := fiber.New()
+	app.Get("/sse", func(c *fiber.Ctx) error {
+		b.Serve(c, "notebooks")
+		return nil
+	})
+
+	done := make(chan error)
+	go func() {
+		_, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/sse", nil), -1)
+		done <- err
+	}()
+	waitFor(t, "the subscriber", func() bool { return subscribers(b, "notebooks") == 1 })
+	b.Close()
+	if err := <-done; err != nil {
+		t.Fatalf("stream ended with %v", err)
+	}
+}
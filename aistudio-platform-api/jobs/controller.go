@@ -0,0 +1,42 @@
+package jobs
+
+import (
+	"Kubernetes-api/helper"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// @Description	Get the status of a background job with the progress of each step and its result or error
+// @Summary		Get job status
+// @Tags		Jobs
+// @Produce		json
+// @Param		id path string true "Job ID"
+// @Router		/api/jobs/{id} [get]
+func (m *Manager) GetJob(c *fiber.Ctx) error {
+	job, ok := m.Get(c.Params("id"))
+	if !ok {
+		return helper.SendResponse(c, "Job not found", nil, fiber.StatusNotFound)
+	}
+	return helper.SendResponse(c, "Job retrieved successfully", job, fiber.StatusOK)
+}
+
+// @Description	Stream the progress of a background job as server sent events. Every event carries the whole job; the stream ends after the final succeeded or failed event
+// @Summary		Get job progress server sent events
+// @Tags		Jobs
+// @Produce		text/event-stream
+// @Param		id path string true "Job ID"
+// @Router		/api/jobs/{id}/sse [get]
+func (m *Manager) GetJobSse(c *fiber.Ctx) error {
+	hub, ok := m.hub(c.Params("id"))
+	if !ok {
+		return helper.SendResponse(c, "Job not found", nil, fiber.StatusNotFound)
+	}
+	hub.Serve(m.ctx, c, "job")
+	return nil
+}
+
+// Accepted answers a request that started job with 202 and where to follow it.
+func Accepted(c *fiber.Ctx, message string, job Job) error {
+	c.Location("/api/jobs/" + job.ID)
+	return helper.SendResponse(c, message, job, fiber.StatusAccepted)
+}
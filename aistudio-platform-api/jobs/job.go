@@ -0,0 +1,317 @@
+// Package jobs runs long provisioning operations in the background so the
+// endpoints that start them can answer straight away with a job to poll.
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2/log"
+	"k8s.io/apimachinery/pkg/util/uuid"
+
+	"Kubernetes-api/internal/sse"
+)
+
+// Status is the state of a job or of one of its steps.
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+	StatusSkipped   Status = "skipped"
+	// StatusRolledBack marks a step whose work was undone after a later step
+	// failed.
+	StatusRolledBack Status = "rolled-back"
+)
+
+// Names of the steps provisioning jobs are made of, so clients can show the
+// same labels for every kind of job.
+const (
+	StepResourceCheck = "resource-check"
+	StepPVC           = "pvc"
+	StepCopy          = "copy"
+	StepService       = "service"
+	StepSecret        = "secret"
+	StepDeployment    = "deployment"
+	StepIngress       = "ingress"
+	StepRollout       = "rollout"
+)
+
+// finishedRetention is how long a finished job can still be looked up.
+const finishedRetention = time.Hour
+
+// Step is one unit of a job's work. Undo, when set, reverses Run and is
+// called if a later step fails, so a failed job leaves nothing half-created.
+type Step struct {
+	Name string
+	Run  func(ctx context.Context) error
+	Undo func(ctx context.Context) error
+}
+
+// Run runs steps in order and returns the first failure. Before returning it
+// undoes the steps that already succeeded, newest first; undo failures are
+// joined to the returned error.
+func Run(ctx context.Context, steps []Step) error {
+	for i, step := range steps {
+		if err := step.Run(ctx); err != nil {
+			err = fmt.Errorf("%s: %w", step.Name, err)
+			for k := i - 1; k >= 0; k-- {
+				if undoErr := undo(ctx, steps[k]); undoErr != nil {
+					err = errors.Join(err, undoErr)
+				}
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Finally returns steps that call done once the job running them stops: as
+// soon as a step fails, or after the last one succeeds. It suits holds such
+// as quota reservations, which must outlive the request that submitted the
+// job but not the job itself.
+func Finally(steps []Step, done func()) []Step {
+	if len(steps) == 0 {
+		done()
+		return steps
+	}
+	out := make([]Step, len(steps))
+	for i, step := range steps {
+		run, last := step.Run, i == len(steps)-1
+		step.Run = func(ctx context.Context) error {
+			err := run(ctx)
+			if err != nil || last {
+				done()
+			}
+			return err
+		}
+		out[i] = step
+	}
+	return out
+}
+
+func undo(ctx context.Context, step Step) error {
+	if step.Undo == nil {
+		return nil
+	}
+	if err := step.Undo(ctx); err != nil {
+		log.Errorf("undoing step %s: %v", step.Name, err)
+		return fmt.Errorf("undoing %s: %w", step.Name, err)
+	}
+	return nil
+}
+
+// StepStatus reports the progress of one step.
+type StepStatus struct {
+	Name       string     `json:"name"`
+	Status     Status     `json:"status"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  *time.Time `json:"startedAt,omitempty"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+}
+
+// Job is a snapshot of a background operation.
+type Job struct {
+	ID         string       `json:"id"`
+	Kind       string       `json:"kind"`
+	Status     Status       `json:"status"`
+	Steps      []StepStatus `json:"steps"`
+	Result     any          `json:"result,omitempty"`
+	Error      string       `json:"error,omitempty"`
+	CreatedAt  time.Time    `json:"createdAt"`
+	FinishedAt *time.Time   `json:"finishedAt,omitempty"`
+}
+
+// Finished reports whether the job has stopped running.
+func (j Job) Finished() bool {
+	return j.Status == StatusSucceeded || j.Status == StatusFailed
+}
+
+// jobEvent is the SSE form of a job snapshot. Every event carries the whole
+// job, so clients only ever need the latest one.
+type jobEvent struct {
+	Job
+	typ string
+}
+
+func (e jobEvent) EventName() string { return e.typ }
+func (e jobEvent) EventKey() string  { return "job" }
+
+// Manager keeps the jobs started by this process in memory.
+type Manager struct {
+	// ctx ends the job streams when the manager is closed.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu   sync.Mutex
+	jobs map[string]*entry
+}
+
+type entry struct {
+	job Job
+	hub *sse.Hub
+}
+
+func NewManager() *Manager {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Manager{ctx: ctx, cancel: cancel, jobs: make(map[string]*entry)}
+}
+
+// Close ends every open job stream, so a server shutting down need not wait
+// for the jobs they follow. Jobs keep running and can still be read.
+func (m *Manager) Close() {
+	m.cancel()
+}
+
+// Submit starts running steps in order in the background and returns the new
+// job. The job stops at the first failing step and undoes the steps before
+// it; result is reported once every step has succeeded.
+func (m *Manager) Submit(kind string, steps []Step, result any) Job {
+	now := time.Now()
+	job := Job{
+		ID:        string(uuid.NewUUID()),
+		Kind:      kind,
+		Status:    StatusPending,
+		Steps:     make([]StepStatus, len(steps)),
+		CreatedAt: now,
+	}
+	for i, step := range steps {
+		job.Steps[i] = StepStatus{Name: step.Name, Status: StatusPending}
+	}
+
+	e := &entry{job: job, hub: sse.NewHub(len(steps)*3 + 2)}
+	m.mu.Lock()
+	m.prune(now)
+	m.jobs[job.ID] = e
+	accepted := e.snapshot()
+	m.mu.Unlock()
+	m.publish(e, "progress")
+
+	go m.run(e, steps, result)
+	return accepted
+}
+
+// Get returns the job with the given ID.
+func (m *Manager) Get(id string) (Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return e.snapshot(), true
+}
+
+func (m *Manager) hub(id string) (*sse.Hub, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.jobs[id]
+	if !ok {
+		return nil, false
+	}
+	return e.hub, true
+}
+
+func (m *Manager) run(e *entry, steps []Step, result any) {
+	ctx := context.Background()
+	m.update(e, func(j *Job) { j.Status = StatusRunning })
+
+	for i, step := range steps {
+		m.update(e, func(j *Job) {
+			now := time.Now()
+			j.Steps[i].Status, j.Steps[i].StartedAt = StatusRunning, &now
+		})
+
+		err := step.Run(ctx)
+		if err != nil {
+			log.Errorf("job %s (%s) failed at step %s: %v", e.job.ID, e.job.Kind, step.Name, err)
+		}
+		m.update(e, func(j *Job) {
+			now := time.Now()
+			j.Steps[i].FinishedAt = &now
+			if err == nil {
+				j.Steps[i].Status = StatusSucceeded
+				return
+			}
+			j.Steps[i].Status, j.Steps[i].Error = StatusFailed, err.Error()
+			for k := i + 1; k < len(j.Steps); k++ {
+				j.Steps[k].Status = StatusSkipped
+			}
+		})
+		if err != nil {
+			m.rollback(ctx, e, steps[:i])
+			m.update(e, func(j *Job) {
+				now := time.Now()
+				j.Status, j.Error, j.FinishedAt = StatusFailed, err.Error(), &now
+			})
+			e.hub.Close()
+			return
+		}
+	}
+
+	m.update(e, func(j *Job) {
+		now := time.Now()
+		j.Status, j.Result, j.FinishedAt = StatusSucceeded, result, &now
+	})
+	e.hub.Close()
+}
+
+// rollback undoes the steps that succeeded before a failure, newest first.
+func (m *Manager) rollback(ctx context.Context, e *entry, done []Step) {
+	for i := len(done) - 1; i >= 0; i-- {
+		if done[i].Undo == nil {
+			continue
+		}
+		err := undo(ctx, done[i])
+		m.update(e, func(j *Job) {
+			if err != nil {
+				j.Steps[i].Error = err.Error()
+				return
+			}
+			j.Steps[i].Status = StatusRolledBack
+		})
+	}
+}
+
+// update applies change to the job and tells its subscribers.
+func (m *Manager) update(e *entry, change func(j *Job)) {
+	m.mu.Lock()
+	change(&e.job)
+	typ := "progress"
+	if e.job.Finished() {
+		typ = string(e.job.Status)
+	}
+	m.mu.Unlock()
+	m.publish(e, typ)
+}
+
+func (m *Manager) publish(e *entry, typ string) {
+	m.mu.Lock()
+	job := e.snapshot()
+	m.mu.Unlock()
+	if err := e.hub.Publish(jobEvent{Job: job, typ: typ}); err != nil {
+		log.Errorf("publishing job %s: %v", job.ID, err)
+	}
+}
+
+// snapshot copies the job so callers can read it without holding the lock.
+func (e *entry) snapshot() Job {
+	job := e.job
+	job.Steps = append([]StepStatus(nil), e.job.Steps...)
+	return job
+}
+
+// prune forgets jobs that finished more than finishedRetention ago. m.mu
+// must be held.
+func (m *Manager) prune(now time.Time) {
+	for id, e := range m.jobs {
+		if e.job.FinishedAt != nil && now.Sub(*e.job.FinishedAt) > finishedRetention {
+			delete(m.jobs, id)
+		}
+	}
+}
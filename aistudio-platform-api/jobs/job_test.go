@@ -0,0 +1,177 @@
+package jobs_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"Kubernetes-api/internal/kubetest"
+	"Kubernetes-api/jobs"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func step(name string, err error, ran *[]string) jobs.Step {
+	return jobs.Step{Name: name, Run: func(context.Context) error {
+		*ran = append(*ran, name)
+		return err
+	}}
+}
+
+func TestJobStopsAtFirstFailingStep(t *testing.T) {
+	h := kubetest.New()
+	app := h.App(func(fiber.Router) {})
+
+	var ran []string
+	job := h.Jobs.Submit("test", []jobs.Step{
+		step(jobs.StepResourceCheck, nil, &ran),
+		step(jobs.StepService, errors.New("quota exceeded"), &ran),
+		step(jobs.StepDeployment, nil, &ran),
+	}, "unused")
+
+	status, resp := kubetest.Do(t, app, fiber.MethodGet, "/api/jobs/"+job.ID, nil)
+	if status != fiber.StatusOK {
+		t.Fatalf("get returned %d %+v", status, resp)
+	}
+
+	job = h.WaitJob(t, resp)
+	if job.Status != jobs.StatusFailed || job.Error != "quota exceeded" || job.Result != nil {
+		t.Fatalf("job = %+v, want failed with the step error and no result", job)
+	}
+	want := []jobs.Status{jobs.StatusSucceeded, jobs.StatusFailed, jobs.StatusSkipped}
+	for i, s := range job.Steps {
+		if s.Status != want[i] {
+			t.Errorf("step %s is %s, want %s", s.Name, s.Status, want[i])
+		}
+	}
+	if len(ran) != 2 {
+		t.Errorf("ran %v, want the steps after the failure skipped", ran)
+	}
+}
+
+func TestRunUndoesCompletedSteps(t *testing.T) {
+	var undone []string
+	reversible := func(name string, err error) jobs.Step {
+		return jobs.Step{
+			Name: name,
+			Run:  func(context.Context) error { return err },
+			Undo: func(context.Context) error { undone = append(undone, name); return nil },
+		}
+	}
+
+	err := jobs.Run(context.Background(), []jobs.Step{
+		reversible(jobs.StepService, nil),
+		reversible(jobs.StepDeployment, nil),
+		reversible(jobs.StepIngress, errors.New("ingress not found")),
+	})
+	if err == nil || !strings.Contains(err.Error(), "ingress: ingress not found") {
+		t.Fatalf("Run returned %v, want the ingress failure", err)
+	}
+	if want := []string{jobs.StepDeployment, jobs.StepService}; !reflect.DeepEqual(undone, want) {
+		t.Fatalf("undone %v, want %v", undone, want)
+	}
+}
+
+func TestJobRollsBackOnFailure(t *testing.T) {
+	h := kubetest.New()
+	app := h.App(func(fiber.Router) {})
+
+	var undone bool
+	job := h.Jobs.Submit("test", []jobs.Step{
+		{Name: jobs.StepService, Run: func(context.Context) error { return nil }, Undo: func(context.Context) error { undone = true; return nil }},
+		{Name: jobs.StepDeployment, Run: func(context.Context) error { return errors.New("forbidden") }},
+	}, nil)
+
+	_, resp := kubetest.Do(t, app, fiber.MethodGet, "/api/jobs/"+job.ID, nil)
+	job = h.WaitJob(t, resp)
+	if !undone || job.Steps[0].Status != jobs.StatusRolledBack || job.Status != jobs.StatusFailed {
+		t.Fatalf("job = %+v, want the service step rolled back", job)
+	}
+}
+
+func TestFinallyCallsDoneWhenStepsStop(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		failAt  string
+		wantRan int
+	}{
+		{"success", "", 3},
+		{"failure", jobs.StepService, 2},
+	} {
+		var ran []string
+		done := 0
+		steps := []jobs.Step{
+			step(jobs.StepResourceCheck, nil, &ran),
+			step(jobs.StepService, nil, &ran),
+			step(jobs.StepDeployment, nil, &ran),
+		}
+		if tc.failAt != "" {
+			steps[1] = step(tc.failAt, errors.New("denied"), &ran)
+		}
+		steps = jobs.Finally(steps, func() {
+			if len(ran) != tc.wantRan {
+				t.Errorf("%s: done called after %v", tc.name, ran)
+			}
+			done++
+		})
+		jobs.Run(context.TODO(), steps)
+		if done != 1 {
+			t.Errorf("%s: done called %d times, want once", tc.name, done)
+		}
+	}
+}
+
+func TestJobStreamEndsWithFinalState(t *testing.T) {
+	h := kubetest.New()
+	app := h.App(func(fiber.Router) {})
+
+	var ran []string
+	job := h.Jobs.Submit("test", []jobs.Step{step(jobs.StepPVC, nil, &ran)}, map[string]string{"url": "http://demo"})
+	_, resp := kubetest.Do(t, app, fiber.MethodGet, "/api/jobs/"+job.ID, nil)
+	h.WaitJob(t, resp)
+
+	stream, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/api/jobs/"+job.ID+"/sse", nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(stream.Body)
+	if !strings.Contains(string(body), "event: succeeded") || !strings.Contains(string(body), `"url":"http://demo"`) {
+		t.Fatalf("stream = %q, want the succeeded job with its result", body)
+	}
+}
+
+func TestCloseEndsStreamsOfRunningJobs(t *testing.T) {
+	h := kubetest.New()
+	app := h.App(func(fiber.Router) {})
+
+	release := make(chan struct{})
+	defer close(release)
+	job := h.Jobs.Submit("test", []jobs.Step{{Name: jobs.StepPVC, Run: func(context.Context) error {
+		<-release
+		return nil
+	}}}, nil)
+
+	done := make(chan error)
+	go func() {
+		_, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/api/jobs/"+job.ID+"/sse", nil), -1)
+		done <- err
+	}()
+	// Closing before the stream subscribes ends it as soon as it does.
+	h.Jobs.Close()
+	if err := <-done; err != nil {
+		t.Fatalf("stream ended with %v", err)
+	}
+}
+
+func TestUnknownJob(t *testing.T) {
+	h := kubetest.New()
+	app := h.App(func(fiber.Router) {})
+
+	if status, _ := kubetest.Do(t, app, fiber.MethodGet, "/api/jobs/missing", nil); status != fiber.StatusNotFound {
+		t.Fatalf("status = %d, want 404", status)
+	}
+}
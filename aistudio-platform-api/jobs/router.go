@@ -0,0 +1,11 @@
+package jobs
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+func SetupRoutes(router fiber.Router, m *Manager) {
+	jobs := router.Group("/jobs")
+	jobs.Get("/:id", m.GetJob)
+	jobs.Get("/:id/sse", m.GetJobSse)
+}
@@ -0,0 +1,250 @@
+package kubeutils
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	cacheResync       = 10 * time.Minute
+	podNodeIndex      = "spec.nodeName"
+	eventObjectIndex  = "involvedObject"
+	nodeFieldSelector = "spec.nodeName="
+)
+
+// Cache holds shared informers for the objects every read endpoint needs, so
+// listing notebooks, accounting node resources and feeding SSE streams read
+// from memory instead of the API server.
+type Cache struct {
+	factory      informers.SharedInformerFactory
+	nodes        corelisters.NodeLister
+	pods         corelisters.PodLister
+	podIndexer   cache.Indexer
+	deployments  appslisters.DeploymentLister
+	statefulsets appslisters.StatefulSetLister
+	claims       corelisters.PersistentVolumeClaimLister
+	events       cache.Indexer
+}
+
+func newCache(clientset kubernetes.Interface) (*Cache, error) {
+	factory := informers.NewSharedInformerFactory(clientset, cacheResync)
+
+	podInformer := factory.Core().V1().Pods().Informer()
+	if err := podInformer.AddIndexers(cache.Indexers{podNodeIndex: indexPodByNode}); err != nil {
+		return nil, fmt.Errorf("failed to index pods by node: %w", err)
+	}
+	eventInformer := factory.Core().V1().Events().Informer()
+	if err := eventInformer.AddIndexers(cache.Indexers{eventObjectIndex: indexEventByObject}); err != nil {
+		return nil, fmt.Errorf("failed to index events by object: %w", err)
+	}
+
+	return &Cache{
+		factory:      factory,
+		nodes:        factory.Core().V1().Nodes().Lister(),
+		pods:         factory.Core().V1().Pods().Lister(),
+		podIndexer:   podInformer.GetIndexer(),
+		deployments:  factory.Apps().V1().Deployments().Lister(),
+		statefulsets: factory.Apps().V1().StatefulSets().Lister(),
+		claims:       factory.Core().V1().PersistentVolumeClaims().Lister(),
+		events:       eventInformer.GetIndexer(),
+	}, nil
+}
+
+func indexPodByNode(obj interface{}) ([]string, error) {
+	pod, ok := obj.(*v1.Pod)
+	if !ok || pod.Spec.NodeName == "" {
+		return nil, nil
+	}
+	return []string{pod.Spec.NodeName}, nil
+}
+
+func indexEventByObject(obj interface{}) ([]string, error) {
+	event, ok := obj.(*v1.Event)
+	if !ok {
+		return nil, nil
+	}
+	return []string{event.Namespace + "/" + event.InvolvedObject.Name}, nil
+}
+
+// StartCache starts the informers and blocks until they have synced or ctx
+// is done. Reads fall back to the API server until it returns successfully,
+// so callers that must not block on an unreachable cluster can run it in a
+// goroutine.
+func (kc *KubernetesConfig) StartCache(ctx context.Context) error {
+	c, err := newCache(kc.Clientset)
+	if err != nil {
+		return err
+	}
+	c.factory.Start(ctx.Done())
+	for typ, synced := range c.factory.WaitForCacheSync(ctx.Done()) {
+		if !synced {
+			return fmt.Errorf("failed to sync %v informer", typ)
+		}
+	}
+	kc.cache.Store(c)
+	return nil
+}
+
+// CacheSynced reports whether reads are being served from the informers.
+func (kc *KubernetesConfig) CacheSynced() bool {
+	return kc.cache.Load() != nil
+}
+
+func (kc *KubernetesConfig) listNodes(ctx context.Context) ([]*v1.Node, error) {
+	if c := kc.cache.Load(); c != nil {
+		return c.nodes.List(labels.Everything())
+	}
+	list, err := kc.Clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	nodes := make([]*v1.Node, len(list.Items))
+	for i := range list.Items {
+		nodes[i] = &list.Items[i]
+	}
+	return nodes, nil
+}
+
+// listPods returns the pods in namespace ("" for all) matching selector.
+func (kc *KubernetesConfig) listPods(ctx context.Context, namespace string, selector labels.Selector) ([]*v1.Pod, error) {
+	if c := kc.cache.Load(); c != nil {
+		return c.pods.Pods(namespace).List(selector)
+	}
+	list, err := kc.Clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, err
+	}
+	return podPointers(list.Items), nil
+}
+
+func (kc *KubernetesConfig) podsOnNode(ctx context.Context, nodeName string) ([]*v1.Pod, error) {
+	if c := kc.cache.Load(); c != nil {
+		objs, err := c.podIndexer.ByIndex(podNodeIndex, nodeName)
+		if err != nil {
+			return nil, err
+		}
+		pods := make([]*v1.Pod, 0, len(objs))
+		for _, obj := range objs {
+			pods = append(pods, obj.(*v1.Pod))
+		}
+		return pods, nil
+	}
+	list, err := kc.Clientset.CoreV1().Pods("").List(ctx, metav1.ListOptions{
+		FieldSelector: nodeFieldSelector + nodeName,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return podPointers(list.Items), nil
+}
+
+func (kc *KubernetesConfig) getDeployment(ctx context.Context, namespace, name string) (*appsv1.Deployment, error) {
+	if c := kc.cache.Load(); c != nil {
+		return c.deployments.Deployments(namespace).Get(name)
+	}
+	return kc.Clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+}
+
+func (kc *KubernetesConfig) getStatefulSet(ctx context.Context, namespace, name string) (*appsv1.StatefulSet, error) {
+	if c := kc.cache.Load(); c != nil {
+		return c.statefulsets.StatefulSets(namespace).Get(name)
+	}
+	return kc.Clientset.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+}
+
+// listStatefulSets returns the statefulsets in namespace ("" for all)
+// matching selector.
+func (kc *KubernetesConfig) listStatefulSets(ctx context.Context, namespace string, selector labels.Selector) ([]*appsv1.StatefulSet, error) {
+	if c := kc.cache.Load(); c != nil {
+		return c.statefulsets.StatefulSets(namespace).List(selector)
+	}
+	list, err := kc.Clientset.AppsV1().StatefulSets(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*appsv1.StatefulSet, len(list.Items))
+	for i := range list.Items {
+		out[i] = &list.Items[i]
+	}
+	return out, nil
+}
+
+// listDeployments returns the deployments in namespace ("" for all)
+// matching selector.
+func (kc *KubernetesConfig) listDeployments(ctx context.Context, namespace string, selector labels.Selector) ([]*appsv1.Deployment, error) {
+	if c := kc.cache.Load(); c != nil {
+		return c.deployments.Deployments(namespace).List(selector)
+	}
+	list, err := kc.Clientset.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*appsv1.Deployment, len(list.Items))
+	for i := range list.Items {
+		out[i] = &list.Items[i]
+	}
+	return out, nil
+}
+
+// listClaims returns the volume claims in namespace ("" for all) matching
+// selector.
+func (kc *KubernetesConfig) listClaims(ctx context.Context, namespace string, selector labels.Selector) ([]*v1.PersistentVolumeClaim, error) {
+	if c := kc.cache.Load(); c != nil {
+		return c.claims.PersistentVolumeClaims(namespace).List(selector)
+	}
+	list, err := kc.Clientset.CoreV1().PersistentVolumeClaims(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*v1.PersistentVolumeClaim, len(list.Items))
+	for i := range list.Items {
+		out[i] = &list.Items[i]
+	}
+	return out, nil
+}
+
+// eventsFor returns the events recorded against the object called name in
+// namespace.
+func (kc *KubernetesConfig) eventsFor(ctx context.Context, namespace, name string) ([]*v1.Event, error) {
+	if c := kc.cache.Load(); c != nil {
+		objs, err := c.events.ByIndex(eventObjectIndex, namespace+"/"+name)
+		if err != nil {
+			return nil, err
+		}
+		events := make([]*v1.Event, 0, len(objs))
+		for _, obj := range objs {
+			events = append(events, obj.(*v1.Event))
+		}
+		return events, nil
+	}
+	list, err := kc.Clientset.CoreV1().Events(namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: fmt.Sprintf("involvedObject.name=%s", name),
+	})
+	if err != nil {
+		return nil, err
+	}
+	events := make([]*v1.Event, len(list.Items))
+	for i := range list.Items {
+		events[i] = &list.Items[i]
+	}
+	return events, nil
+}
+
+func podPointers(items []v1.Pod) []*v1.Pod {
+	pods := make([]*v1.Pod, len(items))
+	for i := range items {
+		pods[i] = &items[i]
+	}
+	return pods
+}
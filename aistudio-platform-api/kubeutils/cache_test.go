@@ -0,0 +1,71 @@
+package kubeutils_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"Kubernetes-api/internal/kubetest"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// failLists makes every list against the fake API server fail, so a passing
+// read proves it was served from the informers.
+func failLists(h *kubetest.Harness) {
+	h.Clientset.PrependReactor("list", "*", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("api server should not be listed")
+	})
+}
+
+func TestReadsAreServedFromCache(t *testing.T) {
+	h := kubetest.New(
+		kubetest.Node("node-a", "4", "16Gi", ""),
+		kubetest.Node("node-b", "4", "16Gi", ""),
+		kubetest.Pod("lab", "alice-0", "alice", "node-a", "3", "2Gi"),
+	)
+	h.StartCache(t)
+	failLists(h)
+
+	pods, err := h.Kube.ListPods("lab")
+	if err != nil || len(pods) != 1 {
+		t.Fatalf("ListPods = %v, %v", pods, err)
+	}
+
+	resources, err := h.Kube.GetRemainingNodeResources()
+	if err != nil {
+		t.Fatalf("GetRemainingNodeResources: %v", err)
+	}
+	free := map[string]string{}
+	for _, r := range resources {
+		free[r.IP] = r.CPU
+	}
+	if free["node-a"] != "1" || free["node-b"] != "4" {
+		t.Fatalf("free cpu per node = %v, want pods counted only on their own node", free)
+	}
+}
+
+func TestCacheFollowsClusterChanges(t *testing.T) {
+	h := kubetest.New()
+	h.StartCache(t)
+
+	pod := kubetest.Pod("lab", "bob-0", "bob", "node-a", "1", "1Gi")
+	if _, err := h.Clientset.CoreV1().Pods("lab").Create(context.TODO(), pod, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		detail, err := h.Kube.GetPodDetail("bob", "lab")
+		if err == nil && detail["name"] == "bob-0" {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("pod never reached the cache: %v, %v", detail, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
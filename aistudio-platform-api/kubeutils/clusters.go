@@ -2,107 +2,273 @@ package kubeutils
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
 	"strings"
 
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
 )
 
+// VendorConfig is the profile of a Kubernetes distribution: the node labels
+// it puts instance types, capacity types and node groups under, the GPU
+// resources its nodes advertise, and how to recognise its nodes. Profiles
+// can be loaded from YAML with LoadVendorProfiles, using the JSON names.
 type VendorConfig struct {
-	InstanceTypeLabel   string
-	CapacityTypeLabel   string
-	NodeGroupLabel      string
-	NodeSelectorPrefix  string
-	GPUVendorLabel      string
-	FieldSelectorPrefix string
+	Name                string `json:"name"`
+	InstanceTypeLabel   string `json:"instanceTypeLabel"`
+	CapacityTypeLabel   string `json:"capacityTypeLabel"`
+	NodeGroupLabel      string `json:"nodeGroupLabel"`
+	NodeSelectorPrefix  string `json:"selectorKey"`
+	GPUVendorLabel      string `json:"gpuResource"`
+	FieldSelectorPrefix string `json:"fieldSelectorPrefix"`
+	// GPUResources lists every GPU resource name the vendor's nodes may
+	// advertise. GPUVendorLabel is the one new workloads request.
+	GPUResources []string `json:"gpuResources"`
+	// Detect matches the profile when any rule matches any node.
+	Detect []DetectionRule `json:"detect"`
 }
 
-var VendorConfigs = map[string]VendorConfig{
-	"eks": {
-		InstanceTypeLabel:   "beta.kubernetes.io/instance-type",
-		CapacityTypeLabel:   "eks.amazonaws.com/capacityType",
-		NodeGroupLabel:      "eks.amazonaws.com/nodegroup",
-		NodeSelectorPrefix:  "type",
-		GPUVendorLabel:      "nvidia.com/gpu",
-		FieldSelectorPrefix: "spec.nodeName=",
+// DetectionRule recognises a node of a distribution. Every condition that
+// is set must hold.
+type DetectionRule struct {
+	// NodeLabels are label keys that must all be present.
+	NodeLabels []string `json:"nodeLabels,omitempty"`
+	// ProviderIDPrefix must start the node's spec.providerID.
+	ProviderIDPrefix string `json:"providerIDPrefix,omitempty"`
+	// KubeletVersionContains must appear in the node's kubelet version,
+	// such as "+k3s".
+	KubeletVersionContains string `json:"kubeletVersionContains,omitempty"`
+	// NoProviderID requires spec.providerID to be empty, as it is on
+	// bare-metal clusters without a cloud provider.
+	NoProviderID bool `json:"noProviderID,omitempty"`
+}
+
+// VendorProfiles is the YAML document LoadVendorProfiles reads.
+type VendorProfiles struct {
+	Profiles []VendorConfig `json:"profiles"`
+}
+
+const (
+	defaultSelectorKey    = "type"
+	defaultGPUResource    = "nvidia.com/gpu"
+	defaultFieldSelector  = "spec.nodeName="
+	standardInstanceLabel = "node.kubernetes.io/instance-type"
+)
+
+// GenericVendorProfile is used when no profile matches the cluster's
+// nodes. It relies only on well-known Kubernetes labels.
+var GenericVendorProfile = VendorConfig{
+	Name:                "generic",
+	InstanceTypeLabel:   standardInstanceLabel,
+	NodeSelectorPrefix:  defaultSelectorKey,
+	GPUVendorLabel:      defaultGPUResource,
+	FieldSelectorPrefix: defaultFieldSelector,
+	GPUResources:        []string{defaultGPUResource},
+}
+
+// DefaultVendorProfiles are the built-in profiles, tried in order.
+var DefaultVendorProfiles = []VendorConfig{
+	{
+		Name:              "eks",
+		InstanceTypeLabel: "beta.kubernetes.io/instance-type",
+		CapacityTypeLabel: "eks.amazonaws.com/capacityType",
+		NodeGroupLabel:    "eks.amazonaws.com/nodegroup",
+		Detect: []DetectionRule{
+			{NodeLabels: []string{"eks.amazonaws.com/nodegroup"}},
+			{ProviderIDPrefix: "aws://"},
+		},
+	},
+	{
+		Name:              "gke",
+		InstanceTypeLabel: standardInstanceLabel,
+		CapacityTypeLabel: "cloud.google.com/gke-preemptible",
+		NodeGroupLabel:    "cloud.google.com/gke-nodepool",
+		Detect: []DetectionRule{
+			{NodeLabels: []string{"cloud.google.com/gke-nodepool"}},
+			{ProviderIDPrefix: "gce://"},
+		},
+	},
+	{
+		Name:              "aks",
+		InstanceTypeLabel: standardInstanceLabel,
+		CapacityTypeLabel: "kubernetes.azure.com/scalesetpriority",
+		NodeGroupLabel:    "kubernetes.azure.com/agentpool",
+		Detect: []DetectionRule{
+			{NodeLabels: []string{"kubernetes.azure.com/agentpool"}},
+			{ProviderIDPrefix: "azure://"},
+		},
+	},
+	{
+		Name:              "openshift",
+		InstanceTypeLabel: standardInstanceLabel,
+		NodeGroupLabel:    "machine.openshift.io/machineset",
+		Detect: []DetectionRule{
+			{NodeLabels: []string{"node.openshift.io/os_id"}},
+		},
 	},
-	"gke": {
-		InstanceTypeLabel:   "node.kubernetes.io/instance-type",
-		CapacityTypeLabel:   "cloud.google.com/gke-preemptible",
-		NodeGroupLabel:      "cloud.google.com/gke-nodepool",
-		NodeSelectorPrefix:  "type",
-		GPUVendorLabel:      "nvidia.com/gpu",
-		FieldSelectorPrefix: "spec.nodeName=",
+	{
+		Name:              "minikube",
+		InstanceTypeLabel: "minikube.k8s.io/instance-type",
+		CapacityTypeLabel: "kubernetes.io/os",
+		NodeGroupLabel:    "minikube.k8s.io/version",
+		Detect: []DetectionRule{
+			{NodeLabels: []string{"minikube.k8s.io/version"}},
+		},
 	},
-	"aks": {
-		InstanceTypeLabel:   "node.kubernetes.io/instance-type",
-		CapacityTypeLabel:   "kubernetes.azure.com/scalesetpriority",
-		NodeGroupLabel:      "kubernetes.azure.com/agentpool",
-		NodeSelectorPrefix:  "type",
-		GPUVendorLabel:      "nvidia.com/gpu",
-		FieldSelectorPrefix: "spec.nodeName=",
+	{
+		Name:              "k3s",
+		InstanceTypeLabel: standardInstanceLabel,
+		NodeGroupLabel:    "kubernetes.io/hostname",
+		Detect: []DetectionRule{
+			{ProviderIDPrefix: "k3s://"},
+			{KubeletVersionContains: "+k3s"},
+		},
 	},
-	"minikube": {
-		InstanceTypeLabel:   "minikube.k8s.io/instance-type",
-		CapacityTypeLabel:   "kubernetes.io/os",
-		NodeGroupLabel:      "minikube.k8s.io/version",
-		NodeSelectorPrefix:  "type",
-		GPUVendorLabel:      "nvidia.com/gpu",
-		FieldSelectorPrefix: "spec.nodeName=",
+	{
+		Name:              "kind",
+		InstanceTypeLabel: standardInstanceLabel,
+		NodeGroupLabel:    "kubernetes.io/hostname",
+		Detect: []DetectionRule{
+			{ProviderIDPrefix: "kind://"},
+		},
+	},
+	{
+		Name:              "onprem",
+		InstanceTypeLabel: standardInstanceLabel,
+		NodeGroupLabel:    "node-role.kubernetes.io/worker",
+		Detect: []DetectionRule{
+			{NoProviderID: true},
+		},
 	},
 }
 
-func (kc *KubernetesConfig) getClusterType() (string, error) {
-
-	nodes, err := kc.Clientset.CoreV1().Nodes().List(context.Background(), metav1.ListOptions{})
+// LoadVendorProfiles reads profiles from the YAML file at path. Fields a
+// profile leaves empty take the generic profile's values. The result lists
+// the file's profiles first, followed by the built-in profiles the file
+// does not redefine by name, so it can be passed to Options.VendorProfiles
+// as is.
+func LoadVendorProfiles(path string) ([]VendorConfig, error) {
+	data, err := os.ReadFile(path)
 	if err != nil {
-		return "", fmt.Errorf("failed to list nodes: %w", err)
+		return nil, fmt.Errorf("failed to read vendor profiles: %w", err)
 	}
-
-	if len(nodes.Items) == 0 {
-		return "unknown", nil
+	var doc VendorProfiles
+	if err := yaml.UnmarshalStrict(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse vendor profiles %s: %w", path, err)
 	}
 
-	for _, node := range nodes.Items {
-		labels := node.GetLabels()
-
-		if _, ok := labels["eks.amazonaws.com/nodegroup"]; ok {
-			return "eks", nil
-		}
-		if _, ok := labels["cloud.google.com/gke-nodepool"]; ok {
-			return "gke", nil
-		}
-		if _, ok := labels["kubernetes.azure.com/agentpool"]; ok {
-			return "aks", nil
+	defined := map[string]bool{}
+	var profiles []VendorConfig
+	for i, p := range doc.Profiles {
+		if p.Name == "" {
+			return nil, fmt.Errorf("vendor profile %d in %s has no name", i, path)
 		}
-		if _, ok := labels["minikube.k8s.io/version"]; ok {
-			return "minikube", nil
+		defined[p.Name] = true
+		profiles = append(profiles, p)
+	}
+	for _, p := range DefaultVendorProfiles {
+		if !defined[p.Name] {
+			profiles = append(profiles, p)
 		}
+	}
+	return profiles, nil
+}
 
-		if strings.HasPrefix(node.Spec.ProviderID, "aws://") {
-			return "aws", nil
-		}
-		if strings.HasPrefix(node.Spec.ProviderID, "gce://") {
-			return "gcp", nil
-		}
-		if strings.HasPrefix(node.Spec.ProviderID, "azure://") {
-			return "azure", nil
+// withDefaults fills the fields p leaves empty from the generic profile.
+func (p VendorConfig) withDefaults() VendorConfig {
+	if p.InstanceTypeLabel == "" {
+		p.InstanceTypeLabel = GenericVendorProfile.InstanceTypeLabel
+	}
+	if p.NodeSelectorPrefix == "" {
+		p.NodeSelectorPrefix = defaultSelectorKey
+	}
+	if p.GPUVendorLabel == "" && len(p.GPUResources) > 0 {
+		p.GPUVendorLabel = p.GPUResources[0]
+	}
+	if p.GPUVendorLabel == "" {
+		p.GPUVendorLabel = defaultGPUResource
+	}
+	if len(p.GPUResources) == 0 {
+		p.GPUResources = []string{p.GPUVendorLabel}
+	}
+	if p.FieldSelectorPrefix == "" {
+		p.FieldSelectorPrefix = defaultFieldSelector
+	}
+	return p
+}
+
+func (r DetectionRule) matches(node *v1.Node) bool {
+	if len(r.NodeLabels) == 0 && r.ProviderIDPrefix == "" && r.KubeletVersionContains == "" && !r.NoProviderID {
+		return false
+	}
+	for _, key := range r.NodeLabels {
+		if _, ok := node.Labels[key]; !ok {
+			return false
 		}
 	}
+	if r.ProviderIDPrefix != "" && !strings.HasPrefix(node.Spec.ProviderID, r.ProviderIDPrefix) {
+		return false
+	}
+	if r.KubeletVersionContains != "" && !strings.Contains(node.Status.NodeInfo.KubeletVersion, r.KubeletVersionContains) {
+		return false
+	}
+	if r.NoProviderID && node.Spec.ProviderID != "" {
+		return false
+	}
+	return true
+}
 
-	return "unknown", nil
+// DetectVendor returns the first of profiles with a rule matching any of
+// nodes, or the generic profile when none does.
+func DetectVendor(profiles []VendorConfig, nodes []*v1.Node) VendorConfig {
+	for _, p := range profiles {
+		for _, rule := range p.Detect {
+			for _, node := range nodes {
+				if rule.matches(node) {
+					return p.withDefaults()
+				}
+			}
+		}
+	}
+	return GenericVendorProfile
 }
 
-func GetVendorConfig() (VendorConfig, error) {
-	kc := NewKubernetesConfig()
-	vendor, err := kc.getClusterType()
+// errNoNodes is returned while the cluster has no nodes to detect a vendor
+// from.
+var errNoNodes = errors.New("cannot detect the cluster vendor: the cluster has no nodes")
+
+// GetVendorConfig returns the profile of the cluster's distribution. It is
+// detected from the nodes on first use and then cached.
+func (kc *KubernetesConfig) GetVendorConfig() (VendorConfig, error) {
+	if cfg := kc.vendor.Load(); cfg != nil {
+		return *cfg, nil
+	}
+
+	nodes, err := kc.listNodes(context.Background())
 	if err != nil {
-		return VendorConfig{}, err
+		return VendorConfig{}, fmt.Errorf("failed to list nodes: %w", err)
+	}
+	if len(nodes) == 0 {
+		return VendorConfig{}, errNoNodes
 	}
 
-	if cfg, ok := VendorConfigs[vendor]; ok {
-		return cfg, nil
+	profiles := kc.vendorProfiles
+	if profiles == nil {
+		profiles = DefaultVendorProfiles
 	}
+	cfg := DetectVendor(profiles, nodes)
+	kc.vendor.Store(&cfg)
+	return cfg, nil
+}
 
-	return VendorConfig{}, fmt.Errorf("no config found for vendor: %s", vendor)
+// WorkloadNodeSelector is the node selector workloads are created with to
+// land on nodes of nodeType. Its key is the vendor profile's selector key.
+func (kc *KubernetesConfig) WorkloadNodeSelector(nodeType string) map[string]string {
+	key := defaultSelectorKey
+	if cfg, err := kc.GetVendorConfig(); err == nil {
+		key = cfg.NodeSelectorPrefix
+	}
+	return map[string]string{key: nodeType}
 }
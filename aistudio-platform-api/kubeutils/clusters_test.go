@@ -0,0 +1,112 @@
+package kubeutils_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"Kubernetes-api/internal/kubetest"
+	"Kubernetes-api/kubeutils"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func bareNode(name string, edit func(*v1.Node)) *v1.Node {
+	node := kubetest.Node(name, "4", "16Gi", "")
+	delete(node.Labels, kubetest.NodeGroupLabel)
+	edit(node)
+	return node
+}
+
+func TestDetectVendor(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(*v1.Node)
+		want string
+	}{
+		{"eks label", func(n *v1.Node) { n.Labels[kubetest.NodeGroupLabel] = "default" }, "eks"},
+		{"aws provider", func(n *v1.Node) { n.Spec.ProviderID = "aws:///us-east-1a/i-0abc" }, "eks"},
+		{"openshift", func(n *v1.Node) { n.Labels["node.openshift.io/os_id"] = "rhcos" }, "openshift"},
+		{"k3s", func(n *v1.Node) { n.Status.NodeInfo.KubeletVersion = "v1.28.2+k3s1"; n.Spec.ProviderID = "rancher://x" }, "k3s"},
+		{"kind", func(n *v1.Node) { n.Spec.ProviderID = "kind://docker/kind/kind-control-plane" }, "kind"},
+		{"bare metal", func(n *v1.Node) {}, "onprem"},
+		{"unknown cloud", func(n *v1.Node) { n.Spec.ProviderID = "hetzner://123" }, "generic"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := kubeutils.DetectVendor(kubeutils.DefaultVendorProfiles, []*v1.Node{bareNode("node-a", tt.edit)})
+			if got.Name != tt.want {
+				t.Fatalf("vendor = %s, want %s", got.Name, tt.want)
+			}
+			if got.GPUVendorLabel == "" || got.NodeSelectorPrefix == "" {
+				t.Errorf("profile %s was not completed with defaults: %+v", got.Name, got)
+			}
+		})
+	}
+}
+
+func TestGetVendorConfigIsCached(t *testing.T) {
+	h := kubetest.New(kubetest.Node("node-a", "4", "16Gi", ""))
+	cfg, err := h.Kube.GetVendorConfig()
+	if err != nil || cfg.Name != "eks" {
+		t.Fatalf("GetVendorConfig = %+v, %v; want eks", cfg, err)
+	}
+
+	var lists int
+	h.Clientset.PrependReactor("list", "nodes", func(k8stesting.Action) (bool, runtime.Object, error) {
+		lists++
+		return false, nil, nil
+	})
+	for i := 0; i < 3; i++ {
+		if _, err := h.Kube.GetVendorConfig(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if lists != 0 {
+		t.Errorf("nodes listed %d times after detection, want 0", lists)
+	}
+}
+
+func TestLoadVendorProfiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "profiles.yaml")
+	yaml := `profiles:
+  - name: rke2
+    nodeGroupLabel: node-pool
+    gpuResources: [amd.com/gpu]
+    detect:
+      - kubeletVersionContains: "+rke2"
+  - name: eks
+    nodeGroupLabel: team
+    detect:
+      - nodeLabels: [eks.amazonaws.com/nodegroup]
+`
+	if err := os.WriteFile(path, []byte(yaml), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	profiles, err := kubeutils.LoadVendorProfiles(path)
+	if err != nil {
+		t.Fatalf("LoadVendorProfiles: %v", err)
+	}
+	if profiles[0].Name != "rke2" || profiles[1].Name != "eks" || len(profiles) != len(kubeutils.DefaultVendorProfiles)+1 {
+		t.Fatalf("profiles = %v, want rke2 and the overridden eks before the other built-ins", profiles)
+	}
+
+	rke2 := bareNode("node-a", func(n *v1.Node) { n.Status.NodeInfo.KubeletVersion = "v1.28.2+rke2r1" })
+	got := kubeutils.DetectVendor(profiles, []*v1.Node{rke2})
+	if got.Name != "rke2" || got.GPUVendorLabel != "amd.com/gpu" || got.NodeSelectorPrefix != "type" {
+		t.Errorf("detected %+v, want rke2 requesting amd.com/gpu with the default selector key", got)
+	}
+	eks := kubetest.Node("node-b", "4", "16Gi", "")
+	if got := kubeutils.DetectVendor(profiles, []*v1.Node{eks}); got.NodeGroupLabel != "team" {
+		t.Errorf("eks node group label = %s, want the file's override", got.NodeGroupLabel)
+	}
+
+	if err := os.WriteFile(path, []byte("profiles:\n  - instanceTypeLabel: x\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kubeutils.LoadVendorProfiles(path); err == nil {
+		t.Error("expected an error for a profile without a name")
+	}
+}
@@ -5,7 +5,7 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"strconv"
+	"time"
 
 	"github.com/gofiber/fiber/v2/log"
 	appsv1 "k8s.io/api/apps/v1"
@@ -14,7 +14,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-func (kc *KubernetesConfig) ConfigModelDeployment(newNamespace string, deploymentName string, Image string, pvcName string, gpuRequest int, modelPort int, nodeSelector string, resources apiv1.ResourceRequirements, envVars []apiv1.EnvVar) {
+func (kc *KubernetesConfig) ConfigModelDeployment(newNamespace string, deploymentName string, Image string, pvcName string, gpu GPURequest, modelPort int, nodeSelector string, resources apiv1.ResourceRequirements, envVars []apiv1.EnvVar, owner Owner) error {
 
 	deploymentsClient := kc.Clientset.AppsV1().Deployments(newNamespace)
 	VolumeMounts := []apiv1.VolumeMount{
@@ -50,9 +50,7 @@ func (kc *KubernetesConfig) ConfigModelDeployment(newNamespace string, deploymen
 					},
 				},
 				Spec: apiv1.PodSpec{
-					NodeSelector: map[string]string{
-						"type": nodeSelector,
-					},
+					NodeSelector: kc.WorkloadNodeSelector(nodeSelector),
 					Volumes: []apiv1.Volume{
 						{
 							Name: pvcName,
@@ -78,18 +76,22 @@ func (kc *KubernetesConfig) ConfigModelDeployment(newNamespace string, deploymen
 			},
 		},
 	}
-	{
-		if gpuRequest > 0 {
-			configGpu(&deployment.Spec.Template.Spec, strconv.Itoa(gpuRequest))
+	if gpu.Count > 0 {
+		if err := kc.configGpu(&deployment.Spec.Template.Spec, gpu); err != nil {
+			return err
 		}
+	}
+	owner.label(&deployment.ObjectMeta)
+	owner.label(&deployment.Spec.Template.ObjectMeta)
 
-		fmt.Println("Creating deployment...")
-		result, err := deploymentsClient.Create(context.TODO(), deployment, metav1.CreateOptions{})
-		if err != nil {
-			log.Error(err.Error(), "Error in creatinng deployment: ", deploymentName)
-		}
-		fmt.Printf("Created deployment %q.\n", result.GetObjectMeta().GetName())
+	fmt.Println("Creating deployment...")
+	result, err := deploymentsClient.Create(context.TODO(), deployment, metav1.CreateOptions{})
+	if err != nil {
+		log.Error(err.Error(), "Error in creatinng deployment: ", deploymentName)
+		return wrapAPIError("create", "deployment", deploymentName, err)
 	}
+	fmt.Printf("Created deployment %q.\n", result.GetObjectMeta().GetName())
+	return nil
 }
 
 
@@ -143,7 +145,7 @@ func (kc *KubernetesConfig) ConfigDeployment(newNamespace, deploymentName, image
     fmt.Printf("Creating deployment %q in namespace %q...\n", deploymentName, newNamespace)
     result, err := deploymentsClient.Create(context.TODO(), deployment, metav1.CreateOptions{})
     if err != nil {
-        return "", fmt.Errorf("failed to create deployment %s: %w", deploymentName, err)
+        return "", wrapAPIError("create", "deployment", deploymentName, err)
     }
 
     deploymentNameResult := result.GetObjectMeta().GetName()
@@ -151,7 +153,7 @@ func (kc *KubernetesConfig) ConfigDeployment(newNamespace, deploymentName, image
     return deploymentNameResult, nil
 }
 
-func (kc *KubernetesConfig) DeleteDeployment(namespace string, deploymentName string) {
+func (kc *KubernetesConfig) DeleteDeployment(namespace string, deploymentName string) error {
 
 	deploymentsClient := kc.Clientset.AppsV1().Deployments(namespace)
 	fmt.Println("Deleting deployment...")
@@ -160,24 +162,53 @@ func (kc *KubernetesConfig) DeleteDeployment(namespace string, deploymentName st
 		PropagationPolicy: &deletePolicy,
 	}); err != nil {
 		log.Error(err.Error(), "Error while deleting the pod")
+		return wrapAPIError("delete", "deployment", deploymentName, err)
 	}
 
 	fmt.Printf("Deleted deployment %q.\n", deploymentName)
+	return nil
 }
 
-func (kc *KubernetesConfig) ModelDeploymentExists(namespace string, deploymentName string) bool {
+// ModelDeploymentExists reports whether the deployment exists. Any error
+// other than not-found is returned rather than treated as absence.
+func (kc *KubernetesConfig) ModelDeploymentExists(namespace string, deploymentName string) (bool, error) {
 
 	deploymentsClient := kc.Clientset.AppsV1().Deployments(namespace)
 
 	_, err := deploymentsClient.Get(context.TODO(), deploymentName, metav1.GetOptions{})
 	if err != nil {
 		if errors.IsNotFound(err) {
-			return false
+			return false, nil
 		}
-		log.Fatalf("Failed to get deployments: %v", err)
+		log.Errorf("Failed to get deployments: %v", err)
+		return false, wrapAPIError("get", "deployment", deploymentName, err)
 	}
 
-	return true
+	return true, nil
+}
+
+// DeleteDeploymentAndWait deletes the deployment if it exists and returns
+// once the API server no longer has it, so one of the same name can be
+// created in its place.
+func (kc *KubernetesConfig) DeleteDeploymentAndWait(ctx context.Context, namespace string, deploymentName string) error {
+	exists, err := kc.ModelDeploymentExists(namespace, deploymentName)
+	if err != nil || !exists {
+		return err
+	}
+	if err := kc.DeleteDeployment(namespace, deploymentName); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	for {
+		exists, err := kc.ModelDeploymentExists(namespace, deploymentName)
+		if err != nil || !exists {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
 }
 
 func (kc *KubernetesConfig) GetDeploymentLogs(deploymentName string, namespace string) (string, error) {
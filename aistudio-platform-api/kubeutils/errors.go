@@ -0,0 +1,101 @@
+package kubeutils
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// Sentinel errors for the ways a Kubernetes call can be refused. Errors
+// returned by the mutators in this package match one of them with errors.Is
+// whenever the API server gave a reason.
+var (
+	ErrNotFound      = errors.New("not found")
+	ErrConflict      = errors.New("conflict")
+	ErrForbidden     = errors.New("forbidden")
+	ErrQuotaExceeded = errors.New("quota exceeded")
+	ErrInvalid       = errors.New("invalid")
+)
+
+// Error describes a failed call to the Kubernetes API. Kind is one of the
+// sentinel errors above, or nil when the failure has no better reason, and
+// Err is the error the client returned.
+type Error struct {
+	Op       string
+	Resource string
+	Name     string
+	Kind     error
+	Err      error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s %s %s: %v", e.Op, e.Resource, e.Name, e.Err)
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// Is matches the sentinel kind, so callers can write
+// errors.Is(err, kubeutils.ErrNotFound) without inspecting API statuses.
+func (e *Error) Is(target error) bool {
+	return e.Kind != nil && e.Kind == target
+}
+
+// StatusCode is the HTTP status a handler should answer with.
+func (e *Error) StatusCode() int {
+	switch e.Kind {
+	case ErrNotFound:
+		return http.StatusNotFound
+	case ErrConflict:
+		return http.StatusConflict
+	case ErrForbidden, ErrQuotaExceeded:
+		return http.StatusForbidden
+	case ErrInvalid:
+		return http.StatusUnprocessableEntity
+	}
+	return http.StatusInternalServerError
+}
+
+// Code is the machine-readable code the API reports for the error.
+func (e *Error) Code() string {
+	switch e.Kind {
+	case ErrNotFound:
+		return "not_found"
+	case ErrConflict:
+		return "conflict"
+	case ErrForbidden:
+		return "forbidden"
+	case ErrQuotaExceeded:
+		return "quota_exceeded"
+	case ErrInvalid:
+		return "invalid"
+	}
+	return ""
+}
+
+// wrapAPIError classifies err from a call that did op on the named resource.
+// It returns nil when err is nil.
+func wrapAPIError(op, resource, name string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Op: op, Resource: resource, Name: name, Kind: kindOf(err), Err: err}
+}
+
+func kindOf(err error) error {
+	switch {
+	case apierrors.IsNotFound(err):
+		return ErrNotFound
+	case apierrors.IsAlreadyExists(err), apierrors.IsConflict(err):
+		return ErrConflict
+	case apierrors.IsForbidden(err) && strings.Contains(err.Error(), "exceeded quota"):
+		return ErrQuotaExceeded
+	case apierrors.IsForbidden(err), apierrors.IsUnauthorized(err):
+		return ErrForbidden
+	case apierrors.IsInvalid(err), apierrors.IsBadRequest(err):
+		return ErrInvalid
+	}
+	return nil
+}
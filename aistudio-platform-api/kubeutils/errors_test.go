@@ -0,0 +1,93 @@
+package kubeutils_test
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"Kubernetes-api/helper"
+	"Kubernetes-api/internal/kubetest"
+	"Kubernetes-api/kubeutils"
+
+	apiv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func failWith(h *kubetest.Harness, verb, resource string, err error) {
+	h.Clientset.PrependReactor(verb, resource, func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, err
+	})
+}
+
+func TestMutatorsReturnTypedErrors(t *testing.T) {
+	services := schema.GroupResource{Resource: "services"}
+	tests := []struct {
+		name   string
+		err    error
+		kind   error
+		status int
+	}{
+		{"forbidden", apierrors.NewForbidden(services, "web", errors.New("rbac denied")), kubeutils.ErrForbidden, http.StatusForbidden},
+		{"quota", apierrors.NewForbidden(services, "web", errors.New("exceeded quota: lab-quota")), kubeutils.ErrQuotaExceeded, http.StatusForbidden},
+		{"conflict", apierrors.NewAlreadyExists(services, "web"), kubeutils.ErrConflict, http.StatusConflict},
+		{"invalid", apierrors.NewBadRequest("bad port"), kubeutils.ErrInvalid, http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := kubetest.New()
+			failWith(h, "create", "services", tt.err)
+
+			err := h.Kube.CreateService("lab", "web", "web", 8888, apiv1.ServiceTypeClusterIP)
+			if !errors.Is(err, tt.kind) {
+				t.Fatalf("CreateService error = %v, want %v", err, tt.kind)
+			}
+			if got := helper.StatusFor(err, http.StatusTeapot); got != tt.status {
+				t.Errorf("status = %d, want %d", got, tt.status)
+			}
+		})
+	}
+}
+
+func TestDeleteMissingResourcesIsNotFound(t *testing.T) {
+	h := kubetest.New()
+
+	for name, err := range map[string]error{
+		"service":     h.Kube.DeleteService("lab", "web"),
+		"deployment":  h.Kube.DeleteDeployment("lab", "web"),
+		"statefulset": h.Kube.DeleteStatefulSet("lab", "web"),
+	} {
+		if !errors.Is(err, kubeutils.ErrNotFound) || !apierrors.IsNotFound(err) {
+			t.Errorf("deleting missing %s: %v, want a not-found error", name, err)
+		}
+	}
+}
+
+func TestCreateNamespaceReturnsErrorsInsteadOfPanicking(t *testing.T) {
+	h := kubetest.New()
+	if err := h.Kube.CreateNamespace("lab"); err != nil {
+		t.Fatalf("CreateNamespace: %v", err)
+	}
+	if err := h.Kube.CreateNamespace("lab"); err != nil {
+		t.Fatalf("CreateNamespace on an existing namespace: %v", err)
+	}
+
+	failWith(h, "create", "namespaces", apierrors.NewForbidden(schema.GroupResource{Resource: "namespaces"}, "model", errors.New("rbac denied")))
+	if err := h.Kube.CreateNamespace("model"); !errors.Is(err, kubeutils.ErrForbidden) {
+		t.Fatalf("CreateNamespace error = %v, want forbidden", err)
+	}
+}
+
+func TestModelDeploymentExistsReportsLookupFailures(t *testing.T) {
+	h := kubetest.New()
+	if exists, err := h.Kube.ModelDeploymentExists("model", "iris"); exists || err != nil {
+		t.Fatalf("ModelDeploymentExists = %v, %v; want false, nil", exists, err)
+	}
+
+	failWith(h, "get", "deployments", apierrors.NewForbidden(schema.GroupResource{Group: "apps", Resource: "deployments"}, "iris", errors.New("rbac denied")))
+	if _, err := h.Kube.ModelDeploymentExists("model", "iris"); !errors.Is(err, kubeutils.ErrForbidden) {
+		t.Fatalf("ModelDeploymentExists error = %v, want forbidden", err)
+	}
+}
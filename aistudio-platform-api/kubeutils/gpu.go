@@ -0,0 +1,232 @@
+package kubeutils
+
+import (
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// GPU resource names the device plugins advertise. MIG profiles are named
+// nvidia.com/mig-<profile>, such as nvidia.com/mig-1g.5gb, and time-sliced
+// NVIDIA GPUs are advertised as nvidia.com/gpu.shared when the device plugin
+// renames shared replicas.
+const (
+	GPUResourceNVIDIA       = "nvidia.com/gpu"
+	GPUResourceNVIDIAShared = "nvidia.com/gpu.shared"
+	GPUResourceAMD          = "amd.com/gpu"
+	GPUResourceIntel        = "gpu.intel.com/i915"
+	gpuResourceMIGPrefix    = "nvidia.com/mig-"
+)
+
+// gpuModelLabels are the node labels GPU feature discovery records the GPU
+// product under, tried in order.
+var gpuModelLabels = []string{
+	"nvidia.com/gpu.product",
+	"amd.com/gpu.product-name",
+	"gpu.intel.com/device-id",
+}
+
+// GPURequest asks for Count devices of one GPU resource.
+type GPURequest struct {
+	Count int
+	// Resource is the GPU resource name. Empty means the vendor profile's
+	// default, usually nvidia.com/gpu.
+	Resource string
+	// Model restricts the pod to nodes whose GPU product label, such as
+	// nvidia.com/gpu.product, has this value.
+	Model string
+}
+
+// IsGPUResource reports whether name is a GPU resource this API knows how
+// to request: a known device plugin resource or a MIG profile.
+func IsGPUResource(name string) bool {
+	switch name {
+	case GPUResourceNVIDIA, GPUResourceNVIDIAShared, GPUResourceAMD, GPUResourceIntel:
+		return true
+	}
+	return strings.HasPrefix(name, gpuResourceMIGPrefix) && len(name) > len(gpuResourceMIGPrefix)
+}
+
+// isGPUResource is IsGPUResource extended with the resources cfg lists.
+func (cfg VendorConfig) isGPUResource(name v1.ResourceName) bool {
+	if IsGPUResource(string(name)) {
+		return true
+	}
+	for _, r := range cfg.GPUResources {
+		if v1.ResourceName(r) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// GPUResourceName is the resource gpu asks for under cfg.
+func (cfg VendorConfig) GPUResourceName(gpu GPURequest) v1.ResourceName {
+	if gpu.Resource != "" {
+		return v1.ResourceName(gpu.Resource)
+	}
+	return v1.ResourceName(cfg.GPUVendorLabel)
+}
+
+// gpuModel returns the GPU product the node's labels name, if any.
+func gpuModel(node *v1.Node) string {
+	for _, label := range gpuModelLabels {
+		if model, ok := node.Labels[label]; ok {
+			return model
+		}
+	}
+	return ""
+}
+
+// gpuModelAffinity requires a node whose GPU product label is model.
+func gpuModelAffinity(model string) *v1.Affinity {
+	terms := make([]v1.NodeSelectorTerm, len(gpuModelLabels))
+	for i, label := range gpuModelLabels {
+		terms[i] = v1.NodeSelectorTerm{MatchExpressions: []v1.NodeSelectorRequirement{{
+			Key:      label,
+			Operator: v1.NodeSelectorOpIn,
+			Values:   []string{model},
+		}}}
+	}
+	return &v1.Affinity{NodeAffinity: &v1.NodeAffinity{
+		RequiredDuringSchedulingIgnoredDuringExecution: &v1.NodeSelector{NodeSelectorTerms: terms},
+	}}
+}
+
+// affinityGPUModel is the GPU model gpuModelAffinity restricted affinity
+// to, or empty.
+func affinityGPUModel(affinity *v1.Affinity) string {
+	if affinity == nil || affinity.NodeAffinity == nil || affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		return ""
+	}
+	for _, term := range affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms {
+		for _, expr := range term.MatchExpressions {
+			for _, label := range gpuModelLabels {
+				if expr.Key == label && expr.Operator == v1.NodeSelectorOpIn && len(expr.Values) == 1 {
+					return expr.Values[0]
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// GPUInventory is the cluster's GPUs of one resource and model.
+type GPUInventory struct {
+	Resource    string `json:"resource"`
+	Model       string `json:"model,omitempty"`
+	Nodes       int    `json:"nodes"`
+	Capacity    int64  `json:"capacity"`
+	Allocatable int64  `json:"allocatable"`
+	Requested   int64  `json:"requested"`
+	Available   int64  `json:"available"`
+}
+
+// nodeGPUs breaks a node's GPUs down by resource. requests are what the
+// node's running pods ask for.
+func (cfg VendorConfig) nodeGPUs(node *v1.Node, requests v1.ResourceList) []GPUInventory {
+	model := gpuModel(node)
+	var gpus []GPUInventory
+	for name, allocatable := range node.Status.Allocatable {
+		if !cfg.isGPUResource(name) {
+			continue
+		}
+		capacity := node.Status.Capacity[name]
+		requested := requests[name]
+		gpus = append(gpus, GPUInventory{
+			Resource:    string(name),
+			Model:       model,
+			Nodes:       1,
+			Capacity:    capacity.Value(),
+			Allocatable: allocatable.Value(),
+			Requested:   requested.Value(),
+			Available:   allocatable.Value() - requested.Value(),
+		})
+	}
+	sortGPUs(gpus)
+	return gpus
+}
+
+// totalGPUs adds up every GPU resource in list.
+func (cfg VendorConfig) totalGPUs(list v1.ResourceList) int64 {
+	var total int64
+	for name, q := range list {
+		if cfg.isGPUResource(name) {
+			total += q.Value()
+		}
+	}
+	return total
+}
+
+func sortGPUs(gpus []GPUInventory) {
+	sort.Slice(gpus, func(i, j int) bool {
+		if gpus[i].Resource != gpus[j].Resource {
+			return gpus[i].Resource < gpus[j].Resource
+		}
+		return gpus[i].Model < gpus[j].Model
+	})
+}
+
+// GetGPUInventory totals the cluster's GPUs by resource and model.
+func (kc *KubernetesConfig) GetGPUInventory() ([]GPUInventory, error) {
+	reports, err := kc.GetNodeResourceReports()
+	if err != nil {
+		return nil, err
+	}
+	return gpuInventory(reports), nil
+}
+
+// gpuInventory adds up the GPU breakdowns of reports.
+func gpuInventory(reports map[string]NodeResourceReport) []GPUInventory {
+	byKey := map[[2]string]*GPUInventory{}
+	for _, report := range reports {
+		for _, g := range report.GPUBreakdown {
+			key := [2]string{g.Resource, g.Model}
+			total, ok := byKey[key]
+			if !ok {
+				total = &GPUInventory{Resource: g.Resource, Model: g.Model}
+				byKey[key] = total
+			}
+			total.Nodes++
+			total.Capacity += g.Capacity
+			total.Allocatable += g.Allocatable
+			total.Requested += g.Requested
+			total.Available += g.Available
+		}
+	}
+	inventory := make([]GPUInventory, 0, len(byKey))
+	for _, g := range byKey {
+		inventory = append(inventory, *g)
+	}
+	sortGPUs(inventory)
+	return inventory
+}
+
+// configGpu requests gpu for every container of spec. The resource name
+// depends on the cluster's vendor, so it fails when that cannot be
+// detected.
+func (kc *KubernetesConfig) configGpu(spec *v1.PodSpec, gpu GPURequest) error {
+	cfg, err := kc.GetVendorConfig()
+	if err != nil {
+		return err
+	}
+	name := cfg.GPUResourceName(gpu)
+
+	quantity := *resource.NewQuantity(int64(gpu.Count), resource.DecimalSI)
+	for i := range spec.Containers {
+		if spec.Containers[i].Resources.Requests == nil {
+			spec.Containers[i].Resources.Requests = v1.ResourceList{}
+		}
+		if spec.Containers[i].Resources.Limits == nil {
+			spec.Containers[i].Resources.Limits = v1.ResourceList{}
+		}
+		spec.Containers[i].Resources.Requests[name] = quantity.DeepCopy()
+		spec.Containers[i].Resources.Limits[name] = quantity.DeepCopy()
+	}
+	if gpu.Model != "" {
+		spec.Affinity = gpuModelAffinity(gpu.Model)
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package kubeutils_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"Kubernetes-api/internal/kubetest"
+	"Kubernetes-api/kubeutils"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// gpuNode returns a node advertising count devices of gpuResource, labelled
+// with model under label.
+func gpuNode(name, gpuResource, count, label, model string) *v1.Node {
+	node := kubetest.Node(name, "8", "32Gi", "")
+	node.Status.Allocatable[v1.ResourceName(gpuResource)] = resource.MustParse(count)
+	node.Status.Capacity[v1.ResourceName(gpuResource)] = resource.MustParse(count)
+	node.Labels[label] = model
+	return node
+}
+
+func TestParseGPU(t *testing.T) {
+	gpu, err := kubeutils.ParseGPU("2", "nvidia.com/mig-1g.5gb", "NVIDIA-A100-SXM4-40GB")
+	if err != nil {
+		t.Fatalf("ParseGPU: %v", err)
+	}
+	if want := (kubeutils.GPURequest{Count: 2, Resource: "nvidia.com/mig-1g.5gb", Model: "NVIDIA-A100-SXM4-40GB"}); gpu != want {
+		t.Errorf("gpu = %+v, want %+v", gpu, want)
+	}
+
+	for _, tc := range []struct{ count, gpuType, model, field string }{
+		{"1", "example.com/fpga", "", "gpuType"},
+		{"1", "nvidia.com/mig-", "", "gpuType"},
+		{"1", "amd.com/gpu", "MI 250", "gpuModel"},
+		{"half", "", "", "gpuRequest"},
+	} {
+		_, err := kubeutils.ParseGPU(tc.count, tc.gpuType, tc.model)
+		var qe *kubeutils.QuantityError
+		if !errors.As(err, &qe) || qe.Field != tc.field {
+			t.Errorf("ParseGPU(%q, %q, %q) = %v, want an error on %s", tc.count, tc.gpuType, tc.model, err, tc.field)
+		}
+	}
+}
+
+func TestGPUInventory(t *testing.T) {
+	busy := kubetest.Pod("lab", "bob-0", "bob", "amd-a", "1", "1Gi")
+	busy.Spec.Containers[0].Resources.Requests["amd.com/gpu"] = resource.MustParse("1")
+	h := kubetest.New(
+		gpuNode("a100-a", "nvidia.com/gpu", "4", "nvidia.com/gpu.product", "NVIDIA-A100"),
+		gpuNode("a100-b", "nvidia.com/mig-1g.5gb", "7", "nvidia.com/gpu.product", "NVIDIA-A100"),
+		gpuNode("amd-a", "amd.com/gpu", "2", "amd.com/gpu.product-name", "MI250"),
+		kubetest.Node("cpu-a", "4", "16Gi", ""),
+		busy,
+	)
+
+	inventory, err := h.Kube.GetGPUInventory()
+	if err != nil {
+		t.Fatalf("GetGPUInventory: %v", err)
+	}
+	want := []kubeutils.GPUInventory{
+		{Resource: "amd.com/gpu", Model: "MI250", Nodes: 1, Capacity: 2, Allocatable: 2, Requested: 1, Available: 1},
+		{Resource: "nvidia.com/gpu", Model: "NVIDIA-A100", Nodes: 1, Capacity: 4, Allocatable: 4, Available: 4},
+		{Resource: "nvidia.com/mig-1g.5gb", Model: "NVIDIA-A100", Nodes: 1, Capacity: 7, Allocatable: 7, Available: 7},
+	}
+	if !reflect.DeepEqual(inventory, want) {
+		t.Errorf("inventory = %+v, want %+v", inventory, want)
+	}
+
+	reports, err := h.Kube.GetNodeResourceReports()
+	if err != nil {
+		t.Fatalf("GetNodeResourceReports: %v", err)
+	}
+	if amd := reports["amd-a"]; amd.Available.GPUs != 1 || amd.GPUModel != "MI250" || len(amd.GPUBreakdown) != 1 {
+		t.Errorf("amd-a = %+v, want 1 available MI250 GPU", amd)
+	}
+	if mig := reports["a100-b"]; mig.Allocatable.GPUs != 7 {
+		t.Errorf("a100-b allocatable GPUs = %d, want the 7 MIG slices", mig.Allocatable.GPUs)
+	}
+}
+
+func TestCanScheduleGPUTypeAndModel(t *testing.T) {
+	h := kubetest.New(
+		gpuNode("a100-a", "nvidia.com/gpu", "4", "nvidia.com/gpu.product", "NVIDIA-A100"),
+		gpuNode("a100-b", "nvidia.com/mig-1g.5gb", "7", "nvidia.com/gpu.product", "NVIDIA-A100"),
+		gpuNode("t4-a", "nvidia.com/mig-1g.5gb", "7", "nvidia.com/gpu.product", "Tesla-T4"),
+	)
+	req := kubeutils.ScheduleRequest{
+		Resources: v1.ResourceRequirements{Requests: v1.ResourceList{
+			v1.ResourceCPU:    resource.MustParse("1"),
+			v1.ResourceMemory: resource.MustParse("1Gi"),
+		}},
+		GPU: kubeutils.GPURequest{Count: 1, Resource: "nvidia.com/mig-1g.5gb", Model: "NVIDIA-A100"},
+	}
+
+	result, err := h.Kube.CanSchedule(req)
+	if err != nil {
+		t.Fatalf("CanSchedule: %v", err)
+	}
+	if got := result.FittingNodes(); !reflect.DeepEqual(got, []string{"a100-b"}) {
+		t.Fatalf("fitting nodes = %v, want [a100-b]", got)
+	}
+	for _, n := range result.Nodes {
+		switch n.Node {
+		case "a100-a":
+			if !reflect.DeepEqual(n.Insufficient, []v1.ResourceName{"nvidia.com/mig-1g.5gb"}) {
+				t.Errorf("a100-a insufficient = %v, want the MIG profile", n.Insufficient)
+			}
+		case "t4-a":
+			if n.Eligible || !strings.Contains(strings.Join(n.Reasons, ","), "GPU model") {
+				t.Errorf("t4-a = %+v, want it ruled out by GPU model", n)
+			}
+		}
+	}
+}
+
+func TestGPUWorkloadNeedsClusterVendor(t *testing.T) {
+	// Without nodes the vendor, and so the GPU resource, is unknown.
+	h := kubetest.New()
+	owner := kubeutils.Owner{User: "alice", Workload: kubeutils.WorkloadLabspace}
+	err := h.Kube.CreateStatefulSet("lab", "alice", "notebook-alice", "jupyter", kubeutils.GPURequest{Count: 1}, 8888, "10Gi", "", v1.ResourceRequirements{}, nil, owner)
+	if err == nil {
+		t.Fatal("CreateStatefulSet with a GPU succeeded on a cluster of unknown vendor")
+	}
+	if list, _ := h.Clientset.AppsV1().StatefulSets("lab").List(context.TODO(), metav1.ListOptions{}); len(list.Items) != 0 {
+		t.Errorf("statefulset created without a GPU resource: %+v", list.Items[0].Spec.Template.Spec.Containers[0].Resources)
+	}
+
+	if err := h.Kube.CreateStatefulSet("lab", "alice", "notebook-alice", "jupyter", kubeutils.GPURequest{}, 8888, "10Gi", "", v1.ResourceRequirements{}, nil, owner); err != nil {
+		t.Errorf("CreateStatefulSet without a GPU = %v, want it to need no vendor", err)
+	}
+}
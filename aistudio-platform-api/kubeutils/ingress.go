@@ -16,22 +16,10 @@ func (kc *KubernetesConfig) AppendRuleToIngress(namespace, ingressName, serviceN
 
 	ingress, err := ingressClient.Get(context.TODO(), ingressName, metav1.GetOptions{})
 	if err != nil {
-		return err
+		return wrapAPIError("get", "ingress", ingressName, err)
 	}
 
-	pathType := networkingv1.PathTypePrefix
-	newPath := networkingv1.HTTPIngressPath{
-		Path:     path,
-		PathType: &pathType,
-		Backend: networkingv1.IngressBackend{
-			Service: &networkingv1.IngressServiceBackend{
-				Name: serviceName,
-				Port: networkingv1.ServiceBackendPort{
-					Number: 80,
-				},
-			},
-		},
-	}
+	newPath := ingressPath(serviceName, path)
 
 	for i := range ingress.Spec.Rules {
 		if ingress.Spec.Rules[i].HTTP != nil {
@@ -45,7 +33,7 @@ func (kc *KubernetesConfig) AppendRuleToIngress(namespace, ingressName, serviceN
 	}
 
 	_, err = ingressClient.Update(context.TODO(), ingress, metav1.UpdateOptions{})
-	return err
+	return wrapAPIError("update", "ingress", ingressName, err)
 }
 
 func (kc *KubernetesConfig) DeleteRuleFromIngress(namespace, path, ingressName string) error {
@@ -54,13 +42,13 @@ func (kc *KubernetesConfig) DeleteRuleFromIngress(namespace, path, ingressName s
 	
 	ingress, err := ingressClient.Get(context.TODO(), ingressName, metav1.GetOptions{})
 	if err != nil {
-		return err
+		return wrapAPIError("get", "ingress", ingressName, err)
 	}
 
 	for _, rule := range ingress.Spec.Rules {
 		if rule.HTTP != nil {
-			for j, path := range rule.HTTP.Paths {
-				if path.Path == fmt.Sprintf("/%s", path) {
+			for j, p := range rule.HTTP.Paths {
+				if p.Path == fmt.Sprintf("/%s", path) {
 					rule.HTTP.Paths = append(rule.HTTP.Paths[:j], rule.HTTP.Paths[j+1:]...)
 					break
 				}
@@ -69,5 +57,22 @@ func (kc *KubernetesConfig) DeleteRuleFromIngress(namespace, path, ingressName s
 	}
 
 	_, err = ingressClient.Update(context.TODO(), ingress, metav1.UpdateOptions{})
-	return err
+	return wrapAPIError("update", "ingress", ingressName, err)
+}
+
+// ingressPath routes the path prefix to port 80 of serviceName.
+func ingressPath(serviceName, path string) networkingv1.HTTPIngressPath {
+	pathType := networkingv1.PathTypePrefix
+	return networkingv1.HTTPIngressPath{
+		Path:     path,
+		PathType: &pathType,
+		Backend: networkingv1.IngressBackend{
+			Service: &networkingv1.IngressServiceBackend{
+				Name: serviceName,
+				Port: networkingv1.ServiceBackendPort{
+					Number: 80,
+				},
+			},
+		},
+	}
 }
@@ -0,0 +1,32 @@
+package kubeutils_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"Kubernetes-api/internal/kubetest"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestAppendAndDeleteIngressRules(t *testing.T) {
+	h := kubetest.New(kubetest.Ingress("lab", "labs"))
+
+	for _, path := range []string{"/alice", "/bob", "/alice"} {
+		if err := h.Kube.AppendRuleToIngress("lab", "labs", "notebook-x", path); err != nil {
+			t.Fatalf("AppendRuleToIngress(%s): %v", path, err)
+		}
+	}
+	if err := h.Kube.DeleteRuleFromIngress("lab", "alice", "labs"); err != nil {
+		t.Fatalf("DeleteRuleFromIngress: %v", err)
+	}
+
+	ing, err := h.Clientset.NetworkingV1().Ingresses("lab").Get(context.TODO(), "labs", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := kubetest.IngressPaths(ing), []string{"/bob"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("paths = %v, want %v", got, want)
+	}
+}
@@ -1,17 +1,13 @@
 package kubeutils
 
 import (
-	"flag"
 	"fmt"
-	"path/filepath"
-
-	"sync"
+	"sync/atomic"
 
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
-	"k8s.io/client-go/util/homedir"
 	metricsv "k8s.io/metrics/pkg/client/clientset/versioned"
 )
 
@@ -19,59 +15,104 @@ type KubernetesConfig struct {
 	Clientset     kubernetes.Interface
 	MetricsClient metricsv.Interface
 	DynamicClient dynamic.Interface
+	// Tenancy, when set, puts each tenant's workloads in a namespace of
+	// its own; see TenantNamespace.
+	Tenancy *Tenancy
+
+	cache atomic.Pointer[Cache]
+	// vendorProfiles are tried in order to detect the vendor; nil means
+	// DefaultVendorProfiles. vendor caches the result.
+	vendorProfiles []VendorConfig
+	vendor         atomic.Pointer[VendorConfig]
 }
 
-var (
-	once       sync.Once
-	kubeConfig *KubernetesConfig
-	configErr  error
-)
+// Options controls how NewKubernetesConfig reaches the cluster. The zero
+// value loads the default kubeconfig with its current context.
+type Options struct {
+	// Kubeconfig is the path to a kubeconfig file. Empty uses the default
+	// loading rules ($KUBECONFIG, then ~/.kube/config).
+	Kubeconfig string
+	// Context overrides the kubeconfig's current-context.
+	Context string
+	// InCluster uses the service account mounted into the pod and ignores
+	// Kubeconfig and Context.
+	InCluster bool
+	// QPS and Burst tune the client-side rate limiter; zero keeps the
+	// client-go defaults.
+	QPS   float32
+	Burst int
+	// VendorProfiles replace DefaultVendorProfiles for vendor detection,
+	// typically as returned by LoadVendorProfiles.
+	VendorProfiles []VendorConfig
+	// Tenancy turns on namespace-per-tenant, typically as returned by
+	// LoadTenancy.
+	Tenancy *Tenancy
+}
 
-func NewKubernetesConfig() *KubernetesConfig {
-	once.Do(func() {
-		var config *rest.Config
-		var err error
+// NewKubernetesConfig builds the typed, metrics and dynamic clients for the
+// cluster described by opts. No request is made to the API server, so it
+// succeeds even when the cluster is unreachable.
+func NewKubernetesConfig(opts Options) (*KubernetesConfig, error) {
+	config, err := opts.restConfig()
+	if err != nil {
+		return nil, err
+	}
+	if opts.QPS > 0 {
+		config.QPS = opts.QPS
+	}
+	if opts.Burst > 0 {
+		config.Burst = opts.Burst
+	}
 
-		config, err = rest.InClusterConfig()
-		if err != nil {
-			var kubeconfig *string
-			if home := homedir.HomeDir(); home != "" {
-				kubeconfig = flag.String("kubeconfig", filepath.Join(home, ".kube", "config"),
-					"(optional) absolute path to the kubeconfig file")
-			} else {
-				kubeconfig = flag.String("kubeconfig", "", "absolute path to the kubeconfig file")
-			}
-			flag.Parse()
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubernetes clientset: %w", err)
+	}
 
-			config, err = clientcmd.BuildConfigFromFlags("", *kubeconfig)
-			if err != nil {
-				configErr = fmt.Errorf("failed to build config from flags: %w", err)
-				return
-			}
-		}
+	metricsClient, err := metricsv.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create metrics client: %w", err)
+	}
 
-		clientset, err := kubernetes.NewForConfig(config)
-		if err != nil {
-			configErr = fmt.Errorf("failed to create kubernetes clientset: %w", err)
-			return
-		}
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dynamic client: %w", err)
+	}
 
-		metricsClient, err := metricsv.NewForConfig(config)
-		if err != nil {
-			configErr = fmt.Errorf("failed to create metrics client: %w", err)
-			return
-		}
-		dynamicClientset, err := dynamic.NewForConfig(config)
+	kc := NewKubernetesConfigForClients(clientset, metricsClient, dynamicClient)
+	kc.vendorProfiles = opts.VendorProfiles
+	kc.Tenancy = opts.Tenancy
+	return kc, nil
+}
+
+// NewKubernetesConfigForClients wraps already constructed clients, which is
+// how tests plug in the fake clientsets.
+func NewKubernetesConfigForClients(clientset kubernetes.Interface, metricsClient metricsv.Interface, dynamicClient dynamic.Interface) *KubernetesConfig {
+	return &KubernetesConfig{
+		Clientset:     clientset,
+		MetricsClient: metricsClient,
+		DynamicClient: dynamicClient,
+	}
+}
+
+func (o Options) restConfig() (*rest.Config, error) {
+	if o.InCluster {
+		config, err := rest.InClusterConfig()
 		if err != nil {
-			configErr = fmt.Errorf("failed to create dynamic client: %w", err)
-			return
+			return nil, fmt.Errorf("failed to load in-cluster config: %w", err)
 		}
+		return config, nil
+	}
 
-		kubeConfig = &KubernetesConfig{
-			Clientset:     clientset,
-			MetricsClient: metricsClient,
-			DynamicClient: dynamicClientset,
-		}
-	})
-	return kubeConfig
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if o.Kubeconfig != "" {
+		rules.ExplicitPath = o.Kubeconfig
+	}
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: o.Context}
+
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build config from kubeconfig: %w", err)
+	}
+	return config, nil
 }
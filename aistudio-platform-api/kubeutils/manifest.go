@@ -4,9 +4,9 @@ import (
 	"bytes"
 	"context"
 	"fmt"
-	"os"
 	"strings"
 
+	"github.com/spf13/afero"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -17,13 +17,13 @@ import (
 	"k8s.io/client-go/dynamic"
 )
 
-func ApplyManifest(filePath, namespace string, dynClient dynamic.Interface, mapper meta.RESTMapper) error {
+func ApplyManifest(fs afero.Fs, filePath, namespace string, dynClient dynamic.Interface, mapper meta.RESTMapper) error {
 	if !strings.HasSuffix(filePath, ".yaml") && !strings.HasSuffix(filePath, ".yml") {
 		return nil
 	}
 	fmt.Printf("Applying: %s\n", filePath)
 
-	data, err := os.ReadFile(filePath)
+	data, err := afero.ReadFile(fs, filePath)
 	if err != nil {
 		return fmt.Errorf("failed to read file %s: %w", filePath, err)
 	}
@@ -9,9 +9,8 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-func GetPodMetrics(namespace string) {
-	config := NewKubernetesConfig()
-	metricsClient := config.MetricsClient
+func (kc *KubernetesConfig) GetPodMetrics(namespace string) {
+	metricsClient := kc.MetricsClient
 	podMetricsList, err := metricsClient.MetricsV1beta1().PodMetricses(namespace).List(context.TODO(), metav1.ListOptions{})
 	if err != nil {
 		log.Fatalf("Error getting pod metrics: %v", err)
@@ -50,10 +49,11 @@ func (kc *KubernetesConfig) GetPodMetric(namespace string) ([]PodMetrics, error)
 			memoryKB := int(memoryQuantity.Value() / 1024)
 
 			metrics = append(metrics, PodMetrics{
-				PodName:     podMetrics.Name,
-				CPUUsage:    fmt.Sprintf("%d", cpuCores),
-				GPUUsage:    gpuUsage,
-				MemoryUsage: fmt.Sprintf("%d KB", memoryKB),
+				PodName:       podMetrics.Name,
+				CPUUsage:      fmt.Sprintf("%d", cpuCores),
+				GPUUsage:      gpuUsage,
+				MemoryUsage:   fmt.Sprintf("%d KB", memoryKB),
+				CPUMillicores: cpuQuantity,
 			})
 		}
 	}
@@ -9,18 +9,17 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-
-func (kc *KubernetesConfig) CreateNamespace(namespace string) string {
+// CreateNamespace creates namespace unless it already exists.
+func (kc *KubernetesConfig) CreateNamespace(namespace string) error {
 	ns := &apiv1.Namespace{
 		ObjectMeta: metav1.ObjectMeta{
 			Name: namespace,
 		},
 	}
-	ns, err := kc.Clientset.CoreV1().Namespaces().Create(context.TODO(), ns, metav1.CreateOptions{})
+	_, err := kc.Clientset.CoreV1().Namespaces().Create(context.TODO(), ns, metav1.CreateOptions{})
 	if errors.IsAlreadyExists(err) {
 		fmt.Printf("Namespace %s already exists\n", namespace)
-	} else if err != nil {
-		panic(err.Error())
+		return nil
 	}
-	return fmt.Sprintf("%+v\n", ns.Status)
+	return wrapAPIError("create", "namespace", namespace, err)
 }
@@ -0,0 +1,160 @@
+package kubeutils
+
+import (
+	"context"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ResourceAmounts is a set of resources in base units: CPU in millicores,
+// memory and ephemeral storage in bytes, GPUs and pods as counts.
+type ResourceAmounts struct {
+	CPUMillicores         int64 `json:"cpuMillicores"`
+	MemoryBytes           int64 `json:"memoryBytes"`
+	GPUs                  int64 `json:"gpus"`
+	EphemeralStorageBytes int64 `json:"ephemeralStorageBytes"`
+	Pods                  int64 `json:"pods"`
+}
+
+// NodeResourceReport is one node in the v2 resource API. Requested and
+// Limits add up the pods still running on the node, counting init
+// containers and pod overhead as the scheduler does, and Requested.Pods is
+// the number of those pods. Available is Allocatable less Requested. Usage
+// is the metrics-server sample, CPU and memory only, and is nil when
+// metrics-server has none for the node. GPUs count every GPU resource the
+// node advertises; GPUBreakdown splits them by resource.
+type NodeResourceReport struct {
+	Name          string           `json:"name"`
+	InstanceType  string           `json:"instanceType,omitempty"`
+	CapacityType  string           `json:"capacityType,omitempty"`
+	NodePool      string           `json:"nodePool,omitempty"`
+	NodeType      string           `json:"nodeType,omitempty"`
+	Ready         bool             `json:"ready"`
+	Unschedulable bool             `json:"unschedulable"`
+	Capacity      ResourceAmounts  `json:"capacity"`
+	Allocatable   ResourceAmounts  `json:"allocatable"`
+	Requested     ResourceAmounts  `json:"requested"`
+	Limits        ResourceAmounts  `json:"limits"`
+	Available     ResourceAmounts  `json:"available"`
+	Usage         *ResourceAmounts `json:"usage,omitempty"`
+	GPUModel      string           `json:"gpuModel,omitempty"`
+	GPUBreakdown  []GPUInventory   `json:"gpuBreakdown,omitempty"`
+}
+
+// GetNodeResourceReports returns every node's resources keyed by node name.
+func (kc *KubernetesConfig) GetNodeResourceReports() (map[string]NodeResourceReport, error) {
+	cfg, err := kc.GetVendorConfig()
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.TODO()
+	nodes, err := kc.listNodes(ctx)
+	if err != nil {
+		return nil, wrapAPIError("list", "nodes", "", err)
+	}
+	usage := kc.nodeUsage(ctx)
+
+	reports := make(map[string]NodeResourceReport, len(nodes))
+	for _, node := range nodes {
+		pods, err := kc.podsOnNode(ctx, node.Name)
+		if err != nil {
+			return nil, wrapAPIError("list", "pods", node.Name, err)
+		}
+		requests := v1.ResourceList{}
+		limits := v1.ResourceList{}
+		var running int64
+		for _, pod := range pods {
+			if podFinished(pod) {
+				continue
+			}
+			running++
+			addResources(requests, PodRequests(&pod.Spec))
+			addResources(limits, PodLimits(&pod.Spec))
+		}
+
+		report := NodeResourceReport{
+			Name:          node.Name,
+			InstanceType:  node.Labels[cfg.InstanceTypeLabel],
+			CapacityType:  node.Labels[cfg.CapacityTypeLabel],
+			NodePool:      node.Labels[cfg.NodeGroupLabel],
+			NodeType:      node.Labels[cfg.NodeSelectorPrefix],
+			Ready:         nodeReady(node),
+			Unschedulable: node.Spec.Unschedulable,
+			Capacity:      amountsOf(node.Status.Capacity, cfg),
+			Allocatable:   amountsOf(node.Status.Allocatable, cfg),
+			Requested:     amountsOf(requests, cfg),
+			Limits:        amountsOf(limits, cfg),
+		}
+		report.Requested.Pods = running
+		report.Limits.Pods = running
+		report.Available = report.Allocatable.minus(report.Requested)
+		report.GPUModel = gpuModel(node)
+		report.GPUBreakdown = cfg.nodeGPUs(node, requests)
+		if u, ok := usage[node.Name]; ok {
+			amounts := amountsOf(u, cfg)
+			report.Usage = &amounts
+		}
+		reports[node.Name] = report
+	}
+	return reports, nil
+}
+
+// nodeUsage returns the latest metrics-server sample per node. A cluster
+// without metrics-server simply has no samples.
+func (kc *KubernetesConfig) nodeUsage(ctx context.Context) map[string]v1.ResourceList {
+	usage := map[string]v1.ResourceList{}
+	if kc.MetricsClient == nil {
+		return usage
+	}
+	list, err := kc.MetricsClient.MetricsV1beta1().NodeMetricses().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return usage
+	}
+	for _, m := range list.Items {
+		usage[m.Name] = m.Usage
+	}
+	return usage
+}
+
+func addResources(total, add v1.ResourceList) {
+	for name, q := range add {
+		sum := total[name]
+		sum.Add(q)
+		total[name] = sum
+	}
+}
+
+func amountsOf(list v1.ResourceList, cfg VendorConfig) ResourceAmounts {
+	cpu := list[v1.ResourceCPU]
+	memory := list[v1.ResourceMemory]
+	storage := list[v1.ResourceEphemeralStorage]
+	pods := list[v1.ResourcePods]
+	return ResourceAmounts{
+		CPUMillicores:         cpu.MilliValue(),
+		MemoryBytes:           memory.Value(),
+		GPUs:                  cfg.totalGPUs(list),
+		EphemeralStorageBytes: storage.Value(),
+		Pods:                  pods.Value(),
+	}
+}
+
+func (a ResourceAmounts) minus(b ResourceAmounts) ResourceAmounts {
+	return ResourceAmounts{
+		CPUMillicores:         a.CPUMillicores - b.CPUMillicores,
+		MemoryBytes:           a.MemoryBytes - b.MemoryBytes,
+		GPUs:                  a.GPUs - b.GPUs,
+		EphemeralStorageBytes: a.EphemeralStorageBytes - b.EphemeralStorageBytes,
+		Pods:                  a.Pods - b.Pods,
+	}
+}
+
+func (a ResourceAmounts) plus(b ResourceAmounts) ResourceAmounts {
+	return ResourceAmounts{
+		CPUMillicores:         a.CPUMillicores + b.CPUMillicores,
+		MemoryBytes:           a.MemoryBytes + b.MemoryBytes,
+		GPUs:                  a.GPUs + b.GPUs,
+		EphemeralStorageBytes: a.EphemeralStorageBytes + b.EphemeralStorageBytes,
+		Pods:                  a.Pods + b.Pods,
+	}
+}
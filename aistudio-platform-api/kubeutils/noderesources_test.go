@@ -0,0 +1,55 @@
+package kubeutils_test
+
+import (
+	"testing"
+
+	"Kubernetes-api/internal/kubetest"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestNodeResourceReports(t *testing.T) {
+	withInit := kubetest.Pod("lab", "alice-0", "alice", "node-a", "250m", "1Gi")
+	withInit.Spec.Containers[0].Resources.Limits = v1.ResourceList{v1.ResourceCPU: resource.MustParse("500m")}
+	withInit.Spec.InitContainers = []v1.Container{{
+		Name:      "setup",
+		Resources: v1.ResourceRequirements{Requests: v1.ResourceList{v1.ResourceMemory: resource.MustParse("3Gi")}},
+	}}
+	withInit.Spec.Overhead = v1.ResourceList{v1.ResourceCPU: resource.MustParse("50m")}
+	finished := kubetest.Pod("lab", "job-0", "job", "node-a", "2", "4Gi")
+	finished.Status.Phase = v1.PodFailed
+
+	h := kubetest.New(
+		kubetest.Node("node-a", "4", "16Gi", "1"),
+		kubetest.Node("node-b", "2", "8Gi", ""),
+		withInit,
+		finished,
+	)
+	h.AddNodeMetrics(t, kubetest.NodeMetrics("node-a", "1500m", "6Gi"))
+
+	reports, err := h.Kube.GetNodeResourceReports()
+	if err != nil {
+		t.Fatalf("GetNodeResourceReports: %v", err)
+	}
+	a, ok := reports["node-a"]
+	if !ok || len(reports) != 2 {
+		t.Fatalf("reports = %v, want node-a and node-b keyed by name", reports)
+	}
+	const gib = 1 << 30
+	if a.Requested.CPUMillicores != 300 || a.Requested.MemoryBytes != 3*gib || a.Requested.Pods != 1 {
+		t.Errorf("requested = %+v, want 300m, 3Gi and one pod", a.Requested)
+	}
+	if a.Limits.CPUMillicores != 550 {
+		t.Errorf("cpu limits = %dm, want 550m", a.Limits.CPUMillicores)
+	}
+	if a.Available.CPUMillicores != 3700 || a.Available.MemoryBytes != 13*gib || a.Available.GPUs != 1 || a.Available.Pods != 109 {
+		t.Errorf("available = %+v, want 3700m, 13Gi, 1 GPU and 109 pods", a.Available)
+	}
+	if a.Usage == nil || a.Usage.CPUMillicores != 1500 || a.Usage.MemoryBytes != 6*gib {
+		t.Errorf("usage = %+v, want 1500m and 6Gi", a.Usage)
+	}
+	if b := reports["node-b"]; b.Usage != nil || b.Allocatable.CPUMillicores != 2000 {
+		t.Errorf("node-b = %+v, want 2000m allocatable and no usage sample", b)
+	}
+}
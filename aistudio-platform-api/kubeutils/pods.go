@@ -7,26 +7,25 @@ import (
 	"time"
 
 	// "github.com/gofiber/fiber/v2/log"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/labels"
 )
 
 func (kc *KubernetesConfig) ListPods(namespace string) ([]map[string]string, error) {
-	podlist := kc.Clientset.CoreV1().Pods(namespace)
-	pods, err := podlist.List(context.Background(), metav1.ListOptions{})
+	pods, err := kc.listPods(context.Background(), namespace, labels.Everything())
 	if err != nil {
 		err = fmt.Errorf("error getting pods: %v ", err)
 		return nil, err
 	}
 	var data []map[string]string
 
-	if len(pods.Items) == 0 {
+	if len(pods) == 0 {
 		return []map[string]string{}, nil
 	}
 	processedDeployments := make(map[string]bool)
 	deploymentPods := make(map[string][]map[string]string)
 
-	for _, pod := range pods.Items {
+	for _, pod := range pods {
 
 		deploymentName := ""
 		if pod.Labels != nil {
@@ -36,125 +35,7 @@ func (kc *KubernetesConfig) ListPods(namespace string) ([]map[string]string, err
 			deploymentName = pod.GetName()
 		}
 
-		podCreationTime := pod.GetCreationTimestamp()
-		age := time.Since(podCreationTime.Time).Round(time.Second)
-
-		// Get the status of each of the pods
-		podStatus := pod.Status
-
-		var containerRestarts int32
-		var containerReady int
-		var totalContainers int
-		var ready string
-		var status string
-
-		// --- ENHANCED STATUS LOGIC START ---
-		if pod.DeletionTimestamp != nil {
-			status = "Terminating"
-		} else {
-			// Look at all container statuses to find the most specific reason
-			if len(podStatus.ContainerStatuses) > 0 {
-				var worstReason string
-				var worstPriority int
-
-				for _, cs := range podStatus.ContainerStatuses {
-					// Handle Waiting state
-					if cs.State.Waiting != nil {
-						reason := cs.State.Waiting.Reason
-						message := strings.ToLower(cs.State.Waiting.Message)
-
-						prio := 0
-						switch reason {
-						case "ErrImagePull", "ImagePullBackOff":
-							prio = 6
-						case "CrashLoopBackOff":
-							prio = 5
-						case "CreateContainerConfigError", "CreateContainerError":
-							prio = 4
-						case "ContainerCreating":
-							prio = 3
-							// Detect migration/init-related activity
-							if strings.Contains(message, "migration") ||
-								strings.Contains(message, "migrate") ||
-								strings.Contains(message, "init") ||
-								strings.Contains(message, "flyway") ||
-								strings.Contains(message, "liquibase") {
-								reason = "Migrating"
-								prio = 7
-							}
-						default:
-							prio = 1
-						}
-
-						if prio > worstPriority {
-							worstPriority = prio
-							worstReason = reason
-							if cs.State.Waiting.Message != "" && reason != "Migrating" {
-								worstReason = fmt.Sprintf("%s (%s)", reason, cs.State.Waiting.Message)
-							}
-						}
-					}
-
-					// Handle Terminated state (highest priority except Terminating)
-					if cs.State.Terminated != nil {
-						var term string
-						if cs.State.Terminated.Reason != "" {
-							term = cs.State.Terminated.Reason
-						} else if cs.State.Terminated.Signal != 0 {
-							term = fmt.Sprintf("Signal:%d", cs.State.Terminated.Signal)
-						} else {
-							term = fmt.Sprintf("ExitCode:%d", cs.State.Terminated.ExitCode)
-						}
-						worstReason = term
-						worstPriority = 10
-					}
-				}
-
-				if worstReason != "" {
-					status = worstReason
-				}
-			}
-
-			// Fallback to pod phase
-			if status == "" {
-				if podStatus.Phase == "PodInitializing" {
-					status = "Initializing"
-				} else {
-					status = string(podStatus.Phase)
-				}
-			}
-		}
-
-		// If still empty (shouldn't happen), use phase
-		if status == "" {
-			status = string(podStatus.Phase)
-		}
-		// --- ENHANCED STATUS LOGIC END ---
-
-		// Count containers and readiness
-		totalContainers = len(pod.Spec.Containers)
-		if len(podStatus.ContainerStatuses) > 0 {
-			for _, cs := range podStatus.ContainerStatuses {
-				containerRestarts += cs.RestartCount
-				if cs.Ready {
-					containerReady++
-				}
-			}
-		}
-
-		name := pod.GetName()
-		ready = fmt.Sprintf("%d/%d", containerReady, totalContainers)
-		restarts := fmt.Sprintf("%d", containerRestarts)
-		ageS := age.String()
-
-		podInfo := map[string]string{
-			"name":     name,
-			"ready":    ready,
-			"status":   status,
-			"restarts": restarts,
-			"age":      ageS,
-		}
-		deploymentPods[deploymentName] = append(deploymentPods[deploymentName], podInfo)
+		deploymentPods[deploymentName] = append(deploymentPods[deploymentName], PodSummary(pod))
 	}
 
 	// Select one representative pod per deployment (prefer Running)
@@ -181,18 +62,140 @@ func (kc *KubernetesConfig) ListPods(namespace string) ([]map[string]string, err
 	}
 	return data, nil
 }
-func (kc *KubernetesConfig) GetPodDetail(id string, namespace string) (map[string]string, error) {
-	podlist := kc.Clientset.CoreV1().Pods(namespace)
-	listOptions := metav1.ListOptions{
-		LabelSelector: "app=" + id,
+
+// PodSummary condenses a pod into the name/ready/status/restarts/age row
+// the list endpoints and SSE streams return.
+func PodSummary(pod *v1.Pod) map[string]string {
+	podCreationTime := pod.GetCreationTimestamp()
+	age := time.Since(podCreationTime.Time).Round(time.Second)
+
+	// Get the status of each of the pods
+	podStatus := pod.Status
+
+	var containerRestarts int32
+	var containerReady int
+	var totalContainers int
+	var ready string
+	var status string
+
+	// --- ENHANCED STATUS LOGIC START ---
+	if pod.DeletionTimestamp != nil {
+		status = "Terminating"
+	} else {
+		// Look at all container statuses to find the most specific reason
+		if len(podStatus.ContainerStatuses) > 0 {
+			var worstReason string
+			var worstPriority int
+
+			for _, cs := range podStatus.ContainerStatuses {
+				// Handle Waiting state
+				if cs.State.Waiting != nil {
+					reason := cs.State.Waiting.Reason
+					message := strings.ToLower(cs.State.Waiting.Message)
+
+					prio := 0
+					switch reason {
+					case "ErrImagePull", "ImagePullBackOff":
+						prio = 6
+					case "CrashLoopBackOff":
+						prio = 5
+					case "CreateContainerConfigError", "CreateContainerError":
+						prio = 4
+					case "ContainerCreating":
+						prio = 3
+						// Detect migration/init-related activity
+						if strings.Contains(message, "migration") ||
+							strings.Contains(message, "migrate") ||
+							strings.Contains(message, "init") ||
+							strings.Contains(message, "flyway") ||
+							strings.Contains(message, "liquibase") {
+							reason = "Migrating"
+							prio = 7
+						}
+					default:
+						prio = 1
+					}
+
+					if prio > worstPriority {
+						worstPriority = prio
+						worstReason = reason
+						if cs.State.Waiting.Message != "" && reason != "Migrating" {
+							worstReason = fmt.Sprintf("%s (%s)", reason, cs.State.Waiting.Message)
+						}
+					}
+				}
+
+				// Handle Terminated state (highest priority except Terminating)
+				if cs.State.Terminated != nil {
+					var term string
+					if cs.State.Terminated.Reason != "" {
+						term = cs.State.Terminated.Reason
+					} else if cs.State.Terminated.Signal != 0 {
+						term = fmt.Sprintf("Signal:%d", cs.State.Terminated.Signal)
+					} else {
+						term = fmt.Sprintf("ExitCode:%d", cs.State.Terminated.ExitCode)
+					}
+					worstReason = term
+					worstPriority = 10
+				}
+			}
+
+			if worstReason != "" {
+				status = worstReason
+			}
+		}
+
+		// Fallback to pod phase
+		if status == "" {
+			if podStatus.Phase == "PodInitializing" {
+				status = "Initializing"
+			} else {
+				status = string(podStatus.Phase)
+			}
+		}
+	}
+
+	// If still empty (shouldn't happen), use phase
+	if status == "" {
+		status = string(podStatus.Phase)
 	}
-	pods, err := podlist.List(context.Background(), listOptions)
+	// --- ENHANCED STATUS LOGIC END ---
+
+	// Count containers and readiness
+	totalContainers = len(pod.Spec.Containers)
+	if len(podStatus.ContainerStatuses) > 0 {
+		for _, cs := range podStatus.ContainerStatuses {
+			containerRestarts += cs.RestartCount
+			if cs.Ready {
+				containerReady++
+			}
+		}
+	}
+
+	name := pod.GetName()
+	ready = fmt.Sprintf("%d/%d", containerReady, totalContainers)
+	restarts := fmt.Sprintf("%d", containerRestarts)
+	ageS := age.String()
+
+	podInfo := map[string]string{
+		"name":     name,
+		"ready":    ready,
+		"status":   status,
+		"restarts": restarts,
+		"age":      ageS,
+	}
+	return podInfo
+}
+
+func (kc *KubernetesConfig) GetPodDetail(id string, namespace string) (map[string]string, error) {
+	selector := labels.SelectorFromSet(labels.Set{"app": id})
+	pods, err := kc.listPods(context.Background(), namespace, selector)
 	if err != nil {
 		err = fmt.Errorf("error getting pods: %v ", err)
 		return nil, err
 	}
 	var data map[string]string
-	for _, pod := range pods.Items {
+	for _, pod := range pods {
 		podCreationTime := pod.GetCreationTimestamp()
 		age := time.Since(podCreationTime.Time).Round(time.Second)
 
@@ -229,19 +232,16 @@ func (kc *KubernetesConfig) GetPodDetail(id string, namespace string) (map[strin
 }
 
 func (kc *KubernetesConfig) GetDeploymentPodEvents(deploymentName, podNamespace string) ([]map[string]string, error) {
-	deploymentsClient := kc.Clientset.AppsV1().Deployments(podNamespace)
 	ctx := context.TODO()
 
 	// Get the deployment to find out which pods belong to it
-	deployment, err := deploymentsClient.Get(ctx, deploymentName, metav1.GetOptions{})
+	deployment, err := kc.getDeployment(ctx, podNamespace, deploymentName)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get deployment: %w", err)
 	}
 
 	// Get pods belonging to the deployment
-	pods, err := kc.Clientset.CoreV1().Pods(podNamespace).List(ctx, metav1.ListOptions{
-		LabelSelector: labels.Set(deployment.Spec.Selector.MatchLabels).String(),
-	})
+	pods, err := kc.listPods(ctx, podNamespace, labels.SelectorFromSet(deployment.Spec.Selector.MatchLabels))
 	if err != nil {
 		return nil, fmt.Errorf("failed to list pods: %w", err)
 	}
@@ -249,15 +249,13 @@ func (kc *KubernetesConfig) GetDeploymentPodEvents(deploymentName, podNamespace
 	var eventDetails []map[string]string
 
 	// Iterate over each pod and fetch events
-	for _, pod := range pods.Items {
-		events, err := kc.Clientset.CoreV1().Events(podNamespace).List(ctx, metav1.ListOptions{
-			FieldSelector: fmt.Sprintf("involvedObject.name=%s", pod.Name),
-		})
+	for _, pod := range pods {
+		events, err := kc.eventsFor(ctx, podNamespace, pod.Name)
 		if err != nil {
 			return nil, fmt.Errorf("failed to list events for pod %s: %w", pod.Name, err)
 		}
 
-		for _, event := range events.Items {
+		for _, event := range events {
 			eventDetail := map[string]string{
 				"PodName": pod.Name,
 				"Type":    event.Type,
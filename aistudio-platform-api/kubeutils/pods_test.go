@@ -0,0 +1,74 @@
+package kubeutils_test
+
+import (
+	"strings"
+	"testing"
+
+	"Kubernetes-api/internal/kubetest"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestListPodsPicksOnePodPerApp(t *testing.T) {
+	pending := kubetest.Pod("lab", "alice-1", "alice", "node-a", "1", "1Gi")
+	pending.Status.Phase = corev1.PodPending
+	pending.Status.ContainerStatuses = nil
+
+	crashing := kubetest.Pod("lab", "bob-0", "bob", "node-a", "1", "1Gi")
+	crashing.Status.ContainerStatuses[0].Ready = false
+	crashing.Status.ContainerStatuses[0].RestartCount = 4
+	crashing.Status.ContainerStatuses[0].State = corev1.ContainerState{
+		Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"},
+	}
+
+	h := kubetest.New(
+		pending,
+		kubetest.Pod("lab", "alice-0", "alice", "node-a", "1", "1Gi"),
+		crashing,
+		kubetest.Pod("model", "other-0", "other", "node-a", "1", "1Gi"),
+	)
+
+	pods, err := h.Kube.ListPods("lab")
+	if err != nil {
+		t.Fatalf("ListPods: %v", err)
+	}
+	if len(pods) != 2 {
+		t.Fatalf("got %d pods, want one per app: %v", len(pods), pods)
+	}
+
+	byName := map[string]map[string]string{}
+	for _, p := range pods {
+		byName[p["name"]] = p
+	}
+	if alice := byName["alice-0"]; alice == nil || alice["status"] != "Running" || alice["ready"] != "1/1" {
+		t.Errorf("alice should be represented by its running pod, got %v", pods)
+	}
+	bob := byName["bob-0"]
+	if bob == nil || !strings.HasPrefix(bob["status"], "CrashLoopBackOff") || bob["restarts"] != "4" {
+		t.Errorf("bob = %v, want CrashLoopBackOff with 4 restarts", bob)
+	}
+}
+
+func TestListPodsEmptyNamespace(t *testing.T) {
+	h := kubetest.New()
+
+	pods, err := h.Kube.ListPods("lab")
+	if err != nil {
+		t.Fatalf("ListPods: %v", err)
+	}
+	if pods == nil || len(pods) != 0 {
+		t.Fatalf("got %v, want an empty non-nil list", pods)
+	}
+}
+
+func TestGetPodDetail(t *testing.T) {
+	h := kubetest.New(kubetest.Pod("lab", "alice-0", "alice", "node-a", "1", "1Gi"))
+
+	pod, err := h.Kube.GetPodDetail("alice", "lab")
+	if err != nil {
+		t.Fatalf("GetPodDetail: %v", err)
+	}
+	if pod["name"] != "alice-0" || pod["status"] != "Running" || pod["ready"] != "1/1" {
+		t.Fatalf("unexpected detail %v", pod)
+	}
+}
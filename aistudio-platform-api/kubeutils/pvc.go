@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"strconv"
 
-	"github.com/gofiber/fiber/v2/log"
 	apiv1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
@@ -58,7 +57,11 @@ func (kc *KubernetesConfig) CreateVolumesAndMounts(gpuRequest int) ([]apiv1.Volu
 	return volumes, volumeMounts
 }
 
-func (kc *KubernetesConfig) CreatePersistentVolume(newNamespace string, pvcName string, diskStorage string) error {
+func (kc *KubernetesConfig) CreatePersistentVolume(newNamespace string, pvcName string, diskStorage string, owner Owner) error {
+	storage, err := ParseQuantity("diskStorage", diskStorage)
+	if err != nil {
+		return err
+	}
 	storageClassName := "nfs-csi-model"
 	pvcClient := kc.Clientset.CoreV1().PersistentVolumeClaims(newNamespace)
 	pvc := &apiv1.PersistentVolumeClaim{
@@ -72,14 +75,15 @@ func (kc *KubernetesConfig) CreatePersistentVolume(newNamespace string, pvcName
 			StorageClassName: &storageClassName,
 			Resources: apiv1.ResourceRequirements{
 				Requests: apiv1.ResourceList{
-					apiv1.ResourceStorage: resource.MustParse(diskStorage),
+					apiv1.ResourceStorage: storage,
 				},
 			},
 		},
 	}
-	_, err := pvcClient.Create(context.TODO(), pvc, metav1.CreateOptions{})
+	owner.label(&pvc.ObjectMeta)
+	_, err = pvcClient.Create(context.TODO(), pvc, metav1.CreateOptions{})
 	if err != nil {
-		return fmt.Errorf("failed to create PersistentVolume: %w", err)
+		return wrapAPIError("create", "persistentvolumeclaim", pvcName, err)
 	}
 	return nil
 }
@@ -88,20 +92,80 @@ func (kc *KubernetesConfig) DeletePersistentVolume(namespace string, pvcName str
 	pvcClient := kc.Clientset.CoreV1().PersistentVolumeClaims(namespace)
 	err := pvcClient.Delete(context.TODO(), pvcName, metav1.DeleteOptions{})
 	if err != nil {
-		return fmt.Errorf("failed to delete PersistentVolume: %w", err)
+		return wrapAPIError("delete", "persistentvolumeclaim", pvcName, err)
 	}
 	return nil
 }
 
-func (kc *KubernetesConfig) PersistentVolumeExists(namespace string, pvcName string) bool {
-	_, err := kc.Clientset.CoreV1().PersistentVolumes().Get(context.TODO(), pvcName, metav1.GetOptions{})
+// ClaimExists reports whether the volume claim pvcName is in namespace.
+func (kc *KubernetesConfig) ClaimExists(namespace, pvcName string) (bool, error) {
+	_, err := kc.Clientset.CoreV1().PersistentVolumeClaims(namespace).Get(context.TODO(), pvcName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, wrapAPIError("get", "persistentvolumeclaim", pvcName, err)
+	}
+	return true, nil
+}
+
+// ClaimSize is the storage the volume claim pvcName in namespace requests.
+func (kc *KubernetesConfig) ClaimSize(namespace, pvcName string) (resource.Quantity, error) {
+	pvc, err := kc.Clientset.CoreV1().PersistentVolumeClaims(namespace).Get(context.TODO(), pvcName, metav1.GetOptions{})
+	if err != nil {
+		return resource.Quantity{}, wrapAPIError("get", "persistentvolumeclaim", pvcName, err)
+	}
+	return pvc.Spec.Resources.Requests[apiv1.ResourceStorage], nil
+}
+
+// ClaimNeedsExpansion reports whether the volume claim name in namespace is
+// smaller than size and can grow to it. Claims cannot shrink, and only grow
+// when their storage class allows volume expansion; both are ErrInvalid
+// errors.
+func (kc *KubernetesConfig) ClaimNeedsExpansion(namespace, name string, size resource.Quantity) (bool, error) {
+	pvc, err := kc.Clientset.CoreV1().PersistentVolumeClaims(namespace).Get(context.TODO(), name, metav1.GetOptions{})
 	if err != nil {
-		if errors.IsNotFound(err) {
-			return false
-		}
+		return false, wrapAPIError("get", "persistentvolumeclaim", name, err)
+	}
+	return kc.needsExpansion(pvc, size)
+}
 
-		log.Error(err.Error(), "Error in persistent volume")
+// ExpandClaim grows the volume claim name in namespace to size, as
+// ClaimNeedsExpansion allows. A claim already of that size is left alone.
+func (kc *KubernetesConfig) ExpandClaim(namespace, name string, size resource.Quantity) error {
+	client := kc.Clientset.CoreV1().PersistentVolumeClaims(namespace)
+	pvc, err := client.Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return wrapAPIError("get", "persistentvolumeclaim", name, err)
 	}
+	if grow, err := kc.needsExpansion(pvc, size); err != nil || !grow {
+		return err
+	}
+	pvc.Spec.Resources.Requests[apiv1.ResourceStorage] = size
+	_, err = client.Update(context.TODO(), pvc, metav1.UpdateOptions{})
+	return wrapAPIError("update", "persistentvolumeclaim", name, err)
+}
 
-	return true
+func (kc *KubernetesConfig) needsExpansion(pvc *apiv1.PersistentVolumeClaim, size resource.Quantity) (bool, error) {
+	invalid := func(format string, args ...any) error {
+		return &Error{Op: "expand", Resource: "persistentvolumeclaim", Name: pvc.Name, Kind: ErrInvalid, Err: fmt.Errorf(format, args...)}
+	}
+	current := pvc.Spec.Resources.Requests[apiv1.ResourceStorage]
+	switch cmp := size.Cmp(current); {
+	case cmp == 0:
+		return false, nil
+	case cmp < 0:
+		return false, invalid("volumes cannot shrink from %s to %s", current.String(), size.String())
+	}
+	if pvc.Spec.StorageClassName == nil || *pvc.Spec.StorageClassName == "" {
+		return false, invalid("the volume has no storage class to expand it")
+	}
+	class, err := kc.Clientset.StorageV1().StorageClasses().Get(context.TODO(), *pvc.Spec.StorageClassName, metav1.GetOptions{})
+	if err != nil {
+		return false, wrapAPIError("get", "storageclass", *pvc.Spec.StorageClassName, err)
+	}
+	if class.AllowVolumeExpansion == nil || !*class.AllowVolumeExpansion {
+		return false, invalid("storage class %s does not allow volume expansion", class.Name)
+	}
+	return true, nil
 }
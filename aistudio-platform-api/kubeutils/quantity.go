@@ -0,0 +1,159 @@
+package kubeutils
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// ResourceSpec is the compute a workload asks for, as the API receives it.
+// Field values are Kubernetes quantities such as "500m" or "2Gi"; GPU is a
+// whole number of devices. GPUType is the GPU resource to request, such as
+// amd.com/gpu or nvidia.com/mig-1g.5gb, and GPUModel the GPU product the
+// node must have; both are optional.
+type ResourceSpec struct {
+	CPURequest    string
+	MemoryRequest string
+	CPULimit      string
+	MemoryLimit   string
+	GPU           string
+	GPUType       string
+	GPUModel      string
+	DiskStorage   string
+}
+
+// Resources is a ResourceSpec that has been parsed and checked.
+type Resources struct {
+	Requirements v1.ResourceRequirements
+	GPU          GPURequest
+	// Disk is zero when neither the spec nor its defaults ask for storage.
+	Disk resource.Quantity
+}
+
+// QuantityError reports a field of a ResourceSpec that cannot be used.
+// Field is the name the API knows the field by.
+type QuantityError struct {
+	Field  string
+	Value  string
+	Reason string
+}
+
+func (e *QuantityError) Error() string {
+	if e.Value == "" {
+		return fmt.Sprintf("%s %s", e.Field, e.Reason)
+	}
+	return fmt.Sprintf("%s %q %s", e.Field, e.Value, e.Reason)
+}
+
+// FieldError lets the API report the problem against the offending field.
+func (e *QuantityError) FieldError() (string, string) { return e.Field, e.Reason }
+
+func (e *QuantityError) StatusCode() int { return http.StatusBadRequest }
+
+func (e *QuantityError) Code() string { return "validation_failed" }
+
+// ParseQuantity parses value as a non-negative Kubernetes quantity. field
+// names the value in the returned error.
+func ParseQuantity(field, value string) (resource.Quantity, error) {
+	q, err := resource.ParseQuantity(strings.TrimSpace(value))
+	if err != nil {
+		return resource.Quantity{}, &QuantityError{Field: field, Value: value, Reason: "is not a Kubernetes quantity such as 500m or 2Gi"}
+	}
+	if q.Sign() < 0 {
+		return resource.Quantity{}, &QuantityError{Field: field, Value: value, Reason: "must not be negative"}
+	}
+	return q, nil
+}
+
+// ParseResources fills the empty fields of spec from defaults and parses
+// the result. CPU and memory requests are required once defaults are
+// applied; a missing limit is set to its request, and a limit below its
+// request is rejected.
+func ParseResources(spec, defaults ResourceSpec) (Resources, error) {
+	var res Resources
+	pick := func(value, fallback string) string {
+		if strings.TrimSpace(value) == "" {
+			return fallback
+		}
+		return value
+	}
+
+	requests := v1.ResourceList{}
+	limits := v1.ResourceList{}
+	for _, r := range []struct {
+		name         v1.ResourceName
+		requestField string
+		request      string
+		limitField   string
+		limit        string
+	}{
+		{v1.ResourceCPU, "cpuRequest", pick(spec.CPURequest, defaults.CPURequest), "cpuLimit", pick(spec.CPULimit, defaults.CPULimit)},
+		{v1.ResourceMemory, "memoryRequest", pick(spec.MemoryRequest, defaults.MemoryRequest), "memoryLimit", pick(spec.MemoryLimit, defaults.MemoryLimit)},
+	} {
+		if strings.TrimSpace(r.request) == "" {
+			return res, &QuantityError{Field: r.requestField, Reason: "is required"}
+		}
+		request, err := ParseQuantity(r.requestField, r.request)
+		if err != nil {
+			return res, err
+		}
+		limit := request.DeepCopy()
+		if strings.TrimSpace(r.limit) != "" {
+			if limit, err = ParseQuantity(r.limitField, r.limit); err != nil {
+				return res, err
+			}
+		}
+		if limit.Cmp(request) < 0 {
+			return res, &QuantityError{Field: r.limitField, Value: r.limit, Reason: fmt.Sprintf("must not be less than the request of %s", request.String())}
+		}
+		requests[r.name] = request
+		limits[r.name] = limit
+	}
+	res.Requirements = v1.ResourceRequirements{Requests: requests, Limits: limits}
+
+	gpu, err := ParseGPU(pick(spec.GPU, defaults.GPU), pick(spec.GPUType, defaults.GPUType), pick(spec.GPUModel, defaults.GPUModel))
+	if err != nil {
+		return res, err
+	}
+	res.GPU = gpu
+
+	if disk := pick(spec.DiskStorage, defaults.DiskStorage); strings.TrimSpace(disk) != "" {
+		q, err := ParseQuantity("diskStorage", disk)
+		if err != nil {
+			return res, err
+		}
+		res.Disk = q
+	}
+	return res, nil
+}
+
+// ParseGPU parses a GPU count with its optional resource name and model.
+// An empty count is zero devices.
+func ParseGPU(count, gpuType, model string) (GPURequest, error) {
+	var gpu GPURequest
+	if count = strings.TrimSpace(count); count != "" {
+		n, err := strconv.Atoi(count)
+		if err != nil || n < 0 {
+			return gpu, &QuantityError{Field: "gpuRequest", Value: count, Reason: "must be a whole number of devices"}
+		}
+		gpu.Count = n
+	}
+	if gpuType = strings.TrimSpace(gpuType); gpuType != "" {
+		if !IsGPUResource(gpuType) {
+			return gpu, &QuantityError{Field: "gpuType", Value: gpuType, Reason: "is not a supported GPU resource such as nvidia.com/gpu, amd.com/gpu or nvidia.com/mig-1g.5gb"}
+		}
+		gpu.Resource = gpuType
+	}
+	if model = strings.TrimSpace(model); model != "" {
+		if errs := validation.IsValidLabelValue(model); len(errs) > 0 {
+			return gpu, &QuantityError{Field: "gpuModel", Value: model, Reason: "is not a valid node label value"}
+		}
+		gpu.Model = model
+	}
+	return gpu, nil
+}
@@ -0,0 +1,78 @@
+package kubeutils_test
+
+import (
+	"errors"
+	"testing"
+
+	"Kubernetes-api/internal/kubetest"
+	"Kubernetes-api/kubeutils"
+)
+
+func TestParseResourcesRejectsBadQuantities(t *testing.T) {
+	valid := kubeutils.ResourceSpec{CPURequest: "500m", MemoryRequest: "1Gi", CPULimit: "1", MemoryLimit: "2Gi"}
+	tests := []struct {
+		name  string
+		edit  func(*kubeutils.ResourceSpec)
+		field string
+	}{
+		{"unparseable", func(s *kubeutils.ResourceSpec) { s.MemoryRequest = "2 gigs" }, "memoryRequest"},
+		{"negative", func(s *kubeutils.ResourceSpec) { s.CPURequest = "-1" }, "cpuRequest"},
+		{"limit below request", func(s *kubeutils.ResourceSpec) { s.CPULimit = "250m" }, "cpuLimit"},
+		{"missing request", func(s *kubeutils.ResourceSpec) { s.MemoryRequest = "" }, "memoryRequest"},
+		{"fractional gpu", func(s *kubeutils.ResourceSpec) { s.GPU = "0.5" }, "gpuRequest"},
+		{"bad disk", func(s *kubeutils.ResourceSpec) { s.DiskStorage = "lots" }, "diskStorage"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := valid
+			tt.edit(&spec)
+			_, err := kubeutils.ParseResources(spec, kubeutils.ResourceSpec{})
+			var qe *kubeutils.QuantityError
+			if !errors.As(err, &qe) || qe.Field != tt.field {
+				t.Fatalf("ParseResources error = %v, want a QuantityError for %s", err, tt.field)
+			}
+		})
+	}
+}
+
+func TestParseResourcesAppliesDefaults(t *testing.T) {
+	defaults := kubeutils.ResourceSpec{CPURequest: "500m", MemoryRequest: "1Gi", CPULimit: "2", MemoryLimit: "4Gi", GPU: "0", DiskStorage: "10Gi"}
+	res, err := kubeutils.ParseResources(kubeutils.ResourceSpec{CPURequest: "1", MemoryLimit: "8Gi"}, defaults)
+	if err != nil {
+		t.Fatalf("ParseResources: %v", err)
+	}
+	if got := res.Requirements.Requests.Cpu().String(); got != "1" {
+		t.Errorf("cpu request = %s, want 1", got)
+	}
+	if got := res.Requirements.Limits.Cpu().String(); got != "2" {
+		t.Errorf("cpu limit = %s, want 2", got)
+	}
+	if got := res.Requirements.Limits.Memory().String(); got != "8Gi" {
+		t.Errorf("memory limit = %s, want 8Gi", got)
+	}
+	if got := res.Disk.String(); got != "10Gi" {
+		t.Errorf("disk = %s, want 10Gi", got)
+	}
+
+	res, err = kubeutils.ParseResources(kubeutils.ResourceSpec{CPURequest: "1", MemoryRequest: "1Gi"}, kubeutils.ResourceSpec{})
+	if err != nil {
+		t.Fatalf("ParseResources without limits: %v", err)
+	}
+	if got := res.Requirements.Limits.Memory().String(); got != "1Gi" {
+		t.Errorf("memory limit = %s, want the request", got)
+	}
+}
+
+func TestCreatorsReturnErrorsForBadQuantities(t *testing.T) {
+	h := kubetest.New()
+	var qe *kubeutils.QuantityError
+	if err := h.Kube.CreatePersistentVolume("model", "pvc-iris", "ten gigs", kubeutils.Owner{}); !errors.As(err, &qe) {
+		t.Errorf("CreatePersistentVolume error = %v, want a QuantityError", err)
+	}
+	if _, err := h.Kube.CheckMemoryAvailability("2 gigs"); !errors.As(err, &qe) {
+		t.Errorf("CheckMemoryAvailability error = %v, want a QuantityError", err)
+	}
+	if _, err := kubeutils.ConfigResource("1", "1Gi", "1", "512Mi"); !errors.As(err, &qe) || qe.Field != "memoryLimit" {
+		t.Errorf("ConfigResource error = %v, want a memoryLimit QuantityError", err)
+	}
+}
@@ -0,0 +1,497 @@
+package kubeutils
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/yaml"
+)
+
+// Labels that record who a workload belongs to, so quota usage can be read
+// back from the cluster. The team is recorded under TenantLabel.
+const (
+	UserLabel     = "aistudio/user"
+	WorkloadLabel = "aistudio/workload"
+)
+
+// Workload kinds WorkloadLabel takes.
+const (
+	WorkloadLabspace = "labspace"
+	WorkloadModel    = "model"
+	WorkloadLLM      = "llm"
+)
+
+// Quota subject kinds.
+const (
+	QuotaUser = "user"
+	QuotaTeam = "team"
+)
+
+// Owner is who a workload is created for. Its labels are put on the
+// workload, its pods and its volumes.
+type Owner struct {
+	User     string
+	Team     string
+	Workload string
+}
+
+// Labels are the owner labels that are set.
+func (o Owner) Labels() map[string]string {
+	out := map[string]string{}
+	for key, value := range map[string]string{UserLabel: o.User, TenantLabel: o.Team, WorkloadLabel: o.Workload} {
+		if value != "" {
+			out[key] = value
+		}
+	}
+	return out
+}
+
+// label adds the owner labels to meta.
+func (o Owner) label(meta *metav1.ObjectMeta) {
+	for key, value := range o.Labels() {
+		if meta.Labels == nil {
+			meta.Labels = map[string]string{}
+		}
+		meta.Labels[key] = value
+	}
+}
+
+// QuotaUsage is what a subject's workloads ask for, in base units.
+// Labspaces and Deployments count objects; model and LLM deployments both
+// count as deployments.
+type QuotaUsage struct {
+	CPUMillicores int64 `json:"cpuMillicores"`
+	MemoryBytes   int64 `json:"memoryBytes"`
+	GPUs          int64 `json:"gpus"`
+	DiskBytes     int64 `json:"diskBytes"`
+	Labspaces     int64 `json:"labspaces"`
+	Deployments   int64 `json:"deployments"`
+}
+
+func (u QuotaUsage) plus(o QuotaUsage) QuotaUsage {
+	return QuotaUsage{
+		CPUMillicores: u.CPUMillicores + o.CPUMillicores,
+		MemoryBytes:   u.MemoryBytes + o.MemoryBytes,
+		GPUs:          u.GPUs + o.GPUs,
+		DiskBytes:     u.DiskBytes + o.DiskBytes,
+		Labspaces:     u.Labspaces + o.Labspaces,
+		Deployments:   u.Deployments + o.Deployments,
+	}
+}
+
+// WorkloadUsage is the CPU, memory and GPU requests of containers containers
+// that each get resources and gpu, as the create endpoints configure them.
+func WorkloadUsage(resources v1.ResourceRequirements, gpu GPURequest, containers int) QuotaUsage {
+	n := int64(containers)
+	return QuotaUsage{
+		CPUMillicores: resources.Requests.Cpu().MilliValue() * n,
+		MemoryBytes:   resources.Requests.Memory().Value() * n,
+		GPUs:          int64(gpu.Count) * n,
+	}
+}
+
+// QuotaCaps are the limits of one subject in the units of QuotaUsage. A nil
+// field is unlimited.
+type QuotaCaps struct {
+	CPUMillicores *int64 `json:"cpuMillicores,omitempty"`
+	MemoryBytes   *int64 `json:"memoryBytes,omitempty"`
+	GPUs          *int64 `json:"gpus,omitempty"`
+	DiskBytes     *int64 `json:"diskBytes,omitempty"`
+	Labspaces     *int64 `json:"labspaces,omitempty"`
+	Deployments   *int64 `json:"deployments,omitempty"`
+}
+
+// over lists the resources where u goes beyond c, with the amounts.
+func (c QuotaCaps) over(u QuotaUsage) []string {
+	var out []string
+	check := func(name string, used int64, limit *int64) {
+		if limit != nil && used > *limit {
+			out = append(out, fmt.Sprintf("%s %d over the limit of %d", name, used, *limit))
+		}
+	}
+	check("cpuMillicores", u.CPUMillicores, c.CPUMillicores)
+	check("memoryBytes", u.MemoryBytes, c.MemoryBytes)
+	check("gpus", u.GPUs, c.GPUs)
+	check("diskBytes", u.DiskBytes, c.DiskBytes)
+	check("labspaces", u.Labspaces, c.Labspaces)
+	check("deployments", u.Deployments, c.Deployments)
+	return out
+}
+
+// QuotaLimits are the limits of a subject as written in the quota policy,
+// in Kubernetes quantities. An omitted field is unlimited.
+type QuotaLimits struct {
+	CPU         *resource.Quantity `json:"cpu,omitempty"`
+	Memory      *resource.Quantity `json:"memory,omitempty"`
+	GPU         *resource.Quantity `json:"gpu,omitempty"`
+	Disk        *resource.Quantity `json:"disk,omitempty"`
+	Labspaces   *int64             `json:"labspaces,omitempty"`
+	Deployments *int64             `json:"deployments,omitempty"`
+}
+
+// over returns l with the fields o sets replaced.
+func (l QuotaLimits) over(o QuotaLimits) QuotaLimits {
+	if o.CPU != nil {
+		l.CPU = o.CPU
+	}
+	if o.Memory != nil {
+		l.Memory = o.Memory
+	}
+	if o.GPU != nil {
+		l.GPU = o.GPU
+	}
+	if o.Disk != nil {
+		l.Disk = o.Disk
+	}
+	if o.Labspaces != nil {
+		l.Labspaces = o.Labspaces
+	}
+	if o.Deployments != nil {
+		l.Deployments = o.Deployments
+	}
+	return l
+}
+
+func (l QuotaLimits) caps() QuotaCaps {
+	value := func(q *resource.Quantity, milli bool) *int64 {
+		if q == nil {
+			return nil
+		}
+		v := q.Value()
+		if milli {
+			v = q.MilliValue()
+		}
+		return &v
+	}
+	return QuotaCaps{
+		CPUMillicores: value(l.CPU, true),
+		MemoryBytes:   value(l.Memory, false),
+		GPUs:          value(l.GPU, false),
+		DiskBytes:     value(l.Disk, false),
+		Labspaces:     l.Labspaces,
+		Deployments:   l.Deployments,
+	}
+}
+
+// QuotaPolicy is the limits the API enforces when workloads are created.
+// A user or team listed by name gets the default limits with the fields
+// its entry sets replaced. It can be loaded from YAML with LoadQuotaPolicy,
+// using the JSON names.
+type QuotaPolicy struct {
+	Defaults QuotaDefaults          `json:"defaults,omitempty"`
+	Users    map[string]QuotaLimits `json:"users,omitempty"`
+	Teams    map[string]QuotaLimits `json:"teams,omitempty"`
+}
+
+// QuotaDefaults are the limits of users and teams the policy does not name.
+type QuotaDefaults struct {
+	User QuotaLimits `json:"user,omitempty"`
+	Team QuotaLimits `json:"team,omitempty"`
+}
+
+// LoadQuotaPolicy reads the quota policy at path.
+func LoadQuotaPolicy(path string) (*QuotaPolicy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read quota policy: %w", err)
+	}
+	var p QuotaPolicy
+	if err := yaml.UnmarshalStrict(data, &p); err != nil {
+		return nil, fmt.Errorf("failed to parse quota policy %s: %w", path, err)
+	}
+	return &p, nil
+}
+
+// Limits are the caps of subject, a user or team as kind says.
+func (p *QuotaPolicy) Limits(kind, subject string) QuotaCaps {
+	if kind == QuotaTeam {
+		return p.Defaults.Team.over(p.Teams[subject]).caps()
+	}
+	return p.Defaults.User.over(p.Users[subject]).caps()
+}
+
+// QuotaReport is a subject's usage, across every cluster, against its
+// limits. Exceeded lists the resources already over their limit, which
+// happens when the policy is tightened after workloads were created.
+type QuotaReport struct {
+	Subject  string     `json:"subject"`
+	Kind     string     `json:"kind"`
+	Usage    QuotaUsage `json:"usage"`
+	Limits   QuotaCaps  `json:"limits"`
+	Exceeded []string   `json:"exceeded,omitempty"`
+}
+
+// WorkloadRef names a workload on one cluster.
+type WorkloadRef struct {
+	Cluster   string
+	Namespace string
+	Name      string
+}
+
+// QuotaRequest is a workload about to be created for Owner. Replaces lists
+// the workloads and volumes it takes the place of, such as the previous
+// deployment of the same name, which are left out of the current usage.
+type QuotaRequest struct {
+	Owner    Owner
+	Add      QuotaUsage
+	Replaces []WorkloadRef
+}
+
+// ValidateQuotaSubject checks that subject can be stored as a label value,
+// as owner labels are.
+func ValidateQuotaSubject(kind, subject string) error {
+	if subject == "" {
+		return &Error{Op: "check", Resource: "quota", Kind: ErrInvalid, Err: fmt.Errorf("the %s is empty", kind)}
+	}
+	if errs := validation.IsValidLabelValue(subject); len(errs) > 0 {
+		return &Error{Op: "check", Resource: "quota", Name: subject, Kind: ErrInvalid, Err: fmt.Errorf("invalid %s: %s", kind, strings.Join(errs, "; "))}
+	}
+	return nil
+}
+
+// QuotaReport adds up the usage of subject on every cluster. With no quota
+// policy every limit is unlimited.
+func (r *Clusters) QuotaReport(kind, subject string) (QuotaReport, error) {
+	if err := ValidateQuotaSubject(kind, subject); err != nil {
+		return QuotaReport{}, err
+	}
+	usage, err := r.quotaUsage(kind, subject, nil)
+	if err != nil {
+		return QuotaReport{}, err
+	}
+	report := QuotaReport{Subject: subject, Kind: kind, Usage: usage}
+	if r.Quotas != nil {
+		report.Limits = r.Quotas.Limits(kind, subject)
+		report.Exceeded = report.Limits.over(usage)
+	}
+	return report, nil
+}
+
+// CheckQuota fails with ErrQuotaExceeded when creating req would take its
+// user or team over a limit of the quota policy. It passes when there is
+// no policy. Usage is read from every cluster, so a cluster that cannot be
+// reached fails the check rather than letting the request through. The
+// usage held by ReserveQuota counts as if it were already in the cluster.
+func (r *Clusters) CheckQuota(req QuotaRequest) error {
+	if r.Quotas == nil {
+		return nil
+	}
+	r.quotaMu.Lock()
+	defer r.quotaMu.Unlock()
+	return r.checkQuota(req)
+}
+
+// ReserveQuota is CheckQuota that, when req passes, holds its usage until
+// release is called. Workloads are created by jobs that run after the
+// request was checked, so without the hold a second request checked before
+// the first one's workload exists would not see it. Release once the
+// workload exists or its creation failed; calling it again does nothing.
+func (r *Clusters) ReserveQuota(req QuotaRequest) (release func(), err error) {
+	if r.Quotas == nil {
+		return func() {}, nil
+	}
+	r.quotaMu.Lock()
+	defer r.quotaMu.Unlock()
+	if err := r.checkQuota(req); err != nil {
+		return nil, err
+	}
+	held := &req
+	r.reserved[held] = struct{}{}
+	return func() {
+		r.quotaMu.Lock()
+		defer r.quotaMu.Unlock()
+		delete(r.reserved, held)
+	}, nil
+}
+
+// checkQuota is CheckQuota with quotaMu held.
+func (r *Clusters) checkQuota(req QuotaRequest) error {
+	subjects := []struct{ kind, name string }{{QuotaUser, req.Owner.User}, {QuotaTeam, req.Owner.Team}}
+	var reasons []string
+	for _, s := range subjects {
+		if s.name == "" {
+			continue
+		}
+		reserved, skip := r.reservedUsage(s.kind, s.name, req.Replaces)
+		usage, err := r.quotaUsage(s.kind, s.name, skip)
+		if err != nil {
+			return err
+		}
+		usage = usage.plus(reserved)
+		for _, reason := range r.Quotas.Limits(s.kind, s.name).over(usage.plus(req.Add)) {
+			reasons = append(reasons, fmt.Sprintf("%s %s would use %s", s.kind, s.name, reason))
+		}
+	}
+	if len(reasons) > 0 {
+		return &Error{Op: "create", Resource: req.Owner.Workload, Kind: ErrQuotaExceeded, Err: fmt.Errorf("quota exceeded: %s", strings.Join(reasons, "; "))}
+	}
+	return nil
+}
+
+// reservedUsage adds up the reservations of subject, leaving out those for
+// a workload skip names, which the request being checked replaces. It
+// returns skip with the workloads the counted reservations replace added,
+// so a workload whose job is still creating it is not counted twice.
+func (r *Clusters) reservedUsage(kind, subject string, skip []WorkloadRef) (QuotaUsage, []WorkloadRef) {
+	var total QuotaUsage
+	out := append([]WorkloadRef(nil), skip...)
+	for held := range r.reserved {
+		owner := held.Owner.User
+		if kind == QuotaTeam {
+			owner = held.Owner.Team
+		}
+		if owner != subject || replacesAny(held.Replaces, skip) {
+			continue
+		}
+		total = total.plus(held.Add)
+		out = append(out, held.Replaces...)
+	}
+	return total, out
+}
+
+func replacesAny(refs, skip []WorkloadRef) bool {
+	for _, ref := range refs {
+		for _, s := range skip {
+			if ref == s {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (r *Clusters) quotaUsage(kind, subject string, skip []WorkloadRef) (QuotaUsage, error) {
+	key := UserLabel
+	if kind == QuotaTeam {
+		key = TenantLabel
+	}
+	selector := labels.SelectorFromSet(labels.Set{key: subject})
+
+	var total QuotaUsage
+	for _, c := range r.list {
+		owned, err := c.Kube.ownedWorkloads(selector)
+		if err != nil {
+			return QuotaUsage{}, fmt.Errorf("cluster %s: %w", c.Name, err)
+		}
+		for _, w := range owned {
+			if !w.in(c.Name, skip) {
+				total = total.plus(w.usage)
+			}
+		}
+	}
+	return total, nil
+}
+
+// ownedWorkload is the usage of one labelled object.
+type ownedWorkload struct {
+	namespace string
+	name      string
+	usage     QuotaUsage
+}
+
+func (w ownedWorkload) in(cluster string, refs []WorkloadRef) bool {
+	for _, ref := range refs {
+		if ref.Cluster == cluster && ref.Namespace == w.namespace && ref.Name == w.name {
+			return true
+		}
+	}
+	return false
+}
+
+// ownedWorkloads lists the labspaces, deployments and deployment volumes
+// selector matches in every namespace, from the informer cache once it has
+// synced. Labspace volumes count for as long as the statefulset exists,
+// even when it is scaled down, since they are kept.
+func (kc *KubernetesConfig) ownedWorkloads(selector labels.Selector) ([]ownedWorkload, error) {
+	cfg, err := kc.GetVendorConfig()
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.TODO()
+
+	var out []ownedWorkload
+	statefulSets, err := kc.listStatefulSets(ctx, "", selector)
+	if err != nil {
+		return nil, wrapAPIError("list", "statefulsets", "", err)
+	}
+	// templates maps the name prefix of the claims made from each claim
+	// template to the template's size and the statefulset's entry in out.
+	type claimTemplate struct {
+		size  int64
+		owner int
+	}
+	templates := make(map[string]claimTemplate)
+	for _, sts := range statefulSets {
+		usage := cfg.templateUsage(sts.Spec.Template.Spec, sts.Spec.Replicas)
+		usage.Labspaces = 1
+		for _, claim := range sts.Spec.VolumeClaimTemplates {
+			size := claim.Spec.Resources.Requests.Storage().Value()
+			usage.DiskBytes += size
+			templates[sts.Namespace+"/"+claim.Name+"-"+sts.Name+"-"] = claimTemplate{size: size, owner: len(out)}
+		}
+		out = append(out, ownedWorkload{namespace: sts.Namespace, name: sts.Name, usage: usage})
+	}
+
+	deployments, err := kc.listDeployments(ctx, "", selector)
+	if err != nil {
+		return nil, wrapAPIError("list", "deployments", "", err)
+	}
+	for _, d := range deployments {
+		usage := cfg.templateUsage(d.Spec.Template.Spec, d.Spec.Replicas)
+		usage.Deployments = 1
+		out = append(out, ownedWorkload{namespace: d.Namespace, name: d.Name, usage: usage})
+	}
+
+	claims, err := kc.listClaims(ctx, "", selector)
+	if err != nil {
+		return nil, wrapAPIError("list", "persistentvolumeclaims", "", err)
+	}
+	for _, pvc := range claims {
+		// Claims made from a labspace's claim template are counted with
+		// the statefulset, by what they have grown to since.
+		if pvc.Labels[WorkloadLabel] == WorkloadLabspace {
+			prefix := pvc.Namespace + "/" + pvc.Name[:strings.LastIndex(pvc.Name, "-")+1]
+			if t, ok := templates[prefix]; ok {
+				if grown := pvc.Spec.Resources.Requests.Storage().Value() - t.size; grown > 0 {
+					out[t.owner].usage.DiskBytes += grown
+				}
+			}
+			continue
+		}
+		usage := QuotaUsage{DiskBytes: pvc.Spec.Resources.Requests.Storage().Value()}
+		out = append(out, ownedWorkload{namespace: pvc.Namespace, name: pvc.Name, usage: usage})
+	}
+	return out, nil
+}
+
+// PodUsage is the CPU, memory and GPU requests of one pod made from spec.
+func (kc *KubernetesConfig) PodUsage(spec v1.PodSpec) (QuotaUsage, error) {
+	cfg, err := kc.GetVendorConfig()
+	if err != nil {
+		return QuotaUsage{}, err
+	}
+	return cfg.templateUsage(spec, nil), nil
+}
+
+// templateUsage is the CPU, memory and GPU requests of replicas pods made
+// from spec.
+func (cfg VendorConfig) templateUsage(spec v1.PodSpec, replicas *int32) QuotaUsage {
+	n := int64(1)
+	if replicas != nil {
+		n = int64(*replicas)
+	}
+	var usage QuotaUsage
+	for _, c := range spec.Containers {
+		usage.CPUMillicores += c.Resources.Requests.Cpu().MilliValue() * n
+		usage.MemoryBytes += c.Resources.Requests.Memory().Value() * n
+		usage.GPUs += cfg.totalGPUs(c.Resources.Requests) * n
+	}
+	return usage
+}
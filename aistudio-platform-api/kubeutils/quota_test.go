@@ -0,0 +1,185 @@
+package kubeutils_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"Kubernetes-api/internal/kubetest"
+	"Kubernetes-api/kubeutils"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func quotaPolicy(t *testing.T, doc string) *kubeutils.QuotaPolicy {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "quotas.yaml")
+	if err := os.WriteFile(path, []byte(doc), 0600); err != nil {
+		t.Fatal(err)
+	}
+	policy, err := kubeutils.LoadQuotaPolicy(path)
+	if err != nil {
+		t.Fatalf("LoadQuotaPolicy: %v", err)
+	}
+	return policy
+}
+
+func TestQuotaPolicyLimits(t *testing.T) {
+	policy := quotaPolicy(t, "defaults:\n  user:\n    cpu: 500m\n    gpu: \"1\"\n    labspaces: 2\nusers:\n  alice:\n    gpu: \"4\"\n")
+
+	alice := policy.Limits(kubeutils.QuotaUser, "alice")
+	if *alice.GPUs != 4 || *alice.CPUMillicores != 500 || *alice.Labspaces != 2 {
+		t.Errorf("alice limits = gpus %d, cpu %d, labspaces %d, want the override on top of the defaults", *alice.GPUs, *alice.CPUMillicores, *alice.Labspaces)
+	}
+	if bob := policy.Limits(kubeutils.QuotaUser, "bob"); *bob.GPUs != 1 || bob.MemoryBytes != nil {
+		t.Errorf("bob limits = %+v, want the defaults with memory unlimited", bob)
+	}
+	if team := policy.Limits(kubeutils.QuotaTeam, "vision"); team.GPUs != nil {
+		t.Errorf("team limits = %+v, want unlimited", team)
+	}
+}
+
+func TestCheckQuota(t *testing.T) {
+	h := kubetest.New(kubetest.Node("gpu-a", "16", "64Gi", "4"))
+	h.Clusters.Quotas = quotaPolicy(t, "defaults:\n  user:\n    gpu: \"2\"\n    labspaces: 2\n  team:\n    cpu: \"3\"\n")
+
+	owner := kubeutils.Owner{User: "alice", Team: "vision", Workload: kubeutils.WorkloadLabspace}
+	resources := v1.ResourceRequirements{Requests: v1.ResourceList{
+		v1.ResourceCPU:    resource.MustParse("2"),
+		v1.ResourceMemory: resource.MustParse("4Gi"),
+	}}
+	gpu := kubeutils.GPURequest{Count: 1}
+	if err := h.Kube.CreateStatefulSet("lab", "alice", "notebook-alice", "jupyter", gpu, 8888, "10Gi", "gpu", resources, nil, owner); err != nil {
+		t.Fatalf("CreateStatefulSet: %v", err)
+	}
+
+	report, err := h.Clusters.QuotaReport(kubeutils.QuotaUser, "alice")
+	if err != nil {
+		t.Fatalf("QuotaReport: %v", err)
+	}
+	want := kubeutils.QuotaUsage{CPUMillicores: 2000, MemoryBytes: 4 << 30, GPUs: 1, DiskBytes: 10 << 30, Labspaces: 1}
+	if report.Usage != want {
+		t.Errorf("usage = %+v, want %+v", report.Usage, want)
+	}
+	if *report.Limits.GPUs != 2 || len(report.Exceeded) != 0 {
+		t.Errorf("report = %+v, want a GPU limit of 2 and nothing exceeded", report)
+	}
+
+	add := kubeutils.WorkloadUsage(resources, gpu, 1)
+	add.Labspaces = 1
+	err = h.Clusters.CheckQuota(kubeutils.QuotaRequest{Owner: kubeutils.Owner{User: "alice"}, Add: add})
+	if err != nil {
+		t.Errorf("a second labspace within alice's quota was refused: %v", err)
+	}
+	// The team already uses 2 of its 3 CPUs.
+	err = h.Clusters.CheckQuota(kubeutils.QuotaRequest{Owner: owner, Add: add})
+	if !errors.Is(err, kubeutils.ErrQuotaExceeded) {
+		t.Errorf("CheckQuota over the team's CPU = %v, want ErrQuotaExceeded", err)
+	}
+	err = h.Clusters.CheckQuota(kubeutils.QuotaRequest{
+		Owner:    owner,
+		Add:      add,
+		Replaces: []kubeutils.WorkloadRef{{Cluster: kubeutils.DefaultClusterName, Namespace: "lab", Name: "alice"}},
+	})
+	if err != nil {
+		t.Errorf("replacing the labspace was refused: %v", err)
+	}
+
+	h.Clusters.Quotas = nil
+	if err := h.Clusters.CheckQuota(kubeutils.QuotaRequest{Owner: owner, Add: kubeutils.QuotaUsage{GPUs: 100}}); err != nil {
+		t.Errorf("without a policy CheckQuota = %v, want nil", err)
+	}
+}
+
+func TestReserveQuota(t *testing.T) {
+	h := kubetest.New(kubetest.Node("node-a", "8", "32Gi", ""))
+	h.Clusters.Quotas = quotaPolicy(t, "defaults:\n  user:\n    deployments: 2\n")
+
+	owner := kubeutils.Owner{User: "alice", Workload: kubeutils.WorkloadModel}
+	deployment := func(name string) kubeutils.QuotaRequest {
+		return kubeutils.QuotaRequest{
+			Owner:    owner,
+			Add:      kubeutils.QuotaUsage{Deployments: 1},
+			Replaces: []kubeutils.WorkloadRef{{Cluster: kubeutils.DefaultClusterName, Namespace: "model", Name: name}},
+		}
+	}
+	releaseIris, err := h.Clusters.ReserveQuota(deployment("iris"))
+	if err != nil {
+		t.Fatalf("ReserveQuota: %v", err)
+	}
+	// While its job runs the deployment is counted once, whether or not
+	// it has been created yet.
+	if err := h.Kube.ConfigModelDeployment("model", "iris", "serve", "pvc-iris", kubeutils.GPURequest{}, 9000, "cpu", v1.ResourceRequirements{}, nil, owner); err != nil {
+		t.Fatalf("ConfigModelDeployment: %v", err)
+	}
+	releaseResnet, err := h.Clusters.ReserveQuota(deployment("resnet"))
+	if err != nil {
+		t.Fatalf("second deployment within the quota was refused: %v", err)
+	}
+	if _, err := h.Clusters.ReserveQuota(deployment("bert")); !errors.Is(err, kubeutils.ErrQuotaExceeded) {
+		t.Errorf("third deployment while two are reserved = %v, want ErrQuotaExceeded", err)
+	}
+	if err := h.Clusters.CheckQuota(deployment("resnet")); err != nil {
+		t.Errorf("redeploying a reserved deployment was refused: %v", err)
+	}
+
+	releaseIris()
+	releaseResnet()
+	releaseResnet()
+	if err := h.Clusters.CheckQuota(deployment("bert")); err != nil {
+		t.Errorf("deployment after the reservations were released was refused: %v", err)
+	}
+}
+
+func TestQuotaCountsGrownLabspaceVolume(t *testing.T) {
+	claim := kubetest.Claim("lab", "jl-alice-0", "nfs-csi-model", "25Gi")
+	claim.Labels = map[string]string{kubeutils.UserLabel: "alice", kubeutils.WorkloadLabel: kubeutils.WorkloadLabspace}
+	h := kubetest.New(kubetest.Node("node-a", "8", "32Gi", ""), claim)
+	owner := kubeutils.Owner{User: "alice", Workload: kubeutils.WorkloadLabspace}
+	if err := h.Kube.CreateStatefulSet("lab", "alice", "notebook-alice", "jupyter", kubeutils.GPURequest{}, 8888, "10Gi", "", v1.ResourceRequirements{}, nil, owner); err != nil {
+		t.Fatalf("CreateStatefulSet: %v", err)
+	}
+
+	report, err := h.Clusters.QuotaReport(kubeutils.QuotaUser, "alice")
+	if err != nil {
+		t.Fatalf("QuotaReport: %v", err)
+	}
+	if report.Usage.DiskBytes != 25<<30 {
+		t.Errorf("disk usage = %d, want the 25Gi the volume was expanded to", report.Usage.DiskBytes)
+	}
+}
+
+func TestQuotaUsageIsServedFromCache(t *testing.T) {
+	h := kubetest.New(kubetest.Node("node-a", "8", "32Gi", ""))
+	resources := v1.ResourceRequirements{Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("1")}}
+	alice := kubeutils.Owner{User: "alice", Team: "vision", Workload: kubeutils.WorkloadLabspace}
+	if err := h.Kube.CreateStatefulSet("lab", "alice", "notebook-alice", "jupyter", kubeutils.GPURequest{}, 8888, "10Gi", "", resources, nil, alice); err != nil {
+		t.Fatalf("CreateStatefulSet: %v", err)
+	}
+	if err := h.Kube.CreatePersistentVolume("model", "pvc-iris", "5Gi", kubeutils.Owner{User: "alice", Team: "vision", Workload: kubeutils.WorkloadModel}); err != nil {
+		t.Fatalf("CreatePersistentVolume: %v", err)
+	}
+	if err := h.Kube.CreatePersistentVolume("model", "pvc-churn", "7Gi", kubeutils.Owner{User: "bob", Team: "speech", Workload: kubeutils.WorkloadModel}); err != nil {
+		t.Fatalf("CreatePersistentVolume: %v", err)
+	}
+	h.StartCache(t)
+	failLists(h)
+
+	for _, tc := range []struct {
+		kind, subject string
+		want          kubeutils.QuotaUsage
+	}{
+		{kubeutils.QuotaUser, "alice", kubeutils.QuotaUsage{CPUMillicores: 1000, DiskBytes: 15 << 30, Labspaces: 1}},
+		{kubeutils.QuotaTeam, "speech", kubeutils.QuotaUsage{DiskBytes: 7 << 30}},
+	} {
+		report, err := h.Clusters.QuotaReport(tc.kind, tc.subject)
+		if err != nil {
+			t.Fatalf("QuotaReport(%s %s): %v", tc.kind, tc.subject, err)
+		}
+		if report.Usage != tc.want {
+			t.Errorf("%s %s usage = %+v, want %+v", tc.kind, tc.subject, report.Usage, tc.want)
+		}
+	}
+}
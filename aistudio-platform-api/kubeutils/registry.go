@@ -0,0 +1,244 @@
+package kubeutils
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"sigs.k8s.io/yaml"
+)
+
+// DefaultClusterName names the only cluster of a registry built with
+// SingleCluster.
+const DefaultClusterName = "default"
+
+// Cluster is one registered cluster.
+type Cluster struct {
+	Name string
+	Kube *KubernetesConfig
+}
+
+// Clusters is the registry of clusters the API manages. The first cluster
+// is the default, used whenever a request does not name one.
+type Clusters struct {
+	list   []Cluster
+	byName map[string]Cluster
+	// Quotas, when set, is enforced by CheckQuota and ReserveQuota across
+	// every cluster.
+	Quotas *QuotaPolicy
+
+	// quotaMu orders quota checks with the reservations they count.
+	quotaMu  sync.Mutex
+	reserved map[*QuotaRequest]struct{}
+}
+
+// NewClusters registers clusters in order. Names must be unique and not
+// empty, and at least one cluster is required.
+func NewClusters(clusters ...Cluster) (*Clusters, error) {
+	if len(clusters) == 0 {
+		return nil, fmt.Errorf("at least one cluster is required")
+	}
+	r := &Clusters{byName: make(map[string]Cluster, len(clusters)), reserved: make(map[*QuotaRequest]struct{})}
+	for _, c := range clusters {
+		if c.Name == "" {
+			return nil, fmt.Errorf("cluster has no name")
+		}
+		if _, ok := r.byName[c.Name]; ok {
+			return nil, fmt.Errorf("cluster %q is registered twice", c.Name)
+		}
+		r.list = append(r.list, c)
+		r.byName[c.Name] = c
+	}
+	return r, nil
+}
+
+// SingleCluster is a registry of kc alone, named DefaultClusterName.
+func SingleCluster(kc *KubernetesConfig) *Clusters {
+	r, _ := NewClusters(Cluster{Name: DefaultClusterName, Kube: kc})
+	return r
+}
+
+// Default is the cluster requests go to when they name none.
+func (r *Clusters) Default() Cluster {
+	return r.list[0]
+}
+
+// All returns the clusters in registration order.
+func (r *Clusters) All() []Cluster {
+	return append([]Cluster(nil), r.list...)
+}
+
+// Len is the number of registered clusters.
+func (r *Clusters) Len() int {
+	return len(r.list)
+}
+
+// Get returns the cluster called name, or the default cluster when name is
+// empty. An unknown name is an ErrNotFound error.
+func (r *Clusters) Get(name string) (Cluster, error) {
+	if name == "" {
+		return r.Default(), nil
+	}
+	c, ok := r.byName[name]
+	if !ok {
+		return Cluster{}, &Error{Op: "get", Resource: "cluster", Name: name, Kind: ErrNotFound, Err: fmt.Errorf("cluster %q is not registered", name)}
+	}
+	return c, nil
+}
+
+// StartCaches starts the informer cache of every cluster. It returns once
+// all have synced or ctx is done, with the errors of those that did not.
+func (r *Clusters) StartCaches(ctx context.Context) error {
+	errs := make(chan error, len(r.list))
+	for _, c := range r.list {
+		go func(c Cluster) {
+			if err := c.Kube.StartCache(ctx); err != nil {
+				errs <- fmt.Errorf("cluster %s: %w", c.Name, err)
+				return
+			}
+			errs <- nil
+		}(c)
+	}
+	var failed []string
+	for range r.list {
+		if err := <-errs; err != nil {
+			failed = append(failed, err.Error())
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("informer caches did not sync: %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// Place returns the first cluster, in registration order, where req fits
+// on a single node. req.NodeSelector is replaced with each cluster's
+// WorkloadNodeSelector for nodeType, as the create endpoints do, since
+// vendors use different selector keys. The error says why every cluster
+// turned the request down.
+func (r *Clusters) Place(req ScheduleRequest, nodeType string) (Cluster, error) {
+	reasons := make([]string, 0, len(r.list))
+	for _, c := range r.list {
+		req.NodeSelector = c.Kube.WorkloadNodeSelector(nodeType)
+		result, err := c.Kube.CanSchedule(req)
+		if err == nil {
+			err = result.Err()
+		}
+		if err == nil {
+			return c, nil
+		}
+		reasons = append(reasons, fmt.Sprintf("cluster %s: %v", c.Name, err))
+	}
+	return Cluster{}, fmt.Errorf("no cluster can fit the request: %s", strings.Join(reasons, "; "))
+}
+
+// ClusterConfig is one cluster entry of the file LoadClusters reads. Each
+// cluster is reached like the single cluster of Options: through a
+// kubeconfig and context, or the in-cluster service account.
+type ClusterConfig struct {
+	Name       string `json:"name"`
+	Kubeconfig string `json:"kubeconfig,omitempty"`
+	Context    string `json:"context,omitempty"`
+	InCluster  bool   `json:"inCluster,omitempty"`
+}
+
+// ClusterRegistry is the YAML document LoadClusters reads. The first
+// cluster is the default.
+type ClusterRegistry struct {
+	Clusters []ClusterConfig `json:"clusters"`
+}
+
+// LoadClusters builds a registry from the YAML file at path. Settings that
+// are not per cluster, such as the rate limits and vendor profiles, come
+// from base.
+func LoadClusters(path string, base Options) (*Clusters, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cluster registry: %w", err)
+	}
+	var doc ClusterRegistry
+	if err := yaml.UnmarshalStrict(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse cluster registry %s: %w", path, err)
+	}
+
+	clusters := make([]Cluster, 0, len(doc.Clusters))
+	for _, cfg := range doc.Clusters {
+		opts := base
+		opts.Kubeconfig = cfg.Kubeconfig
+		opts.Context = cfg.Context
+		opts.InCluster = cfg.InCluster
+		kc, err := NewKubernetesConfig(opts)
+		if err != nil {
+			return nil, fmt.Errorf("cluster %s: %w", cfg.Name, err)
+		}
+		clusters = append(clusters, Cluster{Name: cfg.Name, Kube: kc})
+	}
+	r, err := NewClusters(clusters...)
+	if err != nil {
+		return nil, fmt.Errorf("cluster registry %s: %w", path, err)
+	}
+	return r, nil
+}
+
+// ClusterSummary is one cluster in the aggregated resource view. Error is
+// set, and the totals left empty, when the cluster could not be read.
+type ClusterSummary struct {
+	Name        string          `json:"name"`
+	Default     bool            `json:"default"`
+	Vendor      string          `json:"vendor,omitempty"`
+	Nodes       int             `json:"nodes"`
+	Allocatable ResourceAmounts `json:"allocatable"`
+	Requested   ResourceAmounts `json:"requested"`
+	Available   ResourceAmounts `json:"available"`
+	GPUs        []GPUInventory  `json:"gpus,omitempty"`
+	Error       string          `json:"error,omitempty"`
+}
+
+// ClusterResources totals the resources of every registered cluster.
+type ClusterResources struct {
+	Clusters    []ClusterSummary `json:"clusters"`
+	Allocatable ResourceAmounts  `json:"allocatable"`
+	Requested   ResourceAmounts  `json:"requested"`
+	Available   ResourceAmounts  `json:"available"`
+}
+
+// Resources summarises every cluster and adds them up. A cluster that
+// cannot be reached is reported with its error and left out of the totals,
+// so one unreachable cluster does not hide the others.
+func (r *Clusters) Resources() ClusterResources {
+	var out ClusterResources
+	for i, c := range r.list {
+		summary := c.summary()
+		summary.Default = i == 0
+		out.Clusters = append(out.Clusters, summary)
+		out.Allocatable = out.Allocatable.plus(summary.Allocatable)
+		out.Requested = out.Requested.plus(summary.Requested)
+		out.Available = out.Available.plus(summary.Available)
+	}
+	return out
+}
+
+func (c Cluster) summary() ClusterSummary {
+	summary := ClusterSummary{Name: c.Name}
+	cfg, err := c.Kube.GetVendorConfig()
+	if err != nil {
+		summary.Error = err.Error()
+		return summary
+	}
+	summary.Vendor = cfg.Name
+	reports, err := c.Kube.GetNodeResourceReports()
+	if err != nil {
+		summary.Error = err.Error()
+		return summary
+	}
+	summary.Nodes = len(reports)
+	for _, report := range reports {
+		summary.Allocatable = summary.Allocatable.plus(report.Allocatable)
+		summary.Requested = summary.Requested.plus(report.Requested)
+		summary.Available = summary.Available.plus(report.Available)
+	}
+	summary.GPUs = gpuInventory(reports)
+	return summary
+}
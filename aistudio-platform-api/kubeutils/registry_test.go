@@ -0,0 +1,120 @@
+package kubeutils_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"Kubernetes-api/internal/kubetest"
+	"Kubernetes-api/kubeutils"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestNewClusters(t *testing.T) {
+	kc := kubetest.New().Kube
+	if _, err := kubeutils.NewClusters(); err == nil {
+		t.Error("an empty registry should be rejected")
+	}
+	if _, err := kubeutils.NewClusters(kubeutils.Cluster{Name: "a", Kube: kc}, kubeutils.Cluster{Name: "a", Kube: kc}); err == nil {
+		t.Error("a duplicate cluster name should be rejected")
+	}
+
+	clusters, err := kubeutils.NewClusters(kubeutils.Cluster{Name: "cpu", Kube: kc}, kubeutils.Cluster{Name: "gpu", Kube: kc})
+	if err != nil {
+		t.Fatalf("NewClusters: %v", err)
+	}
+	if c, err := clusters.Get(""); err != nil || c.Name != "cpu" {
+		t.Errorf("Get(\"\") = %v, %v, want the default cluster cpu", c.Name, err)
+	}
+	if _, err := clusters.Get("tpu"); !errors.Is(err, kubeutils.ErrNotFound) {
+		t.Errorf("Get(tpu) = %v, want ErrNotFound", err)
+	}
+}
+
+func TestClustersPlace(t *testing.T) {
+	cpu := kubetest.New(kubetest.Node("cpu-a", "4", "16Gi", ""))
+	gpu := kubetest.New(kubetest.Node("gpu-a", "16", "64Gi", "4"))
+	clusters, err := kubeutils.NewClusters(
+		kubeutils.Cluster{Name: "cpu", Kube: cpu.Kube},
+		kubeutils.Cluster{Name: "gpu", Kube: gpu.Kube},
+	)
+	if err != nil {
+		t.Fatalf("NewClusters: %v", err)
+	}
+	req := kubeutils.ScheduleRequest{Resources: v1.ResourceRequirements{Requests: v1.ResourceList{
+		v1.ResourceCPU:    resource.MustParse("2"),
+		v1.ResourceMemory: resource.MustParse("4Gi"),
+	}}}
+
+	if c, err := clusters.Place(req, "cpu"); err != nil || c.Name != "cpu" {
+		t.Errorf("small request placed on %q, %v, want the default cluster cpu", c.Name, err)
+	}
+	req.GPU = kubeutils.GPURequest{Count: 1}
+	if c, err := clusters.Place(req, "cpu"); err != nil || c.Name != "gpu" {
+		t.Errorf("GPU request placed on %q, %v, want gpu", c.Name, err)
+	}
+	req.GPU.Count = 8
+	_, err = clusters.Place(req, "cpu")
+	if err == nil || !strings.Contains(err.Error(), "cluster cpu") || !strings.Contains(err.Error(), "cluster gpu") {
+		t.Errorf("Place = %v, want why both clusters refused", err)
+	}
+
+	total := clusters.Resources()
+	if len(total.Clusters) != 2 || !total.Clusters[0].Default || total.Clusters[1].Default {
+		t.Fatalf("clusters = %+v, want cpu as the default and gpu", total.Clusters)
+	}
+	if total.Allocatable.CPUMillicores != 20000 || total.Allocatable.GPUs != 4 {
+		t.Errorf("allocatable = %+v, want 20 CPUs and 4 GPUs across both clusters", total.Allocatable)
+	}
+	if g := total.Clusters[1]; g.Vendor != "eks" || g.Nodes != 1 || len(g.GPUs) != 1 {
+		t.Errorf("gpu cluster = %+v, want one eks node with one GPU type", g)
+	}
+}
+
+func TestLoadClusters(t *testing.T) {
+	dir := t.TempDir()
+	kubeconfig := filepath.Join(dir, "kubeconfig")
+	if err := os.WriteFile(kubeconfig, []byte(`apiVersion: v1
+kind: Config
+clusters:
+  - name: a
+    cluster: {server: "https://a.example.com"}
+  - name: b
+    cluster: {server: "https://b.example.com"}
+users:
+  - name: u
+    user: {token: t}
+contexts:
+  - name: a
+    context: {cluster: a, user: u}
+  - name: b
+    context: {cluster: b, user: u}
+current-context: a
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "clusters.yaml")
+	registry := "clusters:\n  - name: cpu\n    kubeconfig: " + kubeconfig + "\n    context: a\n  - name: gpu\n    kubeconfig: " + kubeconfig + "\n    context: b\n"
+	if err := os.WriteFile(path, []byte(registry), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	clusters, err := kubeutils.LoadClusters(path, kubeutils.Options{})
+	if err != nil {
+		t.Fatalf("LoadClusters: %v", err)
+	}
+	if clusters.Len() != 2 || clusters.Default().Name != "cpu" {
+		t.Errorf("clusters = %+v, want cpu then gpu", clusters.All())
+	}
+
+	if err := os.WriteFile(path, []byte("clusters:\n  - name: cpu\n    kubeconfg: x\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kubeutils.LoadClusters(path, kubeutils.Options{}); err == nil {
+		t.Error("an unknown field should be rejected")
+	}
+}
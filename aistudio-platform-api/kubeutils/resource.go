@@ -7,7 +7,6 @@ import (
 
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 type NodeResources struct {
@@ -39,25 +38,25 @@ type PodMetrics struct {
 	CPUUsage    string
 	GPUUsage    string
 	MemoryUsage string
+	// CPUMillicores is CPUUsage before it is rounded up to whole cores.
+	CPUMillicores int64
 }
 
 func (kc *KubernetesConfig) GetClusterNodeResources() ([]ClusterNodeResources, error) {
-	cfg, err := GetVendorConfig()
+	cfg, err := kc.GetVendorConfig()
 	if err != nil {
 		return nil, err
 	}
 
 	ctx := context.TODO()
-	nodes, err := kc.Clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	nodes, err := kc.listNodes(ctx)
 	if err != nil {
 		return nil, err
 	}
 
 	var nodeResources []ClusterNodeResources
-	for _, node := range nodes.Items {
-		pods, err := kc.Clientset.CoreV1().Pods("").List(ctx, metav1.ListOptions{
-			FieldSelector: cfg.FieldSelectorPrefix + node.Name,
-		})
+	for _, node := range nodes {
+		pods, err := kc.podsOnNode(ctx, node.Name)
 		if err != nil {
 			return nil, err
 		}
@@ -71,13 +70,15 @@ func (kc *KubernetesConfig) GetClusterNodeResources() ([]ClusterNodeResources, e
 		usedCPU := resource.Quantity{}
 		usedMemory := resource.Quantity{}
 		usedGPU := resource.Quantity{}
-		for _, pod := range pods.Items {
-			for _, container := range pod.Spec.Containers {
-				usedCPU.Add(container.Resources.Requests[v1.ResourceCPU])
-				usedMemory.Add(container.Resources.Requests[v1.ResourceMemory])
-				if val, ok := container.Resources.Requests[v1.ResourceName(cfg.GPUVendorLabel)]; ok {
-					usedGPU.Add(val)
-				}
+		for _, pod := range pods {
+			if podFinished(pod) {
+				continue
+			}
+			requests := PodRequests(&pod.Spec)
+			usedCPU.Add(requests[v1.ResourceCPU])
+			usedMemory.Add(requests[v1.ResourceMemory])
+			if val, ok := requests[v1.ResourceName(cfg.GPUVendorLabel)]; ok {
+				usedGPU.Add(val)
 			}
 		}
 
@@ -121,55 +122,39 @@ func GigabytesToBytes(gigabytes int64) int64 {
 	return gigabytes * 1024 * 1024 * 1024
 }
 
-func configGpu(spec *v1.PodSpec, gpuRequest string) {
-	cfg, _ := GetVendorConfig()
-
-	for i := range spec.Containers {
-		if spec.Containers[i].Resources.Requests == nil {
-			spec.Containers[i].Resources.Requests = v1.ResourceList{}
-		}
-		if spec.Containers[i].Resources.Limits == nil {
-			spec.Containers[i].Resources.Limits = v1.ResourceList{}
-		}
-		gpuResource := resource.MustParse(gpuRequest)
-		spec.Containers[i].Resources.Requests[v1.ResourceName(cfg.GPUVendorLabel)] = gpuResource
-		spec.Containers[i].Resources.Limits[v1.ResourceName(cfg.GPUVendorLabel)] = gpuResource
-	}
-}
-
-func ConfigResource(cpuRequest string, memoryRequest string, cpuLimit string, memoryLimit string) v1.ResourceRequirements {
-	resource := v1.ResourceRequirements{
-		Requests: v1.ResourceList{
-			v1.ResourceCPU:    resource.MustParse(cpuRequest),
-			v1.ResourceMemory: resource.MustParse(memoryRequest),
-		},
-		Limits: v1.ResourceList{
-			v1.ResourceCPU:    resource.MustParse(cpuLimit),
-			v1.ResourceMemory: resource.MustParse(memoryLimit),
-		},
+// ConfigResource builds the CPU and memory requirements of a container. It
+// returns a *QuantityError if a value does not parse or a limit is below its
+// request.
+func ConfigResource(cpuRequest string, memoryRequest string, cpuLimit string, memoryLimit string) (v1.ResourceRequirements, error) {
+	res, err := ParseResources(ResourceSpec{
+		CPURequest:    cpuRequest,
+		MemoryRequest: memoryRequest,
+		CPULimit:      cpuLimit,
+		MemoryLimit:   memoryLimit,
+	}, ResourceSpec{})
+	if err != nil {
+		return v1.ResourceRequirements{}, err
 	}
-	return resource
+	return res.Requirements, nil
 }
 
 func (kc *KubernetesConfig) GetRemainingNodeResources() (map[string]NodeResources, error) {
-	cfg, err := GetVendorConfig()
+	cfg, err := kc.GetVendorConfig()
 	if err != nil {
 		fmt.Printf("[ERROR] Failed to get vendor config: %v\n", err)
 		return nil, err
 	}
 
 	ctx := context.TODO()
-	nodes, err := kc.Clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	nodes, err := kc.listNodes(ctx)
 	if err != nil {
 		fmt.Printf("[ERROR] Failed to list nodes: %v\n", err)
 		return nil, err
 	}
 
 	nodeResources := make(map[string]NodeResources)
-	for i, node := range nodes.Items {
-		pods, err := kc.Clientset.CoreV1().Pods("").List(ctx, metav1.ListOptions{
-			FieldSelector: cfg.FieldSelectorPrefix + node.Name,
-		})
+	for i, node := range nodes {
+		pods, err := kc.podsOnNode(ctx, node.Name)
 		if err != nil {
 			return nil, err
 		}
@@ -182,13 +167,15 @@ func (kc *KubernetesConfig) GetRemainingNodeResources() (map[string]NodeResource
 		usedCPU := resource.Quantity{}
 		usedMemory := resource.Quantity{}
 		usedGPU := resource.Quantity{}
-		for _, pod := range pods.Items {
-			for _, container := range pod.Spec.Containers {
-				usedCPU.Add(container.Resources.Requests[v1.ResourceCPU])
-				usedMemory.Add(container.Resources.Requests[v1.ResourceMemory])
-				if val, ok := container.Resources.Requests[v1.ResourceName(cfg.GPUVendorLabel)]; ok {
-					usedGPU.Add(val)
-				}
+		for _, pod := range pods {
+			if podFinished(pod) {
+				continue
+			}
+			requests := PodRequests(&pod.Spec)
+			usedCPU.Add(requests[v1.ResourceCPU])
+			usedMemory.Add(requests[v1.ResourceMemory])
+			if val, ok := requests[v1.ResourceName(cfg.GPUVendorLabel)]; ok {
+				usedGPU.Add(val)
 			}
 		}
 
@@ -226,19 +213,18 @@ func (kc *KubernetesConfig) GetRemainingNodeResources() (map[string]NodeResource
 }
 
 func (kc *KubernetesConfig) GetNodeTotalResources() (map[string]NodeResources, error) {
-	cfg, err := GetVendorConfig()
+	cfg, err := kc.GetVendorConfig()
 	if err != nil {
 		return nil, err
 	}
 
-	ctx := context.TODO()
-	nodes, err := kc.Clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	nodes, err := kc.listNodes(context.TODO())
 	if err != nil {
 		return nil, err
 	}
 
 	nodeResources := make(map[string]NodeResources)
-	for i, node := range nodes.Items {
+	for i, node := range nodes {
 		instanceType := node.Labels[cfg.InstanceTypeLabel]
 		capacityType := node.Labels[cfg.CapacityTypeLabel]
 		nodeGroup := node.Labels[cfg.NodeGroupLabel]
@@ -270,16 +256,23 @@ func (kc *KubernetesConfig) GetNodeTotalResources() (map[string]NodeResources, e
 	return nodeResources, nil
 }
 
+// CheckCpuAvailability reports whether any node has the CPU left.
+//
+// Deprecated: it looks at CPU on its own, so a request can pass every check on
+// different nodes and still not fit. Use CanSchedule.
 func (kc *KubernetesConfig) CheckCpuAvailability(numOfCpu string) (bool, error) {
+	cpuRequest, err := ParseQuantity("cpuRequest", numOfCpu)
+	if err != nil {
+		return false, err
+	}
 	nodeResources, err := kc.GetRemainingNodeResources()
 	if err != nil {
 		return false, err
 	}
 
-	numOfCpuFloat, _ := strconv.ParseFloat(numOfCpu, 64)
 	for _, resources := range nodeResources {
-		remainingCpuFloat, _ := strconv.ParseFloat(resources.CPU, 64)
-		if remainingCpuFloat >= numOfCpuFloat {
+		remainingCores, _ := strconv.ParseInt(resources.CPU, 10, 64)
+		if remainingCores*1000 >= cpuRequest.MilliValue() {
 			return true, nil
 		}
 	}
@@ -287,25 +280,34 @@ func (kc *KubernetesConfig) CheckCpuAvailability(numOfCpu string) (bool, error)
 	return false, fmt.Errorf("the requested CPU resources are not available")
 }
 
+// CheckMemoryAvailability reports whether any node has the memory left.
+//
+// Deprecated: it looks at memory on its own, so a request can pass every check on
+// different nodes and still not fit. Use CanSchedule.
 func (kc *KubernetesConfig) CheckMemoryAvailability(memoryRequest string) (bool, error) {
+	memoryRequestQuantity, err := ParseQuantity("memoryRequest", memoryRequest)
+	if err != nil {
+		return false, err
+	}
 	nodeResources, err := kc.GetRemainingNodeResources()
 	if err != nil {
 		return false, err
 	}
-	memoryRequestQuantity := resource.MustParse(memoryRequest)
 	memoryRequestBytes := memoryRequestQuantity.Value()
 
 	for _, resources := range nodeResources {
-		remainingMemoryQuantity := resource.MustParse(resources.Memory)
-		remainingMemoryBytes := GigabytesToBytes(remainingMemoryQuantity.Value())
-		fmt.Println(memoryRequestBytes, remainingMemoryBytes)
-		if remainingMemoryBytes > memoryRequestBytes {
+		remainingGiB, _ := strconv.ParseInt(resources.Memory, 10, 64)
+		if GigabytesToBytes(remainingGiB) > memoryRequestBytes {
 			return true, nil
 		}
 	}
 	return false, fmt.Errorf("the requested memory resources are not available")
 }
 
+// CheckGpuAvailability reports whether any node has the GPUs left.
+//
+// Deprecated: it looks at GPUs on its own, so a request can pass every check on
+// different nodes and still not fit. Use CanSchedule.
 func (kc *KubernetesConfig) CheckGpuAvailability(numOfGpu string) (bool, error) {
 	nodeResources, err := kc.GetRemainingNodeResources()
 	if err != nil {
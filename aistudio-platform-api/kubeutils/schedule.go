@@ -0,0 +1,308 @@
+package kubeutils
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// ScheduleRequest describes one pod of a workload about to be created.
+type ScheduleRequest struct {
+	// Resources are the requirements of each app container.
+	Resources v1.ResourceRequirements
+	// Containers is the number of app containers, which run side by side.
+	// Zero means one.
+	Containers int
+	// InitContainers run one at a time before the app containers start.
+	InitContainers []v1.ResourceRequirements
+	// GPU is the devices each app container asks for. A GPU model keeps the
+	// pod off nodes with other GPUs.
+	GPU GPURequest
+	// EphemeralStorage is the scratch space the pod needs on the node.
+	EphemeralStorage resource.Quantity
+	NodeSelector     map[string]string
+	Tolerations      []v1.Toleration
+	// Replaces names the pods, as namespace/name, the new pod takes the
+	// place of. Their requests do not count against their nodes.
+	Replaces []string
+}
+
+// TemplateScheduleRequest is the request a pod made from spec makes, so a
+// workload scaled to zero can be checked before it is scaled up again. The
+// app containers are taken to be alike, as the ones this API creates are.
+func TemplateScheduleRequest(spec v1.PodSpec) ScheduleRequest {
+	req := ScheduleRequest{
+		Containers:   len(spec.Containers),
+		GPU:          GPURequest{Model: affinityGPUModel(spec.Affinity)},
+		NodeSelector: spec.NodeSelector,
+		Tolerations:  spec.Tolerations,
+	}
+	if len(spec.Containers) > 0 {
+		req.Resources = spec.Containers[0].Resources
+	}
+	for _, c := range spec.InitContainers {
+		req.InitContainers = append(req.InitContainers, c.Resources)
+	}
+	return req
+}
+
+// NodeFit is the verdict for one node. Free is what the node has left for
+// new pods; Insufficient lists the resources it is short of and Reasons
+// explains every way it fails the request. Eligible nodes are ready,
+// schedulable, selected and tolerated, so only room keeps the pod off them.
+type NodeFit struct {
+	Node         string            `json:"node"`
+	NodeType     string            `json:"nodeType,omitempty"`
+	NodePool     string            `json:"nodePool,omitempty"`
+	Fits         bool              `json:"fits"`
+	Eligible     bool              `json:"eligible"`
+	Reasons      []string          `json:"reasons,omitempty"`
+	Insufficient []v1.ResourceName `json:"insufficient,omitempty"`
+	Free         v1.ResourceList   `json:"free"`
+}
+
+// ScheduleResult is the verdict of CanSchedule for every node, sorted by
+// node name.
+type ScheduleResult struct {
+	Fits  bool      `json:"fits"`
+	Nodes []NodeFit `json:"nodes"`
+}
+
+// FittingNodes lists the nodes the request fits on.
+func (r ScheduleResult) FittingNodes() []string {
+	var names []string
+	for _, n := range r.Nodes {
+		if n.Fits {
+			names = append(names, n.Node)
+		}
+	}
+	return names
+}
+
+// Err is nil when the request fits somewhere, and otherwise says why each
+// node turned it down.
+func (r ScheduleResult) Err() error {
+	if r.Fits {
+		return nil
+	}
+	if len(r.Nodes) == 0 {
+		return fmt.Errorf("no nodes are available")
+	}
+	reasons := make([]string, len(r.Nodes))
+	for i, n := range r.Nodes {
+		reasons[i] = n.Node + ": " + strings.Join(n.Reasons, ", ")
+	}
+	return fmt.Errorf("no node can fit the request: %s", strings.Join(reasons, "; "))
+}
+
+// CanSchedule checks the request against every node the way the scheduler
+// would: CPU, memory, GPU, ephemeral storage and pod count must all fit on
+// the same node, the node must be ready, schedulable and match the node
+// selector and GPU model, and every NoSchedule or NoExecute taint must be tolerated.
+// Pods that have finished do not count against a node.
+func (kc *KubernetesConfig) CanSchedule(req ScheduleRequest) (ScheduleResult, error) {
+	cfg, err := kc.GetVendorConfig()
+	if err != nil {
+		return ScheduleResult{}, err
+	}
+	ctx := context.TODO()
+	nodes, err := kc.listNodes(ctx)
+	if err != nil {
+		return ScheduleResult{}, wrapAPIError("list", "nodes", "", err)
+	}
+
+	want := req.podRequests(cfg)
+	result := ScheduleResult{Nodes: make([]NodeFit, 0, len(nodes))}
+	for _, node := range nodes {
+		pods, err := kc.podsOnNode(ctx, node.Name)
+		if err != nil {
+			return ScheduleResult{}, wrapAPIError("list", "pods", node.Name, err)
+		}
+		fit := fitNode(node, req.without(pods), req, want)
+		fit.NodeType = node.Labels[cfg.NodeSelectorPrefix]
+		fit.NodePool = node.Labels[cfg.NodeGroupLabel]
+		result.Fits = result.Fits || fit.Fits
+		result.Nodes = append(result.Nodes, fit)
+	}
+	sort.Slice(result.Nodes, func(i, j int) bool { return result.Nodes[i].Node < result.Nodes[j].Node })
+	return result, nil
+}
+
+// without returns pods less the ones the request replaces.
+func (req ScheduleRequest) without(pods []*v1.Pod) []*v1.Pod {
+	if len(req.Replaces) == 0 {
+		return pods
+	}
+	out := make([]*v1.Pod, 0, len(pods))
+	for _, pod := range pods {
+		replaced := false
+		for _, name := range req.Replaces {
+			replaced = replaced || name == pod.Namespace+"/"+pod.Name
+		}
+		if !replaced {
+			out = append(out, pod)
+		}
+	}
+	return out
+}
+
+// podRequests is what the pod asks of a node, counted as the scheduler does.
+func (req ScheduleRequest) podRequests(cfg VendorConfig) v1.ResourceList {
+	containers := req.Containers
+	if containers < 1 {
+		containers = 1
+	}
+	resources := *req.Resources.DeepCopy()
+	if req.GPU.Count > 0 {
+		if resources.Requests == nil {
+			resources.Requests = v1.ResourceList{}
+		}
+		resources.Requests[cfg.GPUResourceName(req.GPU)] = *resource.NewQuantity(int64(req.GPU.Count), resource.DecimalSI)
+	}
+	spec := v1.PodSpec{Containers: make([]v1.Container, containers)}
+	for i := range spec.Containers {
+		spec.Containers[i].Resources = resources
+	}
+	for _, r := range req.InitContainers {
+		spec.InitContainers = append(spec.InitContainers, v1.Container{Resources: r})
+	}
+	want := PodRequests(&spec)
+	if !req.EphemeralStorage.IsZero() {
+		storage := want[v1.ResourceEphemeralStorage]
+		storage.Add(req.EphemeralStorage)
+		want[v1.ResourceEphemeralStorage] = storage
+	}
+	return want
+}
+
+// PodRequests returns what a pod reserves on its node: the sum of its app
+// containers, or its largest init container where that is larger, plus the
+// pod overhead.
+func PodRequests(spec *v1.PodSpec) v1.ResourceList {
+	return podResources(spec, func(r v1.ResourceRequirements) v1.ResourceList { return r.Requests })
+}
+
+// PodLimits is PodRequests for limits. Containers without a limit on a
+// resource add nothing to it.
+func PodLimits(spec *v1.PodSpec) v1.ResourceList {
+	return podResources(spec, func(r v1.ResourceRequirements) v1.ResourceList { return r.Limits })
+}
+
+func podResources(spec *v1.PodSpec, of func(v1.ResourceRequirements) v1.ResourceList) v1.ResourceList {
+	total := v1.ResourceList{}
+	for _, c := range spec.Containers {
+		addResources(total, of(c.Resources))
+	}
+	for _, c := range spec.InitContainers {
+		for name, q := range of(c.Resources) {
+			if current, ok := total[name]; !ok || q.Cmp(current) > 0 {
+				total[name] = q.DeepCopy()
+			}
+		}
+	}
+	addResources(total, spec.Overhead)
+	return total
+}
+
+// podFinished reports whether pod no longer holds resources on its node.
+func podFinished(pod *v1.Pod) bool {
+	return pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed
+}
+
+// freeOnNode is the node's allocatable resources less what its running pods
+// request, with one pod slot used per pod.
+func freeOnNode(node *v1.Node, pods []*v1.Pod) v1.ResourceList {
+	free := node.Status.Allocatable.DeepCopy()
+	if free == nil {
+		free = v1.ResourceList{}
+	}
+	for _, pod := range pods {
+		if podFinished(pod) {
+			continue
+		}
+		for name, q := range PodRequests(&pod.Spec) {
+			left := free[name]
+			left.Sub(q)
+			free[name] = left
+		}
+		slots := free[v1.ResourcePods]
+		slots.Sub(*resource.NewQuantity(1, resource.DecimalSI))
+		free[v1.ResourcePods] = slots
+	}
+	return free
+}
+
+func fitNode(node *v1.Node, pods []*v1.Pod, req ScheduleRequest, want v1.ResourceList) NodeFit {
+	fit := NodeFit{Node: node.Name, Free: freeOnNode(node, pods)}
+
+	if node.Spec.Unschedulable {
+		fit.Reasons = append(fit.Reasons, "node is cordoned")
+	}
+	if !nodeReady(node) {
+		fit.Reasons = append(fit.Reasons, "node is not ready")
+	}
+	for key, value := range req.NodeSelector {
+		if got, ok := node.Labels[key]; !ok || got != value {
+			fit.Reasons = append(fit.Reasons, fmt.Sprintf("node label %s=%q does not match selector %s=%q", key, got, key, value))
+		}
+	}
+	if req.GPU.Model != "" {
+		if got := gpuModel(node); got != req.GPU.Model {
+			fit.Reasons = append(fit.Reasons, fmt.Sprintf("node GPU model %q is not %q", got, req.GPU.Model))
+		}
+	}
+	for i := range node.Spec.Taints {
+		taint := &node.Spec.Taints[i]
+		if taint.Effect == v1.TaintEffectPreferNoSchedule || tolerated(req.Tolerations, taint) {
+			continue
+		}
+		fit.Reasons = append(fit.Reasons, fmt.Sprintf("untolerated taint %s", taint.ToString()))
+	}
+	fit.Eligible = len(fit.Reasons) == 0
+
+	want = want.DeepCopy()
+	want[v1.ResourcePods] = *resource.NewQuantity(1, resource.DecimalSI)
+	names := make([]string, 0, len(want))
+	for name := range want {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		name := v1.ResourceName(n)
+		q := want[name]
+		if q.IsZero() {
+			continue
+		}
+		free, ok := fit.Free[name]
+		if ok && free.Cmp(q) >= 0 {
+			continue
+		}
+		fit.Insufficient = append(fit.Insufficient, name)
+		fit.Reasons = append(fit.Reasons, fmt.Sprintf("insufficient %s: requested %s, free %s", name, q.String(), free.String()))
+	}
+
+	fit.Fits = len(fit.Reasons) == 0
+	return fit
+}
+
+func nodeReady(node *v1.Node) bool {
+	for _, c := range node.Status.Conditions {
+		if c.Type == v1.NodeReady {
+			return c.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
+
+func tolerated(tolerations []v1.Toleration, taint *v1.Taint) bool {
+	for i := range tolerations {
+		if tolerations[i].ToleratesTaint(taint) {
+			return true
+		}
+	}
+	return false
+}
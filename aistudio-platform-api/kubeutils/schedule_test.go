@@ -0,0 +1,132 @@
+package kubeutils_test
+
+import (
+	"strings"
+	"testing"
+
+	"Kubernetes-api/internal/kubetest"
+	"Kubernetes-api/kubeutils"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func requirements(cpu, memory string) v1.ResourceRequirements {
+	return v1.ResourceRequirements{Requests: v1.ResourceList{
+		v1.ResourceCPU:    resource.MustParse(cpu),
+		v1.ResourceMemory: resource.MustParse(memory),
+	}}
+}
+
+func fitOf(t *testing.T, result kubeutils.ScheduleResult, node string) kubeutils.NodeFit {
+	t.Helper()
+	for _, n := range result.Nodes {
+		if n.Node == node {
+			return n
+		}
+	}
+	t.Fatalf("no verdict for %s in %+v", node, result.Nodes)
+	return kubeutils.NodeFit{}
+}
+
+func TestCanScheduleNeedsEverythingOnOneNode(t *testing.T) {
+	// node-a has the CPU and node-b the memory, but neither has both.
+	h := kubetest.New(
+		kubetest.Node("node-a", "8", "4Gi", ""),
+		kubetest.Node("node-b", "2", "32Gi", ""),
+	)
+
+	result, err := h.Kube.CanSchedule(kubeutils.ScheduleRequest{
+		Resources:    requirements("4", "16Gi"),
+		NodeSelector: h.Kube.WorkloadNodeSelector("cpu"),
+	})
+	if err != nil {
+		t.Fatalf("CanSchedule: %v", err)
+	}
+	if result.Fits || result.Err() == nil {
+		t.Fatalf("request fits = %v, want it rejected", result.Fits)
+	}
+	if got := fitOf(t, result, "node-a").Insufficient; len(got) != 1 || got[0] != v1.ResourceMemory {
+		t.Errorf("node-a insufficient = %v, want memory", got)
+	}
+	if got := fitOf(t, result, "node-b").Insufficient; len(got) != 1 || got[0] != v1.ResourceCPU {
+		t.Errorf("node-b insufficient = %v, want cpu", got)
+	}
+}
+
+func TestCanScheduleCountsFractionalCPUAndFinishedPods(t *testing.T) {
+	done := kubetest.Pod("lab", "job-0", "job", "node-a", "1", "1Gi")
+	done.Status.Phase = v1.PodSucceeded
+	h := kubetest.New(
+		kubetest.Node("node-a", "2", "8Gi", ""),
+		kubetest.Pod("lab", "alice-0", "alice", "node-a", "1200m", "1Gi"),
+		done,
+	)
+
+	req := kubeutils.ScheduleRequest{Resources: requirements("500m", "1Gi"), NodeSelector: h.Kube.WorkloadNodeSelector("cpu")}
+	result, err := h.Kube.CanSchedule(req)
+	if err != nil {
+		t.Fatalf("CanSchedule: %v", err)
+	}
+	if !result.Fits {
+		t.Fatalf("500m should fit in the 800m left: %v", result.Err())
+	}
+	free := fitOf(t, result, "node-a").Free[v1.ResourceCPU]
+	if free.String() != "800m" {
+		t.Errorf("free cpu = %s, want 800m", free.String())
+	}
+
+	req.Resources = requirements("900m", "1Gi")
+	if result, _ := h.Kube.CanSchedule(req); result.Fits {
+		t.Error("900m should not fit in the 800m left")
+	}
+}
+
+func TestCanScheduleCountsInitContainersAndGPUs(t *testing.T) {
+	h := kubetest.New(kubetest.Node("node-a", "4", "8Gi", "1"))
+
+	result, err := h.Kube.CanSchedule(kubeutils.ScheduleRequest{
+		Resources:      requirements("1", "1Gi"),
+		InitContainers: []v1.ResourceRequirements{requirements("1", "12Gi")},
+		NodeSelector:   h.Kube.WorkloadNodeSelector("cpu"),
+	})
+	if err != nil {
+		t.Fatalf("CanSchedule: %v", err)
+	}
+	if result.Fits {
+		t.Error("a 12Gi init container should not fit on an 8Gi node")
+	}
+
+	// Two containers asking for one GPU each need two devices.
+	result, _ = h.Kube.CanSchedule(kubeutils.ScheduleRequest{
+		Resources:    requirements("1", "1Gi"),
+		Containers:   2,
+		GPU:          kubeutils.GPURequest{Count: 1},
+		NodeSelector: h.Kube.WorkloadNodeSelector("cpu"),
+	})
+	if got := fitOf(t, result, "node-a").Insufficient; len(got) != 1 || got[0] != "nvidia.com/gpu" {
+		t.Errorf("insufficient = %v, want nvidia.com/gpu", got)
+	}
+}
+
+func TestCanScheduleRespectsSelectorsAndTaints(t *testing.T) {
+	tainted := kubetest.Node("node-gpu", "8", "32Gi", "")
+	tainted.Spec.Taints = []v1.Taint{{Key: "dedicated", Value: "gpu", Effect: v1.TaintEffectNoSchedule}}
+	h := kubetest.New(tainted)
+
+	req := kubeutils.ScheduleRequest{Resources: requirements("1", "1Gi"), NodeSelector: h.Kube.WorkloadNodeSelector("gpu")}
+	result, err := h.Kube.CanSchedule(req)
+	if err != nil {
+		t.Fatalf("CanSchedule: %v", err)
+	}
+	reasons := strings.Join(fitOf(t, result, "node-gpu").Reasons, "; ")
+	if result.Fits || !strings.Contains(reasons, "selector type=\"gpu\"") || !strings.Contains(reasons, "dedicated=gpu:NoSchedule") {
+		t.Fatalf("reasons = %q, want the selector and the taint", reasons)
+	}
+
+	req.NodeSelector = h.Kube.WorkloadNodeSelector("cpu")
+	req.Tolerations = []v1.Toleration{{Key: "dedicated", Operator: v1.TolerationOpEqual, Value: "gpu", Effect: v1.TaintEffectNoSchedule}}
+	if result, _ := h.Kube.CanSchedule(req); !result.Fits {
+		t.Errorf("tolerated request rejected: %v", result.Err())
+	}
+}
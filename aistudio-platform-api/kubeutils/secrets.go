@@ -0,0 +1,76 @@
+package kubeutils
+
+import (
+	"context"
+	"fmt"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ApplySecret creates the opaque secret name in namespace with data, or
+// replaces the data of the existing one.
+func (kc *KubernetesConfig) ApplySecret(namespace, name string, data map[string]string, owner Owner) error {
+	client := kc.Clientset.CoreV1().Secrets(namespace)
+	secret, err := client.Get(context.TODO(), name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		secret = &apiv1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Type:       apiv1.SecretTypeOpaque,
+			StringData: data,
+		}
+		owner.label(&secret.ObjectMeta)
+		_, err = client.Create(context.TODO(), secret, metav1.CreateOptions{})
+		return wrapAPIError("create", "secret", name, err)
+	}
+	if err != nil {
+		return wrapAPIError("get", "secret", name, err)
+	}
+	// StringData is merged into Data by the API server; clearing Data
+	// drops keys that are no longer set.
+	secret.Data = nil
+	secret.StringData = data
+	owner.label(&secret.ObjectMeta)
+	_, err = client.Update(context.TODO(), secret, metav1.UpdateOptions{})
+	return wrapAPIError("update", "secret", name, err)
+}
+
+// GetSecretValue returns key of the secret name in namespace. A missing
+// secret or key is an ErrNotFound error.
+func (kc *KubernetesConfig) GetSecretValue(namespace, name, key string) (string, error) {
+	secret, err := kc.Clientset.CoreV1().Secrets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return "", wrapAPIError("get", "secret", name, err)
+	}
+	if value, ok := secret.Data[key]; ok {
+		return string(value), nil
+	}
+	// Fake clients and some admission paths leave StringData unmerged.
+	if value, ok := secret.StringData[key]; ok {
+		return value, nil
+	}
+	return "", &Error{Op: "get", Resource: "secret", Name: name, Kind: ErrNotFound, Err: fmt.Errorf("secret has no key %q", key)}
+}
+
+// DeleteSecret deletes the secret name in namespace. A secret that does not
+// exist is not an error, so workloads created before they kept their
+// credentials in secrets can be deleted the same way.
+func (kc *KubernetesConfig) DeleteSecret(namespace, name string) error {
+	err := kc.Clientset.CoreV1().Secrets(namespace).Delete(context.TODO(), name, metav1.DeleteOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	return wrapAPIError("delete", "secret", name, err)
+}
+
+// SecretEnvVar is the variable name read from key of the secret secretName.
+func SecretEnvVar(name, secretName, key string) apiv1.EnvVar {
+	return apiv1.EnvVar{
+		Name: name,
+		ValueFrom: &apiv1.EnvVarSource{SecretKeyRef: &apiv1.SecretKeySelector{
+			LocalObjectReference: apiv1.LocalObjectReference{Name: secretName},
+			Key:                  key,
+		}},
+	}
+}
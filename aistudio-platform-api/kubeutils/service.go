@@ -11,7 +11,11 @@ import (
 	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
-func (kc *KubernetesConfig) CreateService(newNamespace string, serviceName string, lable string, port int,serviceType apiv1.ServiceType) {
+// ServicePort is the port every service CreateService builds listens on,
+// whatever the port of the pods behind it.
+const ServicePort = 80
+
+func (kc *KubernetesConfig) CreateService(newNamespace string, serviceName string, lable string, port int,serviceType apiv1.ServiceType) error {
 
 	servicesClient := kc.Clientset.CoreV1().Services(newNamespace)
 	service := &apiv1.Service{
@@ -25,7 +29,7 @@ func (kc *KubernetesConfig) CreateService(newNamespace string, serviceName strin
 			Type: serviceType,
 			Ports: []apiv1.ServicePort{
 				{
-					Port:       80,
+					Port:       ServicePort,
 					TargetPort: intstr.FromInt(port),
 					NodePort:   0,
 				},
@@ -39,12 +43,13 @@ func (kc *KubernetesConfig) CreateService(newNamespace string, serviceName strin
 	resultSvc, err := servicesClient.Create(context.TODO(), service, metav1.CreateOptions{})
 	if err != nil {
 		log.Error(err.Error(), "Error while creating service", serviceName)
+		return wrapAPIError("create", "service", serviceName, err)
 	}
 	fmt.Printf("[SERVICE-CREATED] %q.\n", resultSvc.GetObjectMeta().GetName())
-	
+	return nil
 }
 
-func (kc *KubernetesConfig) DeleteService(namespace string, serviceName string) {
+func (kc *KubernetesConfig) DeleteService(namespace string, serviceName string) error {
 
 	servicesClient := kc.Clientset.CoreV1().Services(namespace)
 	deletePolicy := metav1.DeletePropagationForeground
@@ -53,8 +58,10 @@ func (kc *KubernetesConfig) DeleteService(namespace string, serviceName string)
 		PropagationPolicy: &deletePolicy,
 	}); err != nil {
 		log.Error(err.Error(), "Error while Deleteing service", serviceName)
+		return wrapAPIError("delete", "service", serviceName, err)
 	}
 	fmt.Println("Deleted services.")
+	return nil
 }
 
 func (kc *KubernetesConfig) ServiceExists(namespace string, serviceName string) bool {
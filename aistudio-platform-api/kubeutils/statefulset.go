@@ -2,13 +2,15 @@ package kubeutils
 
 import (
 	"context"
-	"strconv"
+	"fmt"
+	"time"
 
 	"github.com/gofiber/fiber/v2/log"
 	appsv1 "k8s.io/api/apps/v1"
 	apiv1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
 )
 
 func CreateContainerConfig(containerName string, image string, containerPort int, volumeMounts []apiv1.VolumeMount, envVars []apiv1.EnvVar) apiv1.Container {
@@ -27,15 +29,14 @@ func CreateContainerConfig(containerName string, image string, containerPort int
 	}
 }
 
-func (kc *KubernetesConfig) ConfigStatefulSet(newNamespace string, name string, serviceName string, gpuRequest int, notebookPort int, diskStorage string, nodeSelector string, resources apiv1.ResourceRequirements, containers []apiv1.Container, volumes []apiv1.Volume) {
+func (kc *KubernetesConfig) ConfigStatefulSet(newNamespace string, name string, serviceName string, gpu GPURequest, notebookPort int, diskStorage string, nodeSelector string, resources apiv1.ResourceRequirements, containers []apiv1.Container, volumes []apiv1.Volume, owner Owner) error {
+	storage, err := ParseQuantity("diskStorage", diskStorage)
+	if err != nil {
+		return err
+	}
 	storageClassName := "nfs-csi-model"
 	statefulsetsClient := kc.Clientset.AppsV1().StatefulSets(newNamespace)
 
-	// Apply resources to each container
-	for i := range containers {
-		containers[i].Resources = resources
-	}
-
 	statefulset := &appsv1.StatefulSet{
 		ObjectMeta: metav1.ObjectMeta{
 			Name: name,
@@ -55,9 +56,7 @@ func (kc *KubernetesConfig) ConfigStatefulSet(newNamespace string, name string,
 					},
 				},
 				Spec: apiv1.PodSpec{
-					NodeSelector: map[string]string{
-						"type": nodeSelector,
-					},
+					NodeSelector: kc.WorkloadNodeSelector(nodeSelector),
 					SecurityContext: &apiv1.PodSecurityContext{
 						RunAsUser:  int64Ptr(0),
 						RunAsGroup: int64Ptr(0),
@@ -79,7 +78,7 @@ func (kc *KubernetesConfig) ConfigStatefulSet(newNamespace string, name string,
 						StorageClassName: &storageClassName,
 						Resources: apiv1.ResourceRequirements{
 							Requests: apiv1.ResourceList{
-								apiv1.ResourceStorage: resource.MustParse(diskStorage),
+								apiv1.ResourceStorage: storage,
 							},
 						},
 					},
@@ -88,27 +87,31 @@ func (kc *KubernetesConfig) ConfigStatefulSet(newNamespace string, name string,
 		},
 	}
 
-	if gpuRequest > 0 {
-		configGpu(&statefulset.Spec.Template.Spec, strconv.Itoa(gpuRequest))
+	if err := kc.configResources(&statefulset.Spec.Template.Spec, resources, gpu); err != nil {
+		return err
 	}
+	owner.label(&statefulset.ObjectMeta)
+	owner.label(&statefulset.Spec.Template.ObjectMeta)
+	owner.label(&statefulset.Spec.VolumeClaimTemplates[0].ObjectMeta)
 
 	log.Info("Creating statefulset...")
 	result, err := statefulsetsClient.Create(context.TODO(), statefulset, metav1.CreateOptions{})
 	if err != nil {
 		log.Error("Error in creating labspace: ", err.Error())
-		return
+		return wrapAPIError("create", "statefulset", name, err)
 	}
 	log.Info("Created statefulset %q.\n", result.GetObjectMeta().GetName())
+	return nil
 }
 
-func (kc *KubernetesConfig) CreateStatefulSet(newNamespace string, name string, serviceName string, image string, gpuRequest int, notebookPort int, diskStorage string, nodeSelector string, resources apiv1.ResourceRequirements, envVars []apiv1.EnvVar) {
-	volumes, volumeMounts := kc.CreateVolumesAndMounts(gpuRequest)
+func (kc *KubernetesConfig) CreateStatefulSet(newNamespace string, name string, serviceName string, image string, gpu GPURequest, notebookPort int, diskStorage string, nodeSelector string, resources apiv1.ResourceRequirements, envVars []apiv1.EnvVar, owner Owner) error {
+	volumes, volumeMounts := kc.CreateVolumesAndMounts(gpu.Count)
 	container := CreateContainerConfig(name, image, notebookPort, volumeMounts, envVars)
-	kc.ConfigStatefulSet(newNamespace, name, serviceName, gpuRequest, notebookPort, diskStorage, nodeSelector, resources, []apiv1.Container{container}, volumes)
+	return kc.ConfigStatefulSet(newNamespace, name, serviceName, gpu, notebookPort, diskStorage, nodeSelector, resources, []apiv1.Container{container}, volumes, owner)
 }
 
-func (kc *KubernetesConfig) CreateStatefulSetWithDualContainer(newNamespace, name, serviceName, image, imageAdk string, gpuRequest, notebookPort, adkPort int, diskStorage, nodeSelector string, resources apiv1.ResourceRequirements, env [][]apiv1.EnvVar) {
-	volumes, volumeMounts := kc.CreateVolumesAndMounts(gpuRequest)
+func (kc *KubernetesConfig) CreateStatefulSetWithDualContainer(newNamespace, name, serviceName, image, imageAdk string, gpu GPURequest, notebookPort, adkPort int, diskStorage, nodeSelector string, resources apiv1.ResourceRequirements, env [][]apiv1.EnvVar, owner Owner) error {
+	volumes, volumeMounts := kc.CreateVolumesAndMounts(gpu.Count)
 	env1 := []apiv1.EnvVar{}
 	env2 := []apiv1.EnvVar{}
 	if len(env) > 0 {
@@ -120,17 +123,217 @@ func (kc *KubernetesConfig) CreateStatefulSetWithDualContainer(newNamespace, nam
 	container1 := CreateContainerConfig(name, image, notebookPort, volumeMounts, env1)
 	container2 := CreateContainerConfig("adk", imageAdk, adkPort, volumeMounts, env2)
 	containers := []apiv1.Container{container1, container2}
-	kc.ConfigStatefulSet(newNamespace, name, serviceName, gpuRequest, notebookPort, diskStorage, nodeSelector, resources, containers, volumes)
+	return kc.ConfigStatefulSet(newNamespace, name, serviceName, gpu, notebookPort, diskStorage, nodeSelector, resources, containers, volumes, owner)
 }
 
-func (kc *KubernetesConfig) DeleteStatefulSet(namespace string, statefulSetName string) {
+func (kc *KubernetesConfig) DeleteStatefulSet(namespace string, statefulSetName string) error {
 	statefulSetClient := kc.Clientset.AppsV1().StatefulSets(namespace)
 	deletePolicy := metav1.DeletePropagationForeground
 	if err := statefulSetClient.Delete(context.TODO(), statefulSetName, metav1.DeleteOptions{
 		PropagationPolicy: &deletePolicy,
 	}); err != nil {
 		log.Error("Error in deleting labspace: ", err.Error())
-		return
+		return wrapAPIError("delete", "statefulset", statefulSetName, err)
 	}
 	log.Info("Deleted StatefulSet %s in namespace %s\n", statefulSetName, namespace)
-}
\ No newline at end of file
+	return nil
+}
+
+// RestartedAtAnnotation is the pod template annotation RestartStatefulSet
+// sets, the same one kubectl rollout restart uses.
+const RestartedAtAnnotation = "kubectl.kubernetes.io/restartedAt"
+
+// GetStatefulSet returns the statefulset name in namespace.
+func (kc *KubernetesConfig) GetStatefulSet(namespace, name string) (*appsv1.StatefulSet, error) {
+	sts, err := kc.Clientset.AppsV1().StatefulSets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return nil, wrapAPIError("get", "statefulset", name, err)
+	}
+	return sts, nil
+}
+
+// ListStatefulSets returns the statefulsets in namespace, from the informer
+// cache once it has synced.
+func (kc *KubernetesConfig) ListStatefulSets(namespace string) ([]*appsv1.StatefulSet, error) {
+	list, err := kc.listStatefulSets(context.TODO(), namespace, labels.Everything())
+	if err != nil {
+		return nil, wrapAPIError("list", "statefulsets", "", err)
+	}
+	return list, nil
+}
+
+// RestartStatefulSet rolls the pods of the statefulset name, as kubectl
+// rollout restart does, without recreating it. Each of env replaces the
+// variable of the same name in every container that sets it, so a
+// variable can move to a secret reference in the same rollout.
+func (kc *KubernetesConfig) RestartStatefulSet(namespace, name string, env ...apiv1.EnvVar) error {
+	client := kc.Clientset.AppsV1().StatefulSets(namespace)
+	sts, err := client.Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return wrapAPIError("get", "statefulset", name, err)
+	}
+	tmpl := &sts.Spec.Template
+	if tmpl.Annotations == nil {
+		tmpl.Annotations = map[string]string{}
+	}
+	tmpl.Annotations[RestartedAtAnnotation] = time.Now().Format(time.RFC3339)
+	for i := range tmpl.Spec.Containers {
+		replaceEnv(tmpl.Spec.Containers[i].Env, env)
+	}
+	_, err = client.Update(context.TODO(), sts, metav1.UpdateOptions{})
+	return wrapAPIError("update", "statefulset", name, err)
+}
+
+func replaceEnv(vars, with []apiv1.EnvVar) {
+	for i := range vars {
+		for _, w := range with {
+			if vars[i].Name == w.Name {
+				vars[i] = w
+			}
+		}
+	}
+}
+
+// ScaleStatefulSet sets the replicas of the statefulset name and merges
+// annotations into its own; an empty value removes the annotation.
+func (kc *KubernetesConfig) ScaleStatefulSet(namespace, name string, replicas int32, annotations map[string]string) error {
+	client := kc.Clientset.AppsV1().StatefulSets(namespace)
+	sts, err := client.Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return wrapAPIError("get", "statefulset", name, err)
+	}
+	sts.Spec.Replicas = int32Ptr(replicas)
+	mergeAnnotations(&sts.ObjectMeta, annotations)
+	_, err = client.Update(context.TODO(), sts, metav1.UpdateOptions{})
+	return wrapAPIError("update", "statefulset", name, err)
+}
+
+// AnnotateStatefulSet merges annotations into those of the statefulset
+// name, as ScaleStatefulSet does, without touching its pods.
+func (kc *KubernetesConfig) AnnotateStatefulSet(namespace, name string, annotations map[string]string) error {
+	client := kc.Clientset.AppsV1().StatefulSets(namespace)
+	sts, err := client.Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return wrapAPIError("get", "statefulset", name, err)
+	}
+	mergeAnnotations(&sts.ObjectMeta, annotations)
+	_, err = client.Update(context.TODO(), sts, metav1.UpdateOptions{})
+	return wrapAPIError("update", "statefulset", name, err)
+}
+
+// mergeAnnotations sets annotations on meta; an empty value removes the
+// annotation.
+func mergeAnnotations(meta *metav1.ObjectMeta, annotations map[string]string) {
+	for key, value := range annotations {
+		if value == "" {
+			delete(meta.Annotations, key)
+			continue
+		}
+		if meta.Annotations == nil {
+			meta.Annotations = map[string]string{}
+		}
+		meta.Annotations[key] = value
+	}
+}
+
+// configResources gives every container of spec resources and gpu, and
+// keeps the pod on nodes with gpu's model when it names one.
+func (kc *KubernetesConfig) configResources(spec *apiv1.PodSpec, resources apiv1.ResourceRequirements, gpu GPURequest) error {
+	for i := range spec.Containers {
+		spec.Containers[i].Resources = *resources.DeepCopy()
+	}
+	spec.Affinity = nil
+	if gpu.Count > 0 {
+		return kc.configGpu(spec, gpu)
+	}
+	return nil
+}
+
+// TemplateResources is the ResourceSpec the pods made from spec were sized
+// with, for a resize to keep what it does not change. Volumes are not part
+// of the pod, so DiskStorage is left empty.
+func (kc *KubernetesConfig) TemplateResources(spec apiv1.PodSpec) (ResourceSpec, error) {
+	cfg, err := kc.GetVendorConfig()
+	if err != nil {
+		return ResourceSpec{}, err
+	}
+	var out ResourceSpec
+	if len(spec.Containers) == 0 {
+		return out, nil
+	}
+	r := spec.Containers[0].Resources
+	quantity := func(list apiv1.ResourceList, name apiv1.ResourceName) string {
+		if q, ok := list[name]; ok {
+			return q.String()
+		}
+		return ""
+	}
+	out.CPURequest = quantity(r.Requests, apiv1.ResourceCPU)
+	out.CPULimit = quantity(r.Limits, apiv1.ResourceCPU)
+	out.MemoryRequest = quantity(r.Requests, apiv1.ResourceMemory)
+	out.MemoryLimit = quantity(r.Limits, apiv1.ResourceMemory)
+	for name, q := range r.Requests {
+		if cfg.isGPUResource(name) {
+			out.GPU = q.String()
+			out.GPUType = string(name)
+		}
+	}
+	out.GPUModel = affinityGPUModel(spec.Affinity)
+	return out, nil
+}
+
+// ResizeStatefulSet sizes the pods of the statefulset name with resources
+// and gpu, as ConfigStatefulSet sizes new ones. The changed template rolls
+// the pods one at a time; they are restarted even when only a volume grew,
+// so its file system is resized.
+func (kc *KubernetesConfig) ResizeStatefulSet(namespace, name string, resources apiv1.ResourceRequirements, gpu GPURequest) error {
+	client := kc.Clientset.AppsV1().StatefulSets(namespace)
+	sts, err := client.Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return wrapAPIError("get", "statefulset", name, err)
+	}
+	tmpl := &sts.Spec.Template
+	if err := kc.configResources(&tmpl.Spec, resources, gpu); err != nil {
+		return err
+	}
+	if tmpl.Annotations == nil {
+		tmpl.Annotations = map[string]string{}
+	}
+	tmpl.Annotations[RestartedAtAnnotation] = time.Now().Format(time.RFC3339)
+	_, err = client.Update(context.TODO(), sts, metav1.UpdateOptions{})
+	return wrapAPIError("update", "statefulset", name, err)
+}
+
+// rolloutPollInterval is how often WaitForStatefulSet checks on a rollout.
+var rolloutPollInterval = 2 * time.Second
+
+// WaitForStatefulSet waits until every pod of the statefulset name runs its
+// latest template and is ready, or ctx is done.
+func (kc *KubernetesConfig) WaitForStatefulSet(ctx context.Context, namespace, name string) error {
+	client := kc.Clientset.AppsV1().StatefulSets(namespace)
+	err := wait.PollUntilContextCancel(ctx, rolloutPollInterval, true, func(ctx context.Context) (bool, error) {
+		sts, err := client.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return false, wrapAPIError("get", "statefulset", name, err)
+		}
+		return rolledOut(sts), nil
+	})
+	if err != nil {
+		return fmt.Errorf("waiting for statefulset %s to roll out: %w", name, err)
+	}
+	return nil
+}
+
+// rolledOut reports whether the controller has replaced every pod of sts
+// with a ready pod of its latest template.
+func rolledOut(sts *appsv1.StatefulSet) bool {
+	want := int32(1)
+	if sts.Spec.Replicas != nil {
+		want = *sts.Spec.Replicas
+	}
+	status := sts.Status
+	return status.ObservedGeneration >= sts.Generation &&
+		status.UpdatedReplicas == want &&
+		status.ReadyReplicas == want &&
+		(status.UpdateRevision == "" || status.CurrentRevision == status.UpdateRevision)
+}
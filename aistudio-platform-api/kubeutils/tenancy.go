@@ -0,0 +1,449 @@
+package kubeutils
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	apiv1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/yaml"
+)
+
+// Labels put on every tenant namespace and on the objects created in it.
+const (
+	TenantLabel    = "aistudio/tenant"
+	managedByLabel = "app.kubernetes.io/managed-by"
+	managedBy      = "aistudio-platform-api"
+)
+
+// Names of the per-tenant objects EnsureTenantNamespace keeps up to date.
+const (
+	TenantQuotaName         = "tenant-quota"
+	TenantLimitRangeName    = "tenant-limits"
+	TenantNetworkPolicyName = "tenant-default"
+)
+
+// DefaultTenantPrefix starts the namespace of every tenant unless the
+// tenancy configuration names another prefix.
+const DefaultTenantPrefix = "tenant-"
+
+// Tenancy turns on one namespace per tenant, a team or project. Each tenant
+// namespace is created on first use with the labels, quota, limits, network
+// policy and shared volume claims described here. It can be loaded from
+// YAML with LoadTenancy, using the JSON names.
+type Tenancy struct {
+	// NamespacePrefix is put before the tenant name; empty means
+	// DefaultTenantPrefix.
+	NamespacePrefix string `json:"namespacePrefix,omitempty"`
+	// Labels are added to every tenant namespace besides TenantLabel.
+	Labels map[string]string `json:"labels,omitempty"`
+	// Quota is the hard limit of the tenant's ResourceQuota. Empty creates
+	// no quota.
+	Quota apiv1.ResourceList `json:"quota,omitempty"`
+	// Limits are the per-container defaults and maximum of the tenant's
+	// LimitRange. Empty creates no limit range.
+	Limits TenantLimits `json:"limits,omitempty"`
+	// IngressNamespaces may reach the tenant's pods besides the tenant
+	// itself, typically the ingress controller's namespace. All other
+	// traffic from outside the tenant is denied.
+	IngressNamespaces []string `json:"ingressNamespaces,omitempty"`
+	// APINamespace is the namespace the API runs in, which may reach the
+	// tenant's pods so the idle culler can ask labspaces for their
+	// activity. LoadTenancy defaults it to the namespace of the pod's
+	// service account when the API runs in a cluster.
+	APINamespace string `json:"apiNamespace,omitempty"`
+	// Claims are the shared volume claims workloads mount, such as
+	// aim-runs-claim for labspaces, created in every tenant namespace.
+	Claims []TenantClaim `json:"claims,omitempty"`
+}
+
+// TenantLimits are the container limits of a tenant's LimitRange.
+type TenantLimits struct {
+	DefaultRequest apiv1.ResourceList `json:"defaultRequest,omitempty"`
+	Default        apiv1.ResourceList `json:"default,omitempty"`
+	Max            apiv1.ResourceList `json:"max,omitempty"`
+}
+
+func (l TenantLimits) empty() bool {
+	return len(l.DefaultRequest) == 0 && len(l.Default) == 0 && len(l.Max) == 0
+}
+
+// TenantClaim is a volume claim created in every tenant namespace.
+type TenantClaim struct {
+	Name         string `json:"name"`
+	Size         string `json:"size"`
+	StorageClass string `json:"storageClass,omitempty"`
+	// AccessMode defaults to ReadWriteMany, since the claims are shared by
+	// the tenant's workloads.
+	AccessMode apiv1.PersistentVolumeAccessMode `json:"accessMode,omitempty"`
+}
+
+// LoadTenancy reads the tenancy configuration at path.
+func LoadTenancy(path string) (*Tenancy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tenancy config: %w", err)
+	}
+	var t Tenancy
+	if err := yaml.UnmarshalStrict(data, &t); err != nil {
+		return nil, fmt.Errorf("failed to parse tenancy config %s: %w", path, err)
+	}
+	if t.APINamespace == "" {
+		t.APINamespace = podNamespace()
+	}
+	for i, claim := range t.Claims {
+		if claim.Name == "" {
+			return nil, fmt.Errorf("claim %d in %s has no name", i, path)
+		}
+		if _, err := resource.ParseQuantity(claim.Size); err != nil {
+			return nil, fmt.Errorf("claim %s in %s: invalid size %q: %w", claim.Name, path, claim.Size, err)
+		}
+	}
+	return &t, nil
+}
+
+// serviceAccountNamespaceFile holds the namespace of the pod the API runs in.
+const serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// podNamespace is the namespace the API's pod runs in, or empty outside a
+// cluster.
+func podNamespace() string {
+	data, err := os.ReadFile(serviceAccountNamespaceFile)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// Namespace is the namespace of tenant. The tenant must be named and give
+// a valid namespace name; otherwise the error is ErrInvalid.
+func (t *Tenancy) Namespace(tenant string) (string, error) {
+	if tenant == "" {
+		return "", &Error{Op: "resolve", Resource: "tenant", Kind: ErrInvalid, Err: fmt.Errorf("a tenant is required when tenancy is enabled")}
+	}
+	prefix := t.NamespacePrefix
+	if prefix == "" {
+		prefix = DefaultTenantPrefix
+	}
+	namespace := prefix + tenant
+	if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+		return "", &Error{Op: "resolve", Resource: "tenant", Name: tenant, Kind: ErrInvalid, Err: fmt.Errorf("namespace %q is not valid: %s", namespace, strings.Join(errs, "; "))}
+	}
+	return namespace, nil
+}
+
+// TenantNamespace is the namespace tenant's workloads live in: base when
+// tenancy is off, the tenant's own namespace otherwise. A tenant given
+// with tenancy off still names the team quotas are counted against, so it
+// must be a valid label value.
+func (kc *KubernetesConfig) TenantNamespace(tenant, base string) (string, error) {
+	if tenant != "" {
+		if err := ValidateQuotaSubject(QuotaTeam, tenant); err != nil {
+			return "", err
+		}
+	}
+	if kc.Tenancy == nil {
+		return base, nil
+	}
+	return kc.Tenancy.Namespace(tenant)
+}
+
+// EnsureNamespace creates namespace for workloads of tenant. With tenancy on
+// and a tenant given it is EnsureTenantNamespace, otherwise CreateNamespace.
+func (kc *KubernetesConfig) EnsureNamespace(namespace, tenant string) error {
+	if kc.Tenancy == nil || tenant == "" {
+		return kc.CreateNamespace(namespace)
+	}
+	return kc.EnsureTenantNamespace(namespace, tenant)
+}
+
+// EnsureTenantNamespace creates or updates namespace and the quota, limit
+// range, network policy and volume claims the tenancy configuration asks
+// for. It is safe to call on every request: objects that already match are
+// left alone, and claims that exist are never changed.
+func (kc *KubernetesConfig) EnsureTenantNamespace(namespace, tenant string) error {
+	t := kc.Tenancy
+	if t == nil {
+		return fmt.Errorf("tenancy is not enabled")
+	}
+	labels := map[string]string{}
+	for k, v := range t.Labels {
+		labels[k] = v
+	}
+	labels[TenantLabel] = tenant
+	labels[managedByLabel] = managedBy
+
+	if err := kc.ensureNamespaceLabels(namespace, labels); err != nil {
+		return err
+	}
+	objectLabels := map[string]string{TenantLabel: tenant, managedByLabel: managedBy}
+	if len(t.Quota) > 0 {
+		if err := kc.ensureResourceQuota(namespace, objectLabels, t.Quota); err != nil {
+			return err
+		}
+	}
+	if !t.Limits.empty() {
+		if err := kc.ensureLimitRange(namespace, objectLabels, t.Limits); err != nil {
+			return err
+		}
+	}
+	if err := kc.ensureNetworkPolicy(namespace, objectLabels, t.admittedNamespaces()); err != nil {
+		return err
+	}
+	for _, claim := range t.Claims {
+		if err := kc.ensureClaim(namespace, objectLabels, claim); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (kc *KubernetesConfig) ensureNamespaceLabels(namespace string, labels map[string]string) error {
+	client := kc.Clientset.CoreV1().Namespaces()
+	ns, err := client.Get(context.TODO(), namespace, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		ns = &apiv1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace, Labels: labels}}
+		_, err = client.Create(context.TODO(), ns, metav1.CreateOptions{})
+		if errors.IsAlreadyExists(err) {
+			return kc.ensureNamespaceLabels(namespace, labels)
+		}
+		return wrapAPIError("create", "namespace", namespace, err)
+	}
+	if err != nil {
+		return wrapAPIError("get", "namespace", namespace, err)
+	}
+	if owner, ok := ns.Labels[TenantLabel]; ok && owner != labels[TenantLabel] {
+		return &Error{Op: "update", Resource: "namespace", Name: namespace, Kind: ErrConflict, Err: fmt.Errorf("namespace belongs to tenant %q", owner)}
+	}
+	changed := false
+	if ns.Labels == nil {
+		ns.Labels = map[string]string{}
+	}
+	for k, v := range labels {
+		if ns.Labels[k] != v {
+			ns.Labels[k] = v
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	_, err = client.Update(context.TODO(), ns, metav1.UpdateOptions{})
+	return wrapAPIError("update", "namespace", namespace, err)
+}
+
+func (kc *KubernetesConfig) ensureResourceQuota(namespace string, labels map[string]string, hard apiv1.ResourceList) error {
+	client := kc.Clientset.CoreV1().ResourceQuotas(namespace)
+	quota, err := client.Get(context.TODO(), TenantQuotaName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		quota = &apiv1.ResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{Name: TenantQuotaName, Namespace: namespace, Labels: labels},
+			Spec:       apiv1.ResourceQuotaSpec{Hard: hard},
+		}
+		_, err = client.Create(context.TODO(), quota, metav1.CreateOptions{})
+		return wrapAPIError("create", "resourcequota", TenantQuotaName, err)
+	}
+	if err != nil {
+		return wrapAPIError("get", "resourcequota", TenantQuotaName, err)
+	}
+	if sameResources(quota.Spec.Hard, hard) {
+		return nil
+	}
+	quota.Spec.Hard = hard
+	_, err = client.Update(context.TODO(), quota, metav1.UpdateOptions{})
+	return wrapAPIError("update", "resourcequota", TenantQuotaName, err)
+}
+
+func (kc *KubernetesConfig) ensureLimitRange(namespace string, labels map[string]string, limits TenantLimits) error {
+	item := apiv1.LimitRangeItem{
+		Type:           apiv1.LimitTypeContainer,
+		DefaultRequest: limits.DefaultRequest,
+		Default:        limits.Default,
+		Max:            limits.Max,
+	}
+	client := kc.Clientset.CoreV1().LimitRanges(namespace)
+	lr, err := client.Get(context.TODO(), TenantLimitRangeName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		lr = &apiv1.LimitRange{
+			ObjectMeta: metav1.ObjectMeta{Name: TenantLimitRangeName, Namespace: namespace, Labels: labels},
+			Spec:       apiv1.LimitRangeSpec{Limits: []apiv1.LimitRangeItem{item}},
+		}
+		_, err = client.Create(context.TODO(), lr, metav1.CreateOptions{})
+		return wrapAPIError("create", "limitrange", TenantLimitRangeName, err)
+	}
+	if err != nil {
+		return wrapAPIError("get", "limitrange", TenantLimitRangeName, err)
+	}
+	if len(lr.Spec.Limits) == 1 && sameLimitItem(lr.Spec.Limits[0], item) {
+		return nil
+	}
+	lr.Spec.Limits = []apiv1.LimitRangeItem{item}
+	_, err = client.Update(context.TODO(), lr, metav1.UpdateOptions{})
+	return wrapAPIError("update", "limitrange", TenantLimitRangeName, err)
+}
+
+// admittedNamespaces are the namespaces besides the tenant's own whose pods
+// may reach the tenant's.
+func (t *Tenancy) admittedNamespaces() []string {
+	out := append([]string(nil), t.IngressNamespaces...)
+	if t.APINamespace == "" {
+		return out
+	}
+	for _, ns := range out {
+		if ns == t.APINamespace {
+			return out
+		}
+	}
+	return append(out, t.APINamespace)
+}
+
+// ensureNetworkPolicy admits traffic to the tenant's pods only from the
+// tenant's own pods and from the ingressNamespaces.
+func (kc *KubernetesConfig) ensureNetworkPolicy(namespace string, labels map[string]string, ingressNamespaces []string) error {
+	from := []networkingv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{}}}
+	if len(ingressNamespaces) > 0 {
+		from = append(from, networkingv1.NetworkPolicyPeer{NamespaceSelector: &metav1.LabelSelector{
+			MatchExpressions: []metav1.LabelSelectorRequirement{{
+				Key:      "kubernetes.io/metadata.name",
+				Operator: metav1.LabelSelectorOpIn,
+				Values:   ingressNamespaces,
+			}},
+		}})
+	}
+	spec := networkingv1.NetworkPolicySpec{
+		PodSelector: metav1.LabelSelector{},
+		PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+		Ingress:     []networkingv1.NetworkPolicyIngressRule{{From: from}},
+	}
+
+	client := kc.Clientset.NetworkingV1().NetworkPolicies(namespace)
+	policy, err := client.Get(context.TODO(), TenantNetworkPolicyName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		policy = &networkingv1.NetworkPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: TenantNetworkPolicyName, Namespace: namespace, Labels: labels},
+			Spec:       spec,
+		}
+		_, err = client.Create(context.TODO(), policy, metav1.CreateOptions{})
+		return wrapAPIError("create", "networkpolicy", TenantNetworkPolicyName, err)
+	}
+	if err != nil {
+		return wrapAPIError("get", "networkpolicy", TenantNetworkPolicyName, err)
+	}
+	if equality.Semantic.DeepEqual(policy.Spec, spec) {
+		return nil
+	}
+	policy.Spec = spec
+	_, err = client.Update(context.TODO(), policy, metav1.UpdateOptions{})
+	return wrapAPIError("update", "networkpolicy", TenantNetworkPolicyName, err)
+}
+
+func (kc *KubernetesConfig) ensureClaim(namespace string, labels map[string]string, claim TenantClaim) error {
+	exists, err := kc.ClaimExists(namespace, claim.Name)
+	if err != nil || exists {
+		return err
+	}
+	size, err := resource.ParseQuantity(claim.Size)
+	if err != nil {
+		return &Error{Op: "create", Resource: "persistentvolumeclaim", Name: claim.Name, Kind: ErrInvalid, Err: err}
+	}
+	accessMode := claim.AccessMode
+	if accessMode == "" {
+		accessMode = apiv1.ReadWriteMany
+	}
+	pvc := &apiv1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: claim.Name, Namespace: namespace, Labels: labels},
+		Spec: apiv1.PersistentVolumeClaimSpec{
+			AccessModes: []apiv1.PersistentVolumeAccessMode{accessMode},
+			Resources: apiv1.ResourceRequirements{
+				Requests: apiv1.ResourceList{apiv1.ResourceStorage: size},
+			},
+		},
+	}
+	if claim.StorageClass != "" {
+		storageClass := claim.StorageClass
+		pvc.Spec.StorageClassName = &storageClass
+	}
+	_, err = kc.Clientset.CoreV1().PersistentVolumeClaims(namespace).Create(context.TODO(), pvc, metav1.CreateOptions{})
+	if errors.IsAlreadyExists(err) {
+		return nil
+	}
+	return wrapAPIError("create", "persistentvolumeclaim", claim.Name, err)
+}
+
+// AppendRuleToIngressFrom is AppendRuleToIngress for an ingress that may not
+// exist yet in namespace. A missing ingress is created from the one of the
+// same name in templateNamespace, keeping its class, annotations, hosts and
+// TLS but none of its paths, which belong to the other namespace's services.
+func (kc *KubernetesConfig) AppendRuleToIngressFrom(namespace, templateNamespace, ingressName, serviceName, path string) error {
+	client := kc.Clientset.NetworkingV1().Ingresses(namespace)
+	if _, err := client.Get(context.TODO(), ingressName, metav1.GetOptions{}); err == nil {
+		return kc.AppendRuleToIngress(namespace, ingressName, serviceName, path)
+	} else if !errors.IsNotFound(err) {
+		return wrapAPIError("get", "ingress", ingressName, err)
+	}
+
+	template, err := kc.Clientset.NetworkingV1().Ingresses(templateNamespace).Get(context.TODO(), ingressName, metav1.GetOptions{})
+	if err != nil {
+		return wrapAPIError("get", "ingress", ingressName, err)
+	}
+	ingress := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        ingressName,
+			Namespace:   namespace,
+			Labels:      template.Labels,
+			Annotations: map[string]string{},
+		},
+		Spec: networkingv1.IngressSpec{
+			IngressClassName: template.Spec.IngressClassName,
+			TLS:              template.Spec.TLS,
+		},
+	}
+	for k, v := range template.Annotations {
+		if k != apiv1.LastAppliedConfigAnnotation {
+			ingress.Annotations[k] = v
+		}
+	}
+	for _, rule := range template.Spec.Rules {
+		if rule.HTTP == nil {
+			continue
+		}
+		ingress.Spec.Rules = append(ingress.Spec.Rules, networkingv1.IngressRule{
+			Host: rule.Host,
+			IngressRuleValue: networkingv1.IngressRuleValue{HTTP: &networkingv1.HTTPIngressRuleValue{
+				Paths: []networkingv1.HTTPIngressPath{ingressPath(serviceName, path)},
+			}},
+		})
+	}
+	_, err = client.Create(context.TODO(), ingress, metav1.CreateOptions{})
+	if errors.IsAlreadyExists(err) {
+		return kc.AppendRuleToIngress(namespace, ingressName, serviceName, path)
+	}
+	return wrapAPIError("create", "ingress", ingressName, err)
+}
+
+func sameResources(a, b apiv1.ResourceList) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, q := range a {
+		other, ok := b[name]
+		if !ok || q.Cmp(other) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func sameLimitItem(a, b apiv1.LimitRangeItem) bool {
+	return a.Type == b.Type &&
+		sameResources(a.DefaultRequest, b.DefaultRequest) &&
+		sameResources(a.Default, b.Default) &&
+		sameResources(a.Max, b.Max)
+}
@@ -0,0 +1,125 @@
+package kubeutils_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"Kubernetes-api/internal/kubetest"
+	"Kubernetes-api/kubeutils"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestTenancyNamespace(t *testing.T) {
+	tenancy := &kubeutils.Tenancy{}
+	if ns, err := tenancy.Namespace("vision"); err != nil || ns != "tenant-vision" {
+		t.Errorf("Namespace(vision) = %q, %v, want tenant-vision", ns, err)
+	}
+	for _, tenant := range []string{"", "Vision", "a.b"} {
+		if _, err := tenancy.Namespace(tenant); !errors.Is(err, kubeutils.ErrInvalid) {
+			t.Errorf("Namespace(%q) = %v, want ErrInvalid", tenant, err)
+		}
+	}
+
+	kc := kubetest.New().Kube
+	if ns, err := kc.TenantNamespace("", "lab"); err != nil || ns != "lab" {
+		t.Errorf("without tenancy TenantNamespace = %q, %v, want lab", ns, err)
+	}
+	kc.Tenancy = &kubeutils.Tenancy{NamespacePrefix: "team-"}
+	if ns, err := kc.TenantNamespace("vision", "lab"); err != nil || ns != "team-vision" {
+		t.Errorf("TenantNamespace = %q, %v, want team-vision", ns, err)
+	}
+}
+
+func TestEnsureTenantNamespace(t *testing.T) {
+	h := kubetest.New()
+	h.Kube.Tenancy = &kubeutils.Tenancy{
+		Labels: map[string]string{"team": "yes"},
+		Quota:  v1.ResourceList{v1.ResourceRequestsCPU: resource.MustParse("8")},
+		Limits: kubeutils.TenantLimits{
+			Default: v1.ResourceList{v1.ResourceCPU: resource.MustParse("1")},
+		},
+		IngressNamespaces: []string{"ingress-nginx"},
+		APINamespace:      "aistudio",
+		Claims:            []kubeutils.TenantClaim{{Name: "aim-runs-claim", Size: "10Gi"}},
+	}
+	// A second call must find everything in place and change nothing.
+	for i := 0; i < 2; i++ {
+		if i == 1 {
+			h.Clientset.ClearActions()
+		}
+		if err := h.Kube.EnsureTenantNamespace("tenant-vision", "vision"); err != nil {
+			t.Fatalf("EnsureTenantNamespace #%d: %v", i+1, err)
+		}
+	}
+	for _, action := range h.Clientset.Actions() {
+		if action.GetVerb() != "get" && action.GetVerb() != "list" {
+			t.Errorf("second EnsureTenantNamespace did %s %s", action.GetVerb(), action.GetResource().Resource)
+		}
+	}
+
+	ctx := context.TODO()
+	ns, err := h.Clientset.CoreV1().Namespaces().Get(ctx, "tenant-vision", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("namespace not created: %v", err)
+	}
+	if ns.Labels[kubeutils.TenantLabel] != "vision" || ns.Labels["team"] != "yes" {
+		t.Errorf("namespace labels = %v, want the tenant and configured labels", ns.Labels)
+	}
+	quota, err := h.Clientset.CoreV1().ResourceQuotas("tenant-vision").Get(ctx, kubeutils.TenantQuotaName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("quota not created: %v", err)
+	}
+	if cpu := quota.Spec.Hard[v1.ResourceRequestsCPU]; cpu.String() != "8" {
+		t.Errorf("quota requests.cpu = %s, want 8", cpu.String())
+	}
+	if _, err := h.Clientset.CoreV1().LimitRanges("tenant-vision").Get(ctx, kubeutils.TenantLimitRangeName, metav1.GetOptions{}); err != nil {
+		t.Errorf("limit range not created: %v", err)
+	}
+	policy, err := h.Clientset.NetworkingV1().NetworkPolicies("tenant-vision").Get(ctx, kubeutils.TenantNetworkPolicyName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("network policy not created: %v", err)
+	}
+	from := policy.Spec.Ingress[0].From
+	if len(from) != 2 || from[1].NamespaceSelector == nil {
+		t.Fatalf("network policy peers = %+v, want the tenant and the admitted namespaces", from)
+	}
+	if admitted := from[1].NamespaceSelector.MatchExpressions[0].Values; !reflect.DeepEqual(admitted, []string{"ingress-nginx", "aistudio"}) {
+		t.Errorf("admitted namespaces = %v, want the ingress and the API namespace", admitted)
+	}
+	if _, err := h.Clientset.CoreV1().PersistentVolumeClaims("tenant-vision").Get(ctx, "aim-runs-claim", metav1.GetOptions{}); err != nil {
+		t.Errorf("shared claim not created: %v", err)
+	}
+
+	if err := h.Kube.EnsureTenantNamespace("tenant-vision", "speech"); !errors.Is(err, kubeutils.ErrConflict) {
+		t.Errorf("taking over another tenant's namespace = %v, want ErrConflict", err)
+	}
+}
+
+func TestLoadTenancy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tenancy.yaml")
+	doc := "namespacePrefix: team-\nquota:\n  requests.cpu: \"16\"\nclaims:\n  - name: xtract\n    size: 5Gi\n"
+	if err := os.WriteFile(path, []byte(doc), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tenancy, err := kubeutils.LoadTenancy(path)
+	if err != nil {
+		t.Fatalf("LoadTenancy: %v", err)
+	}
+	if cpu := tenancy.Quota[v1.ResourceRequestsCPU]; tenancy.NamespacePrefix != "team-" || cpu.String() != "16" || len(tenancy.Claims) != 1 {
+		t.Errorf("tenancy = %+v", tenancy)
+	}
+
+	if err := os.WriteFile(path, []byte("claims:\n  - name: xtract\n    size: lots\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kubeutils.LoadTenancy(path); err == nil {
+		t.Error("a claim with an invalid size should be rejected")
+	}
+}
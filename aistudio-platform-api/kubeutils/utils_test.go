@@ -1,79 +1,72 @@
-package kubeutils
+package kubeutils_test
 
-// func TestCheckMemoryAvailability(t *testing.T) {
-// 	kconfig := KubernetesConfig{Clientset: fake.NewSimpleClientset()}
+import (
+	"testing"
 
-// 	bool, err := kconfig.CheckGpuAvaibility("1")
-// 	fmt.Println("Say hi")
+	"Kubernetes-api/internal/kubetest"
+)
 
-// 	if err == nil {
-// 		t.Log(err)
-// 	}
-// 	if bool == true {
-// 		t.Log(" Memory Found")
-// 	}
-// }
+func TestGetRemainingNodeResources(t *testing.T) {
+	h := kubetest.New(
+		kubetest.Node("node-a", "4", "16Gi", "2"),
+		kubetest.Pod("lab", "alice-0", "alice", "node-a", "1", "2Gi"),
+	)
 
-// func TestFakeClientSet(t *testing.T) {
-// 	ctx := context.TODO()
-// 	cs := fake.NewSimpleClientset()
+	resources, err := h.Kube.GetRemainingNodeResources()
+	if err != nil {
+		t.Fatalf("GetRemainingNodeResources: %v", err)
+	}
+	node, ok := resources["node_1"]
+	if !ok {
+		t.Fatalf("expected node_1 in %v", resources)
+	}
+	if node.CPU != "3" || node.Memory != "14" || node.GPU != "2" {
+		t.Errorf("remaining = cpu %s, memory %s, gpu %s; want 3, 14, 2", node.CPU, node.Memory, node.GPU)
+	}
+	if node.IP != "node-a" || node.NodeGroup != "default" {
+		t.Errorf("node identity = %q/%q, want node-a/default", node.IP, node.NodeGroup)
+	}
+}
 
-// 	nodes, err := cs.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
-// 	if err != nil {
-// 		t.Error(err)
-// 	}
+func TestResourceAvailabilityChecks(t *testing.T) {
+	h := kubetest.New(
+		kubetest.Node("node-a", "4", "16Gi", "2"),
+		kubetest.Pod("lab", "alice-0", "alice", "node-a", "1", "2Gi"),
+	)
 
-// 	for _, node := range nodes.Items {
-// 		memoryQty := node.Status.Allocatable[corev1.ResourceMemory]
-// 		memoryRequestQty := resource.MustParse("1Gi")
-// 		if memoryQty.Cmp(memoryRequestQty) >= 0 {
-// 			t.Error("ok")
-// 		}
-// 	}
-// }
+	tests := []struct {
+		name  string
+		check func(string) (bool, error)
+		value string
+		want  bool
+	}{
+		{"cpu fits", h.Kube.CheckCpuAvailability, "2", true},
+		{"cpu exceeds", h.Kube.CheckCpuAvailability, "8", false},
+		{"memory fits", h.Kube.CheckMemoryAvailability, "8Gi", true},
+		{"memory exceeds", h.Kube.CheckMemoryAvailability, "32Gi", false},
+		{"gpu fits", h.Kube.CheckGpuAvailability, "1", true},
+		{"gpu exceeds", h.Kube.CheckGpuAvailability, "4", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.check(tt.value)
+			if got != tt.want {
+				t.Fatalf("got %v (err %v), want %v", got, err, tt.want)
+			}
+			if !tt.want && err == nil {
+				t.Error("expected an error explaining the shortfall")
+			}
+		})
+	}
+}
 
-// func TestGetNodeResources(t *testing.T) {
-// 	// Create a fake client with a node.
-// 	client := fake.NewSimpleClientset(&corev1.Node{
-// 		ObjectMeta: metav1.ObjectMeta{
-// 			Name: "node1",
-// 		},
-// 		Status: corev1.NodeStatus{
-// 			Capacity: corev1.ResourceList{
-// 				"cpu":            resource.MustParse("1000m"),
-// 				"memory":         resource.MustParse("1000Mi"),
-// 				"nvidia.com/gpu": resource.MustParse("1"),
-// 			},
-// 		},
-// 	})
+func TestVendorConfigWithoutNodes(t *testing.T) {
+	h := kubetest.New()
 
-// 	kc := &KubernetesConfig{
-// 		Clientset: client,
-// 	}
-
-// 	resources, err := kc.GetNodeResources()
-// 	if err != nil {
-// 		t.Fatalf("expected no error, got %v", err)
-// 	}
-
-// 	if len(resources) != 1 {
-// 		t.Fatalf("expected one node, got %d", len(resources))
-// 	}
-
-// 	nodeResources, ok := resources["node1"]
-// 	if !ok {
-// 		t.Fatalf("expected resources for node1, got none")
-// 	}
-
-// 	if nodeResources.CPU != "1" {
-// 		t.Errorf("expected CPU to be 1, got %s", nodeResources.CPU)
-// 	}
-
-// 	if nodeResources.Memory != "1000Mi" {
-// 		t.Errorf("expected Memory to be 1000Mi, got %s", nodeResources.Memory)
-// 	}
-
-// 	if nodeResources.GPU != "1" {
-// 		t.Errorf("expected GPU to be 1, got %s", nodeResources.GPU)
-// 	}
-// }
+	if _, err := h.Kube.GetVendorConfig(); err == nil {
+		t.Fatal("expected an error for a cluster with no recognisable nodes")
+	}
+	if _, err := h.Kube.CheckCpuAvailability("1"); err == nil {
+		t.Fatal("expected availability checks to surface the vendor error")
+	}
+}
@@ -0,0 +1,151 @@
+package kubeutils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// WatchKind selects an informer for Watch to subscribe to.
+type WatchKind string
+
+const (
+	WatchPods         WatchKind = "Pod"
+	WatchDeployments  WatchKind = "Deployment"
+	WatchStatefulSets WatchKind = "StatefulSet"
+)
+
+// EventType is the SSE event name a change is delivered under.
+type EventType string
+
+const (
+	EventAdded    EventType = "added"
+	EventModified EventType = "modified"
+	EventDeleted  EventType = "deleted"
+)
+
+// ErrCacheNotSynced is returned by Watch before StartCache has completed.
+var ErrCacheNotSynced = errors.New("informer cache has not synced yet")
+
+// ResourceEvent is a change to a watched object, summarised the way the list
+// endpoints present it.
+type ResourceEvent struct {
+	Type    EventType         `json:"-"`
+	Kind    WatchKind         `json:"kind"`
+	Name    string            `json:"name"`
+	Summary map[string]string `json:"summary"`
+}
+
+// EventName is the SSE event type the change is sent as.
+func (e ResourceEvent) EventName() string {
+	return string(e.Type)
+}
+
+// EventKey identifies the object the change is about.
+func (e ResourceEvent) EventKey() string {
+	return string(e.Kind) + "/" + e.Name
+}
+
+// Watch delivers changes to objects of the given kinds in namespace until
+// ctx is done. Objects that already exist are delivered first as added
+// events. The channel is never closed; receivers should stop on ctx.Done().
+func (kc *KubernetesConfig) Watch(ctx context.Context, namespace string, kinds ...WatchKind) (<-chan ResourceEvent, error) {
+	c := kc.cache.Load()
+	if c == nil {
+		return nil, ErrCacheNotSynced
+	}
+
+	informers := make([]cache.SharedIndexInformer, len(kinds))
+	for i, kind := range kinds {
+		switch kind {
+		case WatchPods:
+			informers[i] = c.factory.Core().V1().Pods().Informer()
+		case WatchDeployments:
+			informers[i] = c.factory.Apps().V1().Deployments().Informer()
+		case WatchStatefulSets:
+			informers[i] = c.factory.Apps().V1().StatefulSets().Informer()
+		default:
+			return nil, fmt.Errorf("unsupported watch kind %q", kind)
+		}
+	}
+
+	events := make(chan ResourceEvent, 16)
+	registrations := make([]cache.ResourceEventHandlerRegistration, 0, len(kinds))
+	unregister := func() {
+		for i, reg := range registrations {
+			informers[i].RemoveEventHandler(reg)
+		}
+	}
+	for i, kind := range kinds {
+		reg, err := informers[i].AddEventHandler(watchHandler(ctx, kind, namespace, events))
+		if err != nil {
+			unregister()
+			return nil, fmt.Errorf("failed to watch %s: %w", kind, err)
+		}
+		registrations = append(registrations, reg)
+	}
+
+	go func() {
+		<-ctx.Done()
+		unregister()
+	}()
+	return events, nil
+}
+
+func watchHandler(ctx context.Context, kind WatchKind, namespace string, events chan<- ResourceEvent) cache.ResourceEventHandler {
+	send := func(typ EventType, obj interface{}) {
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
+		meta, ok := obj.(metav1.Object)
+		if !ok || meta.GetNamespace() != namespace {
+			return
+		}
+		ev := ResourceEvent{Type: typ, Kind: kind, Name: meta.GetName(), Summary: summarize(obj)}
+		select {
+		case events <- ev:
+		case <-ctx.Done():
+		}
+	}
+
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) { send(EventAdded, obj) },
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			// Periodic resyncs redeliver unchanged objects.
+			if oldObj.(metav1.Object).GetResourceVersion() == newObj.(metav1.Object).GetResourceVersion() {
+				return
+			}
+			send(EventModified, newObj)
+		},
+		DeleteFunc: func(obj interface{}) { send(EventDeleted, obj) },
+	}
+}
+
+func summarize(obj interface{}) map[string]string {
+	switch o := obj.(type) {
+	case *v1.Pod:
+		return PodSummary(o)
+	case *appsv1.Deployment:
+		return workloadSummary(o.Name, o.Spec.Replicas, o.Status.ReadyReplicas)
+	case *appsv1.StatefulSet:
+		return workloadSummary(o.Name, o.Spec.Replicas, o.Status.ReadyReplicas)
+	}
+	return nil
+}
+
+func workloadSummary(name string, desired *int32, ready int32) map[string]string {
+	replicas := int32(1)
+	if desired != nil {
+		replicas = *desired
+	}
+	return map[string]string{
+		"name":     name,
+		"ready":    fmt.Sprintf("%d/%d", ready, replicas),
+		"replicas": fmt.Sprintf("%d", replicas),
+	}
+}
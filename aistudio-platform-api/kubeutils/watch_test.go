@@ -0,0 +1,86 @@
+package kubeutils_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"Kubernetes-api/internal/kubetest"
+	"Kubernetes-api/kubeutils"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func nextEvent(t *testing.T, events <-chan kubeutils.ResourceEvent) kubeutils.ResourceEvent {
+	t.Helper()
+	select {
+	case ev := <-events:
+		return ev
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a watch event")
+	}
+	return kubeutils.ResourceEvent{}
+}
+
+func TestWatchRequiresSyncedCache(t *testing.T) {
+	h := kubetest.New()
+	_, err := h.Kube.Watch(context.Background(), "lab", kubeutils.WatchPods)
+	if !errors.Is(err, kubeutils.ErrCacheNotSynced) {
+		t.Fatalf("Watch before sync returned %v, want ErrCacheNotSynced", err)
+	}
+}
+
+func TestWatchDeliversTypedChanges(t *testing.T) {
+	h := kubetest.New(
+		kubetest.Pod("lab", "alice-0", "alice", "node-a", "1", "1Gi"),
+		kubetest.Pod("model", "other-0", "other", "node-a", "1", "1Gi"),
+	)
+	h.StartCache(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := h.Kube.Watch(ctx, "lab", kubeutils.WatchPods, kubeutils.WatchDeployments)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ev := nextEvent(t, events)
+	if ev.Type != kubeutils.EventAdded || ev.Name != "alice-0" || ev.Summary["status"] != "Running" {
+		t.Fatalf("initial event = %+v, want alice-0 added and running", ev)
+	}
+
+	pods := h.Clientset.CoreV1().Pods("lab")
+	pod, _ := pods.Get(ctx, "alice-0", metav1.GetOptions{})
+	pod.ResourceVersion = "2"
+	pod.Status.ContainerStatuses[0].RestartCount = 3
+	if _, err := pods.Update(ctx, pod, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	ev = nextEvent(t, events)
+	if ev.Type != kubeutils.EventModified || ev.Summary["restarts"] != "3" {
+		t.Fatalf("update event = %+v, want modified with 3 restarts", ev)
+	}
+
+	if _, err := h.Clientset.AppsV1().Deployments("lab").Create(ctx, kubetest.Deployment("lab", "alice"), metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	ev = nextEvent(t, events)
+	if ev.Type != kubeutils.EventAdded || ev.Kind != kubeutils.WatchDeployments || ev.Summary["ready"] != "0/1" {
+		t.Fatalf("deployment event = %+v, want added with 0/1 ready", ev)
+	}
+
+	if err := pods.Delete(ctx, "alice-0", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	ev = nextEvent(t, events)
+	if ev.Type != kubeutils.EventDeleted || ev.Name != "alice-0" {
+		t.Fatalf("delete event = %+v, want alice-0 deleted", ev)
+	}
+
+	select {
+	case ev := <-events:
+		t.Fatalf("unexpected event %+v from another namespace", ev)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,77 @@
+package JupyterLabs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"Kubernetes-api/kubeutils"
+)
+
+// HTTPActivity asks the server of a labspace when it was last used, through
+// the labspace's service on kubeutils.ServicePort: JupyterLab's /api/status reports its last kernel
+// or request activity and code-server's /healthz its last heartbeat, which
+// the editor sends while the user is active. Only labspaces on the cluster
+// the API runs in can be reached; elsewhere the culler goes by metrics.
+type HTTPActivity struct {
+	// Client defaults to one with a five second timeout.
+	Client *http.Client
+}
+
+var defaultActivityClient = &http.Client{Timeout: 5 * time.Second}
+
+// activityPaths are asked in order, below the labspace's base path.
+var activityPaths = []string{"/api/status", "/healthz"}
+
+func (p HTTPActivity) LastActivity(ctx context.Context, lab kubeutils.WorkloadRef) (time.Time, error) {
+	client := p.Client
+	if client == nil {
+		client = defaultActivityClient
+	}
+	base := fmt.Sprintf("http://%s%s.%s.svc:%d/%s", NotebookServicePrefix, lab.Name, lab.Namespace, kubeutils.ServicePort, lab.Name)
+	var errs []error
+	for _, path := range activityPaths {
+		last, err := lastActivity(ctx, client, base+path)
+		if err == nil {
+			return last, nil
+		}
+		errs = append(errs, err)
+	}
+	return time.Time{}, errors.Join(errs...)
+}
+
+// activityStatus holds the fields of both JupyterLab's and code-server's
+// answers.
+type activityStatus struct {
+	LastActivity  time.Time `json:"last_activity"`
+	LastHeartbeat int64     `json:"lastHeartbeat"`
+}
+
+func lastActivity(ctx context.Context, client *http.Client, url string) (time.Time, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return time.Time{}, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return time.Time{}, fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	var status activityStatus
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return time.Time{}, fmt.Errorf("decoding %s: %w", url, err)
+	}
+	switch {
+	case !status.LastActivity.IsZero():
+		return status.LastActivity, nil
+	case status.LastHeartbeat > 0:
+		return time.UnixMilli(status.LastHeartbeat), nil
+	}
+	return time.Time{}, fmt.Errorf("%s reported no activity", url)
+}
@@ -0,0 +1,60 @@
+package JupyterLabs_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"Kubernetes-api/internal/kubetest"
+	"Kubernetes-api/kubeutils"
+	JupyterLabs "Kubernetes-api/labs/jupyterlabs"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestHTTPActivityProbesLabspaceService(t *testing.T) {
+	h := kubetest.New()
+	if err := h.Kube.CreateService(JupyterLabs.NotebookNamespace, "notebook-alice", "alice", JupyterLabs.NotebookPort, apiv1.ServiceTypeNodePort); err != nil {
+		t.Fatal(err)
+	}
+	svc, err := h.Clientset.CoreV1().Services(JupyterLabs.NotebookNamespace).Get(context.TODO(), "notebook-alice", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := fmt.Sprintf("notebook-alice.%s.svc:%d", JupyterLabs.NotebookNamespace, svc.Spec.Ports[0].Port)
+
+	last := time.Date(2026, 3, 6, 12, 0, 0, 0, time.UTC)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/alice/api/status" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, `{"last_activity": %q}`, last.Format(time.RFC3339))
+	}))
+	defer server.Close()
+
+	// Every dial goes to the test server; the address asked for is recorded.
+	var dialed string
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			dialed = addr
+			return (&net.Dialer{}).DialContext(ctx, network, server.Listener.Addr().String())
+		},
+	}}
+	probe := JupyterLabs.HTTPActivity{Client: client}
+	got, err := probe.LastActivity(context.TODO(), kubeutils.WorkloadRef{Namespace: JupyterLabs.NotebookNamespace, Name: "alice"})
+	if err != nil {
+		t.Fatalf("LastActivity: %v", err)
+	}
+	if dialed != want {
+		t.Errorf("probe dialed %s, want the service port at %s", dialed, want)
+	}
+	if !got.Equal(last) {
+		t.Errorf("last activity = %s, want %s", got, last)
+	}
+}
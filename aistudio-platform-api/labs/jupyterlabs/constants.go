@@ -42,6 +42,31 @@ const (
 	GitTokenEnv = "git_token"
 )
 
+// Secrets holding a labspace's password and a user's git token, and the
+// keys they are stored under.
+const (
+	LabspaceSecretPrefix = "labspace-"
+	GitCredentialsPrefix = "git-credentials-"
+	SecretPasswordKey    = "password"
+	SecretTokenKey       = "token"
+)
+
+// Annotations a stopped labspace's statefulset keeps until it is resumed.
+const (
+	StoppedAtAnnotation  = "aistudio/stopped-at"
+	StopReasonAnnotation = "aistudio/stop-reason"
+	ReplicasAnnotation   = "aistudio/replicas"
+	// StatusStopped is the status of a labspace scaled to zero.
+	StatusStopped = "Stopped"
+	// StopReasonRequested is the stop reason of labspaces stopped through
+	// the API.
+	StopReasonRequested = "stopped on request"
+)
+
+// ScheduleAnnotation holds a labspace's LabSchedule, as JSON, on its
+// statefulset.
+const ScheduleAnnotation = "aistudio/schedule"
+
 const (
 	SSEDataPrefix = "data: %s\n\n"
 )
@@ -1,21 +1,18 @@
 package JupyterLabs
 
 import (
-	"bufio"
+	"errors"
 	"fmt"
-	"os"
 	"strconv"
-	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/log"
-	"github.com/sirupsen/logrus"
-	"github.com/valyala/fasthttp"
 
 	"Kubernetes-api/artifacts"
 	"Kubernetes-api/enginetemplate"
 	"Kubernetes-api/helper"
-	"Kubernetes-api/internal/sse"
+	"Kubernetes-api/jobs"
+	"Kubernetes-api/kubeutils"
 )
 
 // CreateNotebooks handles the creation of a Jupyter notebook environment.
@@ -25,80 +22,90 @@ import (
 // @Accept json
 // @Produce json
 // @Param createNotebookRequest body CreateLabRequest true "Notebook Body"
+// @Param cluster query string false "Cluster name"
+// @Param X-Tenant header string false "Tenant, required when tenancy is enabled"
 // @Router /api/notebooks [post]
-func CreateNotebooks(c *fiber.Ctx) error {
+func (s *Service) CreateNotebooks(c *fiber.Ctx) error {
+	svc, err := s.forCluster(c)
+	if err != nil {
+		return err
+	}
 	var request CreateLabRequest
 	if err := c.BodyParser(&request); err != nil {
 		log.Error("error parsing request body: ", err)
-		return helper.SendResponse(c, "Invalid Request", nil, fiber.ErrBadRequest.Code)
+		return helper.BadRequest(err)
+	}
+	if err := request.Validate(); err != nil {
+		return err
+	}
+	// Without a cluster named, the labspace goes to the first one it fits.
+	if c.Query(helper.ClusterParam) == "" && s.clusters.Len() > 1 {
+		if svc, err = svc.placeNotebook(request); err != nil {
+			log.Error("failed to place notebook: ", err)
+			return helper.Wrap(err, fmt.Sprintf("Failed to create labspace: %v", err), fiber.StatusInternalServerError)
+		}
 	}
 
-	gitToken := os.Getenv(GitTokenEnv)
-	if valid, err := enginetemplate.IsValidGitHubRepo(request.TemplateBaseURL, request.TemplateVersion, gitToken); !valid {
+	gitToken, err := svc.gitToken(request.Username)
+	if err != nil {
+		log.Error("failed to read git credentials: ", err)
+		return helper.Wrap(err, "Failed to read git credentials", fiber.StatusInternalServerError)
+	}
+	if valid, err := svc.templates.Validate(request.TemplateBaseURL, request.TemplateVersion, gitToken); !valid {
 		log.Error("failed to validate GitHub repository: ", err)
 		return helper.SendResponse(c, "Git Token Error For Template Download", nil, fiber.StatusInternalServerError)
 	}
 
-	message, err := CreateNotebook(
-		request.Username, request.Password, request.CPURequest, request.GPURequest,
-		request.MemoryRequest, request.CPULimit, request.MemoryLimit, request.DiskStorage,
+	template := enginetemplate.Template{
+		TemplateBaseURL: request.TemplateBaseURL,
+		TemplateVersion: request.TemplateVersion,
+		ExpPath:         fmt.Sprintf("%s%s%s", ArtifactPathPrefix, PersistentVolumePrefix, request.Username+PersistentVolumeSuffix),
+	}
+	message, err := svc.CreateNotebook(
+		request.Username, request.Password, request.resourceSpec(),
 		request.NodeSelector, request.WorkSpaceType, request.LabspaceType,
+		svc.templateStep(template, gitToken),
 	)
 	if err != nil {
 		log.Error("failed to create notebook: ", err, message)
-		return helper.SendResponse(c, "Failed to create labspace", nil, fiber.StatusInternalServerError)
-	}
-
-	errChan := make(chan error, 1)
-	go func() {
-		template := enginetemplate.Template{
-			TemplateBaseURL: request.TemplateBaseURL,
-			TemplateVersion: request.TemplateVersion,
-			ExpPath:         fmt.Sprintf("%s%s%s", ArtifactPathPrefix, PersistentVolumePrefix, request.Username+PersistentVolumeSuffix),
-		}
-
-		if err := template.GetTemplate(gitToken); err != nil {
-			log.Error("failed to get template: ", err)
-			if delErr := DeleteNotebook(request.Username); delErr != nil {
-				logrus.Errorf("failed to clean up notebook after template error: %v", delErr)
-			}
-			errChan <- helper.SendResponse(c, "Error in creating labspace", nil, fiber.StatusBadRequest)
-			return
-		}
-		errChan <- nil
-	}()
-
-	if err := <-errChan; err != nil {
-		return err
+		return helper.Wrap(err, fmt.Sprintf("Failed to create labspace: %v", err), fiber.StatusInternalServerError)
 	}
 
 	log.Info("notebook created successfully with template: ", request.TemplateBaseURL, request.TemplateVersion)
-	return helper.SendResponse(c, "Labspace created successfully", nil, fiber.StatusOK)
+	return helper.SendResponse(c, "Labspace created successfully", map[string]string{"cluster": svc.cluster}, fiber.StatusOK)
 }
 
 // RestartNotebooks handles the restart of a Jupyter notebook environment.
-// @Description Create Jupyter Notebook Environment based on the specific users and project
-// @Summary Create Notebook Environment
+// @Description Recreate a Jupyter Notebook Environment for the user, keeping its volume. A labspace that was stopped is resumed as it was, as /api/notebooks/{id}/resume does, and the password and resources given are not used
+// @Summary Restart Notebook Environment
 // @Tags JupyterLabs Notebook
 // @Accept json
 // @Produce json
-// @Param createNotebookRequest body CreateLabRequest true "Notebook Body"
-// @Router /api/notebooks [post]
-func RestartNotebooks(c *fiber.Ctx) error {
-	var request CreateLabRequest
+// @Param restartNotebookRequest body RestartLabRequest true "Notebook Body"
+// @Param cluster query string false "Cluster name"
+// @Param X-Tenant header string false "Tenant, required when tenancy is enabled"
+// @Router /api/notebooks/restart [post]
+func (s *Service) RestartNotebooks(c *fiber.Ctx) error {
+	svc, err := s.forCluster(c)
+	if err != nil {
+		return err
+	}
+	var request RestartLabRequest
 	if err := c.BodyParser(&request); err != nil {
 		log.Error("error parsing request body: ", err)
-		return helper.SendResponse(c, "Invalid Request", nil, fiber.ErrBadRequest.Code)
+		return helper.BadRequest(err)
+	}
+	if err := request.Validate(); err != nil {
+		return err
 	}
 
-	message, err := CreateNotebook(
-		request.Username, request.Password, request.CPURequest, request.GPURequest,
-		request.MemoryRequest, request.CPULimit, request.MemoryLimit, request.DiskStorage,
+	message, err := svc.RestartNotebook(
+		request.Username, request.Password, request.resourceSpec(),
 		request.NodeSelector, request.WorkSpaceType, request.LabspaceType,
 	)
 	if err != nil {
 		log.Error("failed to restart notebook: ", err)
-		return helper.SendResponse(c, "Failed to restart labspace", nil, fiber.ErrBadRequest.Code)
+		return helper.Wrap(err, fmt.Sprintf("Failed to restart labspace: %v", err), fiber.StatusInternalServerError)
 	}
 
 	log.Info("notebook restarted successfully: ", message)
@@ -110,9 +117,15 @@ func RestartNotebooks(c *fiber.Ctx) error {
 // @Summary Get List of Jupyter Notebook
 // @Tags JupyterLabs Notebook
 // @Produce json
+// @Param cluster query string false "Cluster name"
+// @Param X-Tenant header string false "Tenant, required when tenancy is enabled"
 // @Router /api/notebooks [get]
-func GetNotebooks(c *fiber.Ctx) error {
-	data, err := ListNotebooks()
+func (s *Service) GetNotebooks(c *fiber.Ctx) error {
+	svc, err := s.forCluster(c)
+	if err != nil {
+		return err
+	}
+	data, err := svc.ListNotebooks()
 	if err != nil {
 		log.Error("error listing notebooks: ", err)
 		return helper.SendResponse(c, "Invalid Request", nil, fiber.ErrBadRequest.Code)
@@ -126,11 +139,13 @@ func GetNotebooks(c *fiber.Ctx) error {
 			continue
 		}
 		notebook := Notebook{
-			Name:    element["name"],
-			Ready:   element["ready"],
-			Status:  element["status"],
-			Restart: uint(restart),
-			Age:     element["age"],
+			Name:       element["name"],
+			Ready:      element["ready"],
+			Status:     element["status"],
+			Restart:    uint(restart),
+			Age:        element["age"],
+			StoppedAt:  element["stoppedAt"],
+			StopReason: element["stopReason"],
 		}
 		notebooks = append(notebooks, notebook)
 	}
@@ -144,36 +159,21 @@ func GetNotebooks(c *fiber.Ctx) error {
 // @Tags JupyterLabs Notebook
 // @Accept json
 // @Produce text/event-stream
+// @Param cluster query string false "Cluster name"
+// @Param X-Tenant header string false "Tenant, required when tenancy is enabled"
 // @Router /api/notebooks/sse [get]
-func GetNotebooksSse(c *fiber.Ctx) error {
-	c.Set("Content-Type", "text/event-stream")
-	c.Set("Cache-Control", "no-cache")
-	c.Set("Connection", "keep-alive")
-	c.Set("Transfer-Encoding", "chunked")
-
-	c.Context().SetBodyStreamWriter(fasthttp.StreamWriter(func(wr *bufio.Writer) {
-		fmt.Println("WRITER LABS")
-		em := sse.NewBufioEmitter(wr, "notebooks")
-		for {
-			data, err := ListNotebooks()
-			if err != nil {
-				log.Error("error listing notebooks for SSE: ", err)
-				continue
-			}
-
-			sendJsonFlowErr := em.SendJSON("", "message", data)
-			if sendJsonFlowErr.Err != nil {
-				if sendJsonFlowErr.Next {
-					continue
-				} else {
-					break
-				}
-			}
-
-			time.Sleep(5 * time.Second)
-		}
-	}))
+func (s *Service) GetNotebooksSse(c *fiber.Ctx) error {
+	svc, err := s.forCluster(c)
+	if err != nil {
+		return err
+	}
+	topic := svc.topic(notebookTopic, svc.produceNotebookEvents)
+	if err := s.broker.Start(topic); err != nil {
+		log.Error("error starting notebook stream: ", err)
+		return helper.SendResponse(c, "Labspace stream is unavailable", nil, fiber.StatusServiceUnavailable)
+	}
 
+	s.broker.Serve(c, topic)
 	return nil
 }
 
@@ -184,12 +184,18 @@ func GetNotebooksSse(c *fiber.Ctx) error {
 // @Accept json
 // @Param id path string true "Pod Username"
 // @Produce json
+// @Param cluster query string false "Cluster name"
+// @Param X-Tenant header string false "Tenant, required when tenancy is enabled"
 // @Router /api/notebooks/{id} [delete]
-func DeleteNotebookHandler(c *fiber.Ctx) error {
+func (s *Service) DeleteNotebookHandler(c *fiber.Ctx) error {
+	svc, err := s.forCluster(c)
+	if err != nil {
+		return err
+	}
 	username := c.Params("id")
-	if err := DeleteNotebook(username); err != nil {
+	if err := svc.DeleteNotebook(username); err != nil {
 		log.Error("error deleting notebook: ", err)
-		return helper.SendResponse(c, "Failed to delete labspace", nil, fiber.StatusInternalServerError)
+		return helper.SendResponse(c, "Failed to delete labspace", nil, helper.StatusFor(err, fiber.StatusInternalServerError))
 	}
 
 	log.Info("deleted notebook for user: ", username)
@@ -197,24 +203,241 @@ func DeleteNotebookHandler(c *fiber.Ctx) error {
 }
 
 // StopNotebookHandler stops a specific notebook.
-// @Description Stop a specific notebook experiments
+// @Description Stop a specific notebook experiments by scaling it down. Its service, ingress rules, volume and configuration are kept for POST /api/notebooks/{id}/resume
 // @Summary Delete Specific notebook
 // @Tags JupyterLabs Notebook
 // @Accept json
 // @Param id path string true "Pod Username"
 // @Produce json
-// @Router /api/notebooks/{id} [delete]
-func StopNotebookHandler(c *fiber.Ctx) error {
+// @Param cluster query string false "Cluster name"
+// @Param X-Tenant header string false "Tenant, required when tenancy is enabled"
+// @Router /api/notebooks/stop/{id} [delete]
+func (s *Service) StopNotebookHandler(c *fiber.Ctx) error {
+	svc, err := s.forCluster(c)
+	if err != nil {
+		return err
+	}
 	username := c.Params("id")
-	if err := StopNotebook(username); err != nil {
+	if err := svc.StopNotebook(username, StopReasonRequested); err != nil {
 		log.Error("error stopping notebook: ", err)
-		return helper.SendResponse(c, "Failed to stop labspace", nil, fiber.StatusInternalServerError)
+		return helper.SendResponse(c, "Failed to stop labspace", nil, helper.StatusFor(err, fiber.StatusInternalServerError))
 	}
 
 	log.Info("stopped notebook for user: ", username)
 	return helper.SendResponse(c, "Labspace stopped successfully", nil, fiber.StatusOK)
 }
 
+// RotatePasswordHandler replaces the password of a labspace.
+// @Description Replace the password of a labspace. The new password is stored in the labspace's secret and its pods are restarted to pick it up; the labspace keeps its files and address
+// @Summary Rotate labspace password
+// @Tags JupyterLabs Notebook
+// @Accept json
+// @Produce json
+// @Param id path string true "Pod Username"
+// @Param rotatePasswordRequest body RotatePasswordRequest true "New password"
+// @Param cluster query string false "Cluster name"
+// @Param X-Tenant header string false "Tenant, required when tenancy is enabled"
+// @Router /api/notebooks/{id}/password [put]
+func (s *Service) RotatePasswordHandler(c *fiber.Ctx) error {
+	svc, err := s.forCluster(c)
+	if err != nil {
+		return err
+	}
+	var request RotatePasswordRequest
+	if err := c.BodyParser(&request); err != nil {
+		return helper.BadRequest(err)
+	}
+	if err := request.Validate(); err != nil {
+		return err
+	}
+	username := c.Params("id")
+	if err := svc.RotatePassword(username, request.Password); err != nil {
+		log.Error("error rotating labspace password: ", err)
+		return helper.Wrap(err, "Failed to rotate labspace password", fiber.StatusInternalServerError)
+	}
+
+	log.Info("rotated password of labspace: ", username)
+	return helper.SendResponse(c, "Labspace password rotated successfully", nil, fiber.StatusOK)
+}
+
+// SetGitCredentialsHandler stores a user's git token.
+// @Description Store the git token the user's private templates are cloned with. Without one the server's token is used
+// @Summary Store git credentials
+// @Tags JupyterLabs Notebook
+// @Accept json
+// @Produce json
+// @Param user path string true "Username"
+// @Param gitCredentialsRequest body GitCredentialsRequest true "Git token"
+// @Param cluster query string false "Cluster name"
+// @Param X-Tenant header string false "Tenant, required when tenancy is enabled"
+// @Router /api/notebooks/git-credentials/{user} [put]
+func (s *Service) SetGitCredentialsHandler(c *fiber.Ctx) error {
+	svc, err := s.forCluster(c)
+	if err != nil {
+		return err
+	}
+	username := c.Params("user")
+	var v helper.Validator
+	v.DNSLabel("user", GitCredentialsPrefix+"%s", username)
+	if err := v.Err(); err != nil {
+		return err
+	}
+	var request GitCredentialsRequest
+	if err := c.BodyParser(&request); err != nil {
+		return helper.BadRequest(err)
+	}
+	if err := request.Validate(); err != nil {
+		return err
+	}
+	if err := svc.SetGitToken(username, request.Token); err != nil {
+		log.Error("error storing git credentials: ", err)
+		return helper.Wrap(err, "Failed to store git credentials", fiber.StatusInternalServerError)
+	}
+	return helper.SendResponse(c, "Git credentials stored successfully", nil, fiber.StatusOK)
+}
+
+// DeleteGitCredentialsHandler removes a user's git token.
+// @Description Remove the user's stored git token
+// @Summary Delete git credentials
+// @Tags JupyterLabs Notebook
+// @Produce json
+// @Param user path string true "Username"
+// @Param cluster query string false "Cluster name"
+// @Param X-Tenant header string false "Tenant, required when tenancy is enabled"
+// @Router /api/notebooks/git-credentials/{user} [delete]
+func (s *Service) DeleteGitCredentialsHandler(c *fiber.Ctx) error {
+	svc, err := s.forCluster(c)
+	if err != nil {
+		return err
+	}
+	if err := svc.DeleteGitToken(c.Params("user")); err != nil {
+		log.Error("error deleting git credentials: ", err)
+		return helper.Wrap(err, "Failed to delete git credentials", fiber.StatusInternalServerError)
+	}
+	return helper.SendResponse(c, "Git credentials deleted successfully", nil, fiber.StatusOK)
+}
+
+// ResumeNotebookHandler brings a stopped notebook back.
+// @Description Resume a stopped labspace with the configuration it was stopped with, once it fits the user's and team's quotas and the cluster
+// @Summary Resume stopped notebook
+// @Tags JupyterLabs Notebook
+// @Accept json
+// @Param id path string true "Pod Username"
+// @Produce json
+// @Param cluster query string false "Cluster name"
+// @Param X-Tenant header string false "Tenant, required when tenancy is enabled"
+// @Router /api/notebooks/{id}/resume [post]
+func (s *Service) ResumeNotebookHandler(c *fiber.Ctx) error {
+	svc, err := s.forCluster(c)
+	if err != nil {
+		return err
+	}
+	username := c.Params("id")
+	if err := svc.ResumeNotebook(username); err != nil {
+		log.Error("error resuming notebook: ", err)
+		return helper.Wrap(err, fmt.Sprintf("Failed to resume labspace: %v", err), fiber.StatusInternalServerError)
+	}
+
+	log.Info("resumed notebook for user: ", username)
+	return helper.SendResponse(c, "Labspace resumed successfully", nil, fiber.StatusOK)
+}
+
+// ResizeNotebookHandler changes the resources of a labspace.
+// @Description Change the CPU, memory, GPU or disk of a labspace; resources left out keep their current value. The new size is checked against the user's and team's quotas and, for a running labspace, the cluster before anything changes. The volume is expanded when more disk is asked for and its storage class allows it, then the pods are restarted one at a time with the new size and the same volume. Resizing runs as a background job; follow it at /api/jobs/{id}
+// @Summary Resize labspace
+// @Tags JupyterLabs Notebook
+// @Accept json
+// @Produce json
+// @Param id path string true "Pod Username"
+// @Param resizeLabRequest body ResizeLabRequest true "New resources"
+// @Param cluster query string false "Cluster name"
+// @Param X-Tenant header string false "Tenant, required when tenancy is enabled"
+// @Router /api/notebooks/{id} [patch]
+func (s *Service) ResizeNotebookHandler(c *fiber.Ctx) error {
+	svc, err := s.forCluster(c)
+	if err != nil {
+		return err
+	}
+	var request ResizeLabRequest
+	if err := c.BodyParser(&request); err != nil {
+		return helper.BadRequest(err)
+	}
+	if err := request.Validate(); err != nil {
+		return err
+	}
+	username := c.Params("id")
+	steps, err := svc.ResizeNotebook(username, request.resourceSpec())
+	if err != nil {
+		log.Error("error resizing notebook: ", err)
+		return helper.Wrap(err, fmt.Sprintf("Failed to resize labspace: %v", err), fiber.StatusInternalServerError)
+	}
+
+	job := svc.jobs.Submit("resize-labspace", steps, map[string]interface{}{
+		"cluster":  svc.cluster,
+		"labspace": username,
+	})
+	return jobs.Accepted(c, "Labspace resize accepted", job)
+}
+
+// SetScheduleHandler sets when a labspace is stopped and started.
+// @Description Store a schedule that stops the labspace and, optionally, starts it again. Stop and start are five-field cron expressions such as "0 20 * * *" or "0 9 * * MON-FRI", read in the given IANA time zone or UTC. A scheduled start resumes the labspace only if it fits the quotas and the cluster at that time
+// @Summary Set labspace schedule
+// @Tags JupyterLabs Notebook
+// @Accept json
+// @Produce json
+// @Param id path string true "Pod Username"
+// @Param labSchedule body LabSchedule true "Schedule"
+// @Param cluster query string false "Cluster name"
+// @Param X-Tenant header string false "Tenant, required when tenancy is enabled"
+// @Router /api/notebooks/{id}/schedule [put]
+func (s *Service) SetScheduleHandler(c *fiber.Ctx) error {
+	svc, err := s.forCluster(c)
+	if err != nil {
+		return err
+	}
+	var request LabSchedule
+	if err := c.BodyParser(&request); err != nil {
+		return helper.BadRequest(err)
+	}
+	if err := request.Validate(); err != nil {
+		return err
+	}
+	username := c.Params("id")
+	status, err := svc.SetSchedule(username, request)
+	if err != nil {
+		log.Error("error setting labspace schedule: ", err)
+		return helper.Wrap(err, "Failed to set labspace schedule", fiber.StatusInternalServerError)
+	}
+
+	log.Info("set schedule of labspace: ", username)
+	return helper.SendResponse(c, "Labspace schedule set successfully", status, fiber.StatusOK)
+}
+
+// DeleteScheduleHandler removes the schedule of a labspace.
+// @Description Remove the schedule of a labspace. The labspace stays running or stopped as it is
+// @Summary Delete labspace schedule
+// @Tags JupyterLabs Notebook
+// @Accept json
+// @Produce json
+// @Param id path string true "Pod Username"
+// @Param cluster query string false "Cluster name"
+// @Param X-Tenant header string false "Tenant, required when tenancy is enabled"
+// @Router /api/notebooks/{id}/schedule [delete]
+func (s *Service) DeleteScheduleHandler(c *fiber.Ctx) error {
+	svc, err := s.forCluster(c)
+	if err != nil {
+		return err
+	}
+	username := c.Params("id")
+	if err := svc.DeleteSchedule(username); err != nil {
+		log.Error("error deleting labspace schedule: ", err)
+		return helper.Wrap(err, "Failed to delete labspace schedule", fiber.StatusInternalServerError)
+	}
+
+	log.Info("deleted schedule of labspace: ", username)
+	return helper.SendResponse(c, "Labspace schedule deleted successfully", nil, fiber.StatusOK)
+}
+
 // GetOneNotebookHandler retrieves details of a single notebook.
 // @Description Get Detail of Single JupyterLab Notebook Pods
 // @Summary Get Detail of Single JupyterLab Notebook
@@ -222,10 +445,16 @@ func StopNotebookHandler(c *fiber.Ctx) error {
 // @Accept json
 // @Param id path string true "Pod Username"
 // @Produce json
+// @Param cluster query string false "Cluster name"
+// @Param X-Tenant header string false "Tenant, required when tenancy is enabled"
 // @Router /api/notebooks/{id} [get]
-func GetOneNotebookHandler(c *fiber.Ctx) error {
+func (s *Service) GetOneNotebookHandler(c *fiber.Ctx) error {
+	svc, err := s.forCluster(c)
+	if err != nil {
+		return err
+	}
 	username := c.Params("id")
-	element, err := GetOneNotebook(username)
+	element, err := svc.GetOneNotebook(username)
 	if err != nil {
 		log.Error("error retrieving notebook details: ", err)
 		return helper.SendResponse(c, err.Error(), nil, fiber.StatusBadRequest)
@@ -236,39 +465,58 @@ func GetOneNotebookHandler(c *fiber.Ctx) error {
 		log.Warn("error parsing restarts for notebook: ", username)
 	}
 	notebook := Notebook{
-		Name:    element["name"],
-		Ready:   element["ready"],
-		Status:  element["status"],
-		Restart: uint(restart),
-		Age:     element["age"],
+		Name:       element["name"],
+		Ready:      element["ready"],
+		Status:     element["status"],
+		Restart:    uint(restart),
+		Age:        element["age"],
+		StoppedAt:  element["stoppedAt"],
+		StopReason: element["stopReason"],
+	}
+	if notebook.Name != "" {
+		// A labspace whose pod outlived its statefulset has no schedule.
+		if notebook.Schedule, err = svc.GetSchedule(username); err != nil && !errors.Is(err, kubeutils.ErrNotFound) {
+			log.Warn("error reading schedule of notebook: ", username, ": ", err)
+		}
 	}
 
 	return helper.SendResponse(c, "Labspace retrieved successfully", notebook, fiber.StatusOK)
 }
 
 // CloneArtifactsCreateNotebook creates a notebook by cloning artifacts.
-// @Description Create Jupyter Notebook Environment based on the specific users and project
+// @Description Create Jupyter Notebook Environment based on the specific users and project. Provisioning runs as a background job; follow it at /api/jobs/{id}
 // @Summary Create Notebook Environment by cloning artifacts form registered model
 // @Tags JupyterLabs Notebook
 // @Accept json
 // @Produce json
 // @Param createNotebookRequest body CloneNotebookRequest true "Notebook Body"
-// @Router /api/notebooks/cloneartifacts [post]
-func CloneArtifactsCreateNotebook(c *fiber.Ctx) error {
-
+// @Param cluster query string false "Cluster name"
+// @Param X-Tenant header string false "Tenant, required when tenancy is enabled"
+// @Router /api/notebooks/clone-artifacts [post]
+func (s *Service) CloneArtifactsCreateNotebook(c *fiber.Ctx) error {
+	svc, err := s.forCluster(c)
+	if err != nil {
+		return err
+	}
 	var request CloneNotebookRequest
 	if err := c.BodyParser(&request); err != nil {
 		log.Error("error parsing clone request body: ", err)
-		return helper.SendResponse(c, "Invalid Request", nil, fiber.ErrBadRequest.Code)
+		return helper.BadRequest(err)
+	}
+	if err := request.Validate(); err != nil {
+		return err
 	}
 
-	message, err := CloneArtifactsNotebook(request)
+	steps, err := svc.CloneArtifactsNotebook(request)
 	if err != nil {
 		log.Error("error cloning artifacts notebook: ", err)
-		return helper.SendResponse(c, message, nil, fiber.ErrBadRequest.Code)
+		return helper.Wrap(err, fmt.Sprintf("Failed to create labspace: %v", err), fiber.StatusInternalServerError)
 	}
 
-	return helper.SendResponse(c, "Labspace created successfully with model request", nil, fiber.StatusOK)
+	job := svc.jobs.Submit("clone-artifacts", steps, map[string]interface{}{
+		"cluster": svc.cluster,
+	})
+	return jobs.Accepted(c, "Labspace creation with model request accepted", job)
 }
 
 // LabFilesPreview previews files in a labspace.
@@ -278,12 +526,12 @@ func CloneArtifactsCreateNotebook(c *fiber.Ctx) error {
 // @Accept json
 // @Produce json
 // @Router /api/notebooks/files [get]
-func LabFilesPreview(c *fiber.Ctx) error {
+func (s *Service) LabFilesPreview(c *fiber.Ctx) error {
 	username := c.Query("username")
 	filename := c.Query("filename")
 	path := fmt.Sprintf("%s%s%s", ArtifactPathPrefix, PersistentVolumePrefix, username+PersistentVolumeSuffix)
 
-	result, err := artifacts.ReadFiles(path, filename)
+	result, err := artifacts.ReadFiles(s.fs, path, filename)
 	if err != nil {
 		log.Error("error reading labspace file: ", err)
 		return helper.SendResponse(c, "Invalid Request", nil, fiber.ErrBadRequest.Code)
@@ -298,31 +546,21 @@ func LabFilesPreview(c *fiber.Ctx) error {
 // @Tags JupyterLabs Notebook
 // @Accept json
 // @Produce text/event-stream
+// @Param cluster query string false "Cluster name"
+// @Param X-Tenant header string false "Tenant, required when tenancy is enabled"
 // @Router /api/notebooks/metrics/sse [get]
-func GetLabsMetricsSse(c *fiber.Ctx) error {
-	c.Set("Content-Type", "text/event-stream")
-	c.Set("Cache-Control", "no-cache")
-	c.Set("Connection", "keep-alive")
-	c.Set("Transfer-Encoding", "chunked")
-
-	c.Context().SetBodyStreamWriter(fasthttp.StreamWriter(func(w *bufio.Writer) {
-		em := sse.NewBufioEmitter(w, "pod metrics")
-		for {
-			podMetrics, err := GetLabspacesMetrics()
-			if err != nil {
-				log.Errorf("error getting pod metrics: %v", err)
-				break
-			}
-
-			sendJsonFlowErr := em.SendJSON("", "message", podMetrics)
-			if sendJsonFlowErr.Err != nil {
-				break
-			}
-
-			time.Sleep(10 * time.Second)
-		}
-	}))
+func (s *Service) GetLabsMetricsSse(c *fiber.Ctx) error {
+	svc, err := s.forCluster(c)
+	if err != nil {
+		return err
+	}
+	topic := svc.topic(metricsTopic, svc.produceMetricsEvents)
+	if err := s.broker.Start(topic); err != nil {
+		log.Errorf("error starting labspace metrics stream: %v", err)
+		return helper.SendResponse(c, "Labspace metrics stream is unavailable", nil, fiber.StatusServiceUnavailable)
+	}
 
+	s.broker.Serve(c, topic)
 	return nil
 }
 
@@ -332,9 +570,15 @@ func GetLabsMetricsSse(c *fiber.Ctx) error {
 // @Tags JupyterLabs Notebook
 // @Accept json
 // @Produce json
+// @Param cluster query string false "Cluster name"
+// @Param X-Tenant header string false "Tenant, required when tenancy is enabled"
 // @Router /api/notebooks/metrics [get]
-func GetLabsMetrics(c *fiber.Ctx) error {
-	podMetrics, err := GetLabspacesMetrics()
+func (s *Service) GetLabsMetrics(c *fiber.Ctx) error {
+	svc, err := s.forCluster(c)
+	if err != nil {
+		return err
+	}
+	podMetrics, err := svc.GetLabspacesMetrics()
 	if err != nil {
 		log.Errorf("Error getting lab metrics: %v", err)
 		return helper.SendResponse(c, "Error fetching lab metrics", nil, fiber.StatusInternalServerError)
@@ -342,3 +586,49 @@ func GetLabsMetrics(c *fiber.Ctx) error {
 
 	return helper.SendResponse(c, "Labs metrics fetched successfully", podMetrics, fiber.StatusOK)
 }
+
+// GetCullingHandler reports idle labspaces about to be stopped and those
+// already stopped.
+// @Description Get the labspaces the idle culler is about to stop and the ones it has stopped, with the reason. With an X-Tenant header only that team's labspaces are listed
+// @Summary Get idle labspace culling status
+// @Tags JupyterLabs Notebook
+// @Produce json
+// @Param X-Tenant header string false "Tenant, required when tenancy is enabled"
+// @Router /api/notebooks/culling [get]
+func (s *Service) GetCullingHandler(c *fiber.Ctx) error {
+	status := CullStatus{Warnings: []CullNotice{}, Culled: []CullRecord{}}
+	if s.culler != nil {
+		status = s.culler.Status(c.Get(helper.TenantHeader))
+	}
+	return helper.SendResponse(c, "Labspace culling status retrieved successfully", status, fiber.StatusOK)
+}
+
+// GetCullingSse streams idle labspace warnings as server-sent events.
+// @Description Get warnings about idle labspaces about to be stopped, and the labspaces stopped, as server sent events
+// @Summary Get idle labspace culling server sent events
+// @Tags JupyterLabs Notebook
+// @Accept json
+// @Produce text/event-stream
+// @Router /api/notebooks/culling/sse [get]
+func (s *Service) GetCullingSse(c *fiber.Ctx) error {
+	if err := s.broker.Start(cullingTopic); err != nil {
+		log.Error("error starting culling stream: ", err)
+		return helper.SendResponse(c, "Labspace culling stream is unavailable", nil, fiber.StatusServiceUnavailable)
+	}
+
+	s.broker.Serve(c, cullingTopic)
+	return nil
+}
+
+// forCluster returns the service bound to the cluster the request names in
+// its cluster query parameter, or to the default cluster, and scoped to the
+// tenant in its TenantHeader.
+func (s *Service) forCluster(c *fiber.Ctx) (*Service, error) {
+	cluster, err := s.clusters.Get(c.Query(helper.ClusterParam))
+	if err != nil {
+		return nil, err
+	}
+	svc := *s
+	svc.tenant = c.Get(helper.TenantHeader)
+	return svc.on(cluster)
+}
@@ -0,0 +1,770 @@
+package JupyterLabs_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"Kubernetes-api/helper"
+	"Kubernetes-api/internal/kubetest"
+	"Kubernetes-api/jobs"
+	"Kubernetes-api/kubeutils"
+	JupyterLabs "Kubernetes-api/labs/jupyterlabs"
+
+	"github.com/gofiber/fiber/v2"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newLabApp(h *kubetest.Harness) *fiber.App {
+	return h.App(func(api fiber.Router) {
+		JupyterLabs.SetupRoutes(api, JupyterLabs.NewService(h.Clusters, h.Fs, h.Templates, h.Broker, h.Jobs))
+	})
+}
+
+func labRequest(user string) JupyterLabs.CreateLabRequest {
+	return JupyterLabs.CreateLabRequest{
+		Username: user,
+		Password: "secret",
+		ResourceFields: JupyterLabs.ResourceFields{
+			CPURequest:    "1",
+			GPURequest:    "0",
+			MemoryRequest: "2Gi",
+			CPULimit:      "2",
+			MemoryLimit:   "4Gi",
+			DiskStorage:   "10Gi",
+		},
+		NodeSelector:    "cpu",
+		WorkSpaceType:   JupyterLabs.LabTypeJupyterlab,
+		LabspaceType:    JupyterLabs.AiTypeMLModel,
+		TemplateBaseURL: "https://github.com/acme/template",
+		TemplateVersion: "v1.0.0",
+	}
+}
+
+func TestCreateNotebook(t *testing.T) {
+	h := kubetest.New(
+		kubetest.Node("node-a", "8", "32Gi", ""),
+		kubetest.Ingress(JupyterLabs.NotebookNamespace, "labs"),
+	)
+	app := newLabApp(h)
+
+	status, resp := kubetest.Do(t, app, fiber.MethodPost, "/api/notebooks", labRequest("alice"))
+	if status != fiber.StatusOK || !resp.Status {
+		t.Fatalf("create returned %d %+v", status, resp)
+	}
+
+	ctx := context.TODO()
+	sts, err := h.Clientset.AppsV1().StatefulSets(JupyterLabs.NotebookNamespace).Get(ctx, "alice", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("statefulset not created: %v", err)
+	}
+	container := sts.Spec.Template.Spec.Containers[0]
+	if cpu := container.Resources.Requests.Cpu().String(); cpu != "1" {
+		t.Errorf("cpu request = %s, want 1", cpu)
+	}
+	for _, env := range container.Env {
+		if env.Name != JupyterLabs.EnvPassword {
+			continue
+		}
+		if env.Value != "" || env.ValueFrom == nil || env.ValueFrom.SecretKeyRef == nil || env.ValueFrom.SecretKeyRef.Name != "labspace-alice" {
+			t.Errorf("password env = %+v, want a reference to secret labspace-alice", env)
+		}
+	}
+	if password, err := h.Kube.GetSecretValue(JupyterLabs.NotebookNamespace, "labspace-alice", JupyterLabs.SecretPasswordKey); err != nil || password != "secret" {
+		t.Errorf("secret password = %q, %v, want secret", password, err)
+	}
+	if _, err := h.Clientset.CoreV1().Services(JupyterLabs.NotebookNamespace).Get(ctx, "notebook-alice", metav1.GetOptions{}); err != nil {
+		t.Errorf("service not created: %v", err)
+	}
+	ing, _ := h.Clientset.NetworkingV1().Ingresses(JupyterLabs.NotebookNamespace).Get(ctx, "labs", metav1.GetOptions{})
+	if got := kubetest.IngressPaths(ing); !reflect.DeepEqual(got, []string{"/alice"}) {
+		t.Errorf("ingress paths = %v, want [/alice]", got)
+	}
+	if len(h.Templates.Downloaded) != 1 {
+		t.Fatalf("template downloads = %d, want 1", len(h.Templates.Downloaded))
+	}
+	if got, want := h.Templates.Downloaded[0].ExpPath, "/app/artifact/jl-alice-0"; got != want {
+		t.Errorf("template path = %s, want %s", got, want)
+	}
+}
+
+func TestCreateNotebookWithoutCapacity(t *testing.T) {
+	h := kubetest.New(kubetest.Node("node-a", "1", "4Gi", ""))
+	app := newLabApp(h)
+
+	req := labRequest("alice")
+	req.CPURequest = "4"
+	req.CPULimit = "4"
+	status, resp := kubetest.Do(t, app, fiber.MethodPost, "/api/notebooks", req)
+	if status != fiber.StatusInternalServerError || resp.Status {
+		t.Fatalf("create returned %d %+v, want 500", status, resp)
+	}
+
+	_, err := h.Clientset.AppsV1().StatefulSets(JupyterLabs.NotebookNamespace).Get(context.TODO(), "alice", metav1.GetOptions{})
+	if !apierrors.IsNotFound(err) {
+		t.Fatalf("statefulset should not exist, got err=%v", err)
+	}
+}
+
+func TestCreateNotebookWithGPUTypeAndModel(t *testing.T) {
+	node := kubetest.Node("node-a", "8", "32Gi", "")
+	node.Status.Allocatable["amd.com/gpu"] = resource.MustParse("2")
+	node.Labels["amd.com/gpu.product-name"] = "MI250"
+	h := kubetest.New(node, kubetest.Ingress(JupyterLabs.NotebookNamespace, "labs"))
+	app := newLabApp(h)
+
+	req := labRequest("alice")
+	req.GPURequest = "1"
+	req.GPUType = "amd.com/gpu"
+	req.GPUModel = "MI250"
+	status, resp := kubetest.Do(t, app, fiber.MethodPost, "/api/notebooks", req)
+	if status != fiber.StatusOK || !resp.Status {
+		t.Fatalf("create returned %d %+v", status, resp)
+	}
+
+	sts, err := h.Clientset.AppsV1().StatefulSets(JupyterLabs.NotebookNamespace).Get(context.TODO(), "alice", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("statefulset not created: %v", err)
+	}
+	spec := sts.Spec.Template.Spec
+	if gpu := spec.Containers[0].Resources.Limits["amd.com/gpu"]; gpu.Value() != 1 {
+		t.Errorf("amd.com/gpu limit = %s, want 1", gpu.String())
+	}
+	if _, ok := spec.Containers[0].Resources.Limits["nvidia.com/gpu"]; ok {
+		t.Error("statefulset should not ask for nvidia.com/gpu")
+	}
+	if spec.Affinity == nil || spec.Affinity.NodeAffinity == nil {
+		t.Fatal("statefulset has no node affinity for the GPU model")
+	}
+	found := false
+	for _, term := range spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms {
+		for _, expr := range term.MatchExpressions {
+			found = found || (expr.Key == "amd.com/gpu.product-name" && reflect.DeepEqual(expr.Values, []string{"MI250"}))
+		}
+	}
+	if !found {
+		t.Errorf("affinity = %+v, want amd.com/gpu.product-name in [MI250]", spec.Affinity)
+	}
+}
+
+func TestCreateNotebookPlacesOnClusterThatFits(t *testing.T) {
+	cpu := kubetest.New(kubetest.Node("cpu-a", "4", "16Gi", ""), kubetest.Ingress(JupyterLabs.NotebookNamespace, "labs"))
+	gpu := kubetest.New(kubetest.Node("gpu-a", "16", "64Gi", "2"), kubetest.Ingress(JupyterLabs.NotebookNamespace, "labs"))
+	clusters, err := kubeutils.NewClusters(
+		kubeutils.Cluster{Name: "cpu", Kube: cpu.Kube},
+		kubeutils.Cluster{Name: "gpu", Kube: gpu.Kube},
+	)
+	if err != nil {
+		t.Fatalf("NewClusters: %v", err)
+	}
+	app := cpu.App(func(api fiber.Router) {
+		JupyterLabs.SetupRoutes(api, JupyterLabs.NewService(clusters, cpu.Fs, cpu.Templates, cpu.Broker, cpu.Jobs))
+	})
+
+	req := labRequest("alice")
+	req.GPURequest = "1"
+	status, resp := kubetest.Do(t, app, fiber.MethodPost, "/api/notebooks", req)
+	if status != fiber.StatusOK || !resp.Status {
+		t.Fatalf("create returned %d %+v", status, resp)
+	}
+	if data, _ := resp.Data.(map[string]any); data["cluster"] != "gpu" {
+		t.Errorf("placed on %v, want gpu", resp.Data)
+	}
+	ctx := context.TODO()
+	if _, err := gpu.Clientset.AppsV1().StatefulSets(JupyterLabs.NotebookNamespace).Get(ctx, "alice", metav1.GetOptions{}); err != nil {
+		t.Errorf("statefulset not created on the gpu cluster: %v", err)
+	}
+	if _, err := cpu.Clientset.AppsV1().StatefulSets(JupyterLabs.NotebookNamespace).Get(ctx, "alice", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("statefulset should not exist on the cpu cluster, got err=%v", err)
+	}
+
+	status, resp = kubetest.Do(t, app, fiber.MethodGet, "/api/notebooks?cluster=tpu", nil)
+	if status != fiber.StatusNotFound || resp.Error == nil || resp.Error.Code != helper.CodeNotFound {
+		t.Errorf("unknown cluster returned %d %+v, want 404", status, resp)
+	}
+}
+
+func TestCreateNotebookInTenantNamespace(t *testing.T) {
+	h := kubetest.New(
+		kubetest.Node("node-a", "8", "32Gi", ""),
+		kubetest.Ingress(JupyterLabs.NotebookNamespace, "labs"),
+	)
+	h.Kube.Tenancy = &kubeutils.Tenancy{}
+	app := newLabApp(h)
+
+	status, resp := kubetest.Do(t, app, fiber.MethodPost, "/api/notebooks", labRequest("alice"))
+	if status != fiber.StatusUnprocessableEntity || resp.Error == nil {
+		t.Fatalf("create without a tenant returned %d %+v, want 422", status, resp)
+	}
+
+	tenant := map[string]string{helper.TenantHeader: "vision"}
+	status, resp = kubetest.DoWithHeaders(t, app, fiber.MethodPost, "/api/notebooks", labRequest("alice"), tenant)
+	if status != fiber.StatusOK || !resp.Status {
+		t.Fatalf("create returned %d %+v", status, resp)
+	}
+
+	ctx := context.TODO()
+	if _, err := h.Clientset.AppsV1().StatefulSets("tenant-vision").Get(ctx, "alice", metav1.GetOptions{}); err != nil {
+		t.Fatalf("statefulset not created in the tenant namespace: %v", err)
+	}
+	if _, err := h.Clientset.AppsV1().StatefulSets(JupyterLabs.NotebookNamespace).Get(ctx, "alice", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("statefulset created in %s, err=%v", JupyterLabs.NotebookNamespace, err)
+	}
+	if _, err := h.Clientset.NetworkingV1().NetworkPolicies("tenant-vision").Get(ctx, kubeutils.TenantNetworkPolicyName, metav1.GetOptions{}); err != nil {
+		t.Errorf("tenant network policy not created: %v", err)
+	}
+	ing, err := h.Clientset.NetworkingV1().Ingresses("tenant-vision").Get(ctx, "labs", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("tenant lab ingress not created: %v", err)
+	}
+	if got := kubetest.IngressPaths(ing); !reflect.DeepEqual(got, []string{"/alice"}) {
+		t.Errorf("tenant ingress paths = %v, want [/alice]", got)
+	}
+
+	if _, err := h.Clientset.CoreV1().Pods("tenant-vision").Create(ctx, kubetest.Pod("tenant-vision", "alice-0", "alice", "node-a", "1", "1Gi"), metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	for tenant, want := range map[string]int{"vision": 1, "speech": 0} {
+		_, resp := kubetest.DoWithHeaders(t, app, fiber.MethodGet, "/api/notebooks", nil, map[string]string{helper.TenantHeader: tenant})
+		if list, _ := resp.Data.([]any); len(list) != want {
+			t.Errorf("tenant %s lists %#v, want %d labspaces", tenant, resp.Data, want)
+		}
+	}
+}
+
+func TestCreateNotebookOverQuota(t *testing.T) {
+	h := kubetest.New(
+		kubetest.Node("node-a", "8", "32Gi", ""),
+		kubetest.Ingress(JupyterLabs.NotebookNamespace, "labs"),
+	)
+	one := int64(1)
+	h.Clusters.Quotas = &kubeutils.QuotaPolicy{Defaults: kubeutils.QuotaDefaults{User: kubeutils.QuotaLimits{Labspaces: &one}}}
+	app := newLabApp(h)
+
+	status, resp := kubetest.Do(t, app, fiber.MethodPost, "/api/notebooks", labRequest("alice"))
+	if status != fiber.StatusOK {
+		t.Fatalf("first labspace returned %d %+v", status, resp)
+	}
+	sts, err := h.Clientset.AppsV1().StatefulSets(JupyterLabs.NotebookNamespace).Get(context.TODO(), "alice", metav1.GetOptions{})
+	if err != nil || sts.Labels[kubeutils.UserLabel] != "alice" {
+		t.Fatalf("statefulset labels = %v, %v, want its user", sts.Labels, err)
+	}
+
+	// bob already has a labspace, so another one is over the quota of one.
+	owner := kubeutils.Owner{User: "bob", Workload: kubeutils.WorkloadLabspace}
+	if err := h.Kube.CreateStatefulSet(JupyterLabs.NotebookNamespace, "bob", "notebook-bob", "jupyter", kubeutils.GPURequest{}, 8888, "1Gi", "cpu", sts.Spec.Template.Spec.Containers[0].Resources, nil, owner); err != nil {
+		t.Fatal(err)
+	}
+	status, resp = kubetest.Do(t, app, fiber.MethodPost, "/api/notebooks", labRequest("bob"))
+	if status != fiber.StatusForbidden || resp.Error == nil || resp.Error.Code != helper.CodeQuotaExceeded {
+		t.Fatalf("labspace over quota returned %d %+v, want 403 quota_exceeded", status, resp)
+	}
+}
+
+func TestCreateNotebookValidatesRequest(t *testing.T) {
+	h := kubetest.New(
+		kubetest.Node("node-a", "8", "32Gi", ""),
+		kubetest.Ingress(JupyterLabs.NotebookNamespace, "labs"),
+	)
+	app := newLabApp(h)
+
+	req := labRequest("Alice.Smith")
+	req.MemoryRequest = "2 gigs"
+	req.TemplateBaseURL = ""
+	status, resp := kubetest.Do(t, app, fiber.MethodPost, "/api/notebooks", req)
+	if status != fiber.StatusBadRequest || resp.Error == nil || resp.Error.Code != helper.CodeValidationFailed {
+		t.Fatalf("create returned %d %+v, want a validation failure", status, resp)
+	}
+	if got := len(resp.Error.Fields); got != 3 {
+		t.Errorf("field errors = %+v, want userName, memoryRequest and templateUrl", resp.Error.Fields)
+	}
+
+	services, _ := h.Clientset.CoreV1().Services(JupyterLabs.NotebookNamespace).List(context.TODO(), metav1.ListOptions{})
+	if len(services.Items) != 0 {
+		t.Errorf("invalid request created %d services", len(services.Items))
+	}
+}
+
+func TestCreateNotebookAppliesResourceDefaults(t *testing.T) {
+	h := kubetest.New(
+		kubetest.Node("node-a", "8", "32Gi", ""),
+		kubetest.Ingress(JupyterLabs.NotebookNamespace, "labs"),
+	)
+	app := newLabApp(h)
+
+	req := labRequest("alice")
+	req.WorkSpaceType = JupyterLabs.LabTypeCodeServer
+	req.CPURequest, req.MemoryRequest, req.CPULimit, req.MemoryLimit, req.GPURequest = "", "", "", "", ""
+	if status, resp := kubetest.Do(t, app, fiber.MethodPost, "/api/notebooks", req); status != fiber.StatusOK {
+		t.Fatalf("create returned %d %+v", status, resp)
+	}
+
+	sts, err := h.Clientset.AppsV1().StatefulSets(JupyterLabs.NotebookNamespace).Get(context.TODO(), "alice", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("statefulset not created: %v", err)
+	}
+	want := JupyterLabs.ResourceDefaults(JupyterLabs.LabTypeCodeServer, JupyterLabs.AiTypeMLModel)
+	resources := sts.Spec.Template.Spec.Containers[0].Resources
+	if got := resources.Requests.Memory().String(); got != want.MemoryRequest {
+		t.Errorf("memory request = %s, want %s", got, want.MemoryRequest)
+	}
+	if got := resources.Limits.Cpu().String(); got != want.CPULimit {
+		t.Errorf("cpu limit = %s, want %s", got, want.CPULimit)
+	}
+}
+
+func TestCreateNotebookRejectsLimitBelowRequest(t *testing.T) {
+	h := kubetest.New(
+		kubetest.Node("node-a", "8", "32Gi", ""),
+		kubetest.Ingress(JupyterLabs.NotebookNamespace, "labs"),
+	)
+	app := newLabApp(h)
+
+	req := labRequest("alice")
+	req.MemoryLimit = "1Gi"
+	status, resp := kubetest.Do(t, app, fiber.MethodPost, "/api/notebooks", req)
+	if status != fiber.StatusBadRequest || resp.Error == nil || len(resp.Error.Fields) != 1 || resp.Error.Fields[0].Field != "memoryLimit" {
+		t.Fatalf("create returned %d %+v, want a memoryLimit field error", status, resp)
+	}
+}
+
+func TestRestartAndCloneValidateRequests(t *testing.T) {
+	h := kubetest.New(
+		kubetest.Node("node-a", "8", "32Gi", ""),
+		kubetest.Ingress(JupyterLabs.NotebookNamespace, "labs"),
+	)
+	app := newLabApp(h)
+
+	restart := JupyterLabs.RestartLabRequest{Username: "Alice.Smith", ResourceFields: JupyterLabs.ResourceFields{MemoryRequest: "2 gigs"}}
+	status, resp := kubetest.Do(t, app, fiber.MethodPost, "/api/notebooks/restart", restart)
+	if status != fiber.StatusBadRequest || resp.Error == nil || resp.Error.Code != helper.CodeValidationFailed || len(resp.Error.Fields) != 3 {
+		t.Errorf("restart returned %d %+v, want userName, password and memoryRequest errors", status, resp)
+	}
+	clone := JupyterLabs.CloneNotebookRequest{Username: "alice", Password: "secret", BaseUsername: "bob/.."}
+	status, resp = kubetest.Do(t, app, fiber.MethodPost, "/api/notebooks/clone-artifacts", clone)
+	if status != fiber.StatusBadRequest || resp.Error == nil || resp.Error.Code != helper.CodeValidationFailed || len(resp.Error.Fields) != 3 {
+		t.Errorf("clone returned %d %+v, want baseUserName, modelname and version errors", status, resp)
+	}
+	for _, path := range []string{"/api/notebooks/restart", "/api/notebooks/clone-artifacts"} {
+		if status, resp := kubetest.Do(t, app, fiber.MethodPost, path, "not an object"); status != fiber.StatusBadRequest || resp.Error == nil {
+			t.Errorf("%s with a malformed body returned %d %+v, want 400", path, status, resp)
+		}
+	}
+
+	clone.BaseUsername, clone.ModelName, clone.Version = "bob", "churn", "1.0"
+	status, resp = kubetest.Do(t, app, fiber.MethodPost, "/api/notebooks/clone-artifacts", clone)
+	if status != fiber.StatusNotFound || resp.Error == nil || resp.Error.Code != helper.CodeNotFound {
+		t.Errorf("cloning a missing model returned %d %+v, want 404", status, resp)
+	}
+	services, _ := h.Clientset.CoreV1().Services(JupyterLabs.NotebookNamespace).List(context.TODO(), metav1.ListOptions{})
+	if len(services.Items) != 0 {
+		t.Errorf("invalid requests created %d services", len(services.Items))
+	}
+}
+
+func TestCreateNotebookRollsBackOnFailure(t *testing.T) {
+	// No lab ingress exists, so the last step fails after the service and
+	// statefulset were created. The fake clientset does not provision the
+	// statefulset's volume claim, so it is seeded.
+	h := kubetest.New(
+		kubetest.Node("node-a", "8", "32Gi", ""),
+		kubetest.Claim(JupyterLabs.NotebookNamespace, "jl-alice-0", "", "10Gi"),
+	)
+	app := newLabApp(h)
+
+	status, resp := kubetest.Do(t, app, fiber.MethodPost, "/api/notebooks", labRequest("alice"))
+	if status != fiber.StatusInternalServerError || !strings.Contains(resp.Message, "ingress") {
+		t.Fatalf("create returned %d %+v, want 500 naming the ingress step", status, resp)
+	}
+
+	ctx := context.TODO()
+	if _, err := h.Clientset.AppsV1().StatefulSets(JupyterLabs.NotebookNamespace).Get(ctx, "alice", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("statefulset left behind: %v", err)
+	}
+	if _, err := h.Clientset.CoreV1().Services(JupyterLabs.NotebookNamespace).Get(ctx, "notebook-alice", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("service left behind: %v", err)
+	}
+	if _, err := h.Clientset.CoreV1().PersistentVolumeClaims(JupyterLabs.NotebookNamespace).Get(ctx, "jl-alice-0", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("volume claim left behind: %v", err)
+	}
+	if len(h.Templates.Downloaded) != 0 {
+		t.Error("template downloaded for a labspace that was rolled back")
+	}
+}
+
+func TestCreateNotebookReportsTemplateDownloadFailure(t *testing.T) {
+	h := kubetest.New(
+		kubetest.Node("node-a", "8", "32Gi", ""),
+		kubetest.Ingress(JupyterLabs.NotebookNamespace, "labs"),
+		kubetest.Claim(JupyterLabs.NotebookNamespace, "jl-alice-0", "", "10Gi"),
+	)
+	h.Templates.DownloadErr = errors.New("tag v1.0.0 not found")
+	app := newLabApp(h)
+
+	status, resp := kubetest.Do(t, app, fiber.MethodPost, "/api/notebooks", labRequest("alice"))
+	if status != fiber.StatusInternalServerError || resp.Status || !strings.Contains(resp.Message, "tag v1.0.0 not found") {
+		t.Fatalf("create returned %d %+v, want 500 with the download error", status, resp)
+	}
+
+	ctx := context.TODO()
+	if _, err := h.Clientset.AppsV1().StatefulSets(JupyterLabs.NotebookNamespace).Get(ctx, "alice", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("statefulset left behind: %v", err)
+	}
+	if _, err := h.Clientset.CoreV1().PersistentVolumeClaims(JupyterLabs.NotebookNamespace).Get(ctx, "jl-alice-0", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("volume claim left behind: %v", err)
+	}
+	ing, _ := h.Clientset.NetworkingV1().Ingresses(JupyterLabs.NotebookNamespace).Get(ctx, "labs", metav1.GetOptions{})
+	if got := kubetest.IngressPaths(ing); len(got) != 0 {
+		t.Errorf("ingress paths = %v, want none", got)
+	}
+}
+
+func TestCreateNotebookRejectsInvalidTemplate(t *testing.T) {
+	h := kubetest.New(kubetest.Node("node-a", "8", "32Gi", ""))
+	h.Templates.ValidateErr = errors.New("repository not found")
+	app := newLabApp(h)
+
+	status, _ := kubetest.Do(t, app, fiber.MethodPost, "/api/notebooks", labRequest("alice"))
+	if status != fiber.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500", status)
+	}
+	if len(h.Templates.Downloaded) != 0 {
+		t.Fatal("template should not be downloaded when validation fails")
+	}
+}
+
+func TestListAndGetNotebooks(t *testing.T) {
+	h := kubetest.New(
+		kubetest.Pod(JupyterLabs.NotebookNamespace, "alice-0", "alice", "node-a", "1", "1Gi"),
+		kubetest.Pod(JupyterLabs.NotebookNamespace, "bob-0", "bob", "node-a", "1", "1Gi"),
+	)
+	app := newLabApp(h)
+
+	status, resp := kubetest.Do(t, app, fiber.MethodGet, "/api/notebooks", nil)
+	if status != fiber.StatusOK {
+		t.Fatalf("list returned %d", status)
+	}
+	if list, ok := resp.Data.([]any); !ok || len(list) != 2 {
+		t.Fatalf("list data = %#v, want two notebooks", resp.Data)
+	}
+
+	status, resp = kubetest.Do(t, app, fiber.MethodGet, "/api/notebooks/alice", nil)
+	if status != fiber.StatusOK {
+		t.Fatalf("get returned %d", status)
+	}
+	if nb, _ := resp.Data.(map[string]any); nb["name"] != "alice-0" || nb["status"] != "Running" {
+		t.Fatalf("get data = %#v", resp.Data)
+	}
+}
+
+func TestDeleteNotebook(t *testing.T) {
+	h := kubetest.New(
+		kubetest.Node("node-a", "8", "32Gi", ""),
+		kubetest.Ingress(JupyterLabs.NotebookNamespace, "labs"),
+		kubetest.Claim(JupyterLabs.NotebookNamespace, "jl-alice-0", "", "10Gi"),
+	)
+	app := newLabApp(h)
+
+	if status, resp := kubetest.Do(t, app, fiber.MethodPost, "/api/notebooks", labRequest("alice")); status != fiber.StatusOK {
+		t.Fatalf("create returned %d %+v", status, resp)
+	}
+	if status, resp := kubetest.Do(t, app, fiber.MethodDelete, "/api/notebooks/alice", nil); status != fiber.StatusOK {
+		t.Fatalf("delete returned %d %+v", status, resp)
+	}
+
+	ctx := context.TODO()
+	if _, err := h.Clientset.AppsV1().StatefulSets(JupyterLabs.NotebookNamespace).Get(ctx, "alice", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("statefulset still present: %v", err)
+	}
+	if _, err := h.Clientset.CoreV1().Services(JupyterLabs.NotebookNamespace).Get(ctx, "notebook-alice", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("service still present: %v", err)
+	}
+	if _, err := h.Clientset.CoreV1().Secrets(JupyterLabs.NotebookNamespace).Get(ctx, "labspace-alice", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("secret still present: %v", err)
+	}
+	if _, err := h.Clientset.CoreV1().PersistentVolumeClaims(JupyterLabs.NotebookNamespace).Get(ctx, "jl-alice-0", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("volume claim still present: %v", err)
+	}
+	ing, _ := h.Clientset.NetworkingV1().Ingresses(JupyterLabs.NotebookNamespace).Get(ctx, "labs", metav1.GetOptions{})
+	if got := kubetest.IngressPaths(ing); len(got) != 0 {
+		t.Errorf("ingress paths = %v, want none", got)
+	}
+}
+
+func TestStopAndResumeNotebook(t *testing.T) {
+	h := kubetest.New(
+		kubetest.Node("node-a", "8", "32Gi", ""),
+		kubetest.Ingress(JupyterLabs.NotebookNamespace, "labs"),
+	)
+	app := newLabApp(h)
+	ctx := context.TODO()
+	statefulSets := h.Clientset.AppsV1().StatefulSets(JupyterLabs.NotebookNamespace)
+
+	if status, resp := kubetest.Do(t, app, fiber.MethodPost, "/api/notebooks", labRequest("alice")); status != fiber.StatusOK {
+		t.Fatalf("create returned %d %+v", status, resp)
+	}
+	created, _ := statefulSets.Get(ctx, "alice", metav1.GetOptions{})
+	if status, resp := kubetest.Do(t, app, fiber.MethodDelete, "/api/notebooks/stop/alice", nil); status != fiber.StatusOK {
+		t.Fatalf("stop returned %d %+v", status, resp)
+	}
+
+	sts, err := statefulSets.Get(ctx, "alice", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("statefulset deleted on stop: %v", err)
+	}
+	if *sts.Spec.Replicas != 0 || sts.Annotations[JupyterLabs.ReplicasAnnotation] != "1" {
+		t.Errorf("stopped replicas = %d, annotations %v, want 0 with 1 recorded", *sts.Spec.Replicas, sts.Annotations)
+	}
+	if _, err := h.Clientset.CoreV1().Services(JupyterLabs.NotebookNamespace).Get(ctx, "notebook-alice", metav1.GetOptions{}); err != nil {
+		t.Errorf("service deleted on stop: %v", err)
+	}
+	ing, _ := h.Clientset.NetworkingV1().Ingresses(JupyterLabs.NotebookNamespace).Get(ctx, "labs", metav1.GetOptions{})
+	if got := kubetest.IngressPaths(ing); !reflect.DeepEqual(got, []string{"/alice"}) {
+		t.Errorf("ingress paths after stop = %v, want [/alice]", got)
+	}
+	status, resp := kubetest.Do(t, app, fiber.MethodGet, "/api/notebooks/alice", nil)
+	if nb, _ := resp.Data.(map[string]any); status != fiber.StatusOK || nb["status"] != JupyterLabs.StatusStopped || nb["stopReason"] != JupyterLabs.StopReasonRequested {
+		t.Errorf("get stopped labspace returned %d %#v", status, resp.Data)
+	}
+
+	if status, resp := kubetest.Do(t, app, fiber.MethodPost, "/api/notebooks/alice/resume", nil); status != fiber.StatusOK {
+		t.Fatalf("resume returned %d %+v", status, resp)
+	}
+	sts, _ = statefulSets.Get(ctx, "alice", metav1.GetOptions{})
+	if *sts.Spec.Replicas != 1 || sts.Annotations[JupyterLabs.StoppedAtAnnotation] != "" {
+		t.Errorf("resumed replicas = %d, annotations %v, want 1 without the stop record", *sts.Spec.Replicas, sts.Annotations)
+	}
+	if !reflect.DeepEqual(sts.Spec.Template, created.Spec.Template) {
+		t.Error("resumed labspace does not have the configuration it was created with")
+	}
+
+	if status, _ := kubetest.Do(t, app, fiber.MethodPost, "/api/notebooks/alice/resume", nil); status != fiber.StatusConflict {
+		t.Errorf("resuming a running labspace returned %d, want 409", status)
+	}
+	if status, _ := kubetest.Do(t, app, fiber.MethodPost, "/api/notebooks/bob/resume", nil); status != fiber.StatusNotFound {
+		t.Errorf("resuming a missing labspace returned %d, want 404", status)
+	}
+}
+
+func TestStoppedNotebookIsListedAndRestartResumesIt(t *testing.T) {
+	h := kubetest.New(
+		kubetest.Node("node-a", "8", "32Gi", ""),
+		kubetest.Ingress(JupyterLabs.NotebookNamespace, "labs"),
+	)
+	app := newLabApp(h)
+	if status, resp := kubetest.Do(t, app, fiber.MethodPost, "/api/notebooks", labRequest("alice")); status != fiber.StatusOK {
+		t.Fatalf("create returned %d %+v", status, resp)
+	}
+	if status, resp := kubetest.Do(t, app, fiber.MethodDelete, "/api/notebooks/stop/alice", nil); status != fiber.StatusOK {
+		t.Fatalf("stop returned %d %+v", status, resp)
+	}
+
+	status, resp := kubetest.Do(t, app, fiber.MethodGet, "/api/notebooks", nil)
+	list, _ := resp.Data.([]any)
+	if status != fiber.StatusOK || len(list) != 1 {
+		t.Fatalf("list returned %d %#v, want the stopped labspace", status, resp.Data)
+	}
+	if nb, _ := list[0].(map[string]any); nb["name"] != "alice" || nb["status"] != JupyterLabs.StatusStopped || nb["stoppedAt"] == "" || nb["stopReason"] != JupyterLabs.StopReasonRequested {
+		t.Errorf("listed labspace = %#v, want alice stopped with its stop record", nb)
+	}
+
+	lab := labRequest("alice")
+	restart := JupyterLabs.RestartLabRequest{
+		Username: lab.Username, Password: "changed", ResourceFields: lab.ResourceFields,
+		NodeSelector: lab.NodeSelector, WorkSpaceType: lab.WorkSpaceType, LabspaceType: lab.LabspaceType,
+	}
+	if status, resp := kubetest.Do(t, app, fiber.MethodPost, "/api/notebooks/restart", restart); status != fiber.StatusOK {
+		t.Fatalf("restart of a stopped labspace returned %d %+v", status, resp)
+	}
+	sts, _ := h.Clientset.AppsV1().StatefulSets(JupyterLabs.NotebookNamespace).Get(context.TODO(), "alice", metav1.GetOptions{})
+	if *sts.Spec.Replicas != 1 || sts.Annotations[JupyterLabs.StoppedAtAnnotation] != "" {
+		t.Errorf("restarted replicas = %d, annotations %v, want 1 without the stop record", *sts.Spec.Replicas, sts.Annotations)
+	}
+}
+
+func TestResumeNotebookWithoutCapacity(t *testing.T) {
+	h := kubetest.New(
+		kubetest.Node("node-a", "8", "32Gi", ""),
+		kubetest.Ingress(JupyterLabs.NotebookNamespace, "labs"),
+	)
+	app := newLabApp(h)
+
+	if status, resp := kubetest.Do(t, app, fiber.MethodPost, "/api/notebooks", labRequest("alice")); status != fiber.StatusOK {
+		t.Fatalf("create returned %d %+v", status, resp)
+	}
+	if status, resp := kubetest.Do(t, app, fiber.MethodDelete, "/api/notebooks/stop/alice", nil); status != fiber.StatusOK {
+		t.Fatalf("stop returned %d %+v", status, resp)
+	}
+	// Another workload takes the node while the labspace is stopped.
+	hog := kubetest.Pod("default", "hog-0", "hog", "node-a", "8", "1Gi")
+	if _, err := h.Clientset.CoreV1().Pods("default").Create(context.TODO(), hog, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	status, resp := kubetest.Do(t, app, fiber.MethodPost, "/api/notebooks/alice/resume", nil)
+	if status != fiber.StatusInternalServerError || !strings.Contains(resp.Message, "no node can fit") {
+		t.Fatalf("resume returned %d %+v, want 500 explaining the cluster is full", status, resp)
+	}
+	sts, _ := h.Clientset.AppsV1().StatefulSets(JupyterLabs.NotebookNamespace).Get(context.TODO(), "alice", metav1.GetOptions{})
+	if *sts.Spec.Replicas != 0 {
+		t.Errorf("replicas = %d after a failed resume, want 0", *sts.Spec.Replicas)
+	}
+}
+
+func TestRotateNotebookPassword(t *testing.T) {
+	h := kubetest.New(
+		kubetest.Node("node-a", "8", "32Gi", ""),
+		kubetest.Ingress(JupyterLabs.NotebookNamespace, "labs"),
+	)
+	app := newLabApp(h)
+
+	if status, resp := kubetest.Do(t, app, fiber.MethodPost, "/api/notebooks", labRequest("alice")); status != fiber.StatusOK {
+		t.Fatalf("create returned %d %+v", status, resp)
+	}
+	body := JupyterLabs.RotatePasswordRequest{Password: "rotated"}
+	if status, resp := kubetest.Do(t, app, fiber.MethodPut, "/api/notebooks/alice/password", body); status != fiber.StatusOK {
+		t.Fatalf("rotate returned %d %+v", status, resp)
+	}
+
+	if password, err := h.Kube.GetSecretValue(JupyterLabs.NotebookNamespace, "labspace-alice", JupyterLabs.SecretPasswordKey); err != nil || password != "rotated" {
+		t.Errorf("secret password = %q, %v, want rotated", password, err)
+	}
+	sts, err := h.Clientset.AppsV1().StatefulSets(JupyterLabs.NotebookNamespace).Get(context.TODO(), "alice", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("statefulset gone after rotation: %v", err)
+	}
+	if sts.Spec.Template.Annotations[kubeutils.RestartedAtAnnotation] == "" {
+		t.Error("pods were not restarted to pick up the new password")
+	}
+
+	if status, _ := kubetest.Do(t, app, fiber.MethodPut, "/api/notebooks/bob/password", body); status != fiber.StatusNotFound {
+		t.Errorf("rotating a missing labspace returned %d, want 404", status)
+	}
+}
+
+func TestCreateNotebookWithStoredGitToken(t *testing.T) {
+	t.Setenv(JupyterLabs.GitTokenEnv, "server-token")
+	h := kubetest.New(
+		kubetest.Node("node-a", "8", "32Gi", ""),
+		kubetest.Ingress(JupyterLabs.NotebookNamespace, "labs"),
+	)
+	app := newLabApp(h)
+
+	creds := JupyterLabs.GitCredentialsRequest{Token: "alice-token"}
+	status, resp := kubetest.Do(t, app, fiber.MethodPut, "/api/notebooks/git-credentials/alice", creds)
+	if status != fiber.StatusOK {
+		t.Fatalf("storing git credentials returned %d %+v", status, resp)
+	}
+	if strings.Contains(resp.Message, "alice-token") || resp.Data != nil {
+		t.Errorf("response %+v echoes the token", resp)
+	}
+	if status, resp := kubetest.Do(t, app, fiber.MethodPost, "/api/notebooks", labRequest("alice")); status != fiber.StatusOK {
+		t.Fatalf("create returned %d %+v", status, resp)
+	}
+	if status, _ := kubetest.Do(t, app, fiber.MethodDelete, "/api/notebooks/git-credentials/alice", nil); status != fiber.StatusOK {
+		t.Fatalf("deleting git credentials returned %d", status)
+	}
+	if status, resp := kubetest.Do(t, app, fiber.MethodPost, "/api/notebooks", labRequest("bob")); status != fiber.StatusOK {
+		t.Fatalf("create returned %d %+v", status, resp)
+	}
+
+	if want := []string{"alice-token", "server-token"}; !reflect.DeepEqual(h.Templates.Tokens, want) {
+		t.Errorf("templates validated with %v, want %v", h.Templates.Tokens, want)
+	}
+}
+
+// newResizableLab creates alice's labspace with a 10Gi volume from class
+// and its running pod on node-a, which has 8 CPUs.
+func newResizableLab(t *testing.T, class *storagev1.StorageClass) (*kubetest.Harness, *fiber.App) {
+	t.Helper()
+	h := kubetest.New(
+		kubetest.Node("node-a", "8", "32Gi", ""),
+		kubetest.Ingress(JupyterLabs.NotebookNamespace, "labs"),
+		class,
+		kubetest.Claim(JupyterLabs.NotebookNamespace, "jl-alice-0", "nfs-csi-model", "10Gi"),
+		kubetest.Pod(JupyterLabs.NotebookNamespace, "alice-0", "alice", "node-a", "4", "2Gi"),
+	)
+	app := newLabApp(h)
+	if status, resp := kubetest.Do(t, app, fiber.MethodPost, "/api/notebooks", labRequest("alice")); status != fiber.StatusOK {
+		t.Fatalf("create returned %d %+v", status, resp)
+	}
+	return h, app
+}
+
+func TestResizeNotebook(t *testing.T) {
+	h, app := newResizableLab(t, kubetest.StorageClass("nfs-csi-model", true))
+	ctx := context.TODO()
+	statefulSets := h.Clientset.AppsV1().StatefulSets(JupyterLabs.NotebookNamespace)
+	created, _ := statefulSets.Get(ctx, "alice", metav1.GetOptions{})
+	// The controller has rolled the pod out; the fake does not.
+	created.Status.UpdatedReplicas, created.Status.ReadyReplicas = 1, 1
+	if _, err := statefulSets.UpdateStatus(ctx, created, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Six CPUs only fit on node-a once the labspace's own pod is replaced.
+	resize := JupyterLabs.ResizeLabRequest{ResourceFields: JupyterLabs.ResourceFields{CPURequest: "6", CPULimit: "6", DiskStorage: "20Gi"}}
+	status, resp := kubetest.Do(t, app, fiber.MethodPatch, "/api/notebooks/alice", resize)
+	if status != fiber.StatusAccepted {
+		t.Fatalf("resize returned %d %+v", status, resp)
+	}
+	if job := h.WaitJob(t, resp); job.Status != jobs.StatusSucceeded {
+		t.Fatalf("resize job %s: %s %+v", job.Status, job.Error, job.Steps)
+	}
+
+	sts, _ := statefulSets.Get(ctx, "alice", metav1.GetOptions{})
+	resources := sts.Spec.Template.Spec.Containers[0].Resources
+	if cpu := resources.Requests.Cpu(); cpu.Cmp(resource.MustParse("6")) != 0 {
+		t.Errorf("cpu request = %s, want 6", cpu)
+	}
+	if mem := resources.Limits.Memory(); mem.Cmp(resource.MustParse("4Gi")) != 0 {
+		t.Errorf("memory limit = %s, want the 4Gi it had", mem)
+	}
+	if sts.Spec.Template.Annotations[kubeutils.RestartedAtAnnotation] == "" {
+		t.Error("pods were not restarted with the new size")
+	}
+	if !reflect.DeepEqual(sts.Spec.VolumeClaimTemplates, created.Spec.VolumeClaimTemplates) {
+		t.Error("the volume claim template changed, so the workspace would not be kept")
+	}
+	pvc, _ := h.Clientset.CoreV1().PersistentVolumeClaims(JupyterLabs.NotebookNamespace).Get(ctx, "jl-alice-0", metav1.GetOptions{})
+	if size := pvc.Spec.Resources.Requests.Storage(); size.Cmp(resource.MustParse("20Gi")) != 0 {
+		t.Errorf("volume size = %s, want 20Gi", size)
+	}
+
+	if status, _ := kubetest.Do(t, app, fiber.MethodPatch, "/api/notebooks/bob", resize); status != fiber.StatusNotFound {
+		t.Errorf("resizing a missing labspace returned %d, want 404", status)
+	}
+}
+
+func TestResizeNotebookRejectsWhatCannotBeDone(t *testing.T) {
+	h, app := newResizableLab(t, kubetest.StorageClass("nfs-csi-model", false))
+	ctx := context.TODO()
+	before, _ := h.Clientset.AppsV1().StatefulSets(JupyterLabs.NotebookNamespace).Get(ctx, "alice", metav1.GetOptions{})
+
+	for _, tc := range []struct {
+		name    string
+		resize  JupyterLabs.ResizeLabRequest
+		status  int
+		message string
+	}{
+		{"nothing to change", JupyterLabs.ResizeLabRequest{}, fiber.StatusBadRequest, "validation failed"},
+		{"growing a volume that cannot expand", JupyterLabs.ResizeLabRequest{ResourceFields: JupyterLabs.ResourceFields{DiskStorage: "20Gi"}}, fiber.StatusUnprocessableEntity, "does not allow volume expansion"},
+		{"shrinking the volume", JupyterLabs.ResizeLabRequest{ResourceFields: JupyterLabs.ResourceFields{DiskStorage: "5Gi"}}, fiber.StatusUnprocessableEntity, "cannot shrink"},
+		{"a limit below the request kept", JupyterLabs.ResizeLabRequest{ResourceFields: JupyterLabs.ResourceFields{CPULimit: "500m"}}, fiber.StatusBadRequest, "must not be less than the request"},
+		{"more than the cluster has", JupyterLabs.ResizeLabRequest{ResourceFields: JupyterLabs.ResourceFields{CPURequest: "10", CPULimit: "10"}}, fiber.StatusInternalServerError, "no node can fit"},
+	} {
+		status, resp := kubetest.Do(t, app, fiber.MethodPatch, "/api/notebooks/alice", tc.resize)
+		if status != tc.status || !strings.Contains(resp.Message, tc.message) {
+			t.Errorf("%s: resize returned %d %+v, want %d mentioning %q", tc.name, status, resp, tc.status, tc.message)
+		}
+	}
+	after, _ := h.Clientset.AppsV1().StatefulSets(JupyterLabs.NotebookNamespace).Get(ctx, "alice", metav1.GetOptions{})
+	if !reflect.DeepEqual(after.Spec, before.Spec) {
+		t.Error("a rejected resize changed the labspace")
+	}
+}
@@ -0,0 +1,502 @@
+package JupyterLabs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2/log"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+
+	"Kubernetes-api/internal/sse"
+	"Kubernetes-api/kubeutils"
+)
+
+const (
+	cullingTopic = "culling"
+
+	// DefaultCullInterval is how often labspaces are checked when the
+	// policy sets no interval.
+	DefaultCullInterval = time.Minute
+	// DefaultIdleCPUMillicores is the CPU usage under which a labspace
+	// counts as idle when its rule sets no threshold.
+	DefaultIdleCPUMillicores = 50
+
+	// cullHistory is how many culled labspaces are remembered.
+	cullHistory = 100
+)
+
+// Events of the culling topic.
+const (
+	EventCullWarning = "warning"
+	EventCulled      = "culled"
+)
+
+// CullRule is when the labspaces of a team count as idle and are stopped.
+type CullRule struct {
+	// IdleAfter is how long a labspace may go unused before it is stopped.
+	// Zero never stops it.
+	IdleAfter metav1.Duration `json:"idleAfter"`
+	// WarnBefore is how long before the stop its user is warned.
+	WarnBefore metav1.Duration `json:"warnBefore"`
+	// CPUMillicores is the usage at or above which the labspace counts as
+	// in use; DefaultIdleCPUMillicores when zero.
+	CPUMillicores int64 `json:"cpuMillicores"`
+	// GPUOnly leaves labspaces without GPUs running.
+	GPUOnly bool `json:"gpuOnly"`
+}
+
+// CullPolicy is the culling rule of every team. A team listed in Teams
+// uses its own rule in full; every other labspace uses Default.
+type CullPolicy struct {
+	Interval metav1.Duration     `json:"interval"`
+	Default  CullRule            `json:"default"`
+	Teams    map[string]CullRule `json:"teams"`
+}
+
+// LoadCullPolicy reads a culling policy from a YAML file.
+func LoadCullPolicy(path string) (*CullPolicy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read culling policy: %w", err)
+	}
+	var p CullPolicy
+	if err := yaml.UnmarshalStrict(data, &p); err != nil {
+		return nil, fmt.Errorf("failed to parse culling policy %s: %w", path, err)
+	}
+	return &p, nil
+}
+
+// Rule is the rule for the labspaces of team.
+func (p *CullPolicy) Rule(team string) CullRule {
+	if rule, ok := p.Teams[team]; ok {
+		return rule
+	}
+	return p.Default
+}
+
+// ActivityProbe reports when the user of a labspace last used it.
+type ActivityProbe interface {
+	LastActivity(ctx context.Context, lab kubeutils.WorkloadRef) (time.Time, error)
+}
+
+// CullNotice warns that a labspace is about to be stopped for being idle.
+type CullNotice struct {
+	Cluster      string    `json:"cluster"`
+	Namespace    string    `json:"namespace"`
+	Name         string    `json:"name"`
+	Team         string    `json:"team,omitempty"`
+	LastActivity time.Time `json:"lastActivity"`
+	StopAt       time.Time `json:"stopAt"`
+}
+
+func (n CullNotice) EventName() string { return EventCullWarning }
+func (n CullNotice) EventKey() string  { return cullKey(n.Cluster, n.Namespace, n.Name) }
+
+// CullRecord is a labspace the culler stopped, and why.
+type CullRecord struct {
+	Cluster      string    `json:"cluster"`
+	Namespace    string    `json:"namespace"`
+	Name         string    `json:"name"`
+	Team         string    `json:"team,omitempty"`
+	LastActivity time.Time `json:"lastActivity"`
+	CulledAt     time.Time `json:"culledAt"`
+	Reason       string    `json:"reason"`
+}
+
+func (r CullRecord) EventName() string { return EventCulled }
+func (r CullRecord) EventKey() string  { return cullKey(r.Cluster, r.Namespace, r.Name) }
+
+// cullCleared withdraws the warning of a labspace that was used again.
+type cullCleared struct {
+	key string
+}
+
+func (e cullCleared) EventName() string { return sse.EventDeleted }
+func (e cullCleared) EventKey() string  { return e.key }
+
+// CullStatus is what the culler is about to stop and what it has stopped,
+// newest first.
+type CullStatus struct {
+	Warnings []CullNotice `json:"warnings"`
+	Culled   []CullRecord `json:"culled"`
+}
+
+func cullKey(cluster, namespace, name string) string {
+	return cluster + "/" + namespace + "/" + name
+}
+
+// Culler stops labspaces nobody has used for longer than their team's rule
+// allows. A labspace is in use while its CPU usage, as metrics-server
+// reports it, is at the rule's threshold or it uses its GPUs, and whenever
+// the probe reports newer activity. Labspaces seen for the first time count
+// as used at that moment, so restarting the API never stops anything early.
+type Culler struct {
+	svc    *Service
+	policy *CullPolicy
+	probe  ActivityProbe
+
+	sweeping sync.Mutex
+	idle     map[string]*idleState
+
+	mu      sync.Mutex
+	notices map[string]CullNotice
+	culled  []CullRecord
+	hubs    map[*sse.Hub]struct{}
+}
+
+type idleState struct {
+	lastActive time.Time
+}
+
+// EnableCulling makes the service cull idle labspaces under policy once the
+// returned culler runs, and serve its warnings on the culling topic.
+func (s *Service) EnableCulling(policy *CullPolicy, probe ActivityProbe) *Culler {
+	c := &Culler{
+		svc:     s,
+		policy:  policy,
+		probe:   probe,
+		idle:    make(map[string]*idleState),
+		notices: make(map[string]CullNotice),
+		hubs:    make(map[*sse.Hub]struct{}),
+	}
+	s.culler = c
+	s.broker.Register(cullingTopic, c.produce)
+	return c
+}
+
+// Run sweeps every policy interval until ctx is done.
+func (c *Culler) Run(ctx context.Context) {
+	interval := c.policy.Interval.Duration
+	if interval <= 0 {
+		interval = DefaultCullInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.Sweep(ctx, time.Now()); err != nil {
+				log.Errorf("culling idle labspaces: %v", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Sweep checks every running labspace on every cluster as of now, warning
+// the users of those about to be stopped and stopping those idle for too
+// long. A labspace that cannot be checked is left running; the failures are
+// joined in the returned error.
+func (c *Culler) Sweep(ctx context.Context, now time.Time) error {
+	c.sweeping.Lock()
+	defer c.sweeping.Unlock()
+
+	var errs []error
+	seen := make(map[string]bool)
+	for _, cluster := range c.svc.clusters.All() {
+		labs, err := runningLabspaces(cluster.Kube)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("cluster %s: %w", cluster.Name, err))
+			continue
+		}
+		usage := make(map[string]map[string]podUsage)
+		for _, sts := range labs {
+			key := cullKey(cluster.Name, sts.Namespace, sts.Name)
+			seen[key] = true
+			if _, ok := usage[sts.Namespace]; !ok {
+				usage[sts.Namespace], err = namespaceUsage(cluster.Kube, sts.Namespace)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("cluster %s: %w", cluster.Name, err))
+				}
+			}
+			if usage[sts.Namespace] == nil {
+				// Without metrics a busy labspace would look idle.
+				continue
+			}
+			if err := c.check(ctx, cluster, sts, usage[sts.Namespace], now); err != nil {
+				errs = append(errs, fmt.Errorf("labspace %s on cluster %s: %w", sts.Name, cluster.Name, err))
+			}
+		}
+	}
+	for key := range c.idle {
+		if !seen[key] {
+			delete(c.idle, key)
+			c.clearNotice(key)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// check warns about or stops the labspace sts as its rule says.
+func (c *Culler) check(ctx context.Context, cluster kubeutils.Cluster, sts *appsv1.StatefulSet, usage map[string]podUsage, now time.Time) error {
+	team := sts.Labels[kubeutils.TenantLabel]
+	rule := c.policy.Rule(team)
+	if rule.IdleAfter.Duration <= 0 {
+		return nil
+	}
+	if rule.GPUOnly {
+		usage, err := cluster.Kube.PodUsage(sts.Spec.Template.Spec)
+		if err != nil {
+			return err
+		}
+		if usage.GPUs == 0 {
+			return nil
+		}
+	}
+
+	key := cullKey(cluster.Name, sts.Namespace, sts.Name)
+	state, ok := c.idle[key]
+	if !ok {
+		state = &idleState{lastActive: now}
+		c.idle[key] = state
+	}
+	threshold := rule.CPUMillicores
+	if threshold <= 0 {
+		threshold = DefaultIdleCPUMillicores
+	}
+	// A labspace runs a single pod, its statefulset's first ordinal.
+	if u := usage[sts.Name+"-0"]; u.cpuMillicores >= threshold || u.gpu {
+		state.lastActive = now
+	}
+	ref := kubeutils.WorkloadRef{Cluster: cluster.Name, Namespace: sts.Namespace, Name: sts.Name}
+	if last, err := c.probe.LastActivity(ctx, ref); err != nil {
+		log.Debugf("no activity reported by labspace %s: %v", key, err)
+	} else if last.After(state.lastActive) {
+		state.lastActive = minTime(last, now)
+	}
+
+	stopAt := state.lastActive.Add(rule.IdleAfter.Duration)
+	switch {
+	case !now.Before(stopAt):
+		return c.cull(cluster, sts, team, rule, state.lastActive, now)
+	case rule.WarnBefore.Duration > 0 && !now.Before(stopAt.Add(-rule.WarnBefore.Duration)):
+		c.warn(CullNotice{
+			Cluster:      cluster.Name,
+			Namespace:    sts.Namespace,
+			Name:         sts.Name,
+			Team:         team,
+			LastActivity: state.lastActive,
+			StopAt:       stopAt,
+		})
+	default:
+		c.clearNotice(key)
+	}
+	return nil
+}
+
+// cull stops the labspace sts with the reason as its stop reason, and
+// records it.
+func (c *Culler) cull(cluster kubeutils.Cluster, sts *appsv1.StatefulSet, team string, rule CullRule, lastActive, now time.Time) error {
+	policy := "default"
+	if _, ok := c.policy.Teams[team]; ok {
+		policy = fmt.Sprintf("team %s", team)
+	}
+	record := CullRecord{
+		Cluster:      cluster.Name,
+		Namespace:    sts.Namespace,
+		Name:         sts.Name,
+		Team:         team,
+		LastActivity: lastActive,
+		CulledAt:     now,
+		Reason: fmt.Sprintf("idle for %s, longer than the %s the %s culling policy allows",
+			now.Sub(lastActive).Round(time.Second), rule.IdleAfter.Duration, policy),
+	}
+	if err := c.svc.boundTo(cluster, sts).StopNotebook(sts.Name, record.Reason); err != nil {
+		return fmt.Errorf("stopping idle labspace: %w", err)
+	}
+	log.Infof("culled labspace %s: %s", record.EventKey(), record.Reason)
+	delete(c.idle, record.EventKey())
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.notices, record.EventKey())
+	c.culled = append(c.culled, record)
+	if len(c.culled) > cullHistory {
+		c.culled = c.culled[len(c.culled)-cullHistory:]
+	}
+	c.publish(record)
+	return nil
+}
+
+// warn publishes n unless the same warning is already out.
+func (c *Culler) warn(n CullNotice) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if old, ok := c.notices[n.EventKey()]; ok && old.StopAt.Equal(n.StopAt) {
+		return
+	}
+	c.notices[n.EventKey()] = n
+	c.publish(n)
+}
+
+// clearNotice withdraws the warning of key, if there is one.
+func (c *Culler) clearNotice(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.notices[key]; !ok {
+		return
+	}
+	delete(c.notices, key)
+	c.publish(cullCleared{key: key})
+}
+
+// publish sends ev to every running culling stream. c.mu must be held.
+func (c *Culler) publish(ev sse.Event) {
+	for h := range c.hubs {
+		if err := h.Publish(ev); err != nil {
+			log.Errorf("publishing %s event: %v", ev.EventName(), err)
+		}
+	}
+}
+
+// produce feeds the culling topic from the culler until ctx is done. The
+// warnings already out are published first, so clients connecting after
+// them still learn of them.
+func (c *Culler) produce(ctx context.Context, h *sse.Hub) error {
+	c.mu.Lock()
+	c.hubs[h] = struct{}{}
+	for _, n := range c.sortedNotices() {
+		if err := h.Publish(n); err != nil {
+			log.Errorf("publishing %s event: %v", n.EventName(), err)
+		}
+	}
+	c.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		c.mu.Lock()
+		delete(c.hubs, h)
+		c.mu.Unlock()
+	}()
+	return nil
+}
+
+// Status returns the pending warnings and the culled labspaces of team, or
+// of every team when team is empty.
+func (c *Culler) Status(team string) CullStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	status := CullStatus{Warnings: []CullNotice{}, Culled: []CullRecord{}}
+	for _, n := range c.sortedNotices() {
+		if team == "" || n.Team == team {
+			status.Warnings = append(status.Warnings, n)
+		}
+	}
+	for i := len(c.culled) - 1; i >= 0; i-- {
+		if team == "" || c.culled[i].Team == team {
+			status.Culled = append(status.Culled, c.culled[i])
+		}
+	}
+	return status
+}
+
+// sortedNotices returns the pending warnings, soonest stop first. c.mu must
+// be held.
+func (c *Culler) sortedNotices() []CullNotice {
+	out := make([]CullNotice, 0, len(c.notices))
+	for _, n := range c.notices {
+		out = append(out, n)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].StopAt.Equal(out[j].StopAt) {
+			return out[i].StopAt.Before(out[j].StopAt)
+		}
+		return out[i].EventKey() < out[j].EventKey()
+	})
+	return out
+}
+
+// runningLabspaces lists the labspace statefulsets of kc that have pods.
+func runningLabspaces(kc *kubeutils.KubernetesConfig) ([]*appsv1.StatefulSet, error) {
+	labs, err := listLabspaces(kc)
+	if err != nil {
+		return nil, err
+	}
+	out := labs[:0]
+	for _, sts := range labs {
+		if sts.Spec.Replicas == nil || *sts.Spec.Replicas > 0 {
+			out = append(out, sts)
+		}
+	}
+	return out, nil
+}
+
+// listLabspaces lists the labspace statefulsets of kc, stopped or not:
+// those labelled as labspaces in any namespace and, for labspaces created
+// before workloads were labelled, every statefulset in NotebookNamespace.
+func listLabspaces(kc *kubeutils.KubernetesConfig) ([]*appsv1.StatefulSet, error) {
+	ctx := context.TODO()
+	labelled, err := kc.Clientset.AppsV1().StatefulSets("").List(ctx, metav1.ListOptions{
+		LabelSelector: kubeutils.WorkloadLabel + "=" + kubeutils.WorkloadLabspace,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing labspaces: %w", err)
+	}
+	legacy, err := kc.Clientset.AppsV1().StatefulSets(NotebookNamespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("listing labspaces: %w", err)
+	}
+
+	var out []*appsv1.StatefulSet
+	seen := make(map[string]bool)
+	for _, list := range [][]appsv1.StatefulSet{labelled.Items, legacy.Items} {
+		for i := range list {
+			sts := &list[i]
+			key := sts.Namespace + "/" + sts.Name
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			out = append(out, sts)
+		}
+	}
+	return out, nil
+}
+
+// boundTo returns the service bound to the cluster and namespace of the
+// labspace sts, for work done outside a request.
+func (s *Service) boundTo(cluster kubeutils.Cluster, sts *appsv1.StatefulSet) *Service {
+	svc := *s
+	svc.kc = cluster.Kube
+	svc.cluster = cluster.Name
+	svc.namespace = sts.Namespace
+	svc.tenant = sts.Labels[kubeutils.TenantLabel]
+	return &svc
+}
+
+// podUsage is what the containers of one pod use together.
+type podUsage struct {
+	cpuMillicores int64
+	gpu           bool
+}
+
+// namespaceUsage is the usage of every pod in namespace with metrics.
+func namespaceUsage(kc *kubeutils.KubernetesConfig, namespace string) (map[string]podUsage, error) {
+	metrics, err := kc.GetPodMetric(namespace)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]podUsage)
+	for _, m := range metrics {
+		u := out[m.PodName]
+		u.cpuMillicores += m.CPUMillicores
+		u.gpu = u.gpu || (m.GPUUsage != "" && m.GPUUsage != "0")
+		out[m.PodName] = u
+	}
+	return out, nil
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
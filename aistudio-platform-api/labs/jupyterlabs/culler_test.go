@@ -0,0 +1,196 @@
+package JupyterLabs_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"Kubernetes-api/internal/kubetest"
+	"Kubernetes-api/kubeutils"
+	JupyterLabs "Kubernetes-api/labs/jupyterlabs"
+
+	"github.com/gofiber/fiber/v2"
+	apiv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// activity is an ActivityProbe reporting fixed last activity per labspace.
+type activity map[string]time.Time
+
+func (a activity) LastActivity(ctx context.Context, lab kubeutils.WorkloadRef) (time.Time, error) {
+	if last, ok := a[lab.Name]; ok {
+		return last, nil
+	}
+	return time.Time{}, errors.New("unreachable")
+}
+
+// runningLab is a labspace of team whose pod uses cpu.
+type runningLab struct {
+	name, team, cpu string
+}
+
+// newCullingLab seeds running labspaces with their pod metrics and returns
+// the app with culling enabled under policy.
+func newCullingLab(t *testing.T, h *kubetest.Harness, policy *JupyterLabs.CullPolicy, probe JupyterLabs.ActivityProbe, labs ...runningLab) (*fiber.App, *JupyterLabs.Culler) {
+	t.Helper()
+	svc := JupyterLabs.NewService(h.Clusters, h.Fs, h.Templates, h.Broker, h.Jobs)
+	culler := svc.EnableCulling(policy, probe)
+	for _, lab := range labs {
+		owner := kubeutils.Owner{User: lab.name, Team: lab.team, Workload: kubeutils.WorkloadLabspace}
+		err := h.Kube.CreateStatefulSet(JupyterLabs.NotebookNamespace, lab.name, "notebook-"+lab.name, "lab", kubeutils.GPURequest{}, JupyterLabs.NotebookPort, "1Gi", "", apiv1.ResourceRequirements{}, nil, owner)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := h.Kube.CreateService(JupyterLabs.NotebookNamespace, "notebook-"+lab.name, lab.name, JupyterLabs.NotebookPort, apiv1.ServiceTypeNodePort); err != nil {
+			t.Fatal(err)
+		}
+		h.AddPodMetrics(t, kubetest.PodMetrics(JupyterLabs.NotebookNamespace, lab.name+"-0", lab.cpu, "1Gi"))
+	}
+	return h.App(func(api fiber.Router) { JupyterLabs.SetupRoutes(api, svc) }), culler
+}
+
+// labspaceRunning reports whether the labspace name exists and is not
+// scaled down.
+func labspaceRunning(t *testing.T, h *kubetest.Harness, name string) bool {
+	t.Helper()
+	sts, err := h.Clientset.AppsV1().StatefulSets(JupyterLabs.NotebookNamespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return false
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sts.Spec.Replicas == nil || *sts.Spec.Replicas > 0
+}
+
+func cullingStatus(t *testing.T, app *fiber.App) (warnings, culled []map[string]any) {
+	t.Helper()
+	status, resp := kubetest.Do(t, app, fiber.MethodGet, "/api/notebooks/culling", nil)
+	if status != fiber.StatusOK {
+		t.Fatalf("culling status returned %d %+v", status, resp)
+	}
+	data := resp.Data.(map[string]any)
+	for _, w := range data["warnings"].([]any) {
+		warnings = append(warnings, w.(map[string]any))
+	}
+	for _, c := range data["culled"].([]any) {
+		culled = append(culled, c.(map[string]any))
+	}
+	return warnings, culled
+}
+
+func TestCullerWarnsThenStopsIdleLabspace(t *testing.T) {
+	h := kubetest.New(kubetest.Ingress(JupyterLabs.NotebookNamespace, "labs"))
+	policy := &JupyterLabs.CullPolicy{Default: JupyterLabs.CullRule{
+		IdleAfter:  metav1.Duration{Duration: time.Hour},
+		WarnBefore: metav1.Duration{Duration: 10 * time.Minute},
+	}}
+	app, culler := newCullingLab(t, h, policy, activity{}, runningLab{"alice", "", "10m"})
+	ctx := context.TODO()
+	start := time.Now()
+
+	for _, at := range []time.Duration{0, 49 * time.Minute} {
+		if err := culler.Sweep(ctx, start.Add(at)); err != nil {
+			t.Fatalf("sweep at %s: %v", at, err)
+		}
+	}
+	if warnings, _ := cullingStatus(t, app); len(warnings) != 0 {
+		t.Fatalf("warnings before the warning period = %v", warnings)
+	}
+
+	if err := culler.Sweep(ctx, start.Add(55*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	warnings, _ := cullingStatus(t, app)
+	if len(warnings) != 1 || warnings[0]["name"] != "alice" {
+		t.Fatalf("warnings = %v, want one for alice", warnings)
+	}
+	if !labspaceRunning(t, h, "alice") {
+		t.Fatal("labspace stopped during its warning period")
+	}
+
+	if err := culler.Sweep(ctx, start.Add(61*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if labspaceRunning(t, h, "alice") {
+		t.Fatal("idle labspace was not stopped")
+	}
+	sts, _ := h.Clientset.AppsV1().StatefulSets(JupyterLabs.NotebookNamespace).Get(ctx, "alice", metav1.GetOptions{})
+	if reason := sts.Annotations[JupyterLabs.StopReasonAnnotation]; !strings.Contains(reason, "idle for") {
+		t.Errorf("stop reason = %q, want the culling reason", reason)
+	}
+	warnings, culled := cullingStatus(t, app)
+	if len(warnings) != 0 {
+		t.Errorf("warnings after the stop = %v", warnings)
+	}
+	if len(culled) != 1 || !strings.Contains(culled[0]["reason"].(string), "idle for 1h1m0s") {
+		t.Errorf("culled = %v, want alice with the time it was idle", culled)
+	}
+}
+
+func TestCullerFollowsActivityAndTeamRules(t *testing.T) {
+	h := kubetest.New(kubetest.Ingress(JupyterLabs.NotebookNamespace, "labs"))
+	start := time.Now()
+	policy := &JupyterLabs.CullPolicy{
+		Default: JupyterLabs.CullRule{IdleAfter: metav1.Duration{Duration: time.Hour}},
+		Teams:   map[string]JupyterLabs.CullRule{"research": {}},
+	}
+	probe := activity{"alice": start.Add(50 * time.Minute)}
+	_, culler := newCullingLab(t, h, policy, probe,
+		runningLab{"alice", "", "10m"},
+		runningLab{"bob", "", "500m"},
+		runningLab{"carol", "research", "10m"},
+	)
+
+	ctx := context.TODO()
+	for _, at := range []time.Duration{0, 61 * time.Minute} {
+		if err := culler.Sweep(ctx, start.Add(at)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"alice", "bob", "carol"} {
+		if !labspaceRunning(t, h, name) {
+			t.Errorf("%s was stopped although it was in use or exempt", name)
+		}
+	}
+
+	if err := culler.Sweep(ctx, start.Add(111*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if labspaceRunning(t, h, "alice") {
+		t.Error("alice was not stopped an hour after its last activity")
+	}
+	if !labspaceRunning(t, h, "bob") || !labspaceRunning(t, h, "carol") {
+		t.Error("busy or exempt labspaces were stopped")
+	}
+}
+
+func TestLoadCullPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "culling.yaml")
+	doc := "default:\n  idleAfter: 2h\n  warnBefore: 15m\n  gpuOnly: true\nteams:\n  research:\n    idleAfter: 0s\n"
+	if err := os.WriteFile(path, []byte(doc), 0600); err != nil {
+		t.Fatal(err)
+	}
+	policy, err := JupyterLabs.LoadCullPolicy(path)
+	if err != nil {
+		t.Fatalf("LoadCullPolicy: %v", err)
+	}
+	if rule := policy.Rule("vision"); rule.IdleAfter.Duration != 2*time.Hour || !rule.GPUOnly {
+		t.Errorf("default rule = %+v", rule)
+	}
+	if rule := policy.Rule("research"); rule.IdleAfter.Duration != 0 {
+		t.Errorf("research rule = %+v, want culling off", rule)
+	}
+
+	if err := os.WriteFile(path, []byte("default:\n  idle: 2h\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := JupyterLabs.LoadCullPolicy(path); err == nil {
+		t.Error("an unknown field should be rejected")
+	}
+}
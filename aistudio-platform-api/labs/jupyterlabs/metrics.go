@@ -0,0 +1,107 @@
+package JupyterLabs
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/gofiber/fiber/v2/log"
+
+	"Kubernetes-api/internal/sse"
+	"Kubernetes-api/kubeutils"
+)
+
+// metricsInterval is how often metrics-server is sampled for the metrics
+// stream. Pod metrics cannot be watched, so changes are found by comparing
+// consecutive samples.
+const metricsInterval = 10 * time.Second
+
+// labMetricsEvent reports the container usage of one labspace pod.
+type labMetricsEvent struct {
+	Type    kubeutils.EventType    `json:"-"`
+	Pod     string                 `json:"pod"`
+	Metrics []kubeutils.PodMetrics `json:"metrics"`
+}
+
+func (e labMetricsEvent) EventName() string {
+	return string(e.Type)
+}
+
+func (e labMetricsEvent) EventKey() string {
+	return e.Pod
+}
+
+// watchLabspacesMetrics samples labspace metrics every interval and sends an
+// event for each pod whose usage appeared, changed or disappeared since the
+// previous sample. A failed sample is sent as an error event and retried
+// with back-off.
+func (s *Service) watchLabspacesMetrics(ctx context.Context, interval time.Duration) <-chan sse.Event {
+	events := make(chan sse.Event)
+	go func() {
+		backoff := sse.DefaultBackoff()
+		prev := map[string][]kubeutils.PodMetrics{}
+		for {
+			var batch []sse.Event
+			wait := interval
+
+			metrics, err := s.GetLabspacesMetrics()
+			if err != nil {
+				wait = backoff.Step()
+				log.Errorf("error getting pod metrics, retrying in %s: %v", wait, err)
+				batch = append(batch, sse.NewErrorEvent(err, wait))
+			} else {
+				backoff = sse.DefaultBackoff()
+				next := metricsByPod(metrics)
+				for _, ev := range diffMetrics(prev, next) {
+					batch = append(batch, ev)
+				}
+				prev = next
+			}
+
+			for _, ev := range batch {
+				select {
+				case events <- ev:
+				case <-ctx.Done():
+					return
+				}
+			}
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return events
+}
+
+func metricsByPod(metrics []kubeutils.PodMetrics) map[string][]kubeutils.PodMetrics {
+	byPod := make(map[string][]kubeutils.PodMetrics)
+	for _, m := range metrics {
+		byPod[m.PodName] = append(byPod[m.PodName], m)
+	}
+	return byPod
+}
+
+// diffMetrics returns the events that turn prev into next, ordered by pod
+// name.
+func diffMetrics(prev, next map[string][]kubeutils.PodMetrics) []labMetricsEvent {
+	var events []labMetricsEvent
+	for pod, metrics := range next {
+		old, existed := prev[pod]
+		switch {
+		case !existed:
+			events = append(events, labMetricsEvent{Type: kubeutils.EventAdded, Pod: pod, Metrics: metrics})
+		case !reflect.DeepEqual(old, metrics):
+			events = append(events, labMetricsEvent{Type: kubeutils.EventModified, Pod: pod, Metrics: metrics})
+		}
+	}
+	for pod := range prev {
+		if _, ok := next[pod]; !ok {
+			events = append(events, labMetricsEvent{Type: kubeutils.EventDeleted, Pod: pod})
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].Pod < events[j].Pod })
+	return events
+}
@@ -1,22 +1,77 @@
 package JupyterLabs
 
+import (
+	"Kubernetes-api/helper"
+	"Kubernetes-api/kubeutils"
+)
+
 type Notebook struct {
-	Name    string `json:"name"`
-	Ready   string `json:"ready"`
-	Status  string `json:"status"`
-	Restart uint   `json:"restart"`
-	Age     string `json:"age"`
+	Name       string `json:"name"`
+	Ready      string `json:"ready"`
+	Status     string `json:"status"`
+	Restart    uint   `json:"restart"`
+	Age        string `json:"age"`
+	StoppedAt  string `json:"stoppedAt,omitempty"`
+	StopReason string `json:"stopReason,omitempty"`
+	// Schedule is set when the labspace has a start/stop schedule.
+	Schedule *ScheduleStatus `json:"schedule,omitempty"`
+}
+
+// ResourceFields are the resources a labspace request asks for. Every
+// request that sizes a labspace embeds them, so they read the same in each.
+type ResourceFields struct {
+	CPURequest    string `json:"cpuRequest,omitempty"`
+	GPURequest    string `json:"gpuRequest,omitempty"`
+	GPUType       string `json:"gpuType,omitempty"`
+	GPUModel      string `json:"gpuModel,omitempty"`
+	MemoryRequest string `json:"memoryRequest,omitempty"`
+	CPULimit      string `json:"cpuLimit,omitempty"`
+	MemoryLimit   string `json:"memoryLimit,omitempty"`
+	DiskStorage   string `json:"diskStorage,omitempty"`
+}
+
+func (r ResourceFields) resourceSpec() kubeutils.ResourceSpec {
+	return kubeutils.ResourceSpec{
+		CPURequest:    r.CPURequest,
+		MemoryRequest: r.MemoryRequest,
+		CPULimit:      r.CPULimit,
+		MemoryLimit:   r.MemoryLimit,
+		GPU:           r.GPURequest,
+		GPUType:       r.GPUType,
+		GPUModel:      r.GPUModel,
+		DiskStorage:   r.DiskStorage,
+	}
+}
+
+// validate checks the resources of a labspace being created, with those
+// left empty taking the defaults for its workspace and labspace type.
+func (r ResourceFields) validate(v *helper.Validator, labType, aiType string) {
+	_, err := kubeutils.ParseResources(r.resourceSpec(), ResourceDefaults(labType, aiType))
+	v.Check(err)
+}
+
+// validateSet checks only the fields that are set, for a request that keeps
+// the current value of the others.
+func (r ResourceFields) validateSet(v *helper.Validator) {
+	for _, f := range []struct{ field, value string }{
+		{"cpuRequest", r.CPURequest},
+		{"memoryRequest", r.MemoryRequest},
+		{"cpuLimit", r.CPULimit},
+		{"memoryLimit", r.MemoryLimit},
+		{"diskStorage", r.DiskStorage},
+	} {
+		if f.value != "" {
+			v.Quantity(f.field, f.value)
+		}
+	}
+	v.Count("gpuRequest", r.GPURequest)
+	v.LabelValue("gpuModel", r.GPUModel)
 }
 
 type CreateLabRequest struct {
-	Username        string `json:"userName"`
-	Password        string `json:"password"`
-	CPURequest      string `json:"cpuRequest"`
-	GPURequest      string `json:"gpuRequest"`
-	MemoryRequest   string `json:"memoryRequest"`
-	CPULimit        string `json:"cpuLimit"`
-	MemoryLimit     string `json:"memoryLimit"`
-	DiskStorage     string `json:"diskStorage"`
+	Username string `json:"userName"`
+	Password string `json:"password"`
+	ResourceFields
 	NodeSelector    string `json:"nodeSelector"`
 	WorkSpaceType   string `json:"workspaceType"`
 	LabspaceType    string `json:"labspaceType"`
@@ -24,30 +79,84 @@ type CreateLabRequest struct {
 	TemplateBaseURL string `json:"templateUrl"`
 }
 
+// Validate checks the request before anything is created in the cluster.
+// Resources left empty take the defaults for the workspace type.
+func (r CreateLabRequest) Validate() error {
+	var v helper.Validator
+	v.DNSLabel("userName", NotebookServicePrefix+"%s", r.Username)
+	v.Required("password", r.Password)
+	r.ResourceFields.validate(&v, r.WorkSpaceType, r.LabspaceType)
+	v.LabelValue("nodeSelector", r.NodeSelector)
+	v.URL("templateUrl", r.TemplateBaseURL)
+	v.Required("templateVersion", r.TemplateVersion)
+	return v.Err()
+}
+
+// RotatePasswordRequest is the new password of a labspace.
+type RotatePasswordRequest struct {
+	Password string `json:"password"`
+}
+
+func (r RotatePasswordRequest) Validate() error {
+	var v helper.Validator
+	v.Required("password", r.Password)
+	return v.Err()
+}
+
+// GitCredentialsRequest is the token a user's private templates are cloned
+// with.
+type GitCredentialsRequest struct {
+	Token string `json:"token"`
+}
+
+func (r GitCredentialsRequest) Validate() error {
+	var v helper.Validator
+	v.Required("token", r.Token)
+	return v.Err()
+}
+
+// ResizeLabRequest is the new size of a labspace. Fields left empty keep
+// what the labspace has now.
+type ResizeLabRequest struct {
+	ResourceFields
+}
+
+// Validate checks the fields that are set. Whether they fit together with
+// the ones kept is checked against the labspace by ResizeNotebook.
+func (r ResizeLabRequest) Validate() error {
+	var v helper.Validator
+	if r.resourceSpec() == (kubeutils.ResourceSpec{}) {
+		v.Fail("", "at least one resource must be given")
+	}
+	r.ResourceFields.validateSet(&v)
+	return v.Err()
+}
+
 type RestartLabRequest struct {
-	Username      string `json:"userName"`
-	Password      string `json:"password"`
-	CPURequest    string `json:"cpuRequest"`
-	GPURequest    string `json:"gpuRequest"`
-	MemoryRequest string `json:"memoryRequest"`
-	CPULimit      string `json:"cpuLimit"`
-	MemoryLimit   string `json:"memoryLimit"`
-	DiskStorage   string `json:"diskStorage"`
+	Username string `json:"userName"`
+	Password string `json:"password"`
+	ResourceFields
 	NodeSelector  string `json:"nodeSelector"`
 	WorkSpaceType string `json:"workspaceType"`
 	LabspaceType  string `json:"labspaceType"`
 }
 
+// Validate checks the request before the labspace is recreated. Resources
+// left empty take the defaults for the workspace type.
+func (r RestartLabRequest) Validate() error {
+	var v helper.Validator
+	v.DNSLabel("userName", NotebookServicePrefix+"%s", r.Username)
+	v.Required("password", r.Password)
+	r.ResourceFields.validate(&v, r.WorkSpaceType, r.LabspaceType)
+	v.LabelValue("nodeSelector", r.NodeSelector)
+	return v.Err()
+}
+
 type CloneNotebookRequest struct {
-	Username          string   `json:"userName"`
-	BaseUsername      string   `json:"baseUserName"`
-	Password          string   `json:"password"`
-	CPURequest        string   `json:"cpuRequest"`
-	GPURequest        string   `json:"gpuRequest"`
-	MemoryRequest     string   `json:"memoryRequest"`
-	CPULimit          string   `json:"cpuLimit"`
-	MemoryLimit       string   `json:"memoryLimit"`
-	DiskStorage       string   `json:"diskStorage"`
+	Username     string `json:"userName"`
+	BaseUsername string `json:"baseUserName"`
+	Password     string `json:"password"`
+	ResourceFields
 	ModelName         string   `json:"modelname"`
 	Version           string   `json:"version"`
 	NodeSelector      string   `json:"nodeSelector"`
@@ -55,3 +164,19 @@ type CloneNotebookRequest struct {
 	LabspaceType      string   `json:"labspaceType"`
 	SelectedArtifacts []string `json:"selectedArtifacts"`
 }
+
+// Validate checks the labspace settings and names the registered model
+// whose artifacts are cloned.
+func (r CloneNotebookRequest) Validate() error {
+	var v helper.Validator
+	v.DNSLabel("userName", NotebookServicePrefix+"%s", r.Username)
+	v.Required("password", r.Password)
+	r.ResourceFields.validate(&v, r.WorkSpaceType, r.LabspaceType)
+	v.LabelValue("nodeSelector", r.NodeSelector)
+	if v.Required("baseUserName", r.BaseUsername) {
+		v.LabelValue("baseUserName", r.BaseUsername)
+	}
+	v.Required("modelname", r.ModelName)
+	v.Required("version", r.Version)
+	return v.Err()
+}
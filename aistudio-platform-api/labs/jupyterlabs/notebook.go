@@ -1,7 +1,10 @@
 package JupyterLabs
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"os"
 	"strconv"
 	"strings"
 	"time"
@@ -9,46 +12,146 @@ import (
 	"github.com/gofiber/fiber/v2/log"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/afero"
+	appsv1 "k8s.io/api/apps/v1"
 	apiv1 "k8s.io/api/core/v1"
 
 	"Kubernetes-api/artifacts"
+	"Kubernetes-api/enginetemplate"
 	"Kubernetes-api/helper"
+	"Kubernetes-api/internal/sse"
+	"Kubernetes-api/jobs"
 	"Kubernetes-api/kubeutils"
 )
 
-var kc = kubeutils.NewKubernetesConfig()
+// Service serves the labspace endpoints. kc is the cluster the service is
+// bound to, the default one until forCluster or placeNotebook picks another,
+// and namespace is where its labspaces live: NotebookNamespace, or the
+// tenant's namespace when the cluster has tenancy enabled.
+type Service struct {
+	kc        *kubeutils.KubernetesConfig
+	cluster   string
+	namespace string
+	tenant    string
+	clusters  *kubeutils.Clusters
+	fs        afero.Fs
+	templates enginetemplate.Source
+	broker    *sse.Broker
+	jobs      *jobs.Manager
+	// culler is set by EnableCulling.
+	culler *Culler
+}
+
+func NewService(clusters *kubeutils.Clusters, fs afero.Fs, templates enginetemplate.Source, broker *sse.Broker, jobManager *jobs.Manager) *Service {
+	def := clusters.Default()
+	s := &Service{kc: def.Kube, cluster: def.Name, namespace: NotebookNamespace, clusters: clusters, fs: fs, templates: templates, broker: broker, jobs: jobManager}
+	return s
+}
 
 type DeleteNotebookRequest struct {
 	Username string `json:"userName"`
 }
 
-func CreateNotebook(userName, password, cpuRequest, gpuRequest, memoryRequest, cpuLimit, memoryLimit, diskStorage, nodeSelector, labType, aiType string) (string, error) {
-	gpuSize, err := strconv.Atoi(gpuRequest)
+// CreateNotebook creates the labspace's service, statefulset and ingress
+// rules one step at a time, once the labspace is known to fit the quotas of
+// its user and team, and then runs the steps in then. If any step fails the
+// ones before it are undone, so a failed labspace leaves no orphaned
+// resources behind, and the error of the failing step is returned.
+func (s *Service) CreateNotebook(userName, password string, spec kubeutils.ResourceSpec, nodeSelector, labType, aiType string, then ...jobs.Step) (string, error) {
+	res, err := kubeutils.ParseResources(spec, ResourceDefaults(labType, aiType))
+	if err != nil {
+		logrus.Errorf("invalid resources for labspace %s: %v", userName, err)
+		return "", err
+	}
+
+	usage := kubeutils.WorkloadUsage(res.Requirements, res.GPU, labContainers(aiType))
+	usage.DiskBytes = res.Disk.Value()
+	usage.Labspaces = 1
+	release, err := s.clusters.ReserveQuota(kubeutils.QuotaRequest{Owner: s.owner(userName), Add: usage})
 	if err != nil {
-		logrus.Errorf("invalid GPU request value: %s, error: %v", gpuRequest, err)
-		return "", fmt.Errorf("GPU value must be an integer: %w", err)
+		logrus.Errorf("labspace %s: %v", userName, err)
+		return "", err
+	}
+	defer release()
+
+	steps := append(s.notebookSteps(userName, password, res, nodeSelector, labType, aiType), then...)
+	if err := jobs.Run(context.TODO(), steps); err != nil {
+		logrus.Errorf("creating labspace %s: %v", userName, err)
+		return "", err
 	}
+	return "Notebook created successfully", nil
+}
 
-	if gpuSize > 0 {
-		if available, err := kc.CheckGpuAvailability(gpuRequest); err != nil || !available {
-			logrus.Errorf("GPU check failed: %v", err)
-			return "", fmt.Errorf("requested GPU is not available: %w", err)
+// RestartNotebook creates userName's labspace again, keeping its volume.
+// A labspace StopNotebook stopped still exists, so it is resumed instead
+// and comes back as it was, without the password and resources given.
+func (s *Service) RestartNotebook(userName, password string, spec kubeutils.ResourceSpec, nodeSelector, labType, aiType string) (string, error) {
+	sts, err := s.kc.GetStatefulSet(s.namespace, userName)
+	if err != nil && !errors.Is(err, kubeutils.ErrNotFound) {
+		return "", err
+	}
+	if err == nil && stopped(sts) {
+		if err := s.ResumeNotebook(userName); err != nil {
+			return "", err
 		}
+		return "Notebook resumed", nil
 	}
+	return s.CreateNotebook(userName, password, spec, nodeSelector, labType, aiType)
+}
 
-	if available, err := kc.CheckMemoryAvailability(memoryRequest); err != nil || !available {
-		logrus.Errorf("memory check failed: %v", err)
-		return "", fmt.Errorf("requested memory is not available: %w", err)
+// on returns the service bound to cluster, in the namespace of the
+// service's tenant there.
+func (s *Service) on(cluster kubeutils.Cluster) (*Service, error) {
+	namespace, err := cluster.Kube.TenantNamespace(s.tenant, NotebookNamespace)
+	if err != nil {
+		return nil, err
+	}
+	svc := *s
+	svc.kc = cluster.Kube
+	svc.cluster = cluster.Name
+	svc.namespace = namespace
+	return &svc, nil
+}
+
+// owner is who a labspace of userName created by the service belongs to.
+func (s *Service) owner(userName string) kubeutils.Owner {
+	return kubeutils.Owner{User: userName, Team: s.tenant, Workload: kubeutils.WorkloadLabspace}
+}
+
+// placeNotebook returns the service bound to the first registered cluster
+// the labspace fits on.
+func (s *Service) placeNotebook(req CreateLabRequest) (*Service, error) {
+	res, err := kubeutils.ParseResources(req.resourceSpec(), ResourceDefaults(req.WorkSpaceType, req.LabspaceType))
+	if err != nil {
+		return nil, err
 	}
+	cluster, err := s.clusters.Place(kubeutils.ScheduleRequest{
+		Resources:  res.Requirements,
+		Containers: labContainers(req.LabspaceType),
+		GPU:        res.GPU,
+	}, req.NodeSelector)
+	if err != nil {
+		return nil, err
+	}
+	return s.on(cluster)
+}
 
-	if available, err := kc.CheckCpuAvailability(cpuRequest); err != nil || !available {
-		logrus.Errorf("CPU check failed: %v", err)
-		return "", fmt.Errorf("requested CPU is not available: %w", err)
+// labContainers is how many containers a labspace of aiType runs with the
+// requested resources each; agent labspaces run two.
+func labContainers(aiType string) int {
+	if aiType == AiTypeAgent {
+		return 2
 	}
+	return 1
+}
 
+// notebookSteps lists the reversible steps that make up a labspace. The
+// password is kept in the labspace's secret and read from there by its
+// containers, never written into the statefulset itself.
+func (s *Service) notebookSteps(userName, password string, res kubeutils.Resources, nodeSelector, labType, aiType string) []jobs.Step {
+	secretName := labspaceSecret(userName)
 	envVars := []apiv1.EnvVar{
 		{Name: EnvNotebookUser, Value: userName},
-		{Name: EnvPassword, Value: password},
+		kubeutils.SecretEnvVar(EnvPassword, secretName, SecretPasswordKey),
 		{Name: EnvGrantSudo, Value: "yes"},
 		{Name: EnvJupyterEnableLab, Value: "yes"},
 		{Name: EnvNbUID, Value: "1000"},
@@ -56,11 +159,66 @@ func CreateNotebook(userName, password, cpuRequest, gpuRequest, memoryRequest, c
 		{Name: EnvExperimentName, Value: userName},
 	}
 
-	kc.CreateNamespace(NotebookNamespace)
-	ingressRule := fmt.Sprintf("/%s", userName)
 	serviceName := fmt.Sprintf("%s%s", NotebookServicePrefix, userName)
-	kc.CreateService(NotebookNamespace, serviceName, userName, NotebookPort, apiv1.ServiceTypeNodePort)
-	resource := kubeutils.ConfigResource(cpuRequest, memoryRequest, cpuLimit, memoryLimit)
+	resource := res.Requirements
+	gpu := res.GPU
+	diskStorage := res.Disk.String()
+	containers := labContainers(aiType)
+
+	steps := []jobs.Step{
+		{Name: jobs.StepResourceCheck, Run: func(ctx context.Context) error {
+			result, err := s.kc.CanSchedule(kubeutils.ScheduleRequest{
+				Resources:    resource,
+				Containers:   containers,
+				GPU:          gpu,
+				NodeSelector: s.kc.WorkloadNodeSelector(nodeSelector),
+			})
+			if err != nil {
+				return err
+			}
+			return result.Err()
+		}},
+		{
+			Name: jobs.StepService,
+			Run: func(ctx context.Context) error {
+				if err := s.kc.EnsureNamespace(s.namespace, s.tenant); err != nil {
+					return err
+				}
+				return s.kc.CreateService(s.namespace, serviceName, userName, NotebookPort, apiv1.ServiceTypeNodePort)
+			},
+			Undo: func(ctx context.Context) error {
+				return s.kc.DeleteService(s.namespace, serviceName)
+			},
+		},
+		{
+			Name: jobs.StepSecret,
+			Run: func(ctx context.Context) error {
+				return s.kc.ApplySecret(s.namespace, secretName, map[string]string{SecretPasswordKey: password}, s.owner(userName))
+			},
+			Undo: func(ctx context.Context) error {
+				return s.kc.DeleteSecret(s.namespace, secretName)
+			},
+		},
+	}
+
+	if aiType == AiTypeAgent {
+		adkIngressRuleFrontend := fmt.Sprintf("%s%s", userName, AdkIngressFrontendSuffix)
+		envVarsAdk := []apiv1.EnvVar{
+			{Name: EnvNotebookUser, Value: userName},
+			kubeutils.SecretEnvVar(EnvPassword, secretName, SecretPasswordKey),
+			{Name: FrontEndPath, Value: "/" + adkIngressRuleFrontend},
+			{Name: FrontEndDomain, Value: WorkSpaceDomain},
+		}
+		env := [][]apiv1.EnvVar{envVars, envVarsAdk}
+		return append(steps,
+			s.statefulSetStep(userName, func() error {
+				return s.kc.CreateStatefulSetWithDualContainer(s.namespace, userName, serviceName, helper.AgentCodeServerImage, helper.ADKUIImage, gpu, NotebookPort, AdkPort, diskStorage, nodeSelector, resource, env, s.owner(userName))
+			}),
+			s.ingressRuleStep(serviceName, userName),
+			s.ingressRuleStep(serviceName, adkIngressRuleFrontend),
+			s.ingressRuleStep(serviceName, userName+AdkIngressBackendSuffix),
+		)
+	}
 
 	image := helper.CodeServerImage
 	switch aiType {
@@ -73,121 +231,482 @@ func CreateNotebook(userName, password, cpuRequest, gpuRequest, memoryRequest, c
 		default:
 			logrus.Warnf("unknown labType: %s, using default image", labType)
 		}
-		kc.CreateStatefulSet(NotebookNamespace, userName, serviceName, image, gpuSize, NotebookPort, diskStorage, nodeSelector, resource, envVars)
-		kc.AppendRuleToIngress(NotebookNamespace, labIngress, serviceName, ingressRule)
-	case AiTypeAgent:
-		adkIngressRuleFrontend := fmt.Sprintf("/%s%s", userName, AdkIngressFrontendSuffix)
-		adkIngressRuleBackend := fmt.Sprintf("/%s%s", userName, AdkIngressBackendSuffix)
-		kc.AppendRuleToIngress(NotebookNamespace, labIngress, serviceName, ingressRule)
-		imagecodeserver := helper.AgentCodeServerImage
-		imageAdk := helper.ADKUIImage
-		envVarsAdk := []apiv1.EnvVar{
-			{Name: EnvNotebookUser, Value: userName},
-			{Name: EnvPassword, Value: password},
-			{Name: FrontEndPath, Value: adkIngressRuleFrontend},
-			{Name: FrontEndDomain, Value: WorkSpaceDomain},
-		}
-		kc.AppendRuleToIngress(NotebookNamespace, labIngress, serviceName, adkIngressRuleFrontend)
-		env := [][]apiv1.EnvVar{envVars, envVarsAdk}
-		kc.CreateStatefulSetWithDualContainer(NotebookNamespace, userName, serviceName, imagecodeserver, imageAdk, gpuSize, NotebookPort, AdkPort, diskStorage, nodeSelector, resource, env)
-		kc.AppendRuleToIngress(NotebookNamespace, labIngress, serviceName, adkIngressRuleBackend)
-
 	default:
 		logrus.Warnf("unknown aiType: %s, using default image", aiType)
-		kc.CreateStatefulSet(NotebookNamespace, userName, serviceName, image, gpuSize, NotebookPort, diskStorage, nodeSelector, resource, envVars)
-		kc.AppendRuleToIngress(NotebookNamespace, labIngress, serviceName, ingressRule)
 	}
+	return append(steps,
+		s.statefulSetStep(userName, func() error {
+			return s.kc.CreateStatefulSet(s.namespace, userName, serviceName, image, gpu, NotebookPort, diskStorage, nodeSelector, resource, envVars, s.owner(userName))
+		}),
+		s.ingressRuleStep(serviceName, userName),
+	)
+}
 
-	return "Notebook created successfully", nil
+// statefulSetStep runs create and, when undone, removes the statefulset
+// together with the volume claim it may already have provisioned.
+func (s *Service) statefulSetStep(userName string, create func() error) jobs.Step {
+	return jobs.Step{
+		Name: jobs.StepDeployment,
+		Run:  func(ctx context.Context) error { return create() },
+		Undo: func(ctx context.Context) error {
+			if err := s.kc.DeleteStatefulSet(s.namespace, userName); err != nil {
+				return err
+			}
+			pvcName := fmt.Sprintf("%s%s%s", PersistentVolumePrefix, userName, PersistentVolumeSuffix)
+			exists, err := s.kc.ClaimExists(s.namespace, pvcName)
+			if err != nil || !exists {
+				return err
+			}
+			return s.kc.DeletePersistentVolume(s.namespace, pvcName)
+		},
+	}
+}
+
+// templateStep downloads template into the labspace's volume. It has
+// nothing to undo: the volume goes with the statefulset.
+func (s *Service) templateStep(template enginetemplate.Template, gitToken string) jobs.Step {
+	return jobs.Step{Name: stepTemplate, Run: func(ctx context.Context) error {
+		if err := s.templates.Download(template, gitToken); err != nil {
+			return fmt.Errorf("downloading template %s@%s: %w", template.TemplateBaseURL, template.TemplateVersion, err)
+		}
+		return nil
+	}}
+}
+
+// ingressRuleStep routes /rule on the lab ingress to serviceName.
+func (s *Service) ingressRuleStep(serviceName, rule string) jobs.Step {
+	return jobs.Step{
+		Name: jobs.StepIngress,
+		Run: func(ctx context.Context) error {
+			err := s.appendIngressRule(serviceName, "/"+rule)
+			if errors.Is(err, kubeutils.ErrNotFound) {
+				// The lab ingress is part of the cluster setup, so its
+				// absence is a server fault rather than a missing resource
+				// the client asked for.
+				return fmt.Errorf("lab ingress %s is missing: %v", labIngress, err)
+			}
+			if err != nil {
+				return fmt.Errorf("adding ingress rule /%s: %w", rule, err)
+			}
+			return nil
+		},
+		Undo: func(ctx context.Context) error {
+			return s.kc.DeleteRuleFromIngress(s.namespace, rule, labIngress)
+		},
+	}
+}
+
+// appendIngressRule routes path to serviceName on the lab ingress. A tenant
+// namespace gets its own lab ingress, modelled on the one in
+// NotebookNamespace, the first time a labspace is created in it.
+func (s *Service) appendIngressRule(serviceName, path string) error {
+	if s.namespace == NotebookNamespace {
+		return s.kc.AppendRuleToIngress(s.namespace, labIngress, serviceName, path)
+	}
+	return s.kc.AppendRuleToIngressFrom(s.namespace, NotebookNamespace, labIngress, serviceName, path)
+}
+
+// DeleteNotebook removes the labspace together with its volume and its
+// secret, whether it is running or stopped. Every resource is attempted;
+// the failures are joined in the returned error.
+func (s *Service) DeleteNotebook(userName string) error {
+	var errs []error
+	if err := s.kc.DeleteSecret(s.namespace, labspaceSecret(userName)); err != nil {
+		logrus.Errorf("failed to delete secret of labspace %s: %v", userName, err)
+		errs = append(errs, err)
+	}
+	pvcName := fmt.Sprintf("%s%s%s", PersistentVolumePrefix, userName, PersistentVolumeSuffix)
+	exists, err := s.kc.ClaimExists(s.namespace, pvcName)
+	if err == nil && exists {
+		err = s.kc.DeletePersistentVolume(s.namespace, pvcName)
+	}
+	if err != nil {
+		logrus.Errorf("failed to delete persistent volume %s: %v", pvcName, err)
+		errs = append(errs, err)
+	}
+	return errors.Join(append(errs, s.removeNotebook(userName))...)
+}
+
+// StopNotebook scales the labspace down to no pods, recording when, why
+// and how many it had. Its statefulset, service, ingress rules, volume and
+// secret stay as they are, so ResumeNotebook brings it back exactly as it
+// was. Stopping a stopped labspace keeps its first stop's record.
+func (s *Service) StopNotebook(userName, reason string) error {
+	sts, err := s.kc.GetStatefulSet(s.namespace, userName)
+	if err != nil {
+		return err
+	}
+	if stopped(sts) {
+		return nil
+	}
+	replicas := int32(1)
+	if sts.Spec.Replicas != nil {
+		replicas = *sts.Spec.Replicas
+	}
+	return s.kc.ScaleStatefulSet(s.namespace, userName, 0, map[string]string{
+		StoppedAtAnnotation:  time.Now().UTC().Format(time.RFC3339),
+		StopReasonAnnotation: reason,
+		ReplicasAnnotation:   strconv.Itoa(int(replicas)),
+	})
+}
+
+// ResumeNotebook scales a stopped labspace back to the pods it had, once
+// they are known to fit the quotas of its user and team and the cluster.
+func (s *Service) ResumeNotebook(userName string) error {
+	sts, err := s.kc.GetStatefulSet(s.namespace, userName)
+	if err != nil {
+		return err
+	}
+	if !stopped(sts) {
+		return &kubeutils.Error{Op: "resume", Resource: "labspace", Name: userName, Kind: kubeutils.ErrConflict, Err: errors.New("labspace is not stopped")}
+	}
+	replicas, err := strconv.Atoi(sts.Annotations[ReplicasAnnotation])
+	if err != nil || replicas < 1 {
+		replicas = 1
+	}
+
+	spec := sts.Spec.Template.Spec
+	usage, err := s.kc.PodUsage(spec)
+	if err != nil {
+		return err
+	}
+	n := int64(replicas)
+	add := kubeutils.QuotaUsage{CPUMillicores: usage.CPUMillicores * n, MemoryBytes: usage.MemoryBytes * n, GPUs: usage.GPUs * n}
+	release, err := s.clusters.ReserveQuota(kubeutils.QuotaRequest{Owner: s.owner(userName), Add: add})
+	if err != nil {
+		return err
+	}
+	defer release()
+	result, err := s.kc.CanSchedule(kubeutils.TemplateScheduleRequest(spec))
+	if err != nil {
+		return err
+	}
+	if err := result.Err(); err != nil {
+		return err
+	}
+	return s.kc.ScaleStatefulSet(s.namespace, userName, int32(replicas), map[string]string{
+		StoppedAtAnnotation:  "",
+		StopReasonAnnotation: "",
+		ReplicasAnnotation:   "",
+	})
 }
 
-func DeleteNotebook(userName string) error {
+// stopped reports whether StopNotebook scaled sts down.
+func stopped(sts *appsv1.StatefulSet) bool {
+	_, ok := sts.Annotations[StoppedAtAnnotation]
+	return ok && sts.Spec.Replicas != nil && *sts.Spec.Replicas == 0
+}
+
+// rolloutTimeout is how long a resize waits for the labspace's pods to be
+// replaced and ready.
+const rolloutTimeout = 10 * time.Minute
+
+// ResizeNotebook returns the steps that give userName's labspace the
+// resources in spec, keeping the ones spec leaves empty. The new size is
+// checked against the quotas of the user and team, and held against them
+// until the steps finish, and for a running labspace against the room on
+// the cluster, before any step is returned, with the labspace's current
+// size left out of both. The steps grow its volume when spec asks for more
+// disk, update its pod template and wait for the statefulset to replace its
+// pods one at a time; the volume, and the workspace on it, is kept across
+// the restart. A stopped labspace is resized in place and starts with the
+// new size when resumed.
+func (s *Service) ResizeNotebook(userName string, spec kubeutils.ResourceSpec) ([]jobs.Step, error) {
+	sts, err := s.kc.GetStatefulSet(s.namespace, userName)
+	if err != nil {
+		return nil, err
+	}
+	podSpec := sts.Spec.Template.Spec
+	current, err := s.kc.TemplateResources(podSpec)
+	if err != nil {
+		return nil, err
+	}
+	old, err := kubeutils.ParseResources(current, kubeutils.ResourceSpec{})
+	if err != nil {
+		// Not the client's fields at fault, so not reported against them.
+		return nil, fmt.Errorf("reading the resources of labspace %s: %v", userName, err)
+	}
 	pvcName := fmt.Sprintf("%s%s%s", PersistentVolumePrefix, userName, PersistentVolumeSuffix)
-	if kc.PersistentVolumeExists(NotebookNamespace, pvcName) {
-		if err := kc.DeletePersistentVolume(NotebookNamespace, pvcName); err != nil {
-			logrus.Errorf("failed to delete persistent volume %s: %v", pvcName, err)
+	disk, err := s.kc.ClaimSize(s.namespace, pvcName)
+	if err != nil {
+		return nil, err
+	}
+	current.DiskStorage = disk.String()
+	res, err := kubeutils.ParseResources(spec, current)
+	if err != nil {
+		return nil, err
+	}
+	expand, err := s.kc.ClaimNeedsExpansion(s.namespace, pvcName, res.Disk)
+	if err != nil {
+		return nil, err
+	}
+
+	replicas := int64(1)
+	if sts.Spec.Replicas != nil {
+		replicas = int64(*sts.Spec.Replicas)
+	}
+	usage := kubeutils.WorkloadUsage(res.Requirements, res.GPU, len(podSpec.Containers))
+	add := kubeutils.QuotaUsage{
+		CPUMillicores: usage.CPUMillicores * replicas,
+		MemoryBytes:   usage.MemoryBytes * replicas,
+		GPUs:          usage.GPUs * replicas,
+		DiskBytes:     res.Disk.Value(),
+		Labspaces:     1,
+	}
+	release, err := s.clusters.ReserveQuota(kubeutils.QuotaRequest{
+		Owner:    s.owner(userName),
+		Add:      add,
+		Replaces: []kubeutils.WorkloadRef{{Cluster: s.cluster, Namespace: s.namespace, Name: userName}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if replicas > 0 {
+		req := kubeutils.TemplateScheduleRequest(podSpec)
+		req.Resources = res.Requirements
+		req.GPU = res.GPU
+		for i := int64(0); i < replicas; i++ {
+			req.Replaces = append(req.Replaces, fmt.Sprintf("%s/%s-%d", s.namespace, userName, i))
+		}
+		result, err := s.kc.CanSchedule(req)
+		if err == nil {
+			err = result.Err()
+		}
+		if err != nil {
+			release()
+			return nil, err
 		}
 	}
 
-	serviceName := fmt.Sprintf("%s%s", NotebookServicePrefix, userName)
-	adkServiceName := fmt.Sprintf("%s%s", AdkServicePrifix, userName)
-	adkIngressRule := fmt.Sprintf("%s%s", userName, AdkIngressSuffix)
-	kc.DeleteService(NotebookNamespace, serviceName)
-	if kc.ServiceExists(NotebookNamespace, adkServiceName) {
-		kc.DeleteService(NotebookNamespace, adkServiceName)
-		kc.DeleteRuleFromIngress(NotebookNamespace, adkIngressRule, labIngress)
+	var steps []jobs.Step
+	if expand {
+		steps = append(steps, jobs.Step{Name: jobs.StepPVC, Run: func(ctx context.Context) error {
+			return s.kc.ExpandClaim(s.namespace, pvcName, res.Disk)
+		}})
 	}
-	kc.DeleteStatefulSet(NotebookNamespace, userName)
-	kc.DeleteRuleFromIngress(NotebookNamespace, userName, labIngress)
-	return nil
+	steps = append(steps, jobs.Step{
+		Name: jobs.StepDeployment,
+		Run: func(ctx context.Context) error {
+			return s.kc.ResizeStatefulSet(s.namespace, userName, res.Requirements, res.GPU)
+		},
+		Undo: func(ctx context.Context) error {
+			return s.kc.ResizeStatefulSet(s.namespace, userName, old.Requirements, old.GPU)
+		},
+	})
+	if replicas > 0 {
+		steps = append(steps, jobs.Step{Name: jobs.StepRollout, Run: func(ctx context.Context) error {
+			ctx, cancel := context.WithTimeout(ctx, rolloutTimeout)
+			defer cancel()
+			return s.kc.WaitForStatefulSet(ctx, s.namespace, userName)
+		}})
+	}
+	return jobs.Finally(steps, release), nil
 }
-func StopNotebook(userName string) error {
 
+// removeNotebook removes the labspace's statefulset, services and ingress
+// rules, leaving its volume and its secret in place.
+func (s *Service) removeNotebook(userName string) error {
+	var errs []error
 	serviceName := fmt.Sprintf("%s%s", NotebookServicePrefix, userName)
 	adkServiceName := fmt.Sprintf("%s%s", AdkServicePrifix, userName)
 	adkIngressRule := fmt.Sprintf("%s%s", userName, AdkIngressSuffix)
-	kc.DeleteService(NotebookNamespace, serviceName)
-	if kc.ServiceExists(NotebookNamespace, adkServiceName) {
-		kc.DeleteService(NotebookNamespace, adkServiceName)
-		kc.DeleteRuleFromIngress(NotebookNamespace, adkIngressRule, labIngress)
+	errs = append(errs, s.kc.DeleteService(s.namespace, serviceName))
+	if s.kc.ServiceExists(s.namespace, adkServiceName) {
+		errs = append(errs,
+			s.kc.DeleteService(s.namespace, adkServiceName),
+			s.kc.DeleteRuleFromIngress(s.namespace, adkIngressRule, labIngress),
+		)
+	}
+	errs = append(errs,
+		s.kc.DeleteStatefulSet(s.namespace, userName),
+		s.kc.DeleteRuleFromIngress(s.namespace, userName, labIngress),
+	)
+	return errors.Join(errs...)
+}
+
+// RotatePassword replaces the password of userName's labspace and rolls its
+// pods so they pick it up. The labspace keeps its volume and address; one
+// created before passwords were kept in secrets is switched over to its
+// secret by the same rollout.
+func (s *Service) RotatePassword(userName, password string) error {
+	if _, err := s.kc.GetStatefulSet(s.namespace, userName); err != nil {
+		return err
+	}
+	secretName := labspaceSecret(userName)
+	if err := s.kc.ApplySecret(s.namespace, secretName, map[string]string{SecretPasswordKey: password}, s.owner(userName)); err != nil {
+		return err
 	}
-	kc.DeleteStatefulSet(NotebookNamespace, userName)
-	kc.DeleteRuleFromIngress(NotebookNamespace, userName, labIngress)
-	return nil
+	return s.kc.RestartStatefulSet(s.namespace, userName, kubeutils.SecretEnvVar(EnvPassword, secretName, SecretPasswordKey))
 }
 
-func ListNotebooks() ([]map[string]string, error) {
-	return kc.ListPods(NotebookNamespace)
+// SetGitToken stores the git token the templates of userName's labspaces
+// are cloned with.
+func (s *Service) SetGitToken(userName, token string) error {
+	if err := s.kc.EnsureNamespace(s.namespace, s.tenant); err != nil {
+		return err
+	}
+	owner := kubeutils.Owner{User: userName, Team: s.tenant}
+	return s.kc.ApplySecret(s.namespace, GitCredentialsPrefix+userName, map[string]string{SecretTokenKey: token}, owner)
+}
+
+// DeleteGitToken removes userName's stored git token, so their templates
+// are cloned with the server's token again.
+func (s *Service) DeleteGitToken(userName string) error {
+	return s.kc.DeleteSecret(s.namespace, GitCredentialsPrefix+userName)
+}
+
+// gitToken is the token userName's templates are cloned with: their own
+// when they have stored one, the server's otherwise.
+func (s *Service) gitToken(userName string) (string, error) {
+	token, err := s.kc.GetSecretValue(s.namespace, GitCredentialsPrefix+userName, SecretTokenKey)
+	if errors.Is(err, kubeutils.ErrNotFound) {
+		return os.Getenv(GitTokenEnv), nil
+	}
+	return token, err
+}
+
+// labspaceSecret is the name of the secret holding userName's labspace
+// password.
+func labspaceSecret(userName string) string {
+	return LabspaceSecretPrefix + userName
+}
+
+// ListNotebooks returns the details of the pod of every running labspace
+// followed by the labspaces that are stopped, which have none.
+func (s *Service) ListNotebooks() ([]map[string]string, error) {
+	notebooks, err := s.kc.ListPods(s.namespace)
+	if err != nil {
+		return nil, err
+	}
+	statefulSets, err := s.kc.ListStatefulSets(s.namespace)
+	if err != nil {
+		return nil, err
+	}
+	listed := make(map[string]bool, len(notebooks))
+	for _, nb := range notebooks {
+		listed[nb["name"]] = true
+	}
+	for _, sts := range statefulSets {
+		// A pod still shutting down is listed in its place.
+		if stopped(sts) && !listed[sts.Name+PersistentVolumeSuffix] {
+			notebooks = append(notebooks, stoppedNotebook(sts))
+		}
+	}
+	return notebooks, nil
+}
+
+// GetOneNotebook returns the details of the labspace's pod or, once it is
+// stopped, when and why it was stopped.
+func (s *Service) GetOneNotebook(notebook string) (map[string]string, error) {
+	detail, err := s.kc.GetPodDetail(notebook, s.namespace)
+	if err != nil || len(detail) > 0 {
+		return detail, err
+	}
+	sts, err := s.kc.GetStatefulSet(s.namespace, notebook)
+	if err != nil || !stopped(sts) {
+		// Without a pod or a stop record there is nothing more to report.
+		return detail, nil
+	}
+	return stoppedNotebook(sts), nil
 }
 
-func GetOneNotebook(notebook string) (map[string]string, error) {
-	return kc.GetPodDetail(notebook, NotebookNamespace)
+// stoppedNotebook describes the stopped labspace sts in the form of a pod's
+// details, with when and why it was stopped.
+func stoppedNotebook(sts *appsv1.StatefulSet) map[string]string {
+	return map[string]string{
+		"name":       sts.Name,
+		"ready":      "0/0",
+		"status":     StatusStopped,
+		"restarts":   "0",
+		"stoppedAt":  sts.Annotations[StoppedAtAnnotation],
+		"stopReason": sts.Annotations[StopReasonAnnotation],
+	}
 }
 
-func CloneArtifactsNotebook(req CloneNotebookRequest) (string, error) {
+// Names of the labspace-specific steps of a clone-artifacts job, and of
+// the template download that ends a labspace's creation.
+const (
+	stepNotebook   = "notebook"
+	stepVolumeWait = "volume"
+	stepTemplate   = "template"
+)
+
+// A clone polls every volumePollInterval, for up to volumeWaitTimeout, for the
+// new labspace's volume to be mounted.
+const (
+	volumeWaitTimeout  = 2 * time.Minute
+	volumePollInterval = time.Second
+)
+
+// CloneArtifactsNotebook checks that the source model exists and returns the
+// steps that create the labspace and copy the selected artifacts into it.
+func (s *Service) CloneArtifactsNotebook(req CloneNotebookRequest) ([]jobs.Step, error) {
 
-	fs := afero.NewOsFs()
 	normalizedVersion := strings.ReplaceAll(req.Version, ".", "-")
 	src := fmt.Sprintf("%s%s/%s-%s", ModelRegistryPathPrefix, req.BaseUsername, req.ModelName, normalizedVersion)
 
-	if exists, err := afero.DirExists(fs, src); err != nil {
+	if exists, err := afero.DirExists(s.fs, src); err != nil {
 		log.Error("error checking source directory: ", err)
-		return "", fmt.Errorf("error checking source directory: %w", err)
+		return nil, fmt.Errorf("error checking source directory: %w", err)
 	} else if !exists {
 		log.Error("source directory does not exist: ", src)
-		return "", fmt.Errorf("source directory does not exist: %s", src)
+		return nil, &kubeutils.Error{Op: "clone", Resource: "model", Name: req.ModelName, Kind: kubeutils.ErrNotFound, Err: fmt.Errorf("source directory %s does not exist", src)}
 	}
 
-	message, err := CreateNotebook(
-		req.Username, req.Password, req.CPURequest, req.GPURequest, req.MemoryRequest,
-		req.CPULimit, req.MemoryLimit, req.DiskStorage, req.NodeSelector,
-		req.WorkSpaceType, req.LabspaceType,
-	)
-
-	if err != nil {
-		log.Error("error creating notebook: ", err)
-		return "", fmt.Errorf("error creating notebook: %w", err)
-	}
-
-	time.Sleep(6 * time.Second)
 	dst := fmt.Sprintf("%s%s%s", ArtifactPathPrefix, PersistentVolumePrefix, req.Username+PersistentVolumeSuffix)
 
-	if exists, err := afero.DirExists(fs, dst); err != nil {
-		log.Error("error checking destination directory: ", err)
-		return "", fmt.Errorf("error checking destination directory: %w", err)
-	} else if exists {
-		if _, err := artifacts.CloneSelectedArtifacts(src, dst, req.SelectedArtifacts); err != nil {
-
-			if delErr := DeleteNotebook(req.Username); delErr != nil {
-				logrus.Errorf("failed to clean up notebook after artifact cloning error: %v", delErr)
+	steps := []jobs.Step{
+		{
+			Name: stepNotebook,
+			Run: func(ctx context.Context) error {
+				_, err := s.CreateNotebook(
+					req.Username, req.Password, req.resourceSpec(), req.NodeSelector,
+					req.WorkSpaceType, req.LabspaceType,
+				)
+				if err != nil {
+					return fmt.Errorf("error creating notebook: %w", err)
+				}
+				return nil
+			},
+			Undo: func(ctx context.Context) error {
+				return s.DeleteNotebook(req.Username)
+			},
+		},
+		{Name: stepVolumeWait, Run: func(ctx context.Context) error {
+			return s.waitForDir(ctx, dst, volumeWaitTimeout)
+		}},
+		{Name: jobs.StepCopy, Run: func(ctx context.Context) error {
+			if _, err := artifacts.CloneSelectedArtifacts(s.fs, src, dst, req.SelectedArtifacts); err != nil {
+				return fmt.Errorf("error cloning artifacts: %w", err)
 			}
-			return "", fmt.Errorf("error cloning artifacts: %w", err)
-		}
+			return nil
+		}},
 	}
+	return steps, nil
+}
 
-	return message, nil
+// waitForDir polls until dir exists, ctx ends or timeout passes.
+func (s *Service) waitForDir(ctx context.Context, dir string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	ticker := time.NewTicker(volumePollInterval)
+	defer ticker.Stop()
+	for {
+		exists, err := afero.DirExists(s.fs, dir)
+		if err != nil {
+			return fmt.Errorf("error checking destination directory: %w", err)
+		}
+		if exists {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("labspace volume %s was not mounted in time: %w", dir, ctx.Err())
+		case <-ticker.C:
+		}
+	}
 }
 
-func GetLabspacesMetrics() ([]kubeutils.PodMetrics, error) {
-	return kc.GetPodMetric(NotebookNamespace)
+func (s *Service) GetLabspacesMetrics() ([]kubeutils.PodMetrics, error) {
+	return s.kc.GetPodMetric(s.namespace)
 }
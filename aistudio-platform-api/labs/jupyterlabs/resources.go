@@ -0,0 +1,47 @@
+package JupyterLabs
+
+import "Kubernetes-api/kubeutils"
+
+// labResources are what a labspace gets, by workspace type, for whatever its
+// request leaves empty.
+var labResources = map[string]kubeutils.ResourceSpec{
+	LabTypeJupyterlab: {
+		CPURequest:    "500m",
+		MemoryRequest: "1Gi",
+		CPULimit:      "2",
+		MemoryLimit:   "4Gi",
+		GPU:           "0",
+		DiskStorage:   "10Gi",
+	},
+	LabTypeCodeServer: {
+		CPURequest:    "250m",
+		MemoryRequest: "512Mi",
+		CPULimit:      "2",
+		MemoryLimit:   "2Gi",
+		GPU:           "0",
+		DiskStorage:   "10Gi",
+	},
+}
+
+// agentResources replace labResources for agent labspaces, which run the ADK
+// UI next to the editor.
+var agentResources = kubeutils.ResourceSpec{
+	CPURequest:    "1",
+	MemoryRequest: "2Gi",
+	CPULimit:      "4",
+	MemoryLimit:   "8Gi",
+	GPU:           "0",
+	DiskStorage:   "20Gi",
+}
+
+// ResourceDefaults returns the resources used for any field a labspace
+// request leaves empty. Unknown workspace types get the JupyterLab defaults.
+func ResourceDefaults(labType, aiType string) kubeutils.ResourceSpec {
+	if aiType == AiTypeAgent {
+		return agentResources
+	}
+	if spec, ok := labResources[labType]; ok {
+		return spec
+	}
+	return labResources[LabTypeJupyterlab]
+}
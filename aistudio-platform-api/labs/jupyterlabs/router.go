@@ -4,16 +4,25 @@ import (
 	"github.com/gofiber/fiber/v2"
 )
 
-func SetupRoutes(router fiber.Router) {
+func SetupRoutes(router fiber.Router, svc *Service) {
 	notebooks := router.Group("/notebooks")
-	notebooks.Post("/", CreateNotebooks)
-	notebooks.Post("/restart", RestartNotebooks)
-	notebooks.Post("/clone-artifacts", CloneArtifactsCreateNotebook)
-	notebooks.Get("/", GetNotebooks)
-	notebooks.Get("/sse", GetNotebooksSse)
-	notebooks.Get("/metrics", GetLabsMetrics)
-	notebooks.Get("/preview", LabFilesPreview)
-	notebooks.Get("/:id", GetOneNotebookHandler)
-	notebooks.Delete("/stop/:id", StopNotebookHandler)
-	notebooks.Delete("/:id", DeleteNotebookHandler)
+	notebooks.Post("/", svc.CreateNotebooks)
+	notebooks.Post("/restart", svc.RestartNotebooks)
+	notebooks.Post("/clone-artifacts", svc.CloneArtifactsCreateNotebook)
+	notebooks.Get("/", svc.GetNotebooks)
+	notebooks.Get("/sse", svc.GetNotebooksSse)
+	notebooks.Get("/metrics", svc.GetLabsMetrics)
+	notebooks.Get("/preview", svc.LabFilesPreview)
+	notebooks.Get("/culling", svc.GetCullingHandler)
+	notebooks.Get("/culling/sse", svc.GetCullingSse)
+	notebooks.Put("/git-credentials/:user", svc.SetGitCredentialsHandler)
+	notebooks.Delete("/git-credentials/:user", svc.DeleteGitCredentialsHandler)
+	notebooks.Get("/:id", svc.GetOneNotebookHandler)
+	notebooks.Patch("/:id", svc.ResizeNotebookHandler)
+	notebooks.Put("/:id/password", svc.RotatePasswordHandler)
+	notebooks.Post("/:id/resume", svc.ResumeNotebookHandler)
+	notebooks.Put("/:id/schedule", svc.SetScheduleHandler)
+	notebooks.Delete("/:id/schedule", svc.DeleteScheduleHandler)
+	notebooks.Delete("/stop/:id", svc.StopNotebookHandler)
+	notebooks.Delete("/:id", svc.DeleteNotebookHandler)
 }
\ No newline at end of file
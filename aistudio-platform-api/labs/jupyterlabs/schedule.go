@@ -0,0 +1,264 @@
+package JupyterLabs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2/log"
+	appsv1 "k8s.io/api/apps/v1"
+
+	"Kubernetes-api/helper"
+	"Kubernetes-api/internal/cron"
+	"Kubernetes-api/kubeutils"
+)
+
+// ScheduleInterval is how often the scheduler looks for labspaces due to
+// stop or start. Cron expressions name minutes, so a finer interval gains
+// nothing.
+const ScheduleInterval = time.Minute
+
+// LabSchedule is when a labspace is stopped and started again. Stop and
+// Start are five-field cron expressions, either of which may be left out;
+// they are read in TimeZone, an IANA name such as Europe/Berlin, or in UTC
+// when it is empty.
+type LabSchedule struct {
+	Stop     string `json:"stop,omitempty"`
+	Start    string `json:"start,omitempty"`
+	TimeZone string `json:"timeZone,omitempty"`
+}
+
+func (r LabSchedule) Validate() error {
+	var v helper.Validator
+	if r.Stop == "" && r.Start == "" {
+		v.Fail("", "a stop or a start schedule is required")
+	}
+	for _, f := range []struct{ field, value string }{{"stop", r.Stop}, {"start", r.Start}} {
+		if f.value == "" {
+			continue
+		}
+		if _, err := cron.Parse(f.value); err != nil {
+			v.Fail(f.field, "%v", err)
+		}
+	}
+	if _, err := time.LoadLocation(r.TimeZone); err != nil {
+		v.Fail("timeZone", "is not a known time zone such as Europe/Berlin")
+	}
+	return v.Err()
+}
+
+// compiled is a LabSchedule ready to be evaluated. A nil stop or start
+// never fires.
+type compiled struct {
+	stop, start *cron.Schedule
+	loc         *time.Location
+}
+
+func (r LabSchedule) compile() (compiled, error) {
+	var c compiled
+	var err error
+	if c.loc, err = time.LoadLocation(r.TimeZone); err != nil {
+		return c, fmt.Errorf("schedule time zone: %w", err)
+	}
+	for _, f := range []struct {
+		spec string
+		out  **cron.Schedule
+	}{{r.Stop, &c.stop}, {r.Start, &c.start}} {
+		if f.spec == "" {
+			continue
+		}
+		s, err := cron.Parse(f.spec)
+		if err != nil {
+			return c, err
+		}
+		*f.out = &s
+	}
+	return c, nil
+}
+
+// next is the first time after t that s fires, or nil if it never does.
+func (c compiled) next(s *cron.Schedule, t time.Time) *time.Time {
+	if s == nil {
+		return nil
+	}
+	n := s.Next(t.In(c.loc))
+	if n.IsZero() {
+		return nil
+	}
+	return &n
+}
+
+// last is the last time in (since, now] that s fired, or the zero time if
+// it did not.
+func (c compiled) last(s *cron.Schedule, since, now time.Time) time.Time {
+	var last time.Time
+	for t := c.next(s, since); t != nil && !t.After(now); t = c.next(s, *t) {
+		last = *t
+	}
+	return last
+}
+
+// ScheduleStatus is a labspace's schedule with the next times it fires.
+type ScheduleStatus struct {
+	LabSchedule
+	NextStop  *time.Time `json:"nextStop,omitempty"`
+	NextStart *time.Time `json:"nextStart,omitempty"`
+}
+
+func scheduleStatus(sched LabSchedule, now time.Time) (*ScheduleStatus, error) {
+	c, err := sched.compile()
+	if err != nil {
+		return nil, err
+	}
+	return &ScheduleStatus{LabSchedule: sched, NextStop: c.next(c.stop, now), NextStart: c.next(c.start, now)}, nil
+}
+
+// labSchedule reads the schedule stored on sts. ok is false when it has
+// none.
+func labSchedule(sts *appsv1.StatefulSet) (sched LabSchedule, ok bool, err error) {
+	raw, ok := sts.Annotations[ScheduleAnnotation]
+	if !ok {
+		return sched, false, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &sched); err != nil {
+		return sched, true, fmt.Errorf("reading schedule of labspace %s: %w", sts.Name, err)
+	}
+	return sched, true, nil
+}
+
+// SetSchedule stores sched on userName's labspace, replacing the schedule
+// it had, and returns when it next fires.
+func (s *Service) SetSchedule(userName string, sched LabSchedule) (*ScheduleStatus, error) {
+	status, err := scheduleStatus(sched, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	raw, err := json.Marshal(sched)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.kc.AnnotateStatefulSet(s.namespace, userName, map[string]string{ScheduleAnnotation: string(raw)}); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// DeleteSchedule removes the schedule of userName's labspace, leaving it
+// running or stopped as it is.
+func (s *Service) DeleteSchedule(userName string) error {
+	return s.kc.AnnotateStatefulSet(s.namespace, userName, map[string]string{ScheduleAnnotation: ""})
+}
+
+// GetSchedule returns the schedule of userName's labspace, or nil when it
+// has none.
+func (s *Service) GetSchedule(userName string) (*ScheduleStatus, error) {
+	sts, err := s.kc.GetStatefulSet(s.namespace, userName)
+	if err != nil {
+		return nil, err
+	}
+	sched, ok, err := labSchedule(sts)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return scheduleStatus(sched, time.Now())
+}
+
+// Scheduler stops and starts labspaces on every cluster when their
+// schedules say. Each tick acts on the schedule times since the previous
+// one; times that passed while the API was not running are not caught up
+// on. When a stop and a start both passed, the later one wins.
+type Scheduler struct {
+	svc *Service
+
+	mu   sync.Mutex
+	last time.Time
+}
+
+// NewScheduler returns a scheduler for the labspaces of svc.
+func NewScheduler(svc *Service) *Scheduler {
+	return &Scheduler{svc: svc}
+}
+
+// Run ticks every ScheduleInterval until ctx is done.
+func (s *Scheduler) Run(ctx context.Context) {
+	s.Tick(ctx, time.Now())
+	ticker := time.NewTicker(ScheduleInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.Tick(ctx, time.Now()); err != nil {
+				log.Errorf("running labspace schedules: %v", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Tick stops and starts the labspaces whose schedules fired since the
+// previous tick, up to now. The first tick only marks where the next one
+// starts. A labspace that cannot be stopped or started is left as it is
+// until its schedule next fires; the failures are joined in the returned
+// error.
+func (s *Scheduler) Tick(ctx context.Context, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	since := s.last
+	s.last = now
+	if since.IsZero() {
+		return nil
+	}
+
+	var errs []error
+	for _, cluster := range s.svc.clusters.All() {
+		labs, err := listLabspaces(cluster.Kube)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("cluster %s: %w", cluster.Name, err))
+			continue
+		}
+		for _, sts := range labs {
+			if err := s.apply(cluster, sts, since, now); err != nil {
+				errs = append(errs, fmt.Errorf("labspace %s on cluster %s: %w", sts.Name, cluster.Name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// apply stops or starts sts if its schedule fired in (since, now].
+func (s *Scheduler) apply(cluster kubeutils.Cluster, sts *appsv1.StatefulSet, since, now time.Time) error {
+	sched, ok, err := labSchedule(sts)
+	if err != nil || !ok {
+		return err
+	}
+	c, err := sched.compile()
+	if err != nil {
+		return err
+	}
+	stopAt, startAt := c.last(c.stop, since, now), c.last(c.start, since, now)
+	svc := s.svc.boundTo(cluster, sts)
+	switch {
+	case !stopAt.IsZero() && !stopAt.Before(startAt):
+		if sts.Spec.Replicas != nil && *sts.Spec.Replicas == 0 {
+			return nil
+		}
+		reason := fmt.Sprintf("stopped by schedule %q (%s)", sched.Stop, c.loc)
+		if err := svc.StopNotebook(sts.Name, reason); err != nil {
+			return fmt.Errorf("stopping on schedule: %w", err)
+		}
+		log.Infof("stopped labspace %s on schedule", cullKey(cluster.Name, sts.Namespace, sts.Name))
+	case !startAt.IsZero():
+		if !stopped(sts) {
+			return nil
+		}
+		if err := svc.ResumeNotebook(sts.Name); err != nil {
+			return fmt.Errorf("starting on schedule: %w", err)
+		}
+		log.Infof("started labspace %s on schedule", cullKey(cluster.Name, sts.Namespace, sts.Name))
+	}
+	return nil
+}
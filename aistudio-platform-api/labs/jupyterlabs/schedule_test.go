@@ -0,0 +1,126 @@
+package JupyterLabs_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"Kubernetes-api/internal/kubetest"
+	JupyterLabs "Kubernetes-api/labs/jupyterlabs"
+
+	"github.com/gofiber/fiber/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// newScheduledLab creates alice's running labspace and returns the app and
+// a scheduler over the same service.
+func newScheduledLab(t *testing.T) (*kubetest.Harness, *fiber.App, *JupyterLabs.Scheduler) {
+	t.Helper()
+	h := kubetest.New(
+		kubetest.Node("node-a", "8", "32Gi", ""),
+		kubetest.Ingress(JupyterLabs.NotebookNamespace, "labs"),
+		kubetest.Pod(JupyterLabs.NotebookNamespace, "alice-0", "alice", "node-a", "1", "2Gi"),
+	)
+	svc := JupyterLabs.NewService(h.Clusters, h.Fs, h.Templates, h.Broker, h.Jobs)
+	app := h.App(func(api fiber.Router) { JupyterLabs.SetupRoutes(api, svc) })
+	if status, resp := kubetest.Do(t, app, fiber.MethodPost, "/api/notebooks", labRequest("alice")); status != fiber.StatusOK {
+		t.Fatalf("create returned %d %+v", status, resp)
+	}
+	return h, app, JupyterLabs.NewScheduler(svc)
+}
+
+func TestSetAndDeleteLabspaceSchedule(t *testing.T) {
+	_, app, _ := newScheduledLab(t)
+
+	schedule := JupyterLabs.LabSchedule{Stop: "0 20 * * *", Start: "0 9 * * MON-FRI", TimeZone: "Europe/Berlin"}
+	status, resp := kubetest.Do(t, app, fiber.MethodPut, "/api/notebooks/alice/schedule", schedule)
+	if status != fiber.StatusOK {
+		t.Fatalf("set schedule returned %d %+v", status, resp)
+	}
+	if data, _ := resp.Data.(map[string]any); data["nextStop"] == nil || data["nextStart"] == nil {
+		t.Errorf("set schedule data = %v, want the next stop and start", resp.Data)
+	}
+
+	_, resp = kubetest.Do(t, app, fiber.MethodGet, "/api/notebooks/alice", nil)
+	nb, _ := resp.Data.(map[string]any)
+	got, _ := nb["schedule"].(map[string]any)
+	if got["stop"] != schedule.Stop || got["start"] != schedule.Start || got["timeZone"] != schedule.TimeZone {
+		t.Errorf("notebook schedule = %v, want %+v", nb["schedule"], schedule)
+	}
+
+	if status, _ := kubetest.Do(t, app, fiber.MethodDelete, "/api/notebooks/alice/schedule", nil); status != fiber.StatusOK {
+		t.Fatalf("delete schedule returned %d", status)
+	}
+	_, resp = kubetest.Do(t, app, fiber.MethodGet, "/api/notebooks/alice", nil)
+	if nb, _ := resp.Data.(map[string]any); nb["schedule"] != nil {
+		t.Errorf("notebook schedule after delete = %v", nb["schedule"])
+	}
+}
+
+func TestSetLabspaceScheduleValidates(t *testing.T) {
+	_, app, _ := newScheduledLab(t)
+
+	for _, tc := range []struct {
+		schedule JupyterLabs.LabSchedule
+		status   int
+	}{
+		{JupyterLabs.LabSchedule{}, fiber.StatusBadRequest},
+		{JupyterLabs.LabSchedule{Stop: "at 8pm"}, fiber.StatusBadRequest},
+		{JupyterLabs.LabSchedule{Stop: "0 20 * * *", TimeZone: "Mars/Olympus"}, fiber.StatusBadRequest},
+	} {
+		if status, resp := kubetest.Do(t, app, fiber.MethodPut, "/api/notebooks/alice/schedule", tc.schedule); status != tc.status {
+			t.Errorf("schedule %+v returned %d %+v, want %d", tc.schedule, status, resp, tc.status)
+		}
+	}
+	valid := JupyterLabs.LabSchedule{Stop: "0 20 * * *"}
+	if status, _ := kubetest.Do(t, app, fiber.MethodPut, "/api/notebooks/bob/schedule", valid); status != fiber.StatusNotFound {
+		t.Errorf("scheduling a missing labspace returned %d, want 404", status)
+	}
+}
+
+func TestSchedulerStopsAndStartsLabspace(t *testing.T) {
+	h, app, scheduler := newScheduledLab(t)
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("no time zone data: %v", err)
+	}
+	schedule := JupyterLabs.LabSchedule{Stop: "0 20 * * *", Start: "0 9 * * MON-FRI", TimeZone: "Europe/Berlin"}
+	if status, resp := kubetest.Do(t, app, fiber.MethodPut, "/api/notebooks/alice/schedule", schedule); status != fiber.StatusOK {
+		t.Fatalf("set schedule returned %d %+v", status, resp)
+	}
+	ctx := context.TODO()
+	tick := func(at time.Time) {
+		t.Helper()
+		if err := scheduler.Tick(ctx, at); err != nil {
+			t.Fatalf("tick at %s: %v", at, err)
+		}
+	}
+
+	// Friday 6 March 2026.
+	tick(time.Date(2026, 3, 6, 19, 59, 0, 0, berlin))
+	tick(time.Date(2026, 3, 6, 19, 59, 59, 0, berlin))
+	if !labspaceRunning(t, h, "alice") {
+		t.Fatal("labspace stopped before its stop time")
+	}
+	tick(time.Date(2026, 3, 6, 20, 0, 30, 0, berlin))
+	if labspaceRunning(t, h, "alice") {
+		t.Fatal("labspace was not stopped at its stop time")
+	}
+	sts, _ := h.Clientset.AppsV1().StatefulSets(JupyterLabs.NotebookNamespace).Get(ctx, "alice", metav1.GetOptions{})
+	if reason := sts.Annotations[JupyterLabs.StopReasonAnnotation]; !strings.Contains(reason, "stopped by schedule") {
+		t.Errorf("stop reason = %q, want the schedule", reason)
+	}
+
+	// Nothing starts it over the weekend; the evening stops of Saturday
+	// and Sunday find it already stopped.
+	tick(time.Date(2026, 3, 8, 23, 0, 0, 0, berlin))
+	if labspaceRunning(t, h, "alice") {
+		t.Fatal("labspace started at the weekend")
+	}
+	// One tick covering Sunday's stop and Monday's start starts it.
+	tick(time.Date(2026, 3, 9, 9, 0, 10, 0, berlin))
+	if !labspaceRunning(t, h, "alice") {
+		t.Fatal("labspace was not started on Monday morning")
+	}
+}
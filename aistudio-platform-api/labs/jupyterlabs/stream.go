@@ -0,0 +1,41 @@
+package JupyterLabs
+
+import (
+	"context"
+
+	"Kubernetes-api/internal/sse"
+	"Kubernetes-api/kubeutils"
+)
+
+// SSE topics served by this package. The notebook and metrics topics are
+// per cluster and namespace; see topic.
+const (
+	notebookTopic = "notebooks"
+	metricsTopic  = "metrics"
+)
+
+// topic returns the name of the service's own instance of base, registering
+// it fed by produce on first use. Each cluster and tenant namespace gets a
+// topic of its own, so a stream only carries the labspaces its caller may
+// see.
+func (s *Service) topic(base string, produce sse.Producer) string {
+	name := base + "/" + s.cluster + "/" + s.namespace
+	s.broker.RegisterOnce(name, produce)
+	return name
+}
+
+// produceNotebookEvents feeds the notebook topic from the statefulsets and
+// pods in the service's namespace.
+func (s *Service) produceNotebookEvents(ctx context.Context, h *sse.Hub) error {
+	go sse.Follow(ctx, h, func(ctx context.Context) (<-chan kubeutils.ResourceEvent, error) {
+		return s.kc.Watch(ctx, s.namespace, kubeutils.WatchStatefulSets, kubeutils.WatchPods)
+	})
+	return nil
+}
+
+// produceMetricsEvents feeds the metrics topic from metrics-server samples
+// of the service's namespace.
+func (s *Service) produceMetricsEvents(ctx context.Context, h *sse.Hub) error {
+	go sse.Pump(ctx, h, s.watchLabspacesMetrics(ctx, metricsInterval))
+	return nil
+}
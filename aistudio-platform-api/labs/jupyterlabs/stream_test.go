@@ -0,0 +1,55 @@
+package JupyterLabs_test
+
+import (
+	"testing"
+
+	"Kubernetes-api/helper"
+	"Kubernetes-api/internal/kubetest"
+	"Kubernetes-api/kubeutils"
+	JupyterLabs "Kubernetes-api/labs/jupyterlabs"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestNotebookStreamFollowsCallersClusterAndTenant(t *testing.T) {
+	cpu := kubetest.New(kubetest.Pod("tenant-vision", "carol-0", "carol", "cpu-a", "1", "1Gi"))
+	gpu := kubetest.New(
+		kubetest.Pod("tenant-vision", "alice-0", "alice", "gpu-a", "1", "1Gi"),
+		kubetest.Pod("tenant-speech", "bob-0", "bob", "gpu-a", "1", "1Gi"),
+	)
+	for _, h := range []*kubetest.Harness{cpu, gpu} {
+		h.Kube.Tenancy = &kubeutils.Tenancy{}
+		h.StartCache(t)
+	}
+	clusters, err := kubeutils.NewClusters(
+		kubeutils.Cluster{Name: "cpu", Kube: cpu.Kube},
+		kubeutils.Cluster{Name: "gpu", Kube: gpu.Kube},
+	)
+	if err != nil {
+		t.Fatalf("NewClusters: %v", err)
+	}
+	t.Cleanup(cpu.Broker.Close)
+	app := cpu.App(func(api fiber.Router) {
+		JupyterLabs.SetupRoutes(api, JupyterLabs.NewService(clusters, cpu.Fs, cpu.Templates, cpu.Broker, cpu.Jobs))
+	})
+
+	vision := map[string]string{helper.TenantHeader: "vision"}
+	if got := kubetest.FirstEvent(t, app, "/api/notebooks/sse?cluster=gpu", vision); got != "alice-0" {
+		t.Errorf("vision's stream on gpu reported %s, want alice-0", got)
+	}
+	want := map[string]bool{"notebooks/gpu/tenant-vision": true}
+	for _, stats := range cpu.Broker.Stats() {
+		if !want[stats.Topic] {
+			t.Errorf("unexpected sse topic %s", stats.Topic)
+		}
+		delete(want, stats.Topic)
+	}
+	if len(want) != 0 {
+		t.Errorf("sse topics %v were not started", want)
+	}
+
+	status, resp := kubetest.DoWithHeaders(t, app, fiber.MethodGet, "/api/notebooks/sse?cluster=tpu", nil, vision)
+	if status != fiber.StatusNotFound || resp.Error == nil {
+		t.Errorf("stream on an unknown cluster returned %d %+v, want 404", status, resp)
+	}
+}
@@ -2,49 +2,47 @@ package llm
 
 import (
 	"Kubernetes-api/helper"
+	"Kubernetes-api/jobs"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/log"
 )
 
-// @Description	Create Jupyter ModelDeployments Environment based on the specific users and project
+// @Description	Create Jupyter ModelDeployments Environment based on the specific users and project. Provisioning runs as a background job; follow it at /api/jobs/{id}
 // @Summary		Create ModelDeployments Environment
 // @Tags		JupyterLabs ModelDeployments
 // @Accept		json
 // @Produce		json
 // @Param 		createModelDeploymentsRequest body CreateModelDeploymentsRequest true "ModelDeployments Body"
+// @Param		cluster query string false "Cluster name"
+// @Param		X-Tenant header string false "Tenant, required when tenancy is enabled"
 // @Router		/api/modeldeplyment [post]
 // @Router		/api/modeldeplyment [post]
-func CreateLLMDeployment(c *fiber.Ctx) error {
+func (s *Service) CreateLLMDeployment(c *fiber.Ctx) error {
 	var req CreateLlmDeploymentsRequest
 	if err := c.BodyParser(&req); err != nil {
-		return helper.SendResponse(c, "Invalid Request", nil, fiber.ErrBadRequest.Code)
+		return helper.BadRequest(err)
+	}
+	if err := req.Validate(); err != nil {
+		return err
 	}
 
-	// Create a channel to receive the result and error from the goroutine
-	resultChan := make(chan string)
-	errorChan := make(chan error)
-
-	go func() {
-		url, err := CreateLlmDeployments(req)
-		resultChan <- url
-		errorChan <- err
-	}()
-
-	url := <-resultChan
-	err := <-errorChan
-
+	svc, err := s.forCluster(c)
+	if err != nil {
+		return err
+	}
+	url, steps, err := svc.CreateLlmDeployments(req)
 	if err != nil {
 		log.Info(err)
-		return helper.SendResponse(c, "Invalid Request", nil, fiber.ErrBadRequest.Code)
+		return helper.Wrap(err, err.Error(), fiber.StatusBadRequest)
 	}
-	message := "LLM Deployment Created Sucessfully"
-	log.Info(message)
 
-	data := map[string]interface{}{
+	job := s.jobs.Submit("llm-deployment", steps, map[string]interface{}{
 		"inferenceUrl": url,
-	}
-	return helper.SendResponse(c, message, data, fiber.StatusOK)
+		"cluster":      svc.cluster,
+	})
+	log.Info("LLM deployment job started: ", job.ID)
+	return jobs.Accepted(c, "LLM Deployment Accepted", job)
 }
 
 // @Description	Delete or Stop a specific notebook experiments
@@ -52,16 +50,25 @@ func CreateLLMDeployment(c *fiber.Ctx) error {
 // @Tags		JupyterLabs ModelDeployments
 // @Accept		json
 // @Param 		id  path string true "Pod Username"
+// @Param		cluster query string false "Cluster name"
+// @Param		X-Tenant header string false "Tenant, required when tenancy is enabled"
 // @Produce		json
 // @Router		/api/modeldeplyment/{id} [delete]
-func DeleteLLMDeployment(c *fiber.Ctx) error {
+func (s *Service) DeleteLLMDeployment(c *fiber.Ctx) error {
+	svc, err := s.forCluster(c)
+	if err != nil {
+		return err
+	}
 	deploymentName := c.Params("id")
-	DeleteLlmDeployments(deploymentName)
+	if err := svc.DeleteLlmDeployments(deploymentName); err != nil {
+		log.Error("error deleting LLM deployment: ", err)
+		return helper.SendResponse(c, "Failed to delete LLM", nil, helper.StatusFor(err, fiber.StatusInternalServerError))
+	}
 	log.Info("Delete request for LLM Deployment: ", deploymentName)
 	return helper.SendResponse(c, "LLM deleted successfully", nil, fiber.StatusOK)
 }
 
-func GetDefaultLlms(c *fiber.Ctx) error{
+func (s *Service) GetDefaultLlms(c *fiber.Ctx) error{
 	path := "./artifact/pvc-llm/"
 	folders, err := getFolderNames(path)
 	if err != nil {
@@ -70,7 +77,7 @@ func GetDefaultLlms(c *fiber.Ctx) error{
 	return helper.SendResponse(c, "querry list of default LLm", folders, fiber.StatusOK)
 }
 
-func GetSupportedBackend(c *fiber.Ctx) error {
+func (s *Service) GetSupportedBackend(c *fiber.Ctx) error {
 	data := map[string][]string{
 		// "backendType": {"vllm_model", "python", "tensorRT"},
 		"backendType": {"vllm_model"},
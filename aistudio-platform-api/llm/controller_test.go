@@ -0,0 +1,72 @@
+package llm_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"Kubernetes-api/internal/kubetest"
+	"Kubernetes-api/jobs"
+	"Kubernetes-api/llm"
+
+	"github.com/gofiber/fiber/v2"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const modelNamespace = "model"
+
+func llmRequest() llm.CreateLlmDeploymentsRequest {
+	return llm.CreateLlmDeploymentsRequest{
+		Username:       "alice",
+		DeploymentName: "llama",
+		Modelname:      "llama-3-8b",
+		CPURequest:     "1",
+		GPURequest:     "0",
+		MemoryRequest:  "2Gi",
+		CPULimit:       "2",
+		MemoryLimit:    "4Gi",
+		NodeSelector:   "cpu",
+		BackendTpye:    "vllm",
+	}
+}
+
+func TestCreateLLMDeploymentUndoesServiceOnFailure(t *testing.T) {
+	h := kubetest.New(kubetest.Node("node-a", "8", "32Gi", ""))
+	h.Clientset.PrependReactor("create", "deployments", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("admission webhook denied the request")
+	})
+	app := h.App(func(api fiber.Router) { llm.SetupRoutes(api, llm.NewService(h.Clusters, h.Jobs)) })
+
+	status, resp := kubetest.Do(t, app, fiber.MethodPost, "/api/llm", llmRequest())
+	if status != fiber.StatusAccepted {
+		t.Fatalf("create returned %d %+v", status, resp)
+	}
+	if job := h.WaitJob(t, resp); job.Status != jobs.StatusFailed {
+		t.Fatalf("job = %+v, want failed", job)
+	}
+	if _, err := h.Clientset.CoreV1().Services(modelNamespace).Get(context.TODO(), "llama", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("service left behind after the deployment failed, err=%v", err)
+	}
+}
+
+func TestCreateLLMDeploymentKeepsExistingServiceOnFailure(t *testing.T) {
+	h := kubetest.New(kubetest.Node("node-a", "8", "32Gi", ""))
+	if err := h.Kube.CreateService(modelNamespace, "llama", "llama", 8000, "ClusterIP"); err != nil {
+		t.Fatal(err)
+	}
+	h.Clientset.PrependReactor("create", "deployments", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("admission webhook denied the request")
+	})
+	app := h.App(func(api fiber.Router) { llm.SetupRoutes(api, llm.NewService(h.Clusters, h.Jobs)) })
+
+	_, resp := kubetest.Do(t, app, fiber.MethodPost, "/api/llm", llmRequest())
+	if job := h.WaitJob(t, resp); job.Status != jobs.StatusFailed {
+		t.Fatalf("job = %+v, want failed", job)
+	}
+	if _, err := h.Clientset.CoreV1().Services(modelNamespace).Get(context.TODO(), "llama", metav1.GetOptions{}); err != nil {
+		t.Errorf("service of the previous deployment was removed: %v", err)
+	}
+}
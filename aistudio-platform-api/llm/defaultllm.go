@@ -1,40 +1,27 @@
 package llm
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
-	"strconv"
 	"strings"
-	"time"
 
+	"Kubernetes-api/jobs"
 	utils "Kubernetes-api/kubeutils"
 
-	"github.com/gofiber/fiber/v2/log"
 	apiv1 "k8s.io/api/core/v1"
 )
 
-func CreateLlmDeployments(req CreateLlmDeploymentsRequest) (string, error) {
+// CreateLlmDeployments validates req and returns the generate URL the
+// deployment will serve together with the steps that provision it.
+func (s *Service) CreateLlmDeployments(req CreateLlmDeploymentsRequest) (string, []jobs.Step, error) {
 
 	modelPort := 8000
 	Image := "9861531522/general-llm-deployment:v0.4"
-	gpuSize, err := strconv.Atoi(req.GPURequest)
+	gpu, err := utils.ParseGPU(req.GPURequest, req.GPUType, req.GPUModel)
 	if err != nil {
-		log.Error(err.Error(), " Gpu value souldnot be in decimal")
-		return "Gpu value souldnot be in decimal", err
-	}
-	cpuAvailable, err := kc.CheckCpuAvailability(req.CPURequest)
-	if !cpuAvailable {
-		return "requested cpu is not available in any node", err
-	}
-	if int32(gpuSize) > 0 {
-		gpuAvailable, err := kc.CheckGpuAvailability(req.GPURequest)
-		if !gpuAvailable {
-			return "requested gpu is not available in any node", err
-		}
-	}
-	memoryAvailable, err := kc.CheckMemoryAvailability(req.MemoryRequest)
-	if !memoryAvailable {
-		return "Requested memory is not available in any node", err
+		return "", nil, err
 	}
 	req.DeploymentName = strings.Replace(req.DeploymentName, ".", "-", -1)
 	envVars := []apiv1.EnvVar{
@@ -49,33 +36,105 @@ func CreateLlmDeployments(req CreateLlmDeploymentsRequest) (string, error) {
 	}
 	serviceName := req.DeploymentName
 	pvcName := fmt.Sprintf("pvc-%s", "llm")
-	kc.CreateNamespace(modelNamespace)
-	resource := utils.ConfigResource(req.CPURequest, req.MemoryRequest, req.CPULimit, req.MemoryLimit)
-
-	if kc.ModelDeploymentExists(modelNamespace, req.DeploymentName) {
-		kc.DeleteDeployment(modelNamespace, req.DeploymentName)
-		time.Sleep(2 * time.Second)
+	resource, err := utils.ConfigResource(req.CPURequest, req.MemoryRequest, req.CPULimit, req.MemoryLimit)
+	if err != nil {
+		return "", nil, err
 	}
-	for kc.ModelDeploymentExists(modelNamespace, req.DeploymentName) {
-		time.Sleep(1 * time.Second)
+	owner := utils.Owner{User: req.Username, Team: s.tenant, Workload: utils.WorkloadLLM}
+	usage := utils.WorkloadUsage(resource, gpu, 1)
+	usage.Deployments = 1
+	// A deployment of the same name is replaced, so it is not counted.
+	release, err := s.clusters.ReserveQuota(utils.QuotaRequest{
+		Owner:    owner,
+		Add:      usage,
+		Replaces: []utils.WorkloadRef{{Cluster: s.cluster, Namespace: s.namespace, Name: req.DeploymentName}},
+	})
+	if err != nil {
+		return "", nil, err
 	}
-	if !kc.ServiceExists(modelNamespace, serviceName) {
-		kc.CreateService(modelNamespace, serviceName, req.DeploymentName, modelPort, apiv1.ServiceTypeClusterIP)
+
+	serviceCreated := false
+	steps := []jobs.Step{
+		{Name: jobs.StepResourceCheck, Run: func(ctx context.Context) error {
+			result, err := s.kc.CanSchedule(utils.ScheduleRequest{
+				Resources:    resource,
+				GPU:          gpu,
+				NodeSelector: s.kc.WorkloadNodeSelector(req.NodeSelector),
+			})
+			if err != nil {
+				return err
+			}
+			return result.Err()
+		}},
+		{
+			Name: jobs.StepService,
+			Run: func(ctx context.Context) error {
+				if err := s.kc.EnsureNamespace(s.namespace, s.tenant); err != nil {
+					return err
+				}
+				if err := s.checkModelClaim(pvcName); err != nil {
+					return err
+				}
+				if s.kc.ServiceExists(s.namespace, serviceName) {
+					return nil
+				}
+				if err := s.kc.CreateService(s.namespace, serviceName, req.DeploymentName, modelPort, apiv1.ServiceTypeClusterIP); err != nil {
+					return err
+				}
+				serviceCreated = true
+				return nil
+			},
+			// Only a service the step created is removed, so a failed
+			// redeploy leaves the previous deployment's service in place.
+			Undo: func(ctx context.Context) error {
+				if !serviceCreated {
+					return nil
+				}
+				return s.kc.DeleteService(s.namespace, serviceName)
+			},
+		},
+		{
+			Name: jobs.StepDeployment,
+			Run: func(ctx context.Context) error {
+				if err := s.kc.DeleteDeploymentAndWait(ctx, s.namespace, req.DeploymentName); err != nil {
+					return err
+				}
+				return s.kc.ConfigModelDeployment(s.namespace, req.DeploymentName, Image, pvcName, gpu, modelPort, req.NodeSelector, resource, envVars, owner)
+			},
+			Undo: func(ctx context.Context) error {
+				return s.kc.DeleteDeployment(s.namespace, req.DeploymentName)
+			},
+		},
 	}
-	kc.ConfigModelDeployment(modelNamespace, req.DeploymentName, Image, pvcName, gpuSize, modelPort, req.NodeSelector, resource, envVars)
-	url := "http://" + req.DeploymentName + "." + modelNamespace + "/v2/models/"+ req.BackendTpye +"/generate"
+	url := "http://" + req.DeploymentName + "." + s.namespace + "/v2/models/" + req.BackendTpye + "/generate"
 
-	return url, nil
+	return url, jobs.Finally(steps, release), nil
+}
 
+// checkModelClaim fails when a tenant namespace lacks the shared claim the
+// LLM weights are read from. The claim is provisioned with the namespace
+// only when the tenancy configuration lists it.
+func (s *Service) checkModelClaim(pvcName string) error {
+	if s.namespace == modelNamespace {
+		return nil
+	}
+	exists, err := s.kc.ClaimExists(s.namespace, pvcName)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("volume claim %s is missing in namespace %s; add it to the tenancy claims", pvcName, s.namespace)
+	}
+	return nil
 }
 
-func DeleteLlmDeployments(deploymentName string) error {
+func (s *Service) DeleteLlmDeployments(deploymentName string) error {
 
 	serviceName := deploymentName
-	kc.DeleteDeployment(modelNamespace, deploymentName)
-	kc.DeleteService(modelNamespace, serviceName)
-
-	return nil
+	return errors.Join(
+		s.kc.DeleteDeployment(s.namespace, deploymentName),
+		s.kc.DeleteService(s.namespace, serviceName),
+	)
 }
 
 func getFolderNames(path string) ([]string, error) {
@@ -1,17 +1,28 @@
 package llm
 
 import (
+	"strings"
+
+	"Kubernetes-api/helper"
+	"Kubernetes-api/jobs"
 	utils "Kubernetes-api/kubeutils"
+
+	"github.com/gofiber/fiber/v2"
 )
 
 
 var modelNamespace = "model"
 
 type CreateLlmDeploymentsRequest struct {
+	// Username is who quotas count the deployment against. Without it only
+	// the team quota of the X-Tenant header applies.
+	Username       string `json:"userName,omitempty"`
 	DeploymentName string `json:"deploymentName"`
 	Modelname      string `json:"modelName"`
 	CPURequest     string `json:"cpuRequest"`
 	GPURequest     string `json:"gpuRequest"`
+	GPUType        string `json:"gpuType,omitempty"`
+	GPUModel       string `json:"gpuModel,omitempty"`
 	MemoryRequest  string `json:"memoryRequest"`
 	CPULimit       string `json:"cpuLimit"`
 	MemoryLimit    string `json:"memoryLimit"`
@@ -20,4 +31,61 @@ type CreateLlmDeploymentsRequest struct {
 	BackendTpye    string `json:"backendType"`
 }
 
-var kc = utils.NewKubernetesConfig()
+// Validate checks the request before anything is created in the cluster.
+// Dots in the deployment name are replaced with dashes when it is used, so
+// they are allowed here.
+func (r CreateLlmDeploymentsRequest) Validate() error {
+	var v helper.Validator
+	v.LabelValue("userName", r.Username)
+	v.DNSLabel("deploymentName", "%s", strings.ReplaceAll(r.DeploymentName, ".", "-"))
+	v.Required("modelName", r.Modelname)
+	v.Required("backendType", r.BackendTpye)
+	_, err := utils.ConfigResource(r.CPURequest, r.MemoryRequest, r.CPULimit, r.MemoryLimit)
+	v.Check(err)
+	if r.DiskStorage != "" {
+		v.Quantity("diskStorage", r.DiskStorage)
+	}
+	_, err = utils.ParseGPU(r.GPURequest, r.GPUType, r.GPUModel)
+	v.Check(err)
+	v.LabelValue("nodeSelector", r.NodeSelector)
+	return v.Err()
+}
+
+// Service serves the LLM deployment endpoints. kc is the cluster the
+// service is bound to, the default one until forCluster picks another, and
+// namespace is where its deployments live: modelNamespace, or the tenant's
+// namespace when the cluster has tenancy enabled.
+type Service struct {
+	kc        *utils.KubernetesConfig
+	cluster   string
+	namespace string
+	tenant    string
+	clusters  *utils.Clusters
+	jobs      *jobs.Manager
+}
+
+func NewService(clusters *utils.Clusters, jobManager *jobs.Manager) *Service {
+	def := clusters.Default()
+	return &Service{kc: def.Kube, cluster: def.Name, namespace: modelNamespace, clusters: clusters, jobs: jobManager}
+}
+
+// forCluster returns the service bound to the cluster the request names in
+// its cluster query parameter, or to the default cluster, and scoped to the
+// tenant in its TenantHeader.
+func (s *Service) forCluster(c *fiber.Ctx) (*Service, error) {
+	cluster, err := s.clusters.Get(c.Query(helper.ClusterParam))
+	if err != nil {
+		return nil, err
+	}
+	tenant := c.Get(helper.TenantHeader)
+	namespace, err := cluster.Kube.TenantNamespace(tenant, modelNamespace)
+	if err != nil {
+		return nil, err
+	}
+	svc := *s
+	svc.kc = cluster.Kube
+	svc.cluster = cluster.Name
+	svc.namespace = namespace
+	svc.tenant = tenant
+	return &svc, nil
+}
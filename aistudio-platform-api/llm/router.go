@@ -5,10 +5,10 @@ import (
 	"github.com/gofiber/fiber/v2"
 )
 
-func SetupRoutes(router fiber.Router) {
+func SetupRoutes(router fiber.Router, svc *Service) {
 	llmdeploy := router.Group("/llm")
-	llmdeploy.Get("/", GetDefaultLlms)
-	llmdeploy.Post("/", CreateLLMDeployment)
-	llmdeploy.Get("/backendtype", GetSupportedBackend)
-	llmdeploy.Delete("/:id", DeleteLLMDeployment)
+	llmdeploy.Get("/", svc.GetDefaultLlms)
+	llmdeploy.Post("/", svc.CreateLLMDeployment)
+	llmdeploy.Get("/backendtype", svc.GetSupportedBackend)
+	llmdeploy.Delete("/:id", svc.DeleteLLMDeployment)
 }
@@ -1,7 +1,19 @@
 package main
 
 import (
+	"Kubernetes-api/helper"
+	"Kubernetes-api/internal/sse"
+	"Kubernetes-api/jobs"
+	"Kubernetes-api/kubeutils"
+	JupyterLabs "Kubernetes-api/labs/jupyterlabs"
 	"Kubernetes-api/router"
+	"context"
+	"flag"
+	"os"
+	"os/signal"
+	"syscall"
+	// Labspace schedules name IANA time zones, which slim images lack.
+	_ "time/tzdata"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/log"
@@ -13,7 +25,99 @@ import (
 //	@BasePath		/
 
 func main() {
-	app := fiber.New()
-	router.SetupRoutes(app)
-	log.Fatal(app.Listen(":8080"))
+	var opts kubeutils.Options
+	flag.StringVar(&opts.Kubeconfig, "kubeconfig", "", "(optional) absolute path to the kubeconfig file")
+	flag.StringVar(&opts.Context, "context", "", "(optional) kubeconfig context to use")
+	flag.BoolVar(&opts.InCluster, "in-cluster", os.Getenv("KUBERNETES_SERVICE_HOST") != "", "use the in-cluster service account instead of a kubeconfig")
+	qps := flag.Float64("kube-qps", 0, "(optional) client-side QPS limit for the Kubernetes API")
+	flag.IntVar(&opts.Burst, "kube-burst", 0, "(optional) client-side burst limit for the Kubernetes API")
+	vendorProfiles := flag.String("vendor-profiles", os.Getenv("VENDOR_PROFILES"), "(optional) path to a YAML file of cluster vendor profiles")
+	clustersFile := flag.String("clusters", os.Getenv("CLUSTERS_CONFIG"), "(optional) path to a YAML file of the clusters to manage; the first is the default")
+	quotaFile := flag.String("quotas", os.Getenv("QUOTA_POLICY"), "(optional) path to a YAML quota policy of per-user and per-team limits")
+	cullFile := flag.String("culling", os.Getenv("CULL_POLICY"), "(optional) path to a YAML policy for stopping idle labspaces; enables the idle culler")
+	tenancyFile := flag.String("tenancy", os.Getenv("TENANCY_CONFIG"), "(optional) path to a YAML tenancy config; enables one namespace per tenant")
+	flag.Parse()
+	opts.QPS = float32(*qps)
+	if *vendorProfiles != "" {
+		profiles, err := kubeutils.LoadVendorProfiles(*vendorProfiles)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts.VendorProfiles = profiles
+	}
+	if *tenancyFile != "" {
+		tenancy, err := kubeutils.LoadTenancy(*tenancyFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts.Tenancy = tenancy
+	}
+
+	var clusters *kubeutils.Clusters
+	if *clustersFile != "" {
+		loaded, err := kubeutils.LoadClusters(*clustersFile, opts)
+		if err != nil {
+			log.Fatal(err)
+		}
+		clusters = loaded
+	} else {
+		kc, err := kubeutils.NewKubernetesConfig(opts)
+		if err != nil {
+			log.Fatal(err)
+		}
+		clusters = kubeutils.SingleCluster(kc)
+	}
+	if *quotaFile != "" {
+		policy, err := kubeutils.LoadQuotaPolicy(*quotaFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		clusters.Quotas = policy
+	}
+
+	var culling *JupyterLabs.CullPolicy
+	if *cullFile != "" {
+		policy, err := JupyterLabs.LoadCullPolicy(*cullFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		culling = policy
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Reads go to the API server until the informers have synced.
+	go func() {
+		if err := clusters.StartCaches(ctx); err != nil {
+			log.Error(err)
+			return
+		}
+		log.Info("informer caches synced")
+	}()
+
+	broker := sse.NewBroker()
+	jobManager := jobs.NewManager()
+	app := fiber.New(fiber.Config{ErrorHandler: helper.ErrorHandler})
+	router.SetupRoutes(app, router.Dependencies{
+		Kube:     clusters.Default().Kube,
+		Clusters: clusters,
+		Broker:   broker,
+		Jobs:     jobManager,
+		Culling:  culling,
+		Context:  ctx,
+	})
+
+	// Open SSE streams would otherwise keep Shutdown waiting forever.
+	go func() {
+		<-ctx.Done()
+		broker.Close()
+		jobManager.Close()
+		if err := app.Shutdown(); err != nil {
+			log.Error("shutting down: ", err)
+		}
+	}()
+	if err := app.Listen(":8080"); err != nil {
+		log.Fatal(err)
+	}
 }
@@ -2,9 +2,11 @@ package plugin
 
 import (
 	"Kubernetes-api/helper"
+	"Kubernetes-api/jobs"
 	utils "Kubernetes-api/kubeutils"
+	"context"
+	"errors"
 	"fmt"
-	"os"
 	"path/filepath"
 	"strings"
 	"time"
@@ -13,96 +15,104 @@ import (
 	"k8s.io/client-go/restmapper"
 )
 
-func CreatePluginDeployments(req PluginDeploymentsRequest) (string, error) {
-	if req.ZipURL == "" {
-		return "", fmt.Errorf("zipUrl is required")
-	}
-	if req.PluginName == "" {
-		return "", fmt.Errorf("pluginName is required")
-	}
-	if req.RoutePath == "" {
-		return "", fmt.Errorf("routePath is required")
-	}
+// Names of the plugin-specific steps of a plugin deployment job.
+const (
+	stepDownload       = "download"
+	stepApplyManifests = "apply-manifests"
+)
 
+// CreatePluginDeployments validates req and returns the frontend and backend
+// URLs of the plugin together with the steps that deploy it.
+func (s *Service) CreatePluginDeployments(req PluginDeploymentsRequest) (string, string, []jobs.Step, error) {
+	if err := req.Validate(); err != nil {
+		return "", "", nil, err
+	}
 
 	artifactsDir := "artifacts/plugins"
 	zipFileName := fmt.Sprintf("%s-%d.zip", req.PluginName, time.Now().UnixNano())
 	zipFilePath := filepath.Join(artifactsDir, zipFileName)
 	extractDir := filepath.Join(artifactsDir, req.PluginName+"-extracted")
 
-	kc.CreateNamespace(pluginNamespace)
-
-	if err := os.MkdirAll(artifactsDir, 0755); err != nil {
-		return "", fmt.Errorf("failed to create artifacts dir: %w", err)
-	}
-
-	if err := helper.DownloadFile(req.ZipURL, zipFilePath); err != nil {
-		return "", fmt.Errorf("failed to download zip from %s: %w", req.ZipURL, err)
-	}
-	defer os.Remove(zipFilePath)
-
-	if err := ApplyManifestsFromZip(zipFilePath, extractDir, pluginNamespace); err != nil {
-		return "", fmt.Errorf("failed to apply manifests: %w", err)
-	}
-
-	// Step 5: Define expected service names
 	frontendServiceName := fmt.Sprintf("%s-frontend", req.PluginName)
 	backendServiceName := fmt.Sprintf("%s-backend", req.PluginName)
 
-	port := 80
-	if !kc.ServiceExists(pluginNamespace, frontendServiceName) {
-		kc.CreateService(pluginNamespace, frontendServiceName, frontendServiceName, port, apiv1.ServiceTypeClusterIP)
-	}
-	if !kc.ServiceExists(pluginNamespace, backendServiceName) {
-		kc.CreateService(pluginNamespace, backendServiceName, backendServiceName, port, apiv1.ServiceTypeClusterIP)
+	steps := []jobs.Step{
+		{Name: stepDownload, Run: func(ctx context.Context) error {
+			if err := s.kc.CreateNamespace(pluginNamespace); err != nil {
+				return err
+			}
+			if err := s.fs.MkdirAll(artifactsDir, 0755); err != nil {
+				return fmt.Errorf("failed to create artifacts dir: %w", err)
+			}
+			if err := helper.DownloadFile(s.fs, req.ZipURL, zipFilePath); err != nil {
+				return fmt.Errorf("failed to download zip from %s: %w", req.ZipURL, err)
+			}
+			return nil
+		}},
+		{Name: stepApplyManifests, Run: func(ctx context.Context) error {
+			defer s.fs.Remove(zipFilePath)
+			if err := s.ApplyManifestsFromZip(zipFilePath, extractDir, pluginNamespace); err != nil {
+				return fmt.Errorf("failed to apply manifests: %w", err)
+			}
+			return nil
+		}},
+		{Name: jobs.StepService, Run: func(ctx context.Context) error {
+			port := 80
+			for _, name := range []string{frontendServiceName, backendServiceName} {
+				if s.kc.ServiceExists(pluginNamespace, name) {
+					continue
+				}
+				if err := s.kc.CreateService(pluginNamespace, name, name, port, apiv1.ServiceTypeClusterIP); err != nil {
+					return err
+				}
+			}
+			return nil
+		}},
+		{Name: jobs.StepIngress, Run: func(ctx context.Context) error {
+			frontendPath := fmt.Sprintf("/plugins/%s", req.RoutePath)
+			backendPath := fmt.Sprintf("/plugins/%s/api", req.RoutePath)
+			if err := s.kc.AppendRuleToIngress(pluginNamespace, ingressName, frontendServiceName, frontendPath); err != nil {
+				return err
+			}
+			return s.kc.AppendRuleToIngress(pluginNamespace, ingressName, backendServiceName, backendPath)
+		}},
 	}
 
-	frontendPath := fmt.Sprintf("/plugins/%s", req.RoutePath)
-	backendPath := fmt.Sprintf("/plugins/%s/api", req.RoutePath)
-
-	kc.AppendRuleToIngress(pluginNamespace, ingressName, frontendServiceName, frontendPath)
-	kc.AppendRuleToIngress(pluginNamespace, ingressName, backendServiceName, backendPath)
-
 	frontendURL := fmt.Sprintf("http://%s.%s", frontendServiceName, pluginNamespace)
 	backendURL := fmt.Sprintf("http://%s.%s", backendServiceName, pluginNamespace)
-
-	message := fmt.Sprintf("Frontend URL: %s, Backend URL: %s", frontendURL, backendURL)
-	return message, nil
+	return frontendURL, backendURL, steps, nil
 }
 
-func DeletePluginDeployments(pluginName string, rulePath string) error {
+func (s *Service) DeletePluginDeployments(pluginName string, rulePath string) error {
 	frontendDeploymentName := strings.Replace(fmt.Sprintf("%s-frontend", pluginName), ".", "-", -1)
 	frontendServiceName := frontendDeploymentName
 
 	backendDeploymentName := strings.Replace(fmt.Sprintf("%s-backend", pluginName), ".", "-", -1)
 	backendServiceName := backendDeploymentName
 
-	kc.DeleteDeployment(pluginNamespace, frontendDeploymentName)
-	kc.DeleteService(pluginNamespace, frontendServiceName)
-	kc.DeleteRuleFromIngress(pluginNamespace, rulePath, ingressName)
-
-	kc.DeleteDeployment(pluginNamespace, backendDeploymentName)
-	kc.DeleteService(pluginNamespace, backendServiceName)
-
-	return nil
+	return errors.Join(
+		s.kc.DeleteDeployment(pluginNamespace, frontendDeploymentName),
+		s.kc.DeleteService(pluginNamespace, frontendServiceName),
+		s.kc.DeleteRuleFromIngress(pluginNamespace, rulePath, ingressName),
+		s.kc.DeleteDeployment(pluginNamespace, backendDeploymentName),
+		s.kc.DeleteService(pluginNamespace, backendServiceName),
+	)
 }
 
-func ApplyManifestsFromZip(zipFilePath, extractDir, namespace string) error {
-	kube := utils.NewKubernetesConfig()
-	
-	files, err := helper.ExtractZip(zipFilePath, extractDir)
+func (s *Service) ApplyManifestsFromZip(zipFilePath, extractDir, namespace string) error {
+	files, err := helper.ExtractZip(s.fs, zipFilePath, extractDir)
 	if err != nil {
 		return fmt.Errorf("failed to extract zip: %w", err)
 	}
 
-	gr, err := restmapper.GetAPIGroupResources(kube.Clientset.Discovery())
+	gr, err := restmapper.GetAPIGroupResources(s.kc.Clientset.Discovery())
 	if err != nil {
 		return fmt.Errorf("failed to get API resources: %w", err)
 	}
 	mapper := restmapper.NewDiscoveryRESTMapper(gr)
 
 	for _, filePath := range files {
-		if err := utils.ApplyManifest(filePath, namespace, kube.DynamicClient, mapper); err != nil {
+		if err := utils.ApplyManifest(s.fs, filePath, namespace, s.kc.DynamicClient, mapper); err != nil {
 			return err
 		}
 	}
@@ -110,6 +120,6 @@ func ApplyManifestsFromZip(zipFilePath, extractDir, namespace string) error {
 	return nil
 }
 
-func ListPlugins() ([]map[string]string, error) {
-	return kc.ListPods(pluginNamespace)
+func (s *Service) ListPlugins() ([]map[string]string, error) {
+	return s.kc.ListPods(pluginNamespace)
 }
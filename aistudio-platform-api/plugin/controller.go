@@ -2,57 +2,46 @@ package plugin
 
 import (
 	"Kubernetes-api/helper"
-	"Kubernetes-api/internal/sse"
-	"bufio"
-	"fmt"
-	"strings"
-	"time"
+	"Kubernetes-api/jobs"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/log"
-	"github.com/valyala/fasthttp"
 )
 
-// @Description	Create Plugin Deployments Environment based on the specific user and plugin
+// @Description	Create Plugin Deployments Environment based on the specific user and plugin. Deployment runs as a background job; follow it at /api/jobs/{id}
 // @Summary		Create Plugin Deployments
 // @Tags		Plugins
 // @Accept		json
 // @Produce		json
 // @Param 		createPluginDeploymentsRequest body PluginDeploymentsRequest true "Plugin Deployments Body"
+// @Param		cluster query string false "Cluster name"
 // @Router		/api/plugin/deploy [post]
-func CreatePlugin(c *fiber.Ctx) error {
+func (s *Service) CreatePlugin(c *fiber.Ctx) error {
+	svc, err := s.forCluster(c)
+	if err != nil {
+		return err
+	}
 	var req PluginDeploymentsRequest
 	if err := c.BodyParser(&req); err != nil {
-		return helper.SendResponse(c, "Invalid Request", nil, fiber.ErrBadRequest.Code)
+		return helper.BadRequest(err)
+	}
+	if err := req.Validate(); err != nil {
+		return err
 	}
 
-	// Create a channel to receive the result and error from the goroutine
-	resultChan := make(chan string)
-	errorChan := make(chan error)
-
-	go func() {
-		url, err := CreatePluginDeployments(req)
-		resultChan <- url
-		errorChan <- err
-	}()
-
-	url := <-resultChan
-	err := <-errorChan
-
+	frontendURL, backendURL, steps, err := svc.CreatePluginDeployments(req)
 	if err != nil {
 		log.Info(err)
-		return helper.SendResponse(c, "Failed to create plugin deployment", nil, fiber.ErrBadRequest.Code)
+		return helper.NewError(fiber.StatusBadRequest, err.Error(), err)
 	}
 
-	message := "Plugin Deployment Created Successfully"
-	log.Info(message)
-
-	data := map[string]interface{}{
-		"frontendUrl": strings.Split(url, ",")[0], // extract frontend URL
-		"backendUrl":  strings.Split(url, ",")[1], // extract backend URL
-	}
-
-	return helper.SendResponse(c, message, data, fiber.StatusOK)
+	job := svc.jobs.Submit("plugin-deployment", steps, map[string]interface{}{
+		"frontendUrl": frontendURL,
+		"backendUrl":  backendURL,
+		"cluster":     svc.cluster,
+	})
+	log.Info("Plugin deployment job started: ", job.ID)
+	return jobs.Accepted(c, "Plugin Deployment Accepted", job)
 }
 
 // @Description	Delete Plugin Deployments (frontend + backend) based on pluginName and serviceName
@@ -61,8 +50,13 @@ func CreatePlugin(c *fiber.Ctx) error {
 // @Produce		json
 // @Param		pluginName path string true "Plugin Name"
 // @Param		serviceName path string true "Service Name"
+// @Param		cluster query string false "Cluster name"
 // @Router		/api/plugin/deploy/{pluginName}/{serviceName} [delete]
-func DeletePlugin(c *fiber.Ctx) error {
+func (s *Service) DeletePlugin(c *fiber.Ctx) error {
+	svc, err := s.forCluster(c)
+	if err != nil {
+		return err
+	}
 	var req DeletePluginRequest
 
 	if err := c.BodyParser(&req); err != nil {
@@ -72,44 +66,40 @@ func DeletePlugin(c *fiber.Ctx) error {
 	if req.PluginName == "" || req.RoutePath == "" {
 		return helper.SendResponse(c, "pluginName and routePath are required", nil, fiber.StatusBadRequest)
 	}
-	err := DeletePluginDeployments(req.PluginName, req.RoutePath)
+	err = svc.DeletePluginDeployments(req.PluginName, req.RoutePath)
 	if err != nil {
 		log.Error("Failed to delete plugin deployments: %v", err)
-		return helper.SendResponse(c, "Failed to delete deployments", nil, fiber.StatusInternalServerError)
+		return helper.SendResponse(c, "Failed to delete deployments", nil, helper.StatusFor(err, fiber.StatusInternalServerError))
 	}
 
 	log.Info("Delete request for plugin=%s route=%s", req.PluginName, req.RoutePath)
 	return helper.SendResponse(c, "Deployments deleted successfully", nil, fiber.StatusOK)
 }
 
-func GetPluginsSse(c *fiber.Ctx) error {
-	c.Set("Content-Type", "text/event-stream")
-	c.Set("Cache-Control", "no-cache")
-	c.Set("Connection", "keep-alive")
-	c.Set("Transfer-Encoding", "chunked")
-
-	c.Context().SetBodyStreamWriter(fasthttp.StreamWriter(func(wr *bufio.Writer) {
-		fmt.Println("WRITER PLUGIN")
-		em := sse.NewBufioEmitter(wr, "notebooks")
-		for {
-			data, err := ListPlugins()
-			if err != nil {
-				log.Error("error listing notebooks for SSE: ", err)
-				continue
-			}
-
-			sendJsonFlowErr := em.SendJSON("", "message", data)
-			if sendJsonFlowErr.Err != nil {
-				if sendJsonFlowErr.Next {
-					continue
-				} else {
-					break
-				}
-			}
-
-			time.Sleep(5 * time.Second)
-		}
-	}))
+func (s *Service) GetPluginsSse(c *fiber.Ctx) error {
+	svc, err := s.forCluster(c)
+	if err != nil {
+		return err
+	}
+	topic := svc.topic(pluginTopic, svc.producePluginEvents)
+	if err := s.broker.Start(topic); err != nil {
+		log.Error("error starting plugin stream: ", err)
+		return helper.SendResponse(c, "Plugin stream is unavailable", nil, fiber.StatusServiceUnavailable)
+	}
 
+	s.broker.Serve(c, topic)
 	return nil
 }
+
+// forCluster returns the service bound to the cluster the request names in
+// its cluster query parameter, or to the default cluster.
+func (s *Service) forCluster(c *fiber.Ctx) (*Service, error) {
+	cluster, err := s.clusters.Get(c.Query(helper.ClusterParam))
+	if err != nil {
+		return nil, err
+	}
+	svc := *s
+	svc.kc = cluster.Kube
+	svc.cluster = cluster.Name
+	return &svc, nil
+}
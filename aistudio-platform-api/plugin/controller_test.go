@@ -0,0 +1,157 @@
+package plugin_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"Kubernetes-api/internal/kubetest"
+	"Kubernetes-api/jobs"
+	"Kubernetes-api/kubeutils"
+	"Kubernetes-api/plugin"
+
+	"github.com/gofiber/fiber/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const pluginNamespace = "plugin"
+
+const manifest = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: demo-frontend
+spec:
+  selector:
+    matchLabels:
+      app: demo-frontend
+  template:
+    metadata:
+      labels:
+        app: demo-frontend
+    spec:
+      containers:
+      - name: web
+        image: nginx
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: demo-backend
+spec:
+  selector:
+    matchLabels:
+      app: demo-backend
+  template:
+    metadata:
+      labels:
+        app: demo-backend
+    spec:
+      containers:
+      - name: api
+        image: demo/api
+`
+
+func pluginZip(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("manifests/deploy.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte(manifest)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCreatePlugin(t *testing.T) {
+	archive := pluginZip(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(archive)
+	}))
+	defer srv.Close()
+
+	h := kubetest.New(kubetest.Ingress(pluginNamespace, "multi-service-ingress"))
+	app := h.App(func(api fiber.Router) {
+		plugin.SetupRoutes(api, plugin.NewService(h.Clusters, h.Fs, h.Broker, h.Jobs))
+	})
+
+	status, resp := kubetest.Do(t, app, fiber.MethodPost, "/api/plugin", plugin.PluginDeploymentsRequest{
+		ZipURL:     srv.URL + "/demo.zip",
+		RoutePath:  "demo",
+		PluginName: "demo",
+	})
+	if status != fiber.StatusAccepted {
+		t.Fatalf("create returned %d %+v", status, resp)
+	}
+	job := h.WaitJob(t, resp)
+	if job.Status != jobs.StatusSucceeded {
+		t.Fatalf("job = %+v, want succeeded", job)
+	}
+	if result, _ := job.Result.(map[string]any); result["frontendUrl"] != "http://demo-frontend.plugin" || result["backendUrl"] != "http://demo-backend.plugin" {
+		t.Errorf("result = %v", job.Result)
+	}
+
+	ctx := context.TODO()
+	deployments := schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+	for _, name := range []string{"demo-frontend", "demo-backend"} {
+		if _, err := h.Dynamic.Resource(deployments).Namespace(pluginNamespace).Get(ctx, name, metav1.GetOptions{}); err != nil {
+			t.Errorf("manifest %s not applied: %v", name, err)
+		}
+		if _, err := h.Clientset.CoreV1().Services(pluginNamespace).Get(ctx, name, metav1.GetOptions{}); err != nil {
+			t.Errorf("service %s not created: %v", name, err)
+		}
+	}
+
+	ing, _ := h.Clientset.NetworkingV1().Ingresses(pluginNamespace).Get(ctx, "multi-service-ingress", metav1.GetOptions{})
+	if got, want := kubetest.IngressPaths(ing), []string{"/plugins/demo", "/plugins/demo/api"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ingress paths = %v, want %v", got, want)
+	}
+}
+
+func TestCreatePluginRequiresZipURL(t *testing.T) {
+	h := kubetest.New()
+	app := h.App(func(api fiber.Router) {
+		plugin.SetupRoutes(api, plugin.NewService(h.Clusters, h.Fs, h.Broker, h.Jobs))
+	})
+
+	status, _ := kubetest.Do(t, app, fiber.MethodPost, "/api/plugin", plugin.PluginDeploymentsRequest{PluginName: "demo", RoutePath: "demo"})
+	if status != fiber.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", status)
+	}
+}
+
+func TestPluginStreamFollowsCallersCluster(t *testing.T) {
+	cpu := kubetest.New(kubetest.Deployment(pluginNamespace, "notes-frontend"))
+	gpu := kubetest.New(kubetest.Deployment(pluginNamespace, "vision-frontend"))
+	for _, h := range []*kubetest.Harness{cpu, gpu} {
+		h.StartCache(t)
+	}
+	clusters, err := kubeutils.NewClusters(
+		kubeutils.Cluster{Name: "cpu", Kube: cpu.Kube},
+		kubeutils.Cluster{Name: "gpu", Kube: gpu.Kube},
+	)
+	if err != nil {
+		t.Fatalf("NewClusters: %v", err)
+	}
+	t.Cleanup(cpu.Broker.Close)
+	app := cpu.App(func(api fiber.Router) {
+		plugin.SetupRoutes(api, plugin.NewService(clusters, cpu.Fs, cpu.Broker, cpu.Jobs))
+	})
+
+	if got := kubetest.FirstEvent(t, app, "/api/plugin/sse?cluster=gpu", nil); got != "vision-frontend" {
+		t.Errorf("stream on gpu reported %s, want vision-frontend", got)
+	}
+	if got := kubetest.FirstEvent(t, app, "/api/plugin/sse", nil); got != "notes-frontend" {
+		t.Errorf("stream on the default cluster reported %s, want notes-frontend", got)
+	}
+}
@@ -1,7 +1,15 @@
 package plugin
 
 import (
+	"context"
+	"regexp"
+
+	"Kubernetes-api/helper"
+	"Kubernetes-api/internal/sse"
+	"Kubernetes-api/jobs"
 	utils "Kubernetes-api/kubeutils"
+
+	"github.com/spf13/afero"
 )
 
 type PluginDeploymentsRequests struct {
@@ -26,10 +34,63 @@ type DeletePluginRequest struct {
 	RoutePath     string `json:"routePath"`
 }
 
-var kc = utils.NewKubernetesConfig()
+// Service serves the plugin endpoints. kc is the cluster the service is
+// bound to, the default one until forCluster picks another.
+type Service struct {
+	kc       *utils.KubernetesConfig
+	cluster  string
+	clusters *utils.Clusters
+	fs       afero.Fs
+	broker   *sse.Broker
+	jobs     *jobs.Manager
+}
+
+// pluginTopic is the SSE topic GetPluginsSse streams, one per cluster; see
+// topic.
+const pluginTopic = "plugins"
+
+func NewService(clusters *utils.Clusters, fs afero.Fs, broker *sse.Broker, jobManager *jobs.Manager) *Service {
+	def := clusters.Default()
+	return &Service{kc: def.Kube, cluster: def.Name, clusters: clusters, fs: fs, broker: broker, jobs: jobManager}
+}
+
+// topic returns the name of the service's own instance of base, registering
+// it fed by produce on first use. Each cluster gets a topic of its own, so a
+// stream carries the plugins of the cluster its caller asked for. Plugins
+// are installed for every tenant in pluginNamespace, so tenants share it.
+func (s *Service) topic(base string, produce sse.Producer) string {
+	name := base + "/" + s.cluster
+	s.broker.RegisterOnce(name, produce)
+	return name
+}
+
+// producePluginEvents feeds the plugins topic from the deployments and pods
+// in pluginNamespace of the service's cluster.
+func (s *Service) producePluginEvents(ctx context.Context, h *sse.Hub) error {
+	go sse.Follow(ctx, h, func(ctx context.Context) (<-chan utils.ResourceEvent, error) {
+		return s.kc.Watch(ctx, pluginNamespace, utils.WatchDeployments, utils.WatchPods)
+	})
+	return nil
+}
 
 type PluginDeploymentsRequest struct {
 	ZipURL     string `json:"zipUrl"`
 	RoutePath  string `json:"routePath"`  // e.g. "my-plugin"
 	PluginName string `json:"pluginName"` // e.g. "my-plugin"
+}
+
+// routePathPattern matches the path segments a plugin is served under,
+// without the leading slash.
+var routePathPattern = regexp.MustCompile(`^[A-Za-z0-9._~-]+(/[A-Za-z0-9._~-]+)*$`)
+
+// Validate checks the request before anything is downloaded or created in
+// the cluster.
+func (r PluginDeploymentsRequest) Validate() error {
+	var v helper.Validator
+	v.URL("zipUrl", r.ZipURL)
+	v.DNSLabel("pluginName", "%s-frontend", r.PluginName)
+	if v.Required("routePath", r.RoutePath) && !routePathPattern.MatchString(r.RoutePath) {
+		v.Fail("routePath", "must be a URL path such as my-plugin, without a leading slash")
+	}
+	return v.Err()
 }
\ No newline at end of file
@@ -4,9 +4,9 @@ import (
 	"github.com/gofiber/fiber/v2"
 )
 
-func SetupRoutes(router fiber.Router) {
+func SetupRoutes(router fiber.Router, svc *Service) {
 	plugin := router.Group("/plugin")
-	plugin.Get("/sse", GetPluginsSse)
-	plugin.Post("/",CreatePlugin)
-	plugin.Delete("/", DeletePlugin)
+	plugin.Get("/sse", svc.GetPluginsSse)
+	plugin.Post("/",svc.CreatePlugin)
+	plugin.Delete("/", svc.DeletePlugin)
 }
\ No newline at end of file
@@ -0,0 +1,39 @@
+package quotas
+
+import (
+	"Kubernetes-api/helper"
+	"Kubernetes-api/kubeutils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
+)
+
+// Service reports quota usage. Usage is added up across every registered
+// cluster, so it is not bound to one.
+type Service struct {
+	clusters *kubeutils.Clusters
+}
+
+func NewService(clusters *kubeutils.Clusters) *Service {
+	return &Service{clusters: clusters}
+}
+
+// @Description	Get the CPU, memory, GPU, disk, labspace and deployment usage of a user or team across every cluster, against the limits of the quota policy. Limits that are not set are unlimited.
+// @Summary		Get quota usage
+// @Tags		Quotas
+// @Produce		json
+// @Param		subject path string true "User or team name"
+// @Param		kind query string false "user (default) or team"
+// @Router		/api/quotas/{subject} [get]
+func (s *Service) GetQuota(c *fiber.Ctx) error {
+	kind := c.Query("kind", kubeutils.QuotaUser)
+	if kind != kubeutils.QuotaUser && kind != kubeutils.QuotaTeam {
+		return helper.NewError(fiber.StatusBadRequest, "kind must be user or team", nil)
+	}
+	report, err := s.clusters.QuotaReport(kind, c.Params("subject"))
+	if err != nil {
+		log.Error("quota report failed: ", err)
+		return helper.Wrap(err, "Failed to get quota usage", fiber.StatusInternalServerError)
+	}
+	return helper.SendResponse(c, "Quota usage retrieved successfully", report, fiber.StatusOK)
+}
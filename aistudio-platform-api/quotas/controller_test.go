@@ -0,0 +1,49 @@
+package quotas_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"Kubernetes-api/internal/kubetest"
+	"Kubernetes-api/kubeutils"
+	"Kubernetes-api/quotas"
+
+	"github.com/gofiber/fiber/v2"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestGetQuota(t *testing.T) {
+	h := kubetest.New(kubetest.Node("node-a", "8", "32Gi", ""))
+	gpus := resource.MustParse("2")
+	h.Clusters.Quotas = &kubeutils.QuotaPolicy{Teams: map[string]kubeutils.QuotaLimits{"vision": {GPU: &gpus}}}
+	app := h.App(func(api fiber.Router) {
+		quotas.SetupRoutes(api, quotas.NewService(h.Clusters))
+	})
+
+	resources := v1.ResourceRequirements{Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("1")}}
+	owner := kubeutils.Owner{User: "alice", Team: "vision", Workload: kubeutils.WorkloadModel}
+	if err := h.Kube.ConfigModelDeployment("model", "iris", "serve", "pvc-iris", kubeutils.GPURequest{Count: 1}, 9000, "cpu", resources, nil, owner); err != nil {
+		t.Fatal(err)
+	}
+
+	status, resp := kubetest.Do(t, app, fiber.MethodGet, "/api/quotas/vision?kind=team", nil)
+	if status != fiber.StatusOK {
+		t.Fatalf("get quota returned %d %+v", status, resp)
+	}
+	var report kubeutils.QuotaReport
+	raw, _ := json.Marshal(resp.Data)
+	if err := json.Unmarshal(raw, &report); err != nil {
+		t.Fatalf("decoding %s: %v", raw, err)
+	}
+	if report.Usage.Deployments != 1 || report.Usage.GPUs != 1 || report.Usage.CPUMillicores != 1000 {
+		t.Errorf("usage = %+v, want one deployment with 1 CPU and 1 GPU", report.Usage)
+	}
+	if report.Limits.GPUs == nil || *report.Limits.GPUs != 2 || report.Limits.CPUMillicores != nil {
+		t.Errorf("limits = %+v, want 2 GPUs and CPU unlimited", report.Limits)
+	}
+
+	if status, _ := kubetest.Do(t, app, fiber.MethodGet, "/api/quotas/vision?kind=org", nil); status != fiber.StatusBadRequest {
+		t.Errorf("unknown kind returned %d, want 400", status)
+	}
+}
@@ -0,0 +1,9 @@
+package quotas
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+func SetupRoutes(router fiber.Router, svc *Service) {
+	router.Get("/quotas/:subject", svc.GetQuota)
+}
@@ -4,19 +4,44 @@ import (
 	"github.com/gofiber/fiber/v2"
 	utils "Kubernetes-api/kubeutils"
 	helper "Kubernetes-api/helper"
+	"Kubernetes-api/internal/sse"
 )
 
+// Service serves the cluster-wide resource endpoints.
+type Service struct {
+	kc       *utils.KubernetesConfig
+	clusters *utils.Clusters
+	broker   *sse.Broker
+}
+
+func NewService(clusters *utils.Clusters, broker *sse.Broker) *Service {
+	return &Service{kc: clusters.Default().Kube, clusters: clusters, broker: broker}
+}
+
+// forCluster returns the service bound to the cluster the request names.
+func (s *Service) forCluster(c *fiber.Ctx) (*Service, error) {
+	cluster, err := s.clusters.Get(c.Query(helper.ClusterParam))
+	if err != nil {
+		return nil, err
+	}
+	svc := *s
+	svc.kc = cluster.Kube
+	return &svc, nil
+}
+
 // @Description	Get Detail of resouce avilable in kubernetes
 // @Summary		Get Detail of resouce avilable in kubernetes for each nodes
 // @Tags		Resources 
 // @Accept		json
 // @Produce		json
+// @Param		cluster query string false "Cluster name"
 // @Router		/api/resource [get]
-
-var kc = utils.NewKubernetesConfig()
-
-func GetResources(c *fiber.Ctx) error {
-	resource, err := kc.GetRemainingNodeResources()
+func (s *Service) GetResources(c *fiber.Ctx) error {
+	svc, err := s.forCluster(c)
+	if err != nil {
+		return err
+	}
+	resource, err := svc.kc.GetRemainingNodeResources()
 	if err != nil {
 		return helper.SendResponse(c, err.Error(), nil, fiber.ErrBadRequest.Code)
 	}
@@ -28,9 +53,14 @@ func GetResources(c *fiber.Ctx) error {
 // @Tags		Resources 
 // @Accept		json
 // @Produce		json
+// @Param		cluster query string false "Cluster name"
 // @Router		/api/resource [get]
-func GetTotalResouces(c *fiber.Ctx) error {
-	resource, err := kc.GetNodeTotalResources()
+func (s *Service) GetTotalResouces(c *fiber.Ctx) error {
+	svc, err := s.forCluster(c)
+	if err != nil {
+		return err
+	}
+	resource, err := svc.kc.GetNodeTotalResources()
 	if err != nil {
 		return helper.SendResponse(c, err.Error(), nil, fiber.ErrBadRequest.Code)
 	}
@@ -42,16 +72,73 @@ func GetTotalResouces(c *fiber.Ctx) error {
 // @Tags		Resources 
 // @Accept		json
 // @Produce		json
+// @Param		cluster query string false "Cluster name"
 // @Router		/api/resource [get]
-func GetClusterResources(c *fiber.Ctx) error {
-	
-	resource, err := kc.GetClusterNodeResources()
+func (s *Service) GetClusterResources(c *fiber.Ctx) error {
+	svc, err := s.forCluster(c)
+	if err != nil {
+		return err
+	}
+	resource, err := svc.kc.GetClusterNodeResources()
 	if err != nil {
 		return helper.SendResponse(c, err.Error(), nil, fiber.ErrBadRequest.Code)
 	}
 	return helper.SendResponse(c, "Resorce Requested sucessfully", resource, fiber.StatusOK)
 }
 
-func CheckHealth(c *fiber.Ctx) error {
+// @Description	Get allocatable, capacity, requested, limit and measured resources of every node, keyed by node name. CPU is in millicores and memory and storage in bytes; pods that have finished are not counted.
+// @Summary		Get node resources in base units
+// @Tags		Resources
+// @Produce		json
+// @Param		cluster query string false "Cluster name"
+// @Router		/api/v2/resources [get]
+func (s *Service) GetResourcesV2(c *fiber.Ctx) error {
+	svc, err := s.forCluster(c)
+	if err != nil {
+		return err
+	}
+	resources, err := svc.kc.GetNodeResourceReports()
+	if err != nil {
+		return helper.Wrap(err, "Failed to get node resources", fiber.StatusInternalServerError)
+	}
+	return helper.SendResponse(c, "Node resources retrieved successfully", resources, fiber.StatusOK)
+}
+
+// @Description	Get the cluster's GPUs grouped by resource, such as nvidia.com/gpu, amd.com/gpu or a MIG profile, and by GPU model
+// @Summary		Get GPU inventory
+// @Tags		Resources
+// @Produce		json
+// @Param		cluster query string false "Cluster name"
+// @Router		/api/v2/gpus [get]
+func (s *Service) GetGPUs(c *fiber.Ctx) error {
+	svc, err := s.forCluster(c)
+	if err != nil {
+		return err
+	}
+	gpus, err := svc.kc.GetGPUInventory()
+	if err != nil {
+		return helper.Wrap(err, "Failed to get GPU inventory", fiber.StatusInternalServerError)
+	}
+	return helper.SendResponse(c, "GPU inventory retrieved successfully", gpus, fiber.StatusOK)
+}
+
+// @Description	Get every registered cluster with its vendor, node count and resources in base units, and the totals across the clusters that could be reached
+// @Summary		Get resources of every cluster
+// @Tags		Resources
+// @Produce		json
+// @Router		/api/clusters [get]
+func (s *Service) GetClusters(c *fiber.Ctx) error {
+	return helper.SendResponse(c, "Cluster resources retrieved successfully", s.clusters.Resources(), fiber.StatusOK)
+}
+
+func (s *Service) CheckHealth(c *fiber.Ctx) error {
 	return helper.SendResponse(c, "OK", nil, fiber.StatusOK)
-}
\ No newline at end of file
+}
+// @Description	Get the number of clients subscribed to each server sent event topic
+// @Summary		Get SSE subscriber counts
+// @Tags		Monitoring
+// @Produce		json
+// @Router		/api/sse/stats [get]
+func (s *Service) GetSseStats(c *fiber.Ctx) error {
+	return helper.SendResponse(c, "SSE stats retrieved successfully", s.broker.Stats(), fiber.StatusOK)
+}
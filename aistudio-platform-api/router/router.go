@@ -1,25 +1,94 @@
 package router
 
 import (
-	model "Kubernetes-api/deployments"
+	"context"
+
 	artifacts "Kubernetes-api/artifacts"
-	llm "Kubernetes-api/llm"
+	model "Kubernetes-api/deployments"
 	"Kubernetes-api/enginetemplate"
+	"Kubernetes-api/internal/sse"
+	"Kubernetes-api/jobs"
+	utils "Kubernetes-api/kubeutils"
 	JupyterLabs "Kubernetes-api/labs/jupyterlabs"
+	llm "Kubernetes-api/llm"
 	plugin "Kubernetes-api/plugin"
+	"Kubernetes-api/quotas"
+	"Kubernetes-api/scheduling"
+
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+	"github.com/spf13/afero"
 )
 
-func SetupRoutes(app *fiber.App) {
+// Dependencies are the external systems the API talks to. main wires the
+// real cluster, disk and GitHub; tests swap in fakes.
+type Dependencies struct {
+	Kube *utils.KubernetesConfig
+	// Clusters registers every cluster the API manages. When nil, Kube is
+	// the only cluster.
+	Clusters  *utils.Clusters
+	Fs        afero.Fs
+	Templates enginetemplate.Source
+	Broker    *sse.Broker
+	Jobs      *jobs.Manager
+	// Culling, when set, stops idle labspaces under this policy until
+	// Context is done.
+	Culling *JupyterLabs.CullPolicy
+	// Context, when set, runs labspace schedules until it is done.
+	Context context.Context
+}
+
+// SetupRoutes mounts every API group on app. Fs and Templates default to the
+// host filesystem and GitHub when left nil, and a new SSE broker and job
+// manager are created when Broker and Jobs are.
+func SetupRoutes(app *fiber.App, deps Dependencies) {
+	if deps.Fs == nil {
+		deps.Fs = afero.NewOsFs()
+	}
+	if deps.Templates == nil {
+		deps.Templates = enginetemplate.GitHub{}
+	}
+	if deps.Broker == nil {
+		deps.Broker = sse.NewBroker()
+	}
+	if deps.Jobs == nil {
+		deps.Jobs = jobs.NewManager()
+	}
+	if deps.Clusters == nil {
+		deps.Clusters = utils.SingleCluster(deps.Kube)
+	}
+	clusters := deps.Clusters
+
+	svc := NewService(clusters, deps.Broker)
+	app.Use(requestid.New())
 	api := app.Group("/api")
-	api.Get("/resources", GetResources)
-	api.Get("/totalresources", GetTotalResouces)
-	api.Get("/clusterresources", GetClusterResources)
-	api.Get("health/check", CheckHealth)
-	JupyterLabs.SetupRoutes(api)
+	api.Get("/resources", svc.GetResources)
+	api.Get("/totalresources", svc.GetTotalResouces)
+	api.Get("/clusterresources", svc.GetClusterResources)
+	api.Get("/v2/resources", svc.GetResourcesV2)
+	api.Get("/v2/gpus", svc.GetGPUs)
+	api.Get("/clusters", svc.GetClusters)
+	api.Get("health/check", svc.CheckHealth)
+	api.Get("/sse/stats", svc.GetSseStats)
+	jobs.SetupRoutes(api, deps.Jobs)
+	labs := JupyterLabs.NewService(clusters, deps.Fs, deps.Templates, deps.Broker, deps.Jobs)
+	if deps.Culling != nil {
+		ctx := deps.Context
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		culler := labs.EnableCulling(deps.Culling, JupyterLabs.HTTPActivity{})
+		go culler.Run(ctx)
+	}
+	if deps.Context != nil {
+		go JupyterLabs.NewScheduler(labs).Run(deps.Context)
+	}
+	JupyterLabs.SetupRoutes(api, labs)
 	enginetemplate.SetupRoutes(api)
 	artifacts.SetupRoutes(api)
-	model.SetupRoutes(api)
-	llm.SetupRoutes(api)
-	plugin.SetupRoutes(api)
+	model.SetupRoutes(api, model.NewService(clusters, deps.Fs, deps.Broker, deps.Jobs))
+	llm.SetupRoutes(api, llm.NewService(clusters, deps.Jobs))
+	plugin.SetupRoutes(api, plugin.NewService(clusters, deps.Fs, deps.Broker, deps.Jobs))
+	scheduling.SetupRoutes(api, scheduling.NewService(clusters))
+	quotas.SetupRoutes(api, quotas.NewService(clusters))
 }
@@ -0,0 +1,54 @@
+package scheduling
+
+import (
+	"Kubernetes-api/helper"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
+)
+
+// @Description	Check whether a notebook, model or LLM deployment would fit on the cluster without creating anything. Accepts the same body as the create endpoints and returns a verdict for every node, the limiting resource and smaller sizes or node selectors that would fit.
+// @Summary		Scheduling dry run
+// @Tags		Scheduling
+// @Accept		json
+// @Produce		json
+// @Param 		dryRunRequest body DryRunRequest true "Create request body"
+// @Param		cluster query string false "Cluster name"
+// @Router		/api/scheduling/dry-run [post]
+func (s *Service) DryRunHandler(c *fiber.Ctx) error {
+	var req DryRunRequest
+	if err := c.BodyParser(&req); err != nil {
+		return helper.BadRequest(err)
+	}
+	if err := req.Validate(); err != nil {
+		return err
+	}
+
+	svc, err := s.forCluster(c)
+	if err != nil {
+		return err
+	}
+	result, err := svc.DryRun(req)
+	if err != nil {
+		log.Error("scheduling dry run failed: ", err)
+		return helper.Wrap(err, "Failed to check scheduling", fiber.StatusInternalServerError)
+	}
+	message := "Request fits"
+	if !result.Fits {
+		message = "Request does not fit on any node"
+	}
+	return helper.SendResponse(c, message, result, fiber.StatusOK)
+}
+
+// forCluster returns the service bound to the cluster the request names in
+// its cluster query parameter, or to the default cluster.
+func (s *Service) forCluster(c *fiber.Ctx) (*Service, error) {
+	cluster, err := s.clusters.Get(c.Query(helper.ClusterParam))
+	if err != nil {
+		return nil, err
+	}
+	svc := *s
+	svc.kc = cluster.Kube
+	svc.cluster = cluster.Name
+	return &svc, nil
+}
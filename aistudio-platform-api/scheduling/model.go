@@ -0,0 +1,101 @@
+package scheduling
+
+import (
+	"Kubernetes-api/helper"
+	"Kubernetes-api/kubeutils"
+	JupyterLabs "Kubernetes-api/labs/jupyterlabs"
+)
+
+// DryRunRequest takes the resource fields shared by the notebook, model and
+// LLM create bodies, so the UI can send the body it is about to submit.
+// Setting workspaceType or labspaceType marks it as a labspace, which fills
+// empty fields with the labspace defaults.
+type DryRunRequest struct {
+	CPURequest    string `json:"cpuRequest"`
+	GPURequest    string `json:"gpuRequest"`
+	GPUType       string `json:"gpuType,omitempty"`
+	GPUModel      string `json:"gpuModel,omitempty"`
+	MemoryRequest string `json:"memoryRequest"`
+	CPULimit      string `json:"cpuLimit"`
+	MemoryLimit   string `json:"memoryLimit"`
+	DiskStorage   string `json:"diskStorage"`
+	NodeSelector  string `json:"nodeSelector"`
+	WorkSpaceType string `json:"workspaceType"`
+	LabspaceType  string `json:"labspaceType"`
+}
+
+func (r DryRunRequest) isLabspace() bool {
+	return r.WorkSpaceType != "" || r.LabspaceType != ""
+}
+
+// containers is how many containers the workload gives the requested
+// resources to; agent labspaces run two.
+func (r DryRunRequest) containers() int {
+	if r.LabspaceType == JupyterLabs.AiTypeAgent {
+		return 2
+	}
+	return 1
+}
+
+// resources parses the request the way the matching create endpoint would.
+func (r DryRunRequest) resources() (kubeutils.Resources, error) {
+	var defaults kubeutils.ResourceSpec
+	if r.isLabspace() {
+		defaults = JupyterLabs.ResourceDefaults(r.WorkSpaceType, r.LabspaceType)
+	}
+	return kubeutils.ParseResources(kubeutils.ResourceSpec{
+		CPURequest:    r.CPURequest,
+		MemoryRequest: r.MemoryRequest,
+		CPULimit:      r.CPULimit,
+		MemoryLimit:   r.MemoryLimit,
+		GPU:           r.GPURequest,
+		GPUType:       r.GPUType,
+		GPUModel:      r.GPUModel,
+		DiskStorage:   r.DiskStorage,
+	}, defaults)
+}
+
+// Validate checks the request the same way the create endpoints do.
+func (r DryRunRequest) Validate() error {
+	var v helper.Validator
+	_, err := r.resources()
+	v.Check(err)
+	v.LabelValue("nodeSelector", r.NodeSelector)
+	return v.Err()
+}
+
+// Suggestion is a change to the request that would let it fit. A size
+// suggestion gives the largest requests that fit on Node; a node selector
+// suggestion names a node type the request fits on as it is.
+type Suggestion struct {
+	Kind          string `json:"kind"`
+	Node          string `json:"node"`
+	NodePool      string `json:"nodePool,omitempty"`
+	CPURequest    string `json:"cpuRequest,omitempty"`
+	MemoryRequest string `json:"memoryRequest,omitempty"`
+	GPURequest    string `json:"gpuRequest,omitempty"`
+	// EphemeralStorageRequest is set when the containers ask for scratch
+	// space of their own.
+	EphemeralStorageRequest string `json:"ephemeralStorageRequest,omitempty"`
+	NodeSelector            string `json:"nodeSelector,omitempty"`
+}
+
+// Suggestion kinds.
+const (
+	SuggestSize         = "size"
+	SuggestNodeSelector = "nodeSelector"
+)
+
+// LimitSelector is reported as the limiting resource when no node matches
+// the node selector, taints and readiness checks at all.
+const LimitSelector = "nodeSelector"
+
+// DryRunResult is the outcome of a dry run. LimitingResource is the
+// resource the most eligible nodes are short of, and is empty when the
+// request fits.
+type DryRunResult struct {
+	Fits             bool                `json:"fits"`
+	Nodes            []kubeutils.NodeFit `json:"nodes"`
+	LimitingResource string              `json:"limitingResource,omitempty"`
+	Suggestions      []Suggestion        `json:"suggestions,omitempty"`
+}
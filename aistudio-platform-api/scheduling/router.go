@@ -0,0 +1,10 @@
+package scheduling
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+func SetupRoutes(router fiber.Router, svc *Service) {
+	scheduling := router.Group("/scheduling")
+	scheduling.Post("/dry-run", svc.DryRunHandler)
+}
@@ -0,0 +1,176 @@
+package scheduling
+
+import (
+	"sort"
+	"strconv"
+
+	"Kubernetes-api/kubeutils"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// maxSuggestions caps each kind of suggestion a dry run returns.
+const maxSuggestions = 3
+
+// Service answers scheduling questions about one cluster at a time.
+type Service struct {
+	kc       *kubeutils.KubernetesConfig
+	cluster  string
+	clusters *kubeutils.Clusters
+}
+
+func NewService(clusters *kubeutils.Clusters) *Service {
+	def := clusters.Default()
+	return &Service{kc: def.Kube, cluster: def.Name, clusters: clusters}
+}
+
+// DryRun reports where req would fit and, when it fits nowhere, what is
+// short and how the request could be changed to fit.
+func (s *Service) DryRun(req DryRunRequest) (DryRunResult, error) {
+	res, err := req.resources()
+	if err != nil {
+		return DryRunResult{}, err
+	}
+	cfg, err := s.kc.GetVendorConfig()
+	if err != nil {
+		return DryRunResult{}, err
+	}
+	gpuResource := cfg.GPUResourceName(res.GPU)
+
+	sched := kubeutils.ScheduleRequest{
+		Resources:    res.Requirements,
+		Containers:   req.containers(),
+		GPU:          res.GPU,
+		NodeSelector: s.kc.WorkloadNodeSelector(req.NodeSelector),
+	}
+	result, err := s.kc.CanSchedule(sched)
+	if err != nil {
+		return DryRunResult{}, err
+	}
+	out := DryRunResult{Fits: result.Fits, Nodes: result.Nodes}
+	if result.Fits {
+		return out, nil
+	}
+
+	out.LimitingResource = limitingResource(result.Nodes)
+	out.Suggestions = sizeSuggestions(result.Nodes, sched, gpuResource)
+
+	// Nodes of another type the request would fit on as it is.
+	sched.NodeSelector = nil
+	anywhere, err := s.kc.CanSchedule(sched)
+	if err != nil {
+		return DryRunResult{}, err
+	}
+	seen := map[string]bool{}
+	for _, n := range anywhere.Nodes {
+		if !n.Fits || n.NodeType == "" || n.NodeType == req.NodeSelector || seen[n.NodeType] || len(seen) == maxSuggestions {
+			continue
+		}
+		seen[n.NodeType] = true
+		out.Suggestions = append(out.Suggestions, Suggestion{
+			Kind:         SuggestNodeSelector,
+			Node:         n.Node,
+			NodePool:     n.NodePool,
+			NodeSelector: n.NodeType,
+		})
+	}
+	return out, nil
+}
+
+// limitingResource is the resource the most eligible nodes are short of,
+// ties going to the first in name order, or LimitSelector when no node is
+// eligible.
+func limitingResource(nodes []kubeutils.NodeFit) string {
+	counts := map[v1.ResourceName]int{}
+	eligible := false
+	for _, n := range nodes {
+		if !n.Eligible {
+			continue
+		}
+		eligible = true
+		for _, name := range n.Insufficient {
+			counts[name]++
+		}
+	}
+	if !eligible {
+		return LimitSelector
+	}
+	var limiting v1.ResourceName
+	for name, count := range counts {
+		if count > counts[limiting] || (count == counts[limiting] && name < limiting) {
+			limiting = name
+		}
+	}
+	return string(limiting)
+}
+
+// sizeSuggestions shrinks the request to what each eligible node has free,
+// largest CPU first. Nodes without room for any of a requested resource are
+// skipped, as are suggestions that would not shrink anything. The pod's own
+// scratch space cannot be shrunk, so nodes without room for it are skipped
+// too.
+func sizeSuggestions(nodes []kubeutils.NodeFit, req kubeutils.ScheduleRequest, gpuResource v1.ResourceName) []Suggestion {
+	containers := int64(req.Containers)
+	if containers < 1 {
+		containers = 1
+	}
+	wantCPU := req.Resources.Requests[v1.ResourceCPU]
+	wantMemory := req.Resources.Requests[v1.ResourceMemory]
+	wantStorage := req.Resources.Requests[v1.ResourceEphemeralStorage]
+
+	type sized struct {
+		Suggestion
+		cpu int64
+	}
+	var fits []sized
+	for _, n := range nodes {
+		if !n.Eligible || n.Fits {
+			continue
+		}
+		freePods := n.Free[v1.ResourcePods]
+		if freePods.Value() < 1 {
+			continue
+		}
+		freeCPU := n.Free[v1.ResourceCPU]
+		freeMemory := n.Free[v1.ResourceMemory]
+		freeGPU := n.Free[gpuResource]
+		freeStorage := n.Free[v1.ResourceEphemeralStorage]
+		spareStorage := freeStorage.Value() - req.EphemeralStorage.Value()
+		if spareStorage < 0 {
+			continue
+		}
+
+		cpu := min(wantCPU.MilliValue(), freeCPU.MilliValue()/containers)
+		memory := min(wantMemory.Value(), freeMemory.Value()/containers) / (1 << 20) * (1 << 20)
+		gpu := min(int64(req.GPU.Count), freeGPU.Value()/containers)
+		storage := min(wantStorage.Value(), spareStorage/containers) / (1 << 20) * (1 << 20)
+		if cpu <= 0 || memory <= 0 || (req.GPU.Count > 0 && gpu <= 0) || (!wantStorage.IsZero() && storage <= 0) {
+			continue
+		}
+		if cpu == wantCPU.MilliValue() && memory == wantMemory.Value() && gpu == int64(req.GPU.Count) && storage == wantStorage.Value() {
+			continue
+		}
+		s := Suggestion{
+			Kind:          SuggestSize,
+			Node:          n.Node,
+			NodePool:      n.NodePool,
+			CPURequest:    resource.NewMilliQuantity(cpu, resource.DecimalSI).String(),
+			MemoryRequest: resource.NewQuantity(memory, resource.BinarySI).String(),
+		}
+		if req.GPU.Count > 0 {
+			s.GPURequest = strconv.FormatInt(gpu, 10)
+		}
+		if !wantStorage.IsZero() {
+			s.EphemeralStorageRequest = resource.NewQuantity(storage, resource.BinarySI).String()
+		}
+		fits = append(fits, sized{Suggestion: s, cpu: cpu})
+	}
+	sort.SliceStable(fits, func(i, j int) bool { return fits[i].cpu > fits[j].cpu })
+
+	var suggestions []Suggestion
+	for i := 0; i < len(fits) && i < maxSuggestions; i++ {
+		suggestions = append(suggestions, fits[i].Suggestion)
+	}
+	return suggestions
+}
@@ -0,0 +1,104 @@
+package scheduling_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"Kubernetes-api/helper"
+	"Kubernetes-api/internal/kubetest"
+	"Kubernetes-api/scheduling"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func dryRun(t *testing.T, h *kubetest.Harness, body any) (int, helper.APIResponse, scheduling.DryRunResult) {
+	t.Helper()
+	app := h.App(func(api fiber.Router) {
+		scheduling.SetupRoutes(api, scheduling.NewService(h.Clusters))
+	})
+	status, resp := kubetest.Do(t, app, fiber.MethodPost, "/api/scheduling/dry-run", body)
+	var result scheduling.DryRunResult
+	raw, _ := json.Marshal(resp.Data)
+	if err := json.Unmarshal(raw, &result); err != nil {
+		t.Fatalf("decoding %s: %v", raw, err)
+	}
+	return status, resp, result
+}
+
+func TestDryRunFits(t *testing.T) {
+	h := kubetest.New(kubetest.Node("node-a", "4", "16Gi", ""))
+
+	status, _, result := dryRun(t, h, fiber.Map{
+		"userName":      "alice",
+		"cpuRequest":    "1",
+		"memoryRequest": "2Gi",
+		"nodeSelector":  "cpu",
+	})
+	if status != fiber.StatusOK || !result.Fits {
+		t.Fatalf("dry run returned %d %+v, want a fit", status, result)
+	}
+	if len(result.Nodes) != 1 || !result.Nodes[0].Fits || result.LimitingResource != "" {
+		t.Errorf("result = %+v, want node-a to fit", result)
+	}
+}
+
+func TestDryRunExplainsShortfall(t *testing.T) {
+	gpuNode := kubetest.Node("node-gpu", "16", "64Gi", "2")
+	gpuNode.Labels["type"] = "gpu"
+	h := kubetest.New(
+		kubetest.Node("node-a", "4", "16Gi", ""),
+		kubetest.Pod("lab", "bob-0", "bob", "node-a", "1", "4Gi"),
+		gpuNode,
+	)
+
+	status, _, result := dryRun(t, h, fiber.Map{
+		"cpuRequest":    "6",
+		"memoryRequest": "8Gi",
+		"nodeSelector":  "cpu",
+	})
+	if status != fiber.StatusOK || result.Fits {
+		t.Fatalf("dry run returned %d %+v, want no fit", status, result)
+	}
+	if result.LimitingResource != "cpu" {
+		t.Errorf("limiting resource = %q, want cpu", result.LimitingResource)
+	}
+
+	var size, selector *scheduling.Suggestion
+	for i, s := range result.Suggestions {
+		switch s.Kind {
+		case scheduling.SuggestSize:
+			size = &result.Suggestions[i]
+		case scheduling.SuggestNodeSelector:
+			selector = &result.Suggestions[i]
+		}
+	}
+	if size == nil || size.Node != "node-a" || size.CPURequest != "3" || size.MemoryRequest != "8Gi" {
+		t.Errorf("size suggestion = %+v, want 3 CPUs and 8Gi on node-a", size)
+	}
+	if selector == nil || selector.NodeSelector != "gpu" {
+		t.Errorf("node selector suggestion = %+v, want gpu", selector)
+	}
+}
+
+func TestDryRunAppliesLabDefaults(t *testing.T) {
+	h := kubetest.New(kubetest.Node("node-a", "4", "16Gi", ""))
+
+	_, _, result := dryRun(t, h, fiber.Map{
+		"workspaceType": "jupyterlab",
+		"labspaceType":  "AGENT_LABSPACE",
+		"nodeSelector":  "cpu",
+	})
+	cpu := result.Nodes[0].Free["cpu"]
+	if !result.Fits || cpu.String() != "4" {
+		t.Fatalf("result = %+v, want the agent defaults to fit", result)
+	}
+}
+
+func TestDryRunValidatesRequest(t *testing.T) {
+	h := kubetest.New(kubetest.Node("node-a", "4", "16Gi", ""))
+
+	status, resp, _ := dryRun(t, h, fiber.Map{"cpuRequest": "2", "cpuLimit": "1", "memoryRequest": "1Gi"})
+	if status != fiber.StatusBadRequest || resp.Error == nil || len(resp.Error.Fields) != 1 || resp.Error.Fields[0].Field != "cpuLimit" {
+		t.Fatalf("dry run returned %d %+v, want a cpuLimit field error", status, resp)
+	}
+}
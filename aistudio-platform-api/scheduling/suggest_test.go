@@ -0,0 +1,51 @@
+package scheduling
+
+import (
+	"testing"
+
+	"Kubernetes-api/kubeutils"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func freeNode(name, cpu, memory, storage string) kubeutils.NodeFit {
+	return kubeutils.NodeFit{Node: name, Eligible: true, Free: v1.ResourceList{
+		v1.ResourceCPU:              resource.MustParse(cpu),
+		v1.ResourceMemory:           resource.MustParse(memory),
+		v1.ResourceEphemeralStorage: resource.MustParse(storage),
+		v1.ResourcePods:             resource.MustParse("10"),
+	}}
+}
+
+func TestSizeSuggestionsShrinkEphemeralStorage(t *testing.T) {
+	req := kubeutils.ScheduleRequest{Resources: v1.ResourceRequirements{Requests: v1.ResourceList{
+		v1.ResourceCPU:              resource.MustParse("2"),
+		v1.ResourceMemory:           resource.MustParse("4Gi"),
+		v1.ResourceEphemeralStorage: resource.MustParse("20Gi"),
+	}}}
+
+	got := sizeSuggestions([]kubeutils.NodeFit{freeNode("node-a", "4", "16Gi", "5Gi")}, req, "nvidia.com/gpu")
+	if len(got) != 1 || got[0].CPURequest != "2" || got[0].MemoryRequest != "4Gi" || got[0].EphemeralStorageRequest != "5Gi" {
+		t.Fatalf("suggestions = %+v, want the request with 5Gi of ephemeral storage", got)
+	}
+}
+
+func TestSizeSuggestionsSkipNodesWithoutPodScratchSpace(t *testing.T) {
+	req := kubeutils.ScheduleRequest{
+		Resources: v1.ResourceRequirements{Requests: v1.ResourceList{
+			v1.ResourceCPU:    resource.MustParse("6"),
+			v1.ResourceMemory: resource.MustParse("4Gi"),
+		}},
+		EphemeralStorage: resource.MustParse("2Gi"),
+	}
+	nodes := []kubeutils.NodeFit{
+		freeNode("node-a", "4", "16Gi", "1Gi"),
+		freeNode("node-b", "3", "16Gi", "3Gi"),
+	}
+
+	got := sizeSuggestions(nodes, req, "nvidia.com/gpu")
+	if len(got) != 1 || got[0].Node != "node-b" || got[0].CPURequest != "3" || got[0].EphemeralStorageRequest != "" {
+		t.Fatalf("suggestions = %+v, want only node-b, which has room for the pod's scratch space", got)
+	}
+}